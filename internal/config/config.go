@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// ErrInvalidConfig is returned when a config value is out of range
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Themes lists the accepted UI theme names
+var Themes = []string{"system", "light", "dark"}
+
+// =-- Configuration Data Structures --= //
+
+// KDFConfig holds the Argon2 settings used when creating new vaults
+type KDFConfig struct {
+	Time      uint32 `toml:"time"`       // Number of iterations
+	MemoryKiB uint32 `toml:"memory_kib"` // Memory cost (KB)
+	Threads   uint8  `toml:"threads"`    // Number of threads
+}
+
+// UIConfig holds the GUI preferences
+type UIConfig struct {
+	Theme                 string `toml:"theme"`                   // "system", "light" or "dark"
+	ClipboardClearSeconds int    `toml:"clipboard_clear_seconds"` // Clears copied secrets after this delay (0 disables)
+}
+
+// BackupConfig holds the automatic backup settings
+type BackupConfig struct {
+	Directory     string `toml:"directory"`      // Directory backups are kept in, one subdirectory per vault
+	Keep          int    `toml:"keep"`           // Newest backups kept per vault (0 keeps all)
+	MaxAgeDays    int    `toml:"max_age_days"`   // Deletes older backups, the newest is always kept (0 disables)
+	IntervalHours int    `toml:"interval_hours"` // Backs up an unlocked vault after this delay (0 disables)
+}
+
+// Config holds every PassLock setting
+type Config struct {
+	VaultDirectory  string       `toml:"vault_directory"`   // Directory new vaults are created in
+	SearchPaths     []string     `toml:"search_paths"`      // Additional directories searched for vaults
+	AutoLockMinutes int          `toml:"auto_lock_minutes"` // Locks an idle vault after this delay (0 disables)
+	BreachData      string       `toml:"breach_data"`       // Sorted HIBP SHA-1 file or range directory (empty disables)
+	KDF             KDFConfig    `toml:"kdf"`
+	UI              UIConfig     `toml:"ui"`
+	Backup          BackupConfig `toml:"backup"`
+
+	legacyDir string // Vault directory of older versions, always searched
+}
+
+// Params returns the Argon2 parameters for key derivation
+func (kdf KDFConfig) Params() encryption.Argon2Params {
+	return encryption.Argon2Params{
+		Time:    kdf.Time,
+		Memory:  kdf.MemoryKiB,
+		Threads: kdf.Threads,
+		KeyLen:  encryption.DefaultArgon2Params.KeyLen,
+	}
+}
+
+// VaultSearchPaths returns every directory searched for vaults, the vault directory first
+func (cfg *Config) VaultSearchPaths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, path := range append(append([]string{cfg.VaultDirectory}, cfg.SearchPaths...), cfg.legacyDir) {
+		if path == "" || seen[filepath.Clean(path)] {
+			continue
+		}
+		seen[filepath.Clean(path)] = true
+		paths = append(paths, filepath.Clean(path))
+	}
+
+	return paths
+}
+
+// Validate checks that every setting is usable
+func (cfg *Config) Validate() error {
+	if cfg.VaultDirectory == "" {
+		return fmt.Errorf("%w: vault_directory cannot be empty", ErrInvalidConfig)
+	}
+	if cfg.AutoLockMinutes < 0 {
+		return fmt.Errorf("%w: auto_lock_minutes cannot be negative", ErrInvalidConfig)
+	}
+	if cfg.Backup.Directory == "" {
+		return fmt.Errorf("%w: backup directory cannot be empty", ErrInvalidConfig)
+	}
+	if cfg.Backup.Keep < 0 || cfg.Backup.MaxAgeDays < 0 || cfg.Backup.IntervalHours < 0 {
+		return fmt.Errorf("%w: backup settings cannot be negative", ErrInvalidConfig)
+	}
+	if cfg.UI.ClipboardClearSeconds < 0 {
+		return fmt.Errorf("%w: clipboard_clear_seconds cannot be negative", ErrInvalidConfig)
+	}
+
+	validTheme := false
+	for _, theme := range Themes {
+		validTheme = validTheme || cfg.UI.Theme == theme
+	}
+	if !validTheme {
+		return fmt.Errorf("%w: unknown theme %q", ErrInvalidConfig, cfg.UI.Theme)
+	}
+
+	if err := cfg.KDF.Params().Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return nil
+}
+
+// =-- Loading and Saving --= //
+
+// Default returns the built-in settings for the current environment
+func Default() *Config {
+	dirs := ResolveDirs()
+	defaults := encryption.DefaultArgon2Params
+
+	cfg := &Config{
+		VaultDirectory:  filepath.Join(dirs.DataDir, "vaults"),
+		AutoLockMinutes: 15,
+		KDF: KDFConfig{
+			Time:      defaults.Time,
+			MemoryKiB: defaults.Memory,
+			Threads:   defaults.Threads,
+		},
+		UI: UIConfig{
+			Theme:                 "system",
+			ClipboardClearSeconds: 30,
+		},
+		Backup: BackupConfig{
+			Directory:     filepath.Join(dirs.DataDir, "backups"),
+			Keep:          10,
+			IntervalHours: 24,
+		},
+		legacyDir: dirs.legacy,
+	}
+	if dir := os.Getenv(EnvVaultDir); dir != "" {
+		cfg.VaultDirectory = expandPath(dir, ".")
+	}
+
+	return cfg
+}
+
+// Load returns the default settings overridden by the config file (if any) and the environment
+func Load() (*Config, error) {
+	return LoadFile(ConfigPath())
+}
+
+// LoadFile is Load with an explicit config file path
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	metadata, err := toml.DecodeFile(path, cfg)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error reading config file %s: %v", path, err)
+		return nil, err
+	}
+	for _, key := range metadata.Undecoded() {
+		log.Printf("Ignoring unknown config key %q in %s", key.String(), path)
+	}
+
+	// Relative paths in the file are relative to the file, so portable configs can be moved
+	base := filepath.Dir(path)
+	cfg.VaultDirectory = expandPath(cfg.VaultDirectory, base)
+	cfg.Backup.Directory = expandPath(cfg.Backup.Directory, base)
+	cfg.BreachData = expandPath(cfg.BreachData, base)
+	for i, searchPath := range cfg.SearchPaths {
+		cfg.SearchPaths[i] = expandPath(searchPath, base)
+	}
+
+	// The environment takes precedence over the file
+	if dir := os.Getenv(EnvVaultDir); dir != "" {
+		cfg.VaultDirectory = expandPath(dir, ".")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Save writes the settings to the config file path
+func Save(cfg *Config) error {
+	return SaveFile(cfg, ConfigPath())
+}
+
+// SaveFile is Save with an explicit config file path
+func SaveFile(cfg *Config, path string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		log.Printf("Could not create config directory: %s", err)
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("Error creating config file: %s", err)
+		return err
+	}
+
+	err = toml.NewEncoder(file).Encode(cfg)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error writing config file: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// =-- Active Configuration --= //
+
+var (
+	currentMutex sync.RWMutex
+	current      *Config
+)
+
+// Current returns the configuration installed with SetCurrent, or the defaults for the current environment
+func Current() *Config {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+
+	if current == nil {
+		return Default()
+	}
+
+	return current
+}
+
+// SetCurrent installs the configuration used by the rest of the application (nil restores the defaults)
+func SetCurrent(cfg *Config) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	current = cfg
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// =-- Environment Overrides --= //
+
+const (
+	EnvHome     = "PASSLOCK_HOME"      // Directory holding both the config file and vaults
+	EnvConfig   = "PASSLOCK_CONFIG"    // Path of the config file
+	EnvVaultDir = "PASSLOCK_VAULT_DIR" // Directory new vaults are created in
+	EnvPortable = "PASSLOCK_PORTABLE"  // Any non-empty value enables portable mode
+)
+
+// FileName is the name of the configuration file inside the config directory
+const FileName = "config.toml"
+
+// RegistryFileName is the name of the vault registry file inside the config directory
+const RegistryFileName = "vaults.json"
+
+// PortableMarker is a file that enables portable mode when placed next to the executable
+const PortableMarker = "passlock.portable"
+
+// =-- Directory Resolution --= //
+
+// Dirs holds the base directories PassLock uses
+type Dirs struct {
+	ConfigDir string // Directory holding the config file
+	DataDir   string // Directory holding the vaults directory
+	Portable  bool   // Whether everything is kept next to the executable
+	legacy    string // Vault directory used by older versions, searched when different
+}
+
+// ResolveDirs returns the base directories from the environment, portable mode, or OS conventions
+func ResolveDirs() Dirs {
+	if home := os.Getenv(EnvHome); home != "" {
+		return Dirs{ConfigDir: home, DataDir: home}
+	}
+
+	if dir, ok := portableDir(); ok {
+		return Dirs{ConfigDir: dir, DataDir: dir, Portable: true}
+	}
+
+	home := os.Getenv("HOME")
+	switch runtime.GOOS {
+	case "darwin": // MacOS
+		dir := filepath.Join(home, "Library", "Application Support", "PassLock")
+		return Dirs{ConfigDir: dir, DataDir: dir}
+	case "linux":
+		// Follow the XDG base directory specification, older versions kept vaults under ~/.config
+		return Dirs{
+			ConfigDir: filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), "passlock"),
+			DataDir:   filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local", "share"), "passlock"),
+			legacy:    filepath.Join(home, ".config", "passlock", "vaults"),
+		}
+	case "windows":
+		dir := filepath.Join(os.Getenv("APPDATA"), "PassLock")
+		return Dirs{ConfigDir: dir, DataDir: dir}
+	default:
+		return Dirs{ConfigDir: ".", DataDir: "."} // Fallback to current directory
+	}
+}
+
+// ConfigPath returns the path of the config file
+func ConfigPath() string {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+
+	return filepath.Join(ResolveDirs().ConfigDir, FileName)
+}
+
+// RegistryPath returns the path of the registry of vaults kept outside the vault directories
+func RegistryPath() string {
+	return filepath.Join(filepath.Dir(ConfigPath()), RegistryFileName)
+}
+
+// xdgDir returns an XDG base directory, falling back to a path under home when unset or relative
+func xdgDir(variable string, home string, fallback ...string) string {
+	if dir := os.Getenv(variable); dir != "" && filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return filepath.Join(append([]string{home}, fallback...)...)
+}
+
+// portableDir returns the executable's directory when portable mode is enabled
+func portableDir() (string, bool) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	dir := filepath.Dir(executable)
+
+	if os.Getenv(EnvPortable) != "" {
+		return dir, true
+	}
+	if _, err := os.Stat(filepath.Join(dir, PortableMarker)); err == nil {
+		return dir, true
+	}
+
+	return "", false
+}
+
+// expandPath expands a leading "~" and makes relative paths relative to base
+func expandPath(path string, base string) string {
+	if path == "" {
+		return ""
+	}
+	if path == "~" || len(path) > 1 && path[0] == '~' && os.IsPathSeparator(path[1]) {
+		path = filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+
+	return filepath.Clean(path)
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// MaxAttachmentSize is the largest plaintext attachment accepted (bytes)
+var MaxAttachmentSize int64 = 100 * 1024 * 1024
+
+var (
+	ErrAttachmentTooLarge   = errors.New("attachment exceeds the maximum attachment size")
+	ErrAttachmentName       = errors.New("invalid attachment name")
+	ErrAttachmentSize       = errors.New("attachment size does not match its stored size")
+	ErrAttachmentIncomplete = errors.New("attachment data is missing")
+)
+
+// =-- Attachment Data Structures --= //
+
+// Attachment stores information about an encrypted file attached to an entry
+type Attachment struct {
+	ID         int    // Unique ID
+	EntryID    int    // Entry the file is attached to
+	Name       string // Original file name
+	Size       int64  // Plaintext size in bytes
+	CreatedAt  string // Timestamp for attachment creation
+	UUID       string // Stable ID used for sync
+	ModifiedAt string // Timestamp of the last change (UTC)
+	Version    int64  // Logical clock value of the last change
+}
+
+// attachmentColumns lists the attachments table columns read by scanAttachment, in order
+const attachmentColumns = "id, entry_id, name, size, created_at, uuid, modified_at, version"
+
+// scanAttachment scans a row selected with attachmentColumns into an Attachment struct
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var attachment Attachment
+	var uuid, modifiedAt sql.NullString
+	var version sql.NullInt64
+	err := row.Scan(&attachment.ID, &attachment.EntryID, &attachment.Name, &attachment.Size, &attachment.CreatedAt,
+		&uuid, &modifiedAt, &version)
+	if err != nil {
+		return nil, err
+	}
+	attachment.UUID = uuid.String
+	attachment.ModifiedAt = modifiedAt.String
+	attachment.Version = version.Int64
+
+	return &attachment, nil
+}
+
+// =-- Attachment Management Functions --= //
+
+// AddAttachment encrypts everything read from r in chunks and stores it as an attachment of an entry
+func AddAttachment(db *sql.DB, encryptionKey string, entryID int, name string, r io.Reader) (*Attachment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	attachment, err := insertAttachment(tx, encryptionKey, entryID, name, r)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	return attachment, tx.Commit()
+}
+
+// insertAttachment stores an attachment within a transaction
+func insertAttachment(tx *sql.Tx, encryptionKey string, entryID int, name string, r io.Reader) (*Attachment, error) {
+	// Only keep the base name, never a path
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return nil, ErrAttachmentName
+	}
+
+	// Every chunk is authenticated against a random stream ID stored with the attachment
+	streamID := make([]byte, 16)
+	_, err := rand.Read(streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO attachments (entry_id, name, stream_id) VALUES (?, ?, ?);",
+		entryID, name, streamID)
+	if err != nil {
+		log.Printf("Error adding attachment to entry %d: %v", entryID, err)
+		return nil, err
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := writeAttachmentChunks(tx, encryptionKey, lastID, streamID, r)
+	if err != nil {
+		log.Printf("Error storing attachment '%s': %v", name, err)
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE attachments SET size = ? WHERE id = ?;", size, lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachment(tx.QueryRow(
+		"SELECT "+attachmentColumns+" FROM attachments WHERE id = ?;", lastID))
+}
+
+// ListAttachments returns the attachments of an entry ordered by name
+func ListAttachments(db *sql.DB, entryID int) ([]*Attachment, error) {
+	rows, err := db.Query(
+		"SELECT "+attachmentColumns+" FROM attachments WHERE entry_id = ? ORDER BY name COLLATE NOCASE, id;",
+		entryID)
+	if err != nil {
+		log.Printf("Error fetching attachments for entry %d: %v", entryID, err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var attachments []*Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			log.Printf("Error reading attachment row: %v", err)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// ExtractAttachment decrypts an attachment into w, verifying every chunk and the total size.
+// If an error is returned, anything already written to w must be discarded.
+func ExtractAttachment(db *sql.DB, encryptionKey string, id int, w io.Writer) error {
+	return extractAttachment(db, encryptionKey, id, w)
+}
+
+// extractAttachment is ExtractAttachment using either a database or a transaction
+func extractAttachment(q execQuerier, encryptionKey string, id int, w io.Writer) error {
+	var streamID []byte
+	var size int64
+	err := q.QueryRow("SELECT stream_id, size FROM attachments WHERE id = ?;", id).Scan(&streamID, &size)
+	if err != nil {
+		log.Printf("Error fetching attachment with ID %d: %v", id, err)
+		return err
+	}
+
+	rows, err := q.Query("SELECT data FROM attachment_chunks WHERE attachment_id = ? ORDER BY seq;", id)
+	if err != nil {
+		return err
+	}
+	chunks := &chunkReader{rows: rows}
+	defer func(chunks *chunkReader) {
+		err := chunks.rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(chunks)
+
+	decrypter, err := encryption.NewDecryptReader(chunks, encryptionKey, streamID)
+	if err != nil {
+		if errors.Is(err, encryption.ErrStreamHeader) {
+			return ErrAttachmentIncomplete
+		}
+		return err
+	}
+
+	written, err := io.Copy(w, decrypter)
+	if err != nil {
+		log.Printf("Error extracting attachment with ID %d: %v", id, err)
+		return err
+	}
+	if written != size {
+		return ErrAttachmentSize
+	}
+
+	return nil
+}
+
+// DeleteAttachment deletes an attachment and all of its chunks
+func DeleteAttachment(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM attachments WHERE id = ?;", id)
+	if err != nil {
+		log.Printf("Error deleting attachment with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// =-- Chunk Streaming Helpers --= //
+
+// writeAttachmentChunks encrypts everything read from r into chunk rows of an attachment, returning the plaintext size
+func writeAttachmentChunks(tx *sql.Tx, encryptionKey string, attachmentID int64, streamID []byte, r io.Reader) (int64, error) {
+	// Stream the encrypted chunks into the attachment_chunks table
+	chunks := &chunkWriter{tx: tx, attachmentID: attachmentID}
+	encrypter, err := encryption.NewEncryptWriter(chunks, encryptionKey, streamID)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(encrypter, io.LimitReader(r, MaxAttachmentSize+1))
+	if err == nil && size > MaxAttachmentSize {
+		err = ErrAttachmentTooLarge
+	}
+	if err == nil {
+		err = encrypter.Close()
+	}
+
+	return size, err
+}
+
+// chunkWriter stores every write as the next row of attachment_chunks
+type chunkWriter struct {
+	tx           *sql.Tx
+	attachmentID int64
+	seq          int
+}
+
+// Write inserts p as a new chunk row
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	_, err := w.tx.Exec(
+		"INSERT INTO attachment_chunks (attachment_id, seq, data) VALUES (?, ?, ?);",
+		w.attachmentID, w.seq, p)
+	if err != nil {
+		return 0, err
+	}
+	w.seq++
+
+	return len(p), nil
+}
+
+// chunkReader reads attachment_chunks rows in order as one continuous stream
+type chunkReader struct {
+	rows    *sql.Rows
+	current []byte
+}
+
+// Read returns data from the current chunk row, fetching the next row when needed
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if !r.rows.Next() {
+			if err := r.rows.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if err := r.rows.Scan(&r.current); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+
+	return n, nil
+}
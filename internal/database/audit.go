@@ -0,0 +1,498 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// AuditEvent is the kind of vault activity an audit record describes
+type AuditEvent string
+
+const (
+	AuditUnlock       AuditEvent = "unlock"        // Vault unlocked
+	AuditFailedUnlock AuditEvent = "failed_unlock" // Wrong master password entered
+	AuditReveal       AuditEvent = "reveal"        // Secret shown or saved to a file
+	AuditCopy         AuditEvent = "copy"          // Secret copied to the clipboard
+	AuditCreate       AuditEvent = "create"        // Entry created
+	AuditEdit         AuditEvent = "edit"          // Entry, field or attachment changed
+	AuditDelete       AuditEvent = "delete"        // Entry, field or attachment deleted
+	AuditExport       AuditEvent = "export"        // Entries written outside the vault
+	AuditImport       AuditEvent = "import"        // Entries imported into the vault
+	AuditSync         AuditEvent = "sync"          // Vault merged with another copy
+	AuditQuarantine   AuditEvent = "quarantine"    // Corrupt entry moved out of the vault
+	AuditLogRestarted AuditEvent = "log_restarted" // Audit log found deleted and started again
+)
+
+// ErrAuditTampered is returned when audit records were edited, removed or reordered
+var ErrAuditTampered = errors.New("audit log has been modified")
+
+// auditKeySize is the size of the random audit key, half for encrypting records and half for MACs
+const auditKeySize = 64
+
+// auditMarker is encrypted into vault_metadata when the audit log is started
+const auditMarker = "audit log started"
+
+// AuditRecord is a single entry of a vault's audit log
+type AuditRecord struct {
+	ID      int        `json:"-"`                  // Position in the log, from 1
+	Event   AuditEvent `json:"event"`              // What happened
+	EntryID int        `json:"entry_id,omitempty"` // Entry involved (0 if none)
+	Service string     `json:"service,omitempty"`  // Service of the entry involved
+	Detail  string     `json:"detail,omitempty"`   // Free-form description (e.g., field name)
+	Actor   string     `json:"actor"`              // OS user and host that caused the event
+	Time    time.Time  `json:"time"`               // When it happened
+}
+
+// =-- Audit Log Functions --= //
+
+// AppendAudit adds a record to the vault's audit log, filling in the actor and time if they are empty
+func AppendAudit(db *sql.DB, encryptionKey string, record AuditRecord) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = appendAudit(tx, encryptionKey, []AuditRecord{record})
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error appending audit record: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordUnlock logs a successful unlock, preceded by the failed attempts made since the last one
+func RecordUnlock(db *sql.DB, encryptionKey string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = recordUnlock(tx, encryptionKey)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error recording unlock: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordUnlock moves pending failed unlocks into the chain and appends the unlock
+func recordUnlock(tx *sql.Tx, encryptionKey string) error {
+	rows, err := tx.Query("SELECT actor, attempted_at FROM audit_failed_unlocks ORDER BY id;")
+	if err != nil {
+		return err
+	}
+
+	var records []AuditRecord
+	for rows.Next() {
+		record := AuditRecord{Event: AuditFailedUnlock}
+		if err := rows.Scan(&record.Actor, &record.Time); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM audit_failed_unlocks;")
+	if err != nil {
+		return err
+	}
+
+	return appendAudit(tx, encryptionKey, append(records, AuditRecord{Event: AuditUnlock}))
+}
+
+// recordFailedUnlock notes a wrong master password, it is chained into the log at the next unlock because
+// the audit key cannot be read without the right one
+func recordFailedUnlock(db *sql.DB) error {
+	_, err := db.Exec("INSERT INTO audit_failed_unlocks (actor) VALUES (?);", auditActor())
+	if err != nil {
+		log.Printf("Error recording failed unlock: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// appendAudit encrypts and chains records after the latest one, creating the audit key on first use
+func appendAudit(q execQuerier, encryptionKey string, records []AuditRecord) error {
+	auditKey, err := loadAuditKey(q, encryptionKey, true)
+	if err != nil {
+		return err
+	}
+	// A new log replacing a deleted one starts by saying so
+	if auditKey.restarted {
+		records = append([]AuditRecord{{Event: AuditLogRestarted, Detail: "previous log was deleted"}}, records...)
+	}
+
+	var count int
+	var previousMAC string
+	err = q.QueryRow("SELECT COUNT(*), COALESCE((SELECT mac FROM audit_log ORDER BY id DESC LIMIT 1), '') FROM audit_log;").Scan(
+		&count, &previousMAC)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.Actor == "" {
+			record.Actor = auditActor()
+		}
+		if record.Time.IsZero() {
+			record.Time = time.Now()
+		}
+		record.Time = record.Time.UTC()
+
+		plaintext, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		ciphertext, err := encryption.Encrypt(string(plaintext), auditKey.encryptionKey)
+		if err != nil {
+			return err
+		}
+
+		count++
+		previousMAC = auditKey.recordMAC(count, ciphertext, previousMAC)
+		_, err = q.Exec("INSERT INTO audit_log (id, record, mac) VALUES (?, ?, ?);", count, ciphertext, previousMAC)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = q.Exec("UPDATE audit_state SET head = ? WHERE id = 1;", auditKey.headMAC(count, previousMAC))
+	return err
+}
+
+// ReadAuditLog decrypts and verifies the vault's audit log, oldest first. If the chain is broken the records
+// before the break are returned together with an error wrapping ErrAuditTampered.
+func ReadAuditLog(db *sql.DB, encryptionKey string) ([]*AuditRecord, error) {
+	auditKey, err := loadAuditKey(db, encryptionKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT id, record, mac FROM audit_log ORDER BY id;")
+	if err != nil {
+		log.Printf("Error reading audit log: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var records []*AuditRecord
+	previousMAC := ""
+	for rows.Next() {
+		var id int
+		var ciphertext, mac string
+		if err := rows.Scan(&id, &ciphertext, &mac); err != nil {
+			return nil, err
+		}
+
+		if auditKey == nil || id != len(records)+1 || !hmac.Equal([]byte(mac), []byte(auditKey.recordMAC(id, ciphertext, previousMAC))) {
+			return records, fmt.Errorf("%w: record %d does not follow record %d", ErrAuditTampered, id, len(records))
+		}
+		plaintext, err := encryption.Decrypt(ciphertext, auditKey.encryptionKey)
+		if err != nil {
+			return records, fmt.Errorf("%w: record %d cannot be decrypted", ErrAuditTampered, id)
+		}
+
+		record := &AuditRecord{ID: id}
+		if err := json.Unmarshal([]byte(plaintext), record); err != nil {
+			return records, fmt.Errorf("%w: record %d cannot be read", ErrAuditTampered, id)
+		}
+		records = append(records, record)
+		previousMAC = mac
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Removing the latest records leaves a valid chain, the head catches it
+	if auditKey != nil && !hmac.Equal([]byte(auditKey.head), []byte(auditKey.headMAC(len(records), previousMAC))) {
+		return records, fmt.Errorf("%w: records after record %d are missing", ErrAuditTampered, len(records))
+	}
+
+	return records, nil
+}
+
+// ExportAuditLog writes the verified audit log as CSV, the error of a broken chain is returned after the
+// records before the break are written
+func ExportAuditLog(db *sql.DB, encryptionKey string, w io.Writer) error {
+	records, readErr := ReadAuditLog(db, encryptionKey)
+	if readErr != nil && !errors.Is(readErr, ErrAuditTampered) {
+		return readErr
+	}
+
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"id", "time", "event", "entry_id", "service", "detail", "actor"})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		entryID := ""
+		if record.EntryID != 0 {
+			entryID = strconv.Itoa(record.EntryID)
+		}
+		err = writer.Write([]string{
+			strconv.Itoa(record.ID),
+			record.Time.Format(time.RFC3339),
+			string(record.Event),
+			entryID,
+			record.Service,
+			record.Detail,
+			record.Actor,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	return readErr
+}
+
+// =-- Audit Keys --= //
+
+// auditKey holds the decrypted audit key and the stored head of the chain
+type auditKey struct {
+	encryptionKey string // Base64 AES-256 key for records
+	macKey        []byte // HMAC-SHA256 key
+	head          string // Stored head MAC
+	restarted     bool   // Whether the key was just created to replace a deleted log
+}
+
+// loadAuditKey decrypts the vault's audit key, creating it if create is set. Without create, a vault that
+// never logged anything returns nil, and one whose log and key were deleted returns ErrAuditTampered.
+func loadAuditKey(q execQuerier, encryptionKey string, create bool) (*auditKey, error) {
+	started, marked, err := auditStarted(q, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if !create && started && !marked {
+		return nil, fmt.Errorf("%w: the audit marker was removed", ErrAuditTampered)
+	}
+
+	var encryptedKey, head string
+	restarted := false
+	err = q.QueryRow("SELECT audit_key, head FROM audit_state WHERE id = 1;").Scan(&encryptedKey, &head)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !create && started {
+			return nil, fmt.Errorf("%w: the log and its key were deleted", ErrAuditTampered)
+		}
+		if !create {
+			return nil, nil
+		}
+		restarted = started
+
+		raw := make([]byte, auditKeySize)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encryptedKey, err = encryption.Encrypt(base64.StdEncoding.EncodeToString(raw), encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		_, err = q.Exec("INSERT INTO audit_state (id, audit_key, head) VALUES (1, ?, '');", encryptedKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Vaults whose log was started before the marker or the sealed key existed get them with their next record
+	if create {
+		if !marked {
+			marker, err := encryption.Encrypt(auditMarker, encryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			_, err = q.Exec("UPDATE vault_metadata SET audit_marker = ?;", marker)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = sealVaultAuthKey(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keyB64, err := encryption.Decrypt(encryptedKey, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil || len(raw) != auditKeySize {
+		return nil, fmt.Errorf("%w: invalid audit key", ErrAuditTampered)
+	}
+
+	return &auditKey{
+		encryptionKey: base64.StdEncoding.EncodeToString(raw[:32]),
+		macKey:        raw[32:],
+		head:          head,
+		restarted:     restarted,
+	}, nil
+}
+
+// auditStarted returns whether the vault's audit log was started, and whether its metadata still holds the
+// audit marker saying so. A sealed authentication key also shows the log was started, and unlike the marker
+// it cannot be put back without the master password.
+func auditStarted(q execQuerier, encryptionKey string) (started bool, marked bool, err error) {
+	var marker, authKey string
+	err = q.QueryRow("SELECT COALESCE(audit_marker, ''), auth_key FROM vault_metadata LIMIT 1;").Scan(&marker, &authKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if marker == "" {
+		return isSealedAuthKey(authKey), false, nil
+	}
+
+	value, err := encryption.Decrypt(marker, encryptionKey)
+	if err != nil {
+		return false, false, err
+	}
+	if value != auditMarker {
+		return false, false, fmt.Errorf("%w: invalid audit marker", ErrAuditTampered)
+	}
+
+	return true, true, nil
+}
+
+// reencryptAuditMarker re-encrypts the audit marker when the vault is re-keyed
+func reencryptAuditMarker(tx *sql.Tx, oldKey string, newKey string) error {
+	_, marked, err := auditStarted(tx, oldKey)
+	if err != nil || !marked {
+		return err
+	}
+
+	marker, err := encryption.Encrypt(auditMarker, newKey)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE vault_metadata SET audit_marker = ?;", marker)
+	return err
+}
+
+// =-- Sealed Authentication Keys --= //
+
+// sealedAuthKeyPrefix marks an authentication key stored in its sealed form
+const sealedAuthKeyPrefix = "sealed:"
+
+// sealAuthKey returns the sealed form of an authentication key, which a vault stores once its audit log is
+// started. It is derived from the key one way, so going back to the unsealed key to hide that a log was
+// deleted takes the master password.
+func sealAuthKey(authKey string) string {
+	hash := sha256.Sum256([]byte("PassLock audit log\x00" + authKey))
+	return sealedAuthKeyPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// isSealedAuthKey returns whether a stored authentication key is sealed
+func isSealedAuthKey(storedAuthKey string) bool {
+	return strings.HasPrefix(storedAuthKey, sealedAuthKeyPrefix)
+}
+
+// authKeyMatches returns whether a derived authentication key matches the stored one, sealed or not
+func authKeyMatches(storedAuthKey string, authKey string) bool {
+	if isSealedAuthKey(storedAuthKey) {
+		return storedAuthKey == sealAuthKey(authKey)
+	}
+	return storedAuthKey == authKey
+}
+
+// sameAuthKey returns whether two stored authentication keys come from the same master password, when
+// only one of them may have been sealed
+func sameAuthKey(a string, b string) bool {
+	switch {
+	case isSealedAuthKey(a) == isSealedAuthKey(b):
+		return a == b
+	case isSealedAuthKey(a):
+		return a == sealAuthKey(b)
+	default:
+		return sealAuthKey(a) == b
+	}
+}
+
+// sealVaultAuthKey stores the vault's authentication key sealed, if it is not already
+func sealVaultAuthKey(q execQuerier) error {
+	var authKey string
+	err := q.QueryRow("SELECT auth_key FROM vault_metadata LIMIT 1;").Scan(&authKey)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && isSealedAuthKey(authKey)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec("UPDATE vault_metadata SET auth_key = ?;", sealAuthKey(authKey))
+	return err
+}
+
+// recordMAC chains a record to the MAC of the record before it
+func (key *auditKey) recordMAC(id int, ciphertext string, previousMAC string) string {
+	mac := hmac.New(sha256.New, key.macKey)
+	mac.Write([]byte("record"))
+	_ = binary.Write(mac, binary.BigEndian, uint64(id))
+	mac.Write([]byte(previousMAC))
+	mac.Write([]byte(ciphertext))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// headMAC authenticates the number of records and the MAC of the latest one
+func (key *auditKey) headMAC(count int, lastMAC string) string {
+	mac := hmac.New(sha256.New, key.macKey)
+	mac.Write([]byte("head"))
+	_ = binary.Write(mac, binary.BigEndian, uint64(count))
+	mac.Write([]byte(lastMAC))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// auditActor describes who is using PassLock as user@host
+func auditActor() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+
+	return name + "@" + host
+}
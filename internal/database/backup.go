@@ -0,0 +1,475 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Reasons recorded with automatic backups
+const (
+	BackupManual    = "manual"
+	BackupScheduled = "scheduled"
+	BackupMigration = "migration"
+	BackupClear     = "clear"
+	BackupRekey     = "rekey"
+	BackupImport    = "import"
+	BackupRestore   = "restore"
+	BackupSync      = "sync"
+	BackupRepair    = "repair"
+)
+
+// backupTimeFormat is the UTC timestamp at the start of backup file names, it sorts chronologically
+const backupTimeFormat = "20060102T150405.000Z"
+
+// backupFilePattern matches backup file names: <timestamp>_<reason>.sqlite
+var backupFilePattern = regexp.MustCompile(`^(\d{8}T\d{6}\.\d{3}Z)_([a-z-]+)\.sqlite$`)
+
+var (
+	ErrBackupInvalid = errors.New("backup is not a valid vault")
+	ErrBackupAuth    = errors.New("master password does not unlock the backup")
+)
+
+// =-- Backup Data Structures --= //
+
+// Backup describes a backup file of a vault
+type Backup struct {
+	VaultName string    // Vault the backup belongs to
+	Path      string    // Backup file path
+	CreatedAt time.Time // When the backup was taken (UTC)
+	Reason    string    // Why the backup was taken (e.g., BackupScheduled)
+	Entries   int       // Number of entries in the backup, -1 if it could not be read
+	Size      int64     // File size in bytes
+}
+
+// =-- Backup Functions --= //
+
+// BackupVault backs up a vault by name using SQLite's online backup API and applies the retention policy
+func BackupVault(vaultName string, reason string) (*Backup, error) {
+	path, err := existingVaultPath(vaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}(db)
+
+	return backupDB(db, vaultName, path, reason)
+}
+
+// backupOpenVault backs up an open vault before a risky operation, labelled with the name stored in its
+// metadata. Databases without metadata or a file (e.g., in-memory vaults) are skipped.
+func backupOpenVault(db *sql.DB, reason string) error {
+	var vaultName string
+	err := db.QueryRow("SELECT vault_name FROM vault_metadata LIMIT 1;").Scan(&vaultName)
+	if err != nil || ValidateVaultName(vaultName) != nil {
+		return nil
+	}
+	var file string
+	err = db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main';").Scan(&file)
+	if err != nil || file == "" {
+		return nil
+	}
+
+	_, err = backupDB(db, vaultName, file, reason)
+	if err != nil {
+		log.Printf("Error backing up vault %s before %s: %v", vaultName, reason, err)
+	}
+	return err
+}
+
+// backupDB copies an open database to a new backup file of the vault at vaultPath
+func backupDB(db *sql.DB, vaultName string, vaultPath string, reason string) (*Backup, error) {
+	dir := backupDirectory(vaultPath)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Printf("Could not create backup directory: %s", err)
+		return nil, err
+	}
+
+	// Backups taken within the same millisecond get distinct timestamps
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	path := backupPath(dir, createdAt, reason)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		createdAt = createdAt.Add(time.Millisecond)
+		path = backupPath(dir, createdAt, reason)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	target, err := sql.Open("sqlite3", "file:"+escapeSQLitePath(path))
+	if err == nil {
+		err = copyDatabase(target, db)
+		if closeErr := target.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		log.Printf("Error backing up vault %s: %v", vaultName, err)
+		return nil, err
+	}
+
+	err = pruneBackups(vaultName, vaultPath)
+	if err != nil {
+		log.Printf("Error pruning backups of vault %s: %v", vaultName, err)
+	}
+
+	return readBackup(vaultName, path)
+}
+
+// ListBackups returns the backups of a vault, newest first
+func ListBackups(vaultName string) ([]*Backup, error) {
+	path, err := existingVaultPath(vaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	return listBackups(vaultName, path)
+}
+
+// listBackups returns the backups of the vault at vaultPath, newest first
+func listBackups(vaultName string, vaultPath string) ([]*Backup, error) {
+	dir := backupDirectory(vaultPath)
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []*Backup
+	for _, file := range files {
+		if file.IsDir() || !backupFilePattern.MatchString(file.Name()) {
+			continue
+		}
+		backup, err := readBackup(vaultName, filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Printf("Skipping backup %s: %v", file.Name(), err)
+			continue
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(a, b int) bool {
+		return backups[a].CreatedAt.After(backups[b].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// LatestBackup returns the newest backup of a vault, or nil if there is none
+func LatestBackup(vaultName string) (*Backup, error) {
+	backups, err := ListBackups(vaultName)
+	if err != nil || len(backups) == 0 {
+		return nil, err
+	}
+
+	return backups[0], nil
+}
+
+// BackupIfDue takes a scheduled backup if the newest backup is older than the configured interval
+func BackupIfDue(vaultName string) (*Backup, error) {
+	interval := time.Duration(config.Current().Backup.IntervalHours) * time.Hour
+	if interval <= 0 {
+		return nil, nil
+	}
+
+	latest, err := LatestBackup(vaultName)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < interval {
+		return nil, nil
+	}
+
+	return BackupVault(vaultName, BackupScheduled)
+}
+
+// PruneBackups deletes the backups of a vault that fall outside the retention policy
+func PruneBackups(vaultName string) error {
+	path, err := existingVaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+
+	return pruneBackups(vaultName, path)
+}
+
+// pruneBackups deletes the backups of the vault at vaultPath that fall outside the retention policy
+func pruneBackups(vaultName string, vaultPath string) error {
+	settings := config.Current().Backup
+
+	backups, err := listBackups(vaultName, vaultPath)
+	if err != nil {
+		return err
+	}
+
+	for i, backup := range backups {
+		// The newest backup is always kept
+		if i == 0 {
+			continue
+		}
+		tooMany := settings.Keep > 0 && i >= settings.Keep
+		tooOld := settings.MaxAgeDays > 0 && time.Since(backup.CreatedAt) > time.Duration(settings.MaxAgeDays)*24*time.Hour
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		err := os.Remove(backup.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreBackup replaces a vault's contents with a backup once masterPassword is confirmed to unlock the
+// backup. The current contents are backed up first, so a restore can itself be undone.
+func RestoreBackup(vaultName string, backup *Backup, masterPassword string) error {
+	livePath, err := existingVaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+
+	// The live file is overwritten, so no other session may be writing to it
+	lock, err := acquireLock(livePath)
+	if err != nil {
+		return err
+	}
+	defer func(lock *fileLock) {
+		err := lock.release()
+		if err != nil {
+			log.Printf("Error releasing lock of vault %s: %v", vaultName, err)
+		}
+	}(lock)
+
+	live, err := openSQLite(livePath)
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}(live)
+
+	return restoreBackup(live, livePath, backup, masterPassword)
+}
+
+// RestoreBackup replaces the session's vault contents with a backup, using the write lock the session holds
+func (session *VaultSession) RestoreBackup(backup *Backup, masterPassword string) error {
+	if session.lock == nil {
+		return fmt.Errorf("%w: %s", ErrVaultLocked, session.Path)
+	}
+
+	return restoreBackup(session.DB, session.Path, backup, masterPassword)
+}
+
+// restoreBackup copies a verified backup over the open vault at livePath, whose write lock the caller holds
+func restoreBackup(live *sql.DB, livePath string, backup *Backup, masterPassword string) error {
+	source, err := openSQLiteReadOnly(backup.Path)
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}(source)
+
+	err = verifyBackup(source, masterPassword)
+	if err != nil {
+		return err
+	}
+
+	// Keep the live vault's name even if the backup was taken under another one
+	var vaultName string
+	err = live.QueryRow("SELECT vault_name FROM vault_metadata LIMIT 1;").Scan(&vaultName)
+	if err != nil {
+		return err
+	}
+
+	_, err = backupDB(live, vaultName, livePath, BackupRestore)
+	if err != nil {
+		return err
+	}
+
+	err = copyDatabase(live, source)
+	if err != nil {
+		log.Printf("Error restoring vault %s: %v", vaultName, err)
+		return err
+	}
+
+	_, err = live.Exec("UPDATE vault_metadata SET vault_name = ?;", vaultName)
+	return err
+}
+
+// =-- Backup Helpers --= //
+
+// backupDirectory returns the directory holding the backups of the vault file at vaultPath. It is named
+// after the file and a hash of its resolved path, so vaults sharing a name never share backups.
+func backupDirectory(vaultPath string) string {
+	resolved, err := filepath.Abs(vaultPath)
+	if err != nil {
+		resolved = filepath.Clean(vaultPath)
+	}
+	// Only the directory is resolved, the file itself may not exist yet (or any more) when renaming
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(resolved)); err == nil {
+		resolved = filepath.Join(dir, filepath.Base(resolved))
+	}
+
+	sum := sha256.Sum256([]byte(resolved))
+	return filepath.Join(config.Current().Backup.Directory, VaultNameFromPath(resolved)+"-"+hex.EncodeToString(sum[:6]))
+}
+
+// backupPath returns the backup file path for a timestamp and reason
+func backupPath(dir string, createdAt time.Time, reason string) string {
+	return filepath.Join(dir, createdAt.Format(backupTimeFormat)+"_"+reason+VaultExtension)
+}
+
+// readBackup reads the details of a backup file
+func readBackup(vaultName string, path string) (*Backup, error) {
+	match := backupFilePattern.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return nil, fmt.Errorf("%w: unexpected file name %s", ErrBackupInvalid, filepath.Base(path))
+	}
+	createdAt, err := time.Parse(backupTimeFormat, match[1])
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		VaultName: vaultName,
+		Path:      path,
+		CreatedAt: createdAt,
+		Reason:    match[2],
+		Entries:   -1,
+		Size:      info.Size(),
+	}
+
+	db, err := openSQLiteReadOnly(path)
+	if err == nil {
+		_ = db.QueryRow("SELECT COUNT(*) FROM passwords;").Scan(&backup.Entries)
+		_ = db.Close()
+	}
+
+	return backup, nil
+}
+
+// verifyBackup checks a backup is intact and that masterPassword derives its authentication key
+func verifyBackup(db *sql.DB, masterPassword string) error {
+	var integrity string
+	err := db.QueryRow("PRAGMA integrity_check;").Scan(&integrity)
+	if err != nil || integrity != "ok" {
+		return fmt.Errorf("%w: integrity check failed", ErrBackupInvalid)
+	}
+
+	// Backups of vaults created before key derivation settings were stored use the defaults
+	params := encryption.DefaultArgon2Params
+	var authKey, salt string
+	err = db.QueryRow("SELECT auth_key, salt FROM vault_metadata LIMIT 1;").Scan(&authKey, &salt)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+	var hasKDF bool
+	err = db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('vault_metadata') WHERE name = 'kdf_time';").Scan(&hasKDF)
+	if err == nil && hasKDF {
+		err = db.QueryRow("SELECT kdf_time, kdf_memory, kdf_threads FROM vault_metadata LIMIT 1;").Scan(
+			&params.Time, &params.Memory, &params.Threads)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+
+	_, derivedAuthKey, err := encryption.DeriveMasterKeysWithParams(masterPassword, salt, params)
+	if err != nil {
+		return err
+	}
+	if !authKeyMatches(authKey, derivedAuthKey) {
+		return ErrBackupAuth
+	}
+
+	return nil
+}
+
+// copyDatabase replaces the contents of dst with src using SQLite's online backup API
+func copyDatabase(dst *sql.DB, src *sql.DB) error {
+	ctx := context.Background()
+
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dstConn.Close()
+	}()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcConn.Close()
+	}()
+
+	return dstConn.Raw(func(dstDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			dstSQLite, ok := dstDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup destination is not an SQLite connection")
+			}
+			srcSQLite, ok := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup source is not an SQLite connection")
+			}
+
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			// Copy every page in one step, the source stays readable by other connections
+			_, err = backup.Step(-1)
+			if finishErr := backup.Finish(); err == nil {
+				err = finishErr
+			}
+			return err
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Conflict Resolution --= //
+
+// ListSyncConflicts returns the unresolved sync conflicts, oldest first
+func ListSyncConflicts(db *sql.DB, encryptionKey string) ([]*SyncConflict, error) {
+	var conflicts []*SyncConflict
+	err := queryEach(db, "SELECT id, uuid, peer, local, remote, detected_at FROM sync_conflicts ORDER BY id;",
+		func(rows *sql.Rows) error {
+			conflict, err := scanSyncConflict(rows, encryptionKey)
+			conflicts = append(conflicts, conflict)
+			return err
+		})
+	if err != nil {
+		log.Printf("Error listing sync conflicts: %v", err)
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// ResolveSyncConflict settles a conflict by keeping this copy's entry or taking the other copy's. The
+// choice reaches the other copy with the next sync.
+func ResolveSyncConflict(db *sql.DB, encryptionKey string, id int, keepRemote bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = resolveSyncConflict(tx, encryptionKey, id, keepRemote)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error resolving sync conflict %d: %v", id, err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// resolveSyncConflict applies a conflict resolution inside a transaction
+func resolveSyncConflict(tx *sql.Tx, encryptionKey string, id int, keepRemote bool) error {
+	conflict, err := scanSyncConflict(tx.QueryRow(
+		"SELECT id, uuid, peer, local, remote, detected_at FROM sync_conflicts WHERE id = ?;", id), encryptionKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConflictNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	side := &syncSide{tx: tx}
+	if keepRemote {
+		err = side.applyEntry(encryptionKey, conflict.UUID, conflict.Remote)
+	} else if conflict.Local != nil {
+		// A kept entry counts as changed after the other copy deleted it
+		_, err = tx.Exec("UPDATE passwords SET modified_at = "+sqlNow+" WHERE uuid = ?;", conflict.UUID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM sync_conflicts WHERE id = ?;", id)
+	return err
+}
+
+// scanSyncConflict scans and decrypts a sync_conflicts row
+func scanSyncConflict(row rowScanner, encryptionKey string) (*SyncConflict, error) {
+	var conflict SyncConflict
+	var local, remote string
+	err := row.Scan(&conflict.ID, &conflict.UUID, &conflict.Peer, &local, &remote, &conflict.DetectedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	conflict.Local, err = decryptSyncEntry(local, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	conflict.Remote, err = decryptSyncEntry(remote, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conflict, nil
+}
+
+// encryptSyncEntry encrypts an entry as JSON, a nil entry is stored as an empty string
+func encryptSyncEntry(entry *SyncEntry, encryptionKey string) (string, error) {
+	if entry == nil {
+		return "", nil
+	}
+
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return encryption.Encrypt(string(plaintext), encryptionKey)
+}
+
+// decryptSyncEntry reverses encryptSyncEntry
+func decryptSyncEntry(ciphertext string, encryptionKey string) (*SyncEntry, error) {
+	if ciphertext == "" {
+		return nil, nil
+	}
+
+	plaintext, err := encryption.Decrypt(ciphertext, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	var entry SyncEntry
+	err = json.Unmarshal([]byte(plaintext), &entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
@@ -4,44 +4,170 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
 )
 
+// ErrWrongMasterPassword is returned when a master password does not derive the vault's authentication key
+var ErrWrongMasterPassword = errors.New("incorrect master password")
+
 // =-- Standardized EncryptedPassword Entry Data Structures --= //
 
 // PasswordInformation stores information for **output** password entry row dumps
 type PasswordInformation struct {
-	ID                int    // Unique ID
-	Service           string // Service (e.g., "github.com")
-	Username          string // Username for the account
-	EncryptedPassword string // Encrypted password
-	EncryptedNotes    string // Encrypted notes
-	CreatedAt         string // Timestamp for entry creation
+	ID                int       // Unique ID
+	Service           string    // Service (e.g., "github.com")
+	Username          string    // Username for the account
+	EncryptedPassword string    // Encrypted password
+	EncryptedNotes    string    // Encrypted notes
+	CreatedAt         string    // Timestamp for entry creation
+	FolderID          int       // Folder containing the entry (0 if unfiled)
+	EntryType         EntryType // Kind of entry (login, card, ...)
+	UUID              string    // Stable ID used for sync
+	ModifiedAt        string    // Timestamp of the last change (UTC)
+	Version           int64     // Logical clock value of the last change
+	PasswordChangedAt string    // Timestamp the password was last changed (UTC)
+	ExpiresAt         string    // Date the entry expires in DateFormat ("" if it does not)
 }
 
 // PasswordEntry stores information for **input** password entries
 type PasswordEntry struct {
-	Service           string // Service (e.g., "github.com")
-	Username          string // Username for the account
-	EncryptedPassword string // Encrypted password
-	EncryptedNotes    string // Encrypted notes
+	Service           string    // Service (e.g., "github.com")
+	Username          string    // Username for the account
+	EncryptedPassword string    // Encrypted password
+	EncryptedNotes    string    // Encrypted notes
+	FolderID          int       // Folder to store the entry in (0 if unfiled)
+	EntryType         EntryType // Kind of entry (defaults to EntryLogin)
+	PasswordChangedAt time.Time // Time the password was last changed (zero for now)
+}
+
+// =-- Row Scanning Helpers --= //
+
+// entryColumns lists the passwords table columns read by scanEntry, in order
+const entryColumns = "id, service, username, password, notes, created_at, folder_id, entry_type, uuid, modified_at, version, " +
+	sqlPasswordChangedAt + ", COALESCE(expires_at, '')"
+
+// sqlPasswordChangedAt reads when an entry's password was last changed, in syncTimeFormat
+const sqlPasswordChangedAt = `COALESCE(password_changed_at, strftime('%Y-%m-%dT%H:%M:%fZ', created_at), '')`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// execQuerier is implemented by both *sql.DB and *sql.Tx
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// scanEntry scans a row selected with entryColumns into a PasswordInformation struct
+func scanEntry(row rowScanner) (*PasswordInformation, error) {
+	var entry PasswordInformation
+	var notes sql.NullString
+	var folderID sql.NullInt64
+	var entryType string
+	var uuid, modifiedAt sql.NullString
+	var version sql.NullInt64
+	err := row.Scan(
+		&entry.ID,
+		&entry.Service,
+		&entry.Username,
+		&entry.EncryptedPassword,
+		&notes,
+		&entry.CreatedAt,
+		&folderID,
+		&entryType,
+		&uuid,
+		&modifiedAt,
+		&version,
+		&entry.PasswordChangedAt,
+		&entry.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	entry.EncryptedNotes = notes.String
+	entry.FolderID = int(folderID.Int64)
+	entry.EntryType = EntryType(entryType)
+	entry.UUID = uuid.String
+	entry.ModifiedAt = modifiedAt.String
+	entry.Version = version.Int64
+
+	return &entry, nil
+}
+
+// scanEntries scans every row selected with entryColumns
+func scanEntries(rows *sql.Rows) ([]*PasswordInformation, error) {
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var entries []*PasswordInformation
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			log.Printf("Error reading entry row: %v", err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// nullableID converts an optional ID (0 meaning none) into an SQL value
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
 }
 
 // =-- Database Management Functions --= //
 
 // StorePassword stores a new password entry in the database and returns the row information as PasswordInformation struct
 func StorePassword(db *sql.DB, entry PasswordEntry) (*PasswordInformation, error) {
+	return insertEntry(db, entry)
+}
+
+// insertEntry inserts a password entry using either a database or a transaction
+func insertEntry(q execQuerier, entry PasswordEntry) (*PasswordInformation, error) {
+	// Entries without an explicit type are logins
+	if entry.EntryType == "" {
+		entry.EntryType = EntryLogin
+	}
+
 	// Insert SQL query to add a new entry to the passwords table
 	insertSQL := `
-    INSERT INTO passwords (service, username, password, notes) 
-    VALUES (?, ?, ?, ?);`
+    INSERT INTO passwords (service, username, password, notes, folder_id, entry_type, password_changed_at) 
+    VALUES (?, ?, ?, ?, ?, ?, COALESCE(?, ` + sqlNow + `));`
 
-	// Execute the query with the parameters (service, username, encrypted password, and encrypted notes)
-	result, err := db.Exec(
+	// Entries copied from elsewhere keep the time their password was last changed
+	var changedAt any
+	if !entry.PasswordChangedAt.IsZero() {
+		changedAt = entry.PasswordChangedAt.UTC().Format(syncTimeFormat)
+	}
+
+	// Execute the query with the parameters (service, username, encrypted password, encrypted notes, folder, type and change time)
+	result, err := q.Exec(
 		insertSQL,
 		entry.Service,
 		entry.Username,
 		entry.EncryptedPassword,
-		entry.EncryptedNotes)
+		entry.EncryptedNotes,
+		nullableID(entry.FolderID),
+		string(entry.EntryType),
+		changedAt)
 	if err != nil {
 		log.Printf("Error inserting password: %v", err)
 		return nil, err
@@ -56,52 +182,48 @@ func StorePassword(db *sql.DB, entry PasswordEntry) (*PasswordInformation, error
 
 	// Retrieve inserted row
 	query := `
-    SELECT id, service, username, password, notes, created_at 
+    SELECT ` + entryColumns + `
     FROM passwords 
     WHERE id = ? LIMIT 1;`
 
-	row := db.QueryRow(query, lastID)
+	row := q.QueryRow(query, lastID)
 
-	var inserted PasswordInformation
-	err = row.Scan(&inserted.ID, &inserted.Service, &inserted.Username, &inserted.EncryptedPassword, &inserted.EncryptedNotes, &inserted.CreatedAt)
+	inserted, err := scanEntry(row)
 	if err != nil {
 		log.Printf("Error fetching inserted password entry with ID %d: %v", lastID, err)
 		return nil, err
 	}
 
-	return &inserted, nil
+	return inserted, nil
 }
 
 // GetEntryFromID retrieves all entry information for a unique entry ID
 func GetEntryFromID(db *sql.DB, id int) (*PasswordInformation, error) {
 	// Query to retrieve the entire row information for a specific ID
 	query := `
-    SELECT id, service, username, password, notes, created_at 
+    SELECT ` + entryColumns + `
     FROM passwords 
     WHERE id = ? LIMIT 1;`
 
 	// Query the database and fetch the result
 	row := db.QueryRow(query, id)
 
-	// Initialize a PasswordInformation struct to hold the data
-	var entry PasswordInformation
-
-	// Scan the row into the PasswordInformation struct
-	err := row.Scan(&entry.ID, &entry.Service, &entry.Username, &entry.EncryptedPassword, &entry.EncryptedNotes, &entry.CreatedAt)
+	// Scan the row into a PasswordInformation struct
+	entry, err := scanEntry(row)
 	if err != nil {
 		log.Printf("Error fetching password entry with ID %d: %v", id, err)
 		return nil, err
 	}
 
 	// Return the populated PasswordInformation struct
-	return &entry, nil
+	return entry, nil
 }
 
 // GetEntriesFromService GetEntryFromService retrieves all password entries from a given service
 func GetEntriesFromService(db *sql.DB, service string) ([]*PasswordInformation, error) {
 	// Query to retrieve all entries for the given service
 	query := `
-    SELECT id, service, username, password, notes, created_at 
+    SELECT ` + entryColumns + `
     FROM passwords 
     WHERE service = ?;`
 
@@ -111,44 +233,16 @@ func GetEntriesFromService(db *sql.DB, service string) ([]*PasswordInformation,
 		log.Printf("Error fetching entries for service '%s': %v", service, err)
 		return nil, err
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Printf("Error closing rows: %v", err)
-		}
-	}(rows)
-
-	// Slice to hold all the password entries
-	var entries []*PasswordInformation
-
-	// Loop through the rows and scan each one into a PasswordInformation
-	for rows.Next() {
-		var entry PasswordInformation
-		err := rows.Scan(&entry.ID, &entry.Service, &entry.Username, &entry.EncryptedPassword, &entry.EncryptedNotes, &entry.CreatedAt)
-		if err != nil {
-			log.Printf("Error reading row for service '%s': %v", service, err)
-			return nil, err
-		}
-
-		// Append the entry to the slice
-		entries = append(entries, &entry)
-	}
-
-	// Check if there was an error during iteration
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating over rows: %v", err)
-		return nil, err
-	}
 
 	// Return all the entries for the given service
-	return entries, nil
+	return scanEntries(rows)
 }
 
 // GetAllEntries returns all entries in the database as a list of PasswordInformation structs
 func GetAllEntries(db *sql.DB) ([]*PasswordInformation, error) {
 	// Set up SQL query
 	query := `
-	SELECT id, service, username, password, notes, created_at
+	SELECT ` + entryColumns + `
 	FROM passwords;`
 
 	rows, err := db.Query(query)
@@ -156,38 +250,58 @@ func GetAllEntries(db *sql.DB) ([]*PasswordInformation, error) {
 		log.Printf("Error fetching entries for all entries: %v", err)
 		return nil, err
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Printf("Error closing rows: %v", err)
-		}
-	}(rows)
 
-	// Iterate through rows
-	var entries []*PasswordInformation
-	for rows.Next() {
-		var entry PasswordInformation
-		// Input row information into PasswordInformation struct
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Service,
-			&entry.Username,
-			&entry.EncryptedPassword,
-			&entry.EncryptedNotes,
-			&entry.CreatedAt)
-		if err != nil {
-			log.Printf("Error reading row for entry with ID %d: %v", entry.ID, err)
-			return nil, err
-		}
-		entries = append(entries, &entry)
+	return scanEntries(rows)
+}
+
+// UpdateEntryPassword encrypts and stores a new password for an entry, marking it as changed now and
+// recording the change in the audit log
+func UpdateEntryPassword(db *sql.DB, encryptionKey string, id int, newPassword string) (*PasswordInformation, error) {
+	encryptedPassword, err := encryption.Encrypt(newPassword, encryptionKey)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating over rows: %v", err)
+	tx, err := db.Begin()
+	if err != nil {
 		return nil, err
 	}
 
-	return entries, nil
+	updated, err := updateEntryPassword(tx, encryptionKey, id, encryptedPassword)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error updating password of entry with ID %d: %v", id, err)
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// updateEntryPassword replaces an entry's password and audits the change inside a transaction
+func updateEntryPassword(tx *sql.Tx, encryptionKey string, id int, encryptedPassword string) (*PasswordInformation, error) {
+	_, err := tx.Exec("UPDATE passwords SET password = ?, password_changed_at = "+sqlNow+" WHERE id = ?;",
+		encryptedPassword, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fails with sql.ErrNoRows if there is no such entry, rolling back the update
+	updated, err := scanEntry(tx.QueryRow("SELECT "+entryColumns+" FROM passwords WHERE id = ? LIMIT 1;", id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = appendAudit(tx, encryptionKey, []AuditRecord{{
+		Event:   AuditEdit,
+		EntryID: updated.ID,
+		Service: updated.Service,
+		Detail:  "password",
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
 }
 
 // DeleteEntryFromID deletes a specific password entry based on unique ID
@@ -208,11 +322,17 @@ func DeleteEntryFromID(db *sql.DB, id int) error {
 
 // ClearDatabase clears all entries in the passwords table
 func ClearDatabase(db *sql.DB) error {
+	// Clearing cannot be undone, so keep a backup of file-backed vaults
+	err := backupOpenVault(db, BackupClear)
+	if err != nil {
+		return err
+	}
+
 	// SQL query to delete all rows from the passwords table
 	deleteSQL := `DELETE FROM passwords;`
 
 	// Execute the delete query
-	_, err := db.Exec(deleteSQL)
+	_, err = db.Exec(deleteSQL)
 	if err != nil {
 		log.Printf("Error clearing database: %v", err)
 		return err
@@ -235,7 +355,7 @@ func GetSaltFromVault(vaultName string) (string, error) {
 	}(db)
 
 	var salt string
-	err = db.QueryRow("SELECT salt FROM vault_metadata WHERE vault_name = ?;", vaultName).Scan(&salt)
+	err = db.QueryRow("SELECT salt FROM vault_metadata LIMIT 1;").Scan(&salt)
 	if err != nil {
 		log.Printf("Error reading vault metadata: %v", err)
 		return "", err
@@ -244,22 +364,48 @@ func GetSaltFromVault(vaultName string) (string, error) {
 	return salt, nil
 }
 
-// AuthenticateVault returns whether the user is authenticated for a specific vault given an authKey
-func AuthenticateVault(vaultName string, authKey string) (bool, error) {
+// GetKDFParamsFromVault returns the Argon2 parameters a vault's keys are derived with
+func GetKDFParamsFromVault(vaultName string) (encryption.Argon2Params, error) {
+	params := encryption.DefaultArgon2Params
+
 	db, err := InitDB(vaultName)
 	if err != nil {
-		return false, err
+		return params, err
 	}
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
-			log.Println(err)
+			log.Printf("Error closing database: %v", err)
 		}
 	}(db)
 
-	// Retrieve the stored authentication key for the given key
+	err = db.QueryRow("SELECT kdf_time, kdf_memory, kdf_threads FROM vault_metadata LIMIT 1;").Scan(
+		&params.Time, &params.Memory, &params.Threads)
+	if err != nil {
+		log.Printf("Error reading vault metadata: %v", err)
+		return params, err
+	}
+
+	return params, nil
+}
+
+// AuthenticateVault returns whether the user is authenticated for a specific vault given an authKey
+func AuthenticateVault(vaultName string, authKey string) (bool, error) {
+	// A session takes the write lock for recording a failed unlock
+	session, err := OpenVaultSession(vaultName)
+	if err != nil {
+		return false, err
+	}
+	defer func(session *VaultSession) {
+		err := session.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}(session)
+
+	// Retrieve the stored authentication key (a vault has a single metadata row, whatever the file is named)
 	var storedAuthKey string
-	err = db.QueryRow("SELECT auth_key FROM vault_metadata WHERE vault_name = ?", vaultName).Scan(&storedAuthKey)
+	err = session.DB.QueryRow("SELECT auth_key FROM vault_metadata LIMIT 1;").Scan(&storedAuthKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// Vault does not exist
@@ -271,12 +417,40 @@ func AuthenticateVault(vaultName string, authKey string) (bool, error) {
 	}
 
 	// Compare provided authKey with vault metadata authKey
-	verificationResult := authKey == storedAuthKey
+	verificationResult := authKeyMatches(storedAuthKey, authKey)
 
 	if verificationResult {
 		return true, nil // Authenticated
 	} else {
 		log.Printf("Vault %s not authenticated", vaultName)
+		// Failing to record the attempt does not change the outcome
+		if session.ReadOnly {
+			log.Printf("Vault %s is open for writing in another process, failed unlock not recorded", vaultName)
+		} else {
+			_ = recordFailedUnlock(session.DB)
+		}
 		return false, nil
 	}
 }
+
+// VerifyMasterPassword checks masterPassword against an open vault, for confirming sensitive operations
+func VerifyMasterPassword(db *sql.DB, masterPassword string) error {
+	params := encryption.DefaultArgon2Params
+	var authKey, salt string
+	err := db.QueryRow("SELECT auth_key, salt, kdf_time, kdf_memory, kdf_threads FROM vault_metadata LIMIT 1;").Scan(
+		&authKey, &salt, &params.Time, &params.Memory, &params.Threads)
+	if err != nil {
+		log.Printf("Error reading vault metadata: %v", err)
+		return err
+	}
+
+	_, derivedAuthKey, err := encryption.DeriveMasterKeysWithParams(masterPassword, salt, params)
+	if err != nil {
+		return err
+	}
+	if !authKeyMatches(authKey, derivedAuthKey) {
+		return ErrWrongMasterPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,436 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"golang.org/x/crypto/ssh"
+)
+
+// =-- Entry Types --= //
+
+// EntryType identifies the kind of item stored in an entry
+type EntryType string
+
+const (
+	EntryLogin      EntryType = "login"     // Website or application login
+	EntrySecureNote EntryType = "note"      // Free-form encrypted note
+	EntryCard       EntryType = "card"      // Payment card
+	EntryIdentity   EntryType = "identity"  // Identity and address details
+	EntrySSHKey     EntryType = "ssh_key"   // SSH private key
+	EntryAPIToken   EntryType = "api_token" // API key or token
+	EntryDatabase   EntryType = "database"  // Database credentials
+	EntryWiFi       EntryType = "wifi"      // Wi-Fi network
+)
+
+var (
+	ErrUnknownEntryType  = errors.New("unknown entry type")
+	ErrMissingField      = errors.New("required field is missing")
+	ErrInvalidCardNumber = errors.New("invalid card number")
+	ErrInvalidCardExpiry = errors.New("invalid card expiry, expected MM/YY")
+	ErrInvalidSSHKey     = errors.New("invalid SSH key")
+	ErrInvalidPort       = errors.New("port must be between 1 and 65535")
+	ErrInvalidWiFi       = errors.New("invalid Wi-Fi network settings")
+)
+
+// =-- Entry Type Schemas --= //
+
+// TypeField describes a type-specific field, stored as a custom field named after its label
+type TypeField struct {
+	Key      string    // Stable key used in TypedEntry.Fields
+	Label    string    // Display label, also the stored custom field name
+	Type     FieldType // Field type used for validation and display
+	Required bool      // Whether the field must have a value
+}
+
+// EntrySchema describes how an entry type uses the built-in columns and which extra fields it has
+type EntrySchema struct {
+	Type           EntryType   // Entry type described by the schema
+	Label          string      // Display name of the type
+	TitleLabel     string      // Label for the service column
+	UsernameLabel  string      // Label for the username column ("" if unused)
+	SecretLabel    string      // Label for the encrypted password column ("" if unused)
+	SecretLines    bool        // Whether the secret is multi-line (notes, keys)
+	SecretOptional bool        // Whether the secret may be left empty
+	Fields         []TypeField // Extra typed fields
+
+	validate func(entry *TypedEntry) error // Type-specific validation
+}
+
+// EntrySchemas lists every entry type in display order
+var EntrySchemas = []*EntrySchema{
+	{
+		Type: EntryLogin, Label: "Login",
+		TitleLabel: "Service", UsernameLabel: "Username", SecretLabel: "Password",
+	},
+	{
+		Type: EntrySecureNote, Label: "Secure Note",
+		TitleLabel: "Title", SecretLabel: "Note", SecretLines: true,
+	},
+	{
+		Type: EntryCard, Label: "Payment Card",
+		TitleLabel: "Card name", UsernameLabel: "Cardholder", SecretLabel: "Card number",
+		Fields: []TypeField{
+			{Key: "expiry", Label: "Expiry (MM/YY)", Type: FieldText, Required: true},
+			{Key: "cvv", Label: "Security code", Type: FieldHidden},
+			{Key: "pin", Label: "PIN", Type: FieldHidden},
+			{Key: "brand", Label: "Brand", Type: FieldText},
+		},
+		validate: validateCard,
+	},
+	{
+		Type: EntryIdentity, Label: "Identity",
+		TitleLabel: "Title", UsernameLabel: "Full name",
+		Fields: []TypeField{
+			{Key: "email", Label: "Email", Type: FieldEmail},
+			{Key: "phone", Label: "Phone", Type: FieldText},
+			{Key: "birth_date", Label: "Date of birth", Type: FieldDate},
+			{Key: "address", Label: "Address", Type: FieldText},
+			{Key: "city", Label: "City", Type: FieldText},
+			{Key: "postal_code", Label: "Postal code", Type: FieldText},
+			{Key: "country", Label: "Country", Type: FieldText},
+			{Key: "id_number", Label: "ID number", Type: FieldHidden},
+		},
+	},
+	{
+		Type: EntrySSHKey, Label: "SSH Key",
+		TitleLabel: "Host", UsernameLabel: "User", SecretLabel: "Private key", SecretLines: true,
+		Fields: []TypeField{
+			{Key: "public_key", Label: "Public key", Type: FieldText},
+			{Key: "passphrase", Label: "Passphrase", Type: FieldHidden},
+		},
+		validate: validateSSHKey,
+	},
+	{
+		Type: EntryAPIToken, Label: "API Token",
+		TitleLabel: "Service", UsernameLabel: "Key ID", SecretLabel: "Token",
+		Fields: []TypeField{
+			{Key: "endpoint", Label: "Endpoint", Type: FieldURL},
+			{Key: "scopes", Label: "Scopes", Type: FieldText},
+			{Key: "expires", Label: "Expires", Type: FieldDate},
+		},
+	},
+	{
+		Type: EntryDatabase, Label: "Database",
+		TitleLabel: "Host", UsernameLabel: "Username", SecretLabel: "Password",
+		Fields: []TypeField{
+			{Key: "engine", Label: "Engine", Type: FieldText},
+			{Key: "port", Label: "Port", Type: FieldNumber},
+			{Key: "database", Label: "Database name", Type: FieldText},
+		},
+		validate: validateDatabase,
+	},
+	{
+		Type: EntryWiFi, Label: "Wi-Fi Network",
+		TitleLabel: "Network name (SSID)", SecretLabel: "Passphrase", SecretOptional: true,
+		Fields: []TypeField{
+			{Key: "security", Label: "Security (WPA2, WPA3, WEP, Open)", Type: FieldText},
+		},
+		validate: validateWiFi,
+	},
+}
+
+// GetEntrySchema returns the schema of an entry type, an empty type is treated as a login
+func GetEntrySchema(entryType EntryType) (*EntrySchema, error) {
+	if entryType == "" {
+		entryType = EntryLogin
+	}
+
+	for _, schema := range EntrySchemas {
+		if schema.Type == entryType {
+			return schema, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownEntryType, entryType)
+}
+
+// =-- Typed Entries --= //
+
+// TypedEntry stores the decrypted contents of an entry of any type
+type TypedEntry struct {
+	ID       int               // Unique ID (0 for new entries)
+	Type     EntryType         // Entry type
+	Title    string            // Stored in the service column
+	Username string            // Stored in the username column
+	Secret   string            // Stored encrypted in the password column
+	Notes    string            // Stored encrypted in the notes column
+	Fields   map[string]string // Type-specific field values keyed by TypeField.Key
+	FolderID int               // Folder to store the entry in (0 if unfiled)
+}
+
+// ValidateTypedEntry checks a typed entry against its schema
+func ValidateTypedEntry(entry *TypedEntry) error {
+	schema, err := GetEntrySchema(entry.Type)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(entry.Title) == "" {
+		return fmt.Errorf("%w: %s", ErrMissingField, schema.TitleLabel)
+	}
+	if schema.SecretLabel != "" && !schema.SecretOptional && entry.Secret == "" {
+		return fmt.Errorf("%w: %s", ErrMissingField, schema.SecretLabel)
+	}
+
+	for _, field := range schema.Fields {
+		value := entry.Fields[field.Key]
+		if field.Required && strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%w: %s", ErrMissingField, field.Label)
+		}
+		if err := ValidateFieldValue(field.Type, value); err != nil {
+			return fmt.Errorf("%s: %w", field.Label, err)
+		}
+	}
+
+	if schema.validate != nil {
+		return schema.validate(entry)
+	}
+
+	return nil
+}
+
+// StoreTypedEntry validates, encrypts and stores a typed entry with its fields in one transaction
+func StoreTypedEntry(db *sql.DB, encryptionKey string, entry *TypedEntry) (*PasswordInformation, error) {
+	err := ValidateTypedEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	schema, _ := GetEntrySchema(entry.Type)
+
+	encryptedSecret, err := encryption.Encrypt(entry.Secret, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptedNotes := ""
+	if entry.Notes != "" {
+		encryptedNotes, err = encryption.Encrypt(entry.Notes, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := insertEntry(tx, PasswordEntry{
+		Service:           strings.TrimSpace(entry.Title),
+		Username:          entry.Username,
+		EncryptedPassword: encryptedSecret,
+		EncryptedNotes:    encryptedNotes,
+		FolderID:          entry.FolderID,
+		EntryType:         schema.Type,
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	// Every non-empty type-specific field becomes an encrypted custom field
+	for _, field := range schema.Fields {
+		value := entry.Fields[field.Key]
+		if value == "" {
+			continue
+		}
+
+		encryptedValue, err := encryption.Encrypt(value, encryptionKey)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+
+		_, err = insertCustomField(tx, stored.ID, CustomFieldEntry{
+			Name:           field.Label,
+			Type:           field.Type,
+			EncryptedValue: encryptedValue,
+		})
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error storing typed entry: %v", err)
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// GetTypedEntry retrieves and decrypts an entry and its type-specific fields
+func GetTypedEntry(db *sql.DB, encryptionKey string, id int) (*TypedEntry, error) {
+	stored, err := GetEntryFromID(db, id)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := GetEntrySchema(stored.EntryType)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &TypedEntry{
+		ID:       stored.ID,
+		Type:     schema.Type,
+		Title:    stored.Service,
+		Username: stored.Username,
+		Fields:   make(map[string]string),
+		FolderID: stored.FolderID,
+	}
+
+	entry.Secret, err = encryption.Decrypt(stored.EncryptedPassword, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if stored.EncryptedNotes != "" {
+		entry.Notes, err = encryption.Decrypt(stored.EncryptedNotes, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Match stored custom fields back to schema keys by label
+	fields, err := GetCustomFields(db, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		for _, schemaField := range schema.Fields {
+			if field.Name != schemaField.Label {
+				continue
+			}
+			value, err := encryption.Decrypt(field.EncryptedValue, encryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			entry.Fields[schemaField.Key] = value
+		}
+	}
+
+	return entry, nil
+}
+
+// =-- Type-Specific Validation --= //
+
+// ValidLuhn returns whether a card number (spaces and dashes allowed) passes the Luhn checksum
+func ValidLuhn(number string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if len(digits) < 12 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// ParseCardExpiry parses an MM/YY or MM/YYYY expiry into the last moment the card is valid
+func ParseCardExpiry(expiry string) (time.Time, error) {
+	parts := strings.Split(strings.TrimSpace(expiry), "/")
+	if len(parts) != 2 {
+		return time.Time{}, ErrInvalidCardExpiry
+	}
+
+	month, err := strconv.Atoi(parts[0])
+	if err != nil || month < 1 || month > 12 {
+		return time.Time{}, ErrInvalidCardExpiry
+	}
+
+	year, err := strconv.Atoi(parts[1])
+	if err != nil || (len(parts[1]) != 2 && len(parts[1]) != 4) {
+		return time.Time{}, ErrInvalidCardExpiry
+	}
+	if len(parts[1]) == 2 {
+		year += 2000
+	}
+
+	// Cards are valid until the end of the expiry month
+	return time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), nil
+}
+
+// validateCard checks the card number checksum and expiry format
+func validateCard(entry *TypedEntry) error {
+	if !ValidLuhn(entry.Secret) {
+		return ErrInvalidCardNumber
+	}
+
+	_, err := ParseCardExpiry(entry.Fields["expiry"])
+	return err
+}
+
+// validateSSHKey checks the private key is PEM encoded and the public key (if any) parses
+func validateSSHKey(entry *TypedEntry) error {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(entry.Secret)))
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return fmt.Errorf("%w: private key must be PEM encoded", ErrInvalidSSHKey)
+	}
+
+	if publicKey := strings.TrimSpace(entry.Fields["public_key"]); publicKey != "" {
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSSHKey, err)
+		}
+	}
+
+	return nil
+}
+
+// validateDatabase checks the port is in range
+func validateDatabase(entry *TypedEntry) error {
+	port := strings.TrimSpace(entry.Fields["port"])
+	if port == "" {
+		return nil
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return ErrInvalidPort
+	}
+
+	return nil
+}
+
+// validateWiFi checks SSID length and the passphrase length required by the security mode
+func validateWiFi(entry *TypedEntry) error {
+	if len(entry.Title) > 32 {
+		return fmt.Errorf("%w: SSID longer than 32 bytes", ErrInvalidWiFi)
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(entry.Fields["security"])) {
+	case "", "WPA", "WPA2", "WPA3":
+		if len(entry.Secret) < 8 || len(entry.Secret) > 63 {
+			return fmt.Errorf("%w: WPA passphrase must be 8 to 63 characters", ErrInvalidWiFi)
+		}
+	case "WEP", "OPEN":
+	default:
+		return fmt.Errorf("%w: unknown security mode %q", ErrInvalidWiFi, entry.Fields["security"])
+	}
+
+	return nil
+}
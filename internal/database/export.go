@@ -0,0 +1,437 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ExportExtension is the file extension of encrypted vault exports
+const ExportExtension = ".plockdb"
+
+// exportMagic starts every export file
+var exportMagic = []byte("PLOCKDB\x00")
+
+const (
+	exportVersion       = 1
+	exportCipher        = "aes-256-gcm-stream"
+	exportKDF           = "argon2id"
+	maxExportHeaderSize = 64 * 1024
+)
+
+var (
+	ErrNotExport          = errors.New("file is not a PassLock vault export")
+	ErrExportVersion      = errors.New("unsupported vault export version")
+	ErrExportAuth         = errors.New("wrong export password or corrupted export")
+	ErrExportInvalidVault = errors.New("export does not contain a valid vault")
+)
+
+// =-- Export File Format --= //
+
+// An export file is the magic bytes, a big-endian uint32 header length, the JSON header, and then the
+// serialized SQLite vault encrypted as a chunked stream. The stream is authenticated together with
+// everything before it, so the header cannot be changed either.
+
+// ExportInfo is the unencrypted header of an export file
+type ExportInfo struct {
+	Version    int       `json:"version"`     // Export format version
+	VaultName  string    `json:"vault_name"`  // Name of the exported vault
+	ExportedAt time.Time `json:"exported_at"` // When the export was written (UTC)
+	Cipher     string    `json:"cipher"`      // Content encryption, exportCipher
+	KDF        string    `json:"kdf"`         // Key derivation function, exportKDF
+	KDFTime    uint32    `json:"kdf_time"`    // Argon2 iterations
+	KDFMemory  uint32    `json:"kdf_memory"`  // Argon2 memory cost (KB)
+	KDFThreads uint8     `json:"kdf_threads"` // Argon2 threads
+	Salt       string    `json:"salt"`        // Key derivation salt
+	Size       int64     `json:"size"`        // Serialized vault size in bytes
+}
+
+// kdfParams returns the Argon2 parameters recorded in the header
+func (info *ExportInfo) kdfParams() encryption.Argon2Params {
+	return encryption.Argon2Params{
+		Time:    info.KDFTime,
+		Memory:  info.KDFMemory,
+		Threads: info.KDFThreads,
+		KeyLen:  encryption.DefaultArgon2Params.KeyLen,
+	}
+}
+
+// =-- Export and Import Functions --= //
+
+// ExportVault writes a vault to destPath as a single file encrypted with an export password that is
+// independent of the vault's master password
+func ExportVault(vaultName string, destPath string, exportPassword string, params encryption.Argon2Params) error {
+	if exportPassword == "" {
+		return errors.New("export password cannot be empty")
+	}
+
+	path, err := existingVaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+	session, err := openReadSession(path)
+	if err != nil {
+		return err
+	}
+	defer func(session *VaultSession) {
+		err := session.Close()
+		if err != nil {
+			log.Printf("Error closing vault %s: %v", vaultName, err)
+		}
+	}(session)
+
+	image, err := serializeDatabase(session.DB)
+	if err != nil {
+		log.Printf("Error serializing vault %s: %v", vaultName, err)
+		return err
+	}
+
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		return err
+	}
+	key, _, err := encryption.DeriveMasterKeysWithParams(exportPassword, salt, params)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(ExportInfo{
+		Version:    exportVersion,
+		VaultName:  vaultName,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Cipher:     exportCipher,
+		KDF:        exportKDF,
+		KDFTime:    params.Time,
+		KDFMemory:  params.Memory,
+		KDFThreads: params.Threads,
+		Salt:       salt,
+		Size:       int64(len(image)),
+	})
+	if err != nil {
+		return err
+	}
+
+	var output bytes.Buffer
+	output.Write(exportMagic)
+	_ = binary.Write(&output, binary.BigEndian, uint32(len(header)))
+	output.Write(header)
+	associatedData := bytes.Clone(output.Bytes())
+
+	encrypter, err := encryption.NewEncryptWriter(&output, key, associatedData)
+	if err != nil {
+		return err
+	}
+	_, err = encrypter.Write(image)
+	if err == nil {
+		err = encrypter.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(destPath, output.Bytes(), 0600)
+	if err != nil {
+		log.Printf("Error writing export %s: %v", destPath, err)
+		return err
+	}
+
+	return nil
+}
+
+// ReadExportInfo reads the unencrypted header of an export file
+func ReadExportInfo(path string) (*ExportInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, _, err := readExportHeader(bufio.NewReader(file))
+	return info, err
+}
+
+// ImportVault decrypts an export file and installs it into the vault directory. The vault is named
+// vaultName, or the exported name if empty; if that name is taken a free name such as "Name (2)" is
+// chosen. The installed vault name is returned.
+func ImportVault(srcPath string, exportPassword string, vaultName string) (string, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	info, associatedData, err := readExportHeader(reader)
+	if err != nil {
+		return "", err
+	}
+
+	key, _, err := encryption.DeriveMasterKeysWithParams(exportPassword, info.Salt, info.kdfParams())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotExport, err)
+	}
+
+	decrypter, err := encryption.NewDecryptReader(reader, key, associatedData)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotExport, err)
+	}
+	image, err := io.ReadAll(decrypter)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrExportAuth, err)
+	}
+	if int64(len(image)) != info.Size {
+		return "", fmt.Errorf("%w: size mismatch", ErrExportAuth)
+	}
+
+	err = validateVaultImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	if vaultName == "" {
+		vaultName = info.VaultName
+	}
+	vaultName, err = uniqueVaultName(vaultName)
+	if err != nil {
+		return "", err
+	}
+
+	return vaultName, installVaultImage(vaultName, image)
+}
+
+// =-- Export Helpers --= //
+
+// readExportHeader reads and checks the header, returning it with the bytes the stream is bound to
+func readExportHeader(reader io.Reader) (*ExportInfo, []byte, error) {
+	prefix := make([]byte, len(exportMagic)+4)
+	_, err := io.ReadFull(reader, prefix)
+	if err != nil || !bytes.Equal(prefix[:len(exportMagic)], exportMagic) {
+		return nil, nil, ErrNotExport
+	}
+
+	headerSize := binary.BigEndian.Uint32(prefix[len(exportMagic):])
+	if headerSize == 0 || headerSize > maxExportHeaderSize {
+		return nil, nil, ErrNotExport
+	}
+	header := make([]byte, headerSize)
+	_, err = io.ReadFull(reader, header)
+	if err != nil {
+		return nil, nil, ErrNotExport
+	}
+
+	var info ExportInfo
+	err = json.Unmarshal(header, &info)
+	if err != nil {
+		return nil, nil, ErrNotExport
+	}
+	if info.Version != exportVersion || info.Cipher != exportCipher || info.KDF != exportKDF {
+		return nil, nil, fmt.Errorf("%w: version %d (%s, %s)", ErrExportVersion, info.Version, info.Cipher, info.KDF)
+	}
+	// The header is only authenticated once the key is derived, so its parameters are checked first
+	if err := info.kdfParams().Validate(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNotExport, err)
+	}
+
+	return &info, append(prefix, header...), nil
+}
+
+// uniqueVaultName returns vaultName, or the first free "vaultName (n)" if it is taken
+func uniqueVaultName(vaultName string) (string, error) {
+	err := ValidateVaultName(vaultName)
+	if err != nil {
+		return "", err
+	}
+
+	candidate := vaultName
+	for n := 2; ; n++ {
+		path, err := VaultPath(candidate)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)", vaultName, n)
+	}
+}
+
+// installVaultImage writes a serialized vault to a new vault file and names it vaultName
+func installVaultImage(vaultName string, image []byte) error {
+	path, err := VaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrVaultExists, vaultName)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(image)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Opening the vault also upgrades exports written by older versions
+		err = setStoredVaultName(path, vaultName)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		log.Printf("Error installing vault %s: %v", vaultName, err)
+		return err
+	}
+
+	return nil
+}
+
+// validateVaultImage checks that a serialized database is intact and contains vault metadata
+func validateVaultImage(image []byte) error {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return errors.New("not an SQLite connection")
+		}
+		return sqliteConn.Deserialize(image, "main")
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExportInvalidVault, err)
+	}
+
+	var integrity string
+	err = conn.QueryRowContext(context.Background(), "PRAGMA integrity_check;").Scan(&integrity)
+	if err != nil || integrity != "ok" {
+		return fmt.Errorf("%w: integrity check failed", ErrExportInvalidVault)
+	}
+
+	var metadataRows int
+	err = conn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM vault_metadata;").Scan(&metadataRows)
+	if err != nil || metadataRows == 0 {
+		return fmt.Errorf("%w: missing vault metadata", ErrExportInvalidVault)
+	}
+
+	return nil
+}
+
+// serializeDatabase returns a consistent image of an open database file
+func serializeDatabase(db *sql.DB) ([]byte, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var image []byte
+	err = conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return errors.New("not an SQLite connection")
+		}
+		image, err = sqliteConn.Serialize("main")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Images of WAL vaults cannot be deserialized, mark them as rollback journal databases (the file format
+	// read and write versions in the header), opening the installed file switches it back to WAL
+	if len(image) >= 20 {
+		image[18], image[19] = 1, 1
+	}
+
+	return image, nil
+}
+
+// DefaultExportName returns the suggested export file name for a vault
+func DefaultExportName(vaultName string) string {
+	return vaultName + "-" + time.Now().Format("2006-01-02") + ExportExtension
+}
+
+// =-- Plaintext Export Records --= //
+
+// PlaintextExport records an unencrypted export of a vault's entries
+type PlaintextExport struct {
+	ID         int    // Unique ID
+	Format     string // File format (e.g., "json")
+	Path       string // File the entries were written to
+	Entries    int    // Number of entries exported
+	ExportedAt string // Timestamp of the export
+}
+
+// RecordPlaintextExport notes in the vault that its entries were written unencrypted to path
+func RecordPlaintextExport(db *sql.DB, format string, path string, entries int) error {
+	_, err := db.Exec("INSERT INTO plaintext_exports (format, path, entries) VALUES (?, ?, ?);", format, path, entries)
+	if err != nil {
+		log.Printf("Error recording plaintext export: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListPlaintextExports returns every recorded plaintext export, newest first
+func ListPlaintextExports(db *sql.DB) ([]*PlaintextExport, error) {
+	rows, err := db.Query("SELECT id, format, path, entries, exported_at FROM plaintext_exports ORDER BY id DESC;")
+	if err != nil {
+		log.Printf("Error listing plaintext exports: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var exports []*PlaintextExport
+	for rows.Next() {
+		export := &PlaintextExport{}
+		err = rows.Scan(&export.ID, &export.Format, &export.Path, &export.Entries, &export.ExportedAt)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =-- Custom Field Types --= //
+
+// FieldType identifies how a custom field value is validated and displayed
+type FieldType string
+
+const (
+	FieldText   FieldType = "text"   // Plain text
+	FieldHidden FieldType = "hidden" // Secret, hidden like passwords until revealed
+	FieldURL    FieldType = "url"    // Absolute URL (e.g., "https://example.com")
+	FieldEmail  FieldType = "email"  // Email address
+	FieldDate   FieldType = "date"   // Date in DateFormat
+	FieldNumber FieldType = "number" // Integer or decimal number
+)
+
+// DateFormat is the layout used for FieldDate values
+const DateFormat = "2006-01-02"
+
+// FieldTypes lists every supported custom field type in display order
+var FieldTypes = []FieldType{FieldText, FieldHidden, FieldURL, FieldEmail, FieldDate, FieldNumber}
+
+var (
+	ErrInvalidFieldType  = errors.New("invalid custom field type")
+	ErrInvalidFieldValue = errors.New("invalid custom field value")
+	ErrEmptyFieldName    = errors.New("custom field name cannot be empty")
+)
+
+// IsSecret returns whether values of this type should be hidden until revealed
+func (fieldType FieldType) IsSecret() bool {
+	return fieldType == FieldHidden
+}
+
+// Valid returns whether fieldType is a supported custom field type
+func (fieldType FieldType) Valid() bool {
+	for _, known := range FieldTypes {
+		if fieldType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFieldValue checks a plaintext value against its field type (call before encrypting)
+func ValidateFieldValue(fieldType FieldType, value string) error {
+	if !fieldType.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidFieldType, fieldType)
+	}
+
+	// Empty values are allowed for every type
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	switch fieldType {
+	case FieldURL:
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%w: %q is not an absolute URL", ErrInvalidFieldValue, value)
+		}
+	case FieldEmail:
+		address, err := mail.ParseAddress(value)
+		if err != nil || address.Address != value {
+			return fmt.Errorf("%w: %q is not an email address", ErrInvalidFieldValue, value)
+		}
+	case FieldDate:
+		if _, err := time.Parse(DateFormat, value); err != nil {
+			return fmt.Errorf("%w: %q is not a date (YYYY-MM-DD)", ErrInvalidFieldValue, value)
+		}
+	case FieldNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%w: %q is not a number", ErrInvalidFieldValue, value)
+		}
+	}
+
+	return nil
+}
+
+// =-- Custom Field Data Structures --= //
+
+// CustomField stores information for **output** custom field rows
+type CustomField struct {
+	ID             int       // Unique ID
+	EntryID        int       // Entry the field belongs to
+	Name           string    // Field name (e.g., "Account number")
+	Type           FieldType // Field type
+	EncryptedValue string    // Encrypted value
+	Position       int       // Display order within the entry
+}
+
+// CustomFieldEntry stores information for **input** custom fields
+type CustomFieldEntry struct {
+	Name           string    // Field name (e.g., "Account number")
+	Type           FieldType // Field type
+	EncryptedValue string    // Encrypted value
+}
+
+// customFieldColumns lists the custom_fields table columns read by scanCustomField, in order
+const customFieldColumns = "id, entry_id, name, field_type, value, position"
+
+// scanCustomField scans a row selected with customFieldColumns into a CustomField struct
+func scanCustomField(row rowScanner) (*CustomField, error) {
+	var field CustomField
+	var fieldType string
+	err := row.Scan(&field.ID, &field.EntryID, &field.Name, &fieldType, &field.EncryptedValue, &field.Position)
+	if err != nil {
+		return nil, err
+	}
+	field.Type = FieldType(fieldType)
+
+	return &field, nil
+}
+
+// =-- Custom Field Management Functions --= //
+
+// AddCustomField appends a custom field to an entry and returns the stored field
+func AddCustomField(db *sql.DB, entryID int, field CustomFieldEntry) (*CustomField, error) {
+	err := checkCustomField(field)
+	if err != nil {
+		return nil, err
+	}
+
+	return insertCustomField(db, entryID, field)
+}
+
+// insertCustomField inserts a validated custom field using either a database or a transaction
+func insertCustomField(q execQuerier, entryID int, field CustomFieldEntry) (*CustomField, error) {
+	// New fields are displayed after existing ones
+	result, err := q.Exec(`
+	INSERT INTO custom_fields (entry_id, name, field_type, value, position)
+	VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM custom_fields WHERE entry_id = ?));`,
+		entryID, strings.TrimSpace(field.Name), string(field.Type), field.EncryptedValue, entryID)
+	if err != nil {
+		log.Printf("Error adding custom field to entry %d: %v", entryID, err)
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error retrieving last insert ID: %v", err)
+		return nil, err
+	}
+
+	row := q.QueryRow("SELECT "+customFieldColumns+" FROM custom_fields WHERE id = ? LIMIT 1;", lastID)
+	return scanCustomField(row)
+}
+
+// GetCustomField retrieves a custom field from its unique ID
+func GetCustomField(db *sql.DB, id int) (*CustomField, error) {
+	row := db.QueryRow("SELECT "+customFieldColumns+" FROM custom_fields WHERE id = ? LIMIT 1;", id)
+
+	field, err := scanCustomField(row)
+	if err != nil {
+		log.Printf("Error fetching custom field with ID %d: %v", id, err)
+		return nil, err
+	}
+
+	return field, nil
+}
+
+// GetCustomFields returns the custom fields of an entry in display order
+func GetCustomFields(db *sql.DB, entryID int) ([]*CustomField, error) {
+	rows, err := db.Query(
+		"SELECT "+customFieldColumns+" FROM custom_fields WHERE entry_id = ? ORDER BY position, id;",
+		entryID)
+	if err != nil {
+		log.Printf("Error fetching custom fields for entry %d: %v", entryID, err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var fields []*CustomField
+	for rows.Next() {
+		field, err := scanCustomField(rows)
+		if err != nil {
+			log.Printf("Error reading custom field row: %v", err)
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// UpdateCustomField replaces the name, type and value of a custom field
+func UpdateCustomField(db *sql.DB, id int, field CustomFieldEntry) error {
+	err := checkCustomField(field)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE custom_fields SET name = ?, field_type = ?, value = ? WHERE id = ?;",
+		strings.TrimSpace(field.Name), string(field.Type), field.EncryptedValue, id)
+	if err != nil {
+		log.Printf("Error updating custom field with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteCustomField deletes a custom field from its unique ID
+func DeleteCustomField(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM custom_fields WHERE id = ?;", id)
+	if err != nil {
+		log.Printf("Error deleting custom field with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// checkCustomField validates the parts of a custom field that are stored unencrypted
+func checkCustomField(field CustomFieldEntry) error {
+	if strings.TrimSpace(field.Name) == "" {
+		return ErrEmptyFieldName
+	}
+	if !field.Type.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidFieldType, field.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+)
+
+// =-- Folder Errors --= //
+
+var (
+	ErrEmptyFolderName = errors.New("folder name cannot be empty")
+	ErrFolderExists    = errors.New("a folder with this name already exists in the parent folder")
+	ErrFolderCycle     = errors.New("a folder cannot be moved into itself or one of its subfolders")
+)
+
+// =-- Folder Data Structures --= //
+
+// Folder stores information for a single (possibly nested) folder
+type Folder struct {
+	ID           int    // Unique ID
+	Name         string // Display name
+	ParentID     int    // Parent folder ID (0 for top-level folders)
+	CreatedAt    string // Timestamp for folder creation
+	UUID         string // Stable ID used for sync
+	ModifiedAt   string // Timestamp of the last change (UTC)
+	Version      int64  // Logical clock value of the last change
+	RotationDays int    // Days between password rotations in the folder, or RotationInherit or RotationNever
+}
+
+// folderColumns lists the folders table columns read by scanFolder, in order
+const folderColumns = "id, name, parent_id, created_at, uuid, modified_at, version, rotation_days"
+
+// scanFolder scans a row selected with folderColumns into a Folder struct
+func scanFolder(row rowScanner) (*Folder, error) {
+	var folder Folder
+	var parentID, version sql.NullInt64
+	var uuid, modifiedAt sql.NullString
+	err := row.Scan(&folder.ID, &folder.Name, &parentID, &folder.CreatedAt, &uuid, &modifiedAt, &version, &folder.RotationDays)
+	if err != nil {
+		return nil, err
+	}
+	folder.ParentID = int(parentID.Int64)
+	folder.UUID = uuid.String
+	folder.ModifiedAt = modifiedAt.String
+	folder.Version = version.Int64
+
+	return &folder, nil
+}
+
+// =-- Folder Management Functions --= //
+
+// CreateFolder creates a folder named name inside parentID (0 for top-level) and returns it
+func CreateFolder(db *sql.DB, name string, parentID int) (*Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrEmptyFolderName
+	}
+
+	// Sibling folders must have unique names
+	err := checkFolderNameFree(db, name, parentID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?);", name, nullableID(parentID))
+	if err != nil {
+		log.Printf("Error creating folder '%s': %v", name, err)
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error retrieving last insert ID: %v", err)
+		return nil, err
+	}
+
+	return GetFolder(db, int(lastID))
+}
+
+// GetFolder retrieves a folder from its unique ID
+func GetFolder(db *sql.DB, id int) (*Folder, error) {
+	row := db.QueryRow("SELECT "+folderColumns+" FROM folders WHERE id = ? LIMIT 1;", id)
+
+	folder, err := scanFolder(row)
+	if err != nil {
+		log.Printf("Error fetching folder with ID %d: %v", id, err)
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+// ListFolders returns every folder in the vault ordered by name
+func ListFolders(db *sql.DB) ([]*Folder, error) {
+	rows, err := db.Query("SELECT " + folderColumns + " FROM folders ORDER BY name COLLATE NOCASE;")
+	if err != nil {
+		log.Printf("Error fetching folders: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var folders []*Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			log.Printf("Error reading folder row: %v", err)
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating over rows: %v", err)
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// RenameFolder changes the name of a folder
+func RenameFolder(db *sql.DB, id int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrEmptyFolderName
+	}
+
+	folder, err := GetFolder(db, id)
+	if err != nil {
+		return err
+	}
+
+	err = checkFolderNameFree(db, name, folder.ParentID, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE folders SET name = ? WHERE id = ?;", name, id)
+	if err != nil {
+		log.Printf("Error renaming folder with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// MoveFolder moves a folder (and its subfolders) into newParentID (0 for top-level)
+func MoveFolder(db *sql.DB, id int, newParentID int) error {
+	folder, err := GetFolder(db, id)
+	if err != nil {
+		return err
+	}
+
+	// Walk up from the new parent to make sure the folder is not one of its ancestors
+	for ancestorID := newParentID; ancestorID != 0; {
+		if ancestorID == id {
+			return ErrFolderCycle
+		}
+		ancestor, err := GetFolder(db, ancestorID)
+		if err != nil {
+			return err
+		}
+		ancestorID = ancestor.ParentID
+	}
+
+	err = checkFolderNameFree(db, folder.Name, newParentID, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE folders SET parent_id = ? WHERE id = ?;", nullableID(newParentID), id)
+	if err != nil {
+		log.Printf("Error moving folder with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteFolder deletes a folder and its subfolders, entries inside them become unfiled
+func DeleteFolder(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM folders WHERE id = ?;", id)
+	if err != nil {
+		log.Printf("Error deleting folder with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// MoveEntryToFolder assigns an entry to a folder, folderID 0 removes it from any folder
+func MoveEntryToFolder(db *sql.DB, entryID int, folderID int) error {
+	_, err := db.Exec("UPDATE passwords SET folder_id = ? WHERE id = ?;", nullableID(folderID), entryID)
+	if err != nil {
+		log.Printf("Error moving entry %d to folder %d: %v", entryID, folderID, err)
+		return err
+	}
+
+	return nil
+}
+
+// GetEntriesInFolder returns the entries in a folder (0 for unfiled), including subfolders if recursive
+func GetEntriesInFolder(db *sql.DB, folderID int, recursive bool) ([]*PasswordInformation, error) {
+	var rows *sql.Rows
+	var err error
+
+	switch {
+	case folderID == 0:
+		rows, err = db.Query("SELECT " + entryColumns + " FROM passwords WHERE folder_id IS NULL;")
+	case recursive:
+		// Collect the folder and all of its descendants with a recursive CTE
+		rows, err = db.Query(`
+		WITH RECURSIVE subtree(id) AS (
+		    SELECT ?
+		    UNION ALL
+		    SELECT folders.id FROM folders JOIN subtree ON folders.parent_id = subtree.id
+		)
+		SELECT `+entryColumns+` FROM passwords WHERE folder_id IN (SELECT id FROM subtree);`, folderID)
+	default:
+		rows, err = db.Query("SELECT "+entryColumns+" FROM passwords WHERE folder_id = ?;", folderID)
+	}
+	if err != nil {
+		log.Printf("Error fetching entries for folder %d: %v", folderID, err)
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+// GetFolderPath returns the names from the top-level folder down to the given folder
+func GetFolderPath(db *sql.DB, id int) ([]string, error) {
+	var path []string
+	for id != 0 {
+		folder, err := GetFolder(db, id)
+		if err != nil {
+			return nil, err
+		}
+		path = append([]string{folder.Name}, path...)
+		id = folder.ParentID
+	}
+
+	return path, nil
+}
+
+// checkFolderNameFree returns ErrFolderExists if a sibling other than exceptID already uses name
+func checkFolderNameFree(db *sql.DB, name string, parentID int, exceptID int) error {
+	var count int
+	err := db.QueryRow(`
+	SELECT COUNT(*) FROM folders
+	WHERE name = ? COLLATE NOCASE AND parent_id IS ? AND id != ?;`,
+		name, nullableID(parentID), exceptID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrFolderExists
+	}
+
+	return nil
+}
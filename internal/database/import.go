@@ -0,0 +1,243 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Import Data Structures --= //
+
+// ImportField stores a decrypted custom field of an imported entry
+type ImportField struct {
+	Name  string    // Field name
+	Type  FieldType // Field type (text if empty)
+	Value string    // Plaintext value
+}
+
+// ImportAttachment stores a file attached to an imported entry
+type ImportAttachment struct {
+	Name string // File name
+	Data []byte // Plaintext contents
+}
+
+// ImportRecord stores the decrypted contents of an entry read from another password manager
+type ImportRecord struct {
+	Service     string             // Service (e.g., "github.com")
+	Username    string             // Username for the account
+	Password    string             // Plaintext password
+	Notes       string             // Plaintext notes
+	EntryType   EntryType          // Kind of entry (defaults to EntryLogin)
+	Folder      []string           // Folder path from the top level (empty if unfiled)
+	Tags        []string           // Tag names
+	Fields      []ImportField      // Custom fields in display order
+	Attachments []ImportAttachment // Attached files
+	ChangedAt   time.Time          // Time the password was last changed in the source (zero if unknown)
+}
+
+// ImportSummary reports what ImportEntries added to a vault
+type ImportSummary struct {
+	Imported       int // Entries added
+	FoldersCreated int // Folders created for the entries
+}
+
+// =-- Import Functions --= //
+
+// ImportEntries encrypts and stores records in a single transaction, creating missing folders. Nothing is
+// stored if any record fails. File-backed vaults are backed up first.
+func ImportEntries(db *sql.DB, encryptionKey string, records []ImportRecord) (*ImportSummary, error) {
+	for i, record := range records {
+		err := checkImportRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+
+	err := backupOpenVault(db, BackupImport)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ImportSummary{}
+	folderIDs := make(map[string]int)
+	for i, record := range records {
+		err = importRecord(tx, encryptionKey, record, folderIDs, summary)
+		if err != nil {
+			_ = tx.Rollback()
+			log.Printf("Error importing record %d: %v", i+1, err)
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+
+	err = appendAudit(tx, encryptionKey, []AuditRecord{{Event: AuditImport, Detail: fmt.Sprintf("%d entries", summary.Imported)}})
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error auditing import: %v", err)
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing import: %v", err)
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// checkImportRecord validates the unencrypted parts of a record before anything is written
+func checkImportRecord(record ImportRecord) error {
+	if strings.TrimSpace(record.Service) == "" {
+		return errors.New("service cannot be empty")
+	}
+	if record.EntryType != "" {
+		if _, err := GetEntrySchema(record.EntryType); err != nil {
+			return err
+		}
+	}
+	for _, field := range record.Fields {
+		if field.Type == "" {
+			field.Type = FieldText
+		}
+		err := checkCustomField(CustomFieldEntry{Name: field.Name, Type: field.Type})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importRecord encrypts and inserts a single record with its folder, fields, attachments and tags
+func importRecord(tx *sql.Tx, encryptionKey string, record ImportRecord, folderIDs map[string]int, summary *ImportSummary) error {
+	folderID, err := ensureFolderPath(tx, record.Folder, folderIDs, summary)
+	if err != nil {
+		return err
+	}
+
+	encryptedPassword, err := encryption.Encrypt(record.Password, encryptionKey)
+	if err != nil {
+		return err
+	}
+	encryptedNotes := ""
+	if record.Notes != "" {
+		encryptedNotes, err = encryption.Encrypt(record.Notes, encryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A change time in the future would postpone rotation indefinitely, so it counts as unknown
+	changedAt := record.ChangedAt
+	if changedAt.After(time.Now()) {
+		changedAt = time.Time{}
+	}
+
+	stored, err := insertEntry(tx, PasswordEntry{
+		Service:           strings.TrimSpace(record.Service),
+		Username:          record.Username,
+		EncryptedPassword: encryptedPassword,
+		EncryptedNotes:    encryptedNotes,
+		FolderID:          folderID,
+		EntryType:         record.EntryType,
+		PasswordChangedAt: changedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, field := range record.Fields {
+		if field.Type == "" {
+			field.Type = FieldText
+		}
+		encryptedValue, err := encryption.Encrypt(field.Value, encryptionKey)
+		if err != nil {
+			return err
+		}
+		_, err = insertCustomField(tx, stored.ID, CustomFieldEntry{
+			Name:           field.Name,
+			Type:           field.Type,
+			EncryptedValue: encryptedValue,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, attachment := range record.Attachments {
+		_, err = insertAttachment(tx, encryptionKey, stored.ID, attachment.Name, bytes.NewReader(attachment.Data))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range record.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		err = tagEntry(tx, stored.ID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary.Imported++
+	return nil
+}
+
+// ensureFolderPath returns the ID of a nested folder, creating missing folders along the path
+func ensureFolderPath(tx *sql.Tx, path []string, folderIDs map[string]int, summary *ImportSummary) (int, error) {
+	parentID := 0
+	key := ""
+
+	for _, name := range path {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		// Folder names are unique per parent regardless of case
+		key += "/" + strings.ToLower(name)
+		if id, ok := folderIDs[key]; ok {
+			parentID = id
+			continue
+		}
+
+		var id int
+		err := tx.QueryRow(
+			"SELECT id FROM folders WHERE name = ? COLLATE NOCASE AND parent_id IS ? LIMIT 1;",
+			name, nullableID(parentID)).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			result, err := tx.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?);", name, nullableID(parentID))
+			if err != nil {
+				log.Printf("Error creating folder '%s': %v", name, err)
+				return 0, err
+			}
+			lastID, err := result.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+			id = int(lastID)
+			summary.FoldersCreated++
+		} else if err != nil {
+			return 0, err
+		}
+
+		folderIDs[key] = id
+		parentID = id
+	}
+
+	return parentID, nil
+}
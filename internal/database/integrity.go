@@ -0,0 +1,609 @@
+package database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// ErrQuarantineNotFound is returned when a quarantined entry does not exist
+var ErrQuarantineNotFound = errors.New("quarantined entry not found")
+
+// IssueKind groups the problems an integrity check can find
+type IssueKind string
+
+const (
+	IssueStorage  IssueKind = "storage"  // Damaged database pages, indexes or references
+	IssueSchema   IssueKind = "schema"   // Missing tables or columns, or an unknown schema version
+	IssueMetadata IssueKind = "metadata" // Unusable unlock or sync information
+	IssueAudit    IssueKind = "audit"    // Audit log that cannot be read or verified
+	IssueEntry    IssueKind = "entry"    // Entry whose encrypted values cannot be decrypted
+)
+
+// integrityTables lists the tables every migrated vault has
+var integrityTables = []string{
+	"passwords", "vault_metadata", "folders", "tags", "entry_tags", "custom_fields", "attachments",
+	"attachment_chunks", "plaintext_exports", "audit_log", "audit_state", "audit_failed_unlocks", "sync_state",
+	"sync_tombstones", "sync_peers", "sync_base", "sync_conflicts", "quarantine",
+}
+
+// =-- Integrity Data Structures --= //
+
+// IntegrityIssue is a single problem found by an integrity check
+type IntegrityIssue struct {
+	Kind    IssueKind // Kind of problem
+	EntryID int       // Affected entry (0 unless Kind is IssueEntry)
+	Service string    // Service of the affected entry
+	Detail  string    // Description of the problem
+}
+
+// IntegrityReport is the result of an integrity check
+type IntegrityReport struct {
+	Entries     int              // Entries checked
+	Quarantined int              // Entries already in quarantine
+	Issues      []IntegrityIssue // Problems found (empty if the vault is healthy)
+}
+
+// QuarantinedEntry is an entry moved out of the vault because it could not be decrypted
+type QuarantinedEntry struct {
+	ID            int    // Unique ID
+	UUID          string // UUID the entry had in the vault
+	Service       string // Service of the entry
+	Username      string // Username of the entry
+	Reason        string // Problem that caused the quarantine
+	QuarantinedAt string // Timestamp the entry was quarantined
+}
+
+// quarantineRecord stores every row of a quarantined entry exactly as it was, values still encrypted
+type quarantineRecord struct {
+	Entry       *PasswordInformation    `json:"entry"`
+	Fields      []*CustomField          `json:"fields,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Attachments []quarantinedAttachment `json:"attachments,omitempty"`
+}
+
+// quarantinedAttachment stores an attachment of a quarantined entry with its encrypted chunks
+type quarantinedAttachment struct {
+	Attachment *Attachment `json:"attachment"`
+	StreamID   []byte      `json:"stream_id"`
+	Chunks     [][]byte    `json:"chunks"`
+}
+
+// Healthy reports whether the check found no problems
+func (report *IntegrityReport) Healthy() bool {
+	return len(report.Issues) == 0
+}
+
+// CorruptEntries returns the IDs of the entries that can be quarantined
+func (report *IntegrityReport) CorruptEntries() []int {
+	var ids []int
+	for _, issue := range report.Issues {
+		if issue.Kind == IssueEntry {
+			ids = append(ids, issue.EntryID)
+		}
+	}
+	return ids
+}
+
+// =-- Integrity Check Functions --= //
+
+// CheckVaultIntegrity verifies an unlocked vault: the SQLite file structure and references, the schema, the
+// vault metadata, the audit log and every encrypted entry value. Problems are reported rather than returned
+// as errors, an error means the check itself could not run.
+func CheckVaultIntegrity(db *sql.DB, encryptionKey string) (*IntegrityReport, error) {
+	report := &IntegrityReport{}
+
+	for _, check := range []func(*sql.DB, string, *IntegrityReport) error{
+		checkStorage, checkSchema, checkMetadata, checkAudit, checkEntries,
+	} {
+		err := check(db, encryptionKey, report)
+		if err != nil {
+			log.Printf("Error checking vault integrity: %v", err)
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// add records a problem in the report
+func (report *IntegrityReport) add(kind IssueKind, detail string) {
+	report.Issues = append(report.Issues, IntegrityIssue{Kind: kind, Detail: detail})
+}
+
+// checkStorage runs SQLite's own structure and foreign key checks
+func checkStorage(db *sql.DB, _ string, report *IntegrityReport) error {
+	err := queryEach(db, "PRAGMA integrity_check;", func(rows *sql.Rows) error {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			report.add(IssueStorage, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return queryEach(db, "PRAGMA foreign_key_check;", func(rows *sql.Rows) error {
+		var table, parent string
+		var rowID sql.NullInt64
+		var foreignKey int
+		if err := rows.Scan(&table, &rowID, &parent, &foreignKey); err != nil {
+			return err
+		}
+		report.add(IssueStorage, fmt.Sprintf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent))
+		return nil
+	})
+}
+
+// checkSchema makes sure every migration was applied and the tables and columns read by PassLock exist
+func checkSchema(db *sql.DB, _ string, report *IntegrityReport) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		report.add(IssueSchema, fmt.Sprintf("schema version is %d, expected %d", version, len(migrations)))
+	}
+
+	tables := make(map[string]bool)
+	err = queryEach(db, "SELECT name FROM sqlite_master WHERE type = 'table';", func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		tables[name] = true
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, table := range integrityTables {
+		if !tables[table] {
+			report.add(IssueSchema, "table "+table+" is missing")
+		}
+	}
+
+	// Selecting no rows still fails if a column is missing
+	for table, columns := range map[string]string{
+		"passwords":     entryColumns,
+		"folders":       folderColumns,
+		"custom_fields": customFieldColumns,
+		"attachments":   attachmentColumns,
+	} {
+		if !tables[table] {
+			continue
+		}
+		_, err := db.Exec("SELECT " + columns + " FROM " + table + " LIMIT 0;")
+		if err != nil {
+			report.add(IssueSchema, fmt.Sprintf("table %s is missing columns: %v", table, err))
+		}
+	}
+
+	return nil
+}
+
+// checkMetadata makes sure the vault can be unlocked and synced
+func checkMetadata(db *sql.DB, _ string, report *IntegrityReport) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM vault_metadata;").Scan(&count)
+	if err != nil {
+		report.add(IssueMetadata, fmt.Sprintf("vault metadata cannot be read: %v", err))
+		return nil
+	}
+	if count != 1 {
+		report.add(IssueMetadata, fmt.Sprintf("vault metadata has %d rows, expected 1", count))
+		if count == 0 {
+			return nil
+		}
+	}
+
+	var vaultName, authKey, salt string
+	params := encryption.DefaultArgon2Params
+	err = db.QueryRow("SELECT vault_name, auth_key, salt, kdf_time, kdf_memory, kdf_threads FROM vault_metadata LIMIT 1;").Scan(
+		&vaultName, &authKey, &salt, &params.Time, &params.Memory, &params.Threads)
+	if err != nil {
+		report.add(IssueMetadata, fmt.Sprintf("vault metadata cannot be read: %v", err))
+		return nil
+	}
+	if err := ValidateVaultName(vaultName); err != nil {
+		report.add(IssueMetadata, err.Error())
+	}
+	if authKey == "" || salt == "" {
+		report.add(IssueMetadata, "authentication key or salt is empty")
+	}
+	if err := params.Validate(); err != nil {
+		report.add(IssueMetadata, fmt.Sprintf("key derivation settings are invalid: %v", err))
+	}
+
+	var vaultID string
+	err = db.QueryRow("SELECT vault_id FROM sync_state WHERE id = 1;").Scan(&vaultID)
+	if err != nil || vaultID == "" {
+		report.add(IssueMetadata, "vault ID for sync is missing")
+	}
+
+	return nil
+}
+
+// checkAudit verifies the audit log chain
+func checkAudit(db *sql.DB, encryptionKey string, report *IntegrityReport) error {
+	_, err := ReadAuditLog(db, encryptionKey)
+	if err != nil {
+		report.add(IssueAudit, err.Error())
+	}
+	return nil
+}
+
+// checkEntries decrypts the password, notes and custom field values of every entry
+func checkEntries(db *sql.DB, encryptionKey string, report *IntegrityReport) error {
+	err := db.QueryRow("SELECT COUNT(*) FROM quarantine;").Scan(&report.Quarantined)
+	if err != nil {
+		return err
+	}
+
+	problems := make(map[int][]string)
+	var order []int
+	services := make(map[int]string)
+	note := func(id int, problem string) {
+		if _, ok := problems[id]; !ok {
+			order = append(order, id)
+		}
+		problems[id] = append(problems[id], problem)
+	}
+
+	err = queryEach(db, "SELECT id, service, password, notes FROM passwords ORDER BY id;", func(rows *sql.Rows) error {
+		var id int
+		var service, password, notes sql.NullString
+		if err := rows.Scan(&id, &service, &password, &notes); err != nil {
+			return err
+		}
+		report.Entries++
+		services[id] = service.String
+
+		if _, err := encryption.Decrypt(password.String, encryptionKey); err != nil {
+			note(id, "password cannot be decrypted")
+		}
+		if notes.String != "" {
+			if _, err := encryption.Decrypt(notes.String, encryptionKey); err != nil {
+				note(id, "notes cannot be decrypted")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = queryEach(db, "SELECT entry_id, name, value FROM custom_fields ORDER BY entry_id, position, id;", func(rows *sql.Rows) error {
+		var entryID int
+		var name, value sql.NullString
+		if err := rows.Scan(&entryID, &name, &value); err != nil {
+			return err
+		}
+		if _, err := encryption.Decrypt(value.String, encryptionKey); err != nil {
+			note(entryID, fmt.Sprintf("custom field %q cannot be decrypted", name.String))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		report.Issues = append(report.Issues, IntegrityIssue{
+			Kind:    IssueEntry,
+			EntryID: id,
+			Service: services[id],
+			Detail:  strings.Join(problems[id], ", "),
+		})
+	}
+
+	return nil
+}
+
+// =-- Quarantine Functions --= //
+
+// QuarantineEntries moves the corrupt entries found by a check out of the vault, with their fields, tags
+// and attachments, into the quarantine table. The vault is backed up first. Quarantined entries are also
+// forgotten by sync, so the next sync restores them from a healthy copy instead of deleting them there.
+func QuarantineEntries(db *sql.DB, encryptionKey string, report *IntegrityReport) (int, error) {
+	reasons := make(map[int]string)
+	var ids []int
+	for _, issue := range report.Issues {
+		if issue.Kind == IssueEntry {
+			ids = append(ids, issue.EntryID)
+			reasons[issue.EntryID] = issue.Detail
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	err := backupOpenVault(db, BackupRepair)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var records []AuditRecord
+	for _, id := range ids {
+		entry, err := quarantineEntry(tx, id, reasons[id])
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already removed since the check
+			continue
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			log.Printf("Error quarantining entry %d: %v", id, err)
+			return 0, err
+		}
+		records = append(records, AuditRecord{Event: AuditQuarantine, EntryID: id, Service: entry.Service, Detail: reasons[id]})
+	}
+
+	err = appendAudit(tx, encryptionKey, records)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(records), nil
+}
+
+// quarantineEntry copies an entry's rows into the quarantine table and deletes the entry
+func quarantineEntry(tx *sql.Tx, id int, reason string) (*PasswordInformation, error) {
+	entry, err := scanEntry(tx.QueryRow("SELECT "+entryColumns+" FROM passwords WHERE id = ?;", id))
+	if err != nil {
+		return nil, err
+	}
+	record := quarantineRecord{Entry: entry}
+
+	err = queryEach(tx, "SELECT "+customFieldColumns+" FROM custom_fields WHERE entry_id = ? ORDER BY position, id;",
+		func(rows *sql.Rows) error {
+			field, err := scanCustomField(rows)
+			record.Fields = append(record.Fields, field)
+			return err
+		}, id)
+	if err != nil {
+		return nil, err
+	}
+	err = queryEach(tx, "SELECT t.name FROM tags t JOIN entry_tags et ON et.tag_id = t.id WHERE et.entry_id = ? ORDER BY t.name;",
+		func(rows *sql.Rows) error {
+			var name string
+			err := rows.Scan(&name)
+			record.Tags = append(record.Tags, name)
+			return err
+		}, id)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := []string{entry.UUID}
+	err = queryEach(tx, "SELECT "+attachmentColumns+", stream_id FROM attachments WHERE entry_id = ? ORDER BY id;",
+		func(rows *sql.Rows) error {
+			var attachment quarantinedAttachment
+			var uuid, modifiedAt sql.NullString
+			var version sql.NullInt64
+			attachment.Attachment = &Attachment{}
+			err := rows.Scan(&attachment.Attachment.ID, &attachment.Attachment.EntryID, &attachment.Attachment.Name,
+				&attachment.Attachment.Size, &attachment.Attachment.CreatedAt, &uuid, &modifiedAt, &version, &attachment.StreamID)
+			attachment.Attachment.UUID = uuid.String
+			attachment.Attachment.ModifiedAt = modifiedAt.String
+			attachment.Attachment.Version = version.Int64
+			record.Attachments = append(record.Attachments, attachment)
+			uuids = append(uuids, uuid.String)
+			return err
+		}, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range record.Attachments {
+		attachment := &record.Attachments[i]
+		err = queryEach(tx, "SELECT data FROM attachment_chunks WHERE attachment_id = ? ORDER BY seq;", func(rows *sql.Rows) error {
+			var chunk []byte
+			err := rows.Scan(&chunk)
+			attachment.Chunks = append(attachment.Chunks, chunk)
+			return err
+		}, attachment.Attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO quarantine (entry_uuid, service, username, reason, record) VALUES (?, ?, ?, ?, ?);",
+		entry.UUID, entry.Service, entry.Username, reason, string(data))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("DELETE FROM passwords WHERE id = ?;", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a tombstone or common ancestor, sync treats the entry as missing here rather than deleted
+	for _, uuid := range uuids {
+		for _, query := range []string{
+			"DELETE FROM sync_tombstones WHERE uuid = ?;",
+			"DELETE FROM sync_base WHERE uuid = ?;",
+			"DELETE FROM sync_conflicts WHERE uuid = ?;",
+		} {
+			if _, err := tx.Exec(query, uuid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entry, nil
+}
+
+// reencryptQuarantine re-encrypts the values of quarantined entries that still decrypt with the old key.
+// Values that do not are left as they are, they were the reason for the quarantine.
+func reencryptQuarantine(tx *sql.Tx, oldKey string, newKey string) error {
+	records := make(map[int]string)
+	err := queryEach(tx, "SELECT id, record FROM quarantine;", func(rows *sql.Rows) error {
+		var id int
+		var data string
+		err := rows.Scan(&id, &data)
+		records[id] = data
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, data := range records {
+		var record quarantineRecord
+		err := json.Unmarshal([]byte(data), &record)
+		if err != nil {
+			log.Printf("Error reading quarantined entry %d: %v", id, err)
+			return err
+		}
+
+		if record.Entry != nil {
+			record.Entry.EncryptedPassword, err = reencryptIfReadable(record.Entry.EncryptedPassword, oldKey, newKey)
+			if err != nil {
+				return err
+			}
+			record.Entry.EncryptedNotes, err = reencryptIfReadable(record.Entry.EncryptedNotes, oldKey, newKey)
+			if err != nil {
+				return err
+			}
+		}
+		for _, field := range record.Fields {
+			field.EncryptedValue, err = reencryptIfReadable(field.EncryptedValue, oldKey, newKey)
+			if err != nil {
+				return err
+			}
+		}
+		for i := range record.Attachments {
+			err = record.Attachments[i].reencrypt(oldKey, newKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		updated, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE quarantine SET record = ? WHERE id = ?;", string(updated), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reencryptIfReadable re-encrypts a value from oldKey to newKey, returning it unchanged if it is empty or
+// does not decrypt
+func reencryptIfReadable(ciphertext string, oldKey string, newKey string) (string, error) {
+	if ciphertext == "" {
+		return ciphertext, nil
+	}
+	plaintext, err := encryption.Decrypt(ciphertext, oldKey)
+	if err != nil {
+		return ciphertext, nil
+	}
+
+	return encryption.Encrypt(plaintext, newKey)
+}
+
+// reencrypt rewrites the chunks of a quarantined attachment under a new stream ID if they decrypt with
+// oldKey, leaving damaged attachments as they are
+func (attachment *quarantinedAttachment) reencrypt(oldKey string, newKey string) error {
+	decrypter, err := encryption.NewDecryptReader(bytes.NewReader(bytes.Join(attachment.Chunks, nil)), oldKey, attachment.StreamID)
+	if err != nil {
+		return nil
+	}
+	var plaintext bytes.Buffer
+	if _, err := io.Copy(&plaintext, decrypter); err != nil {
+		return nil
+	}
+
+	streamID := make([]byte, 16)
+	if _, err := rand.Read(streamID); err != nil {
+		return err
+	}
+	chunks := &chunkCollector{}
+	encrypter, err := encryption.NewEncryptWriter(chunks, newKey, streamID)
+	if err != nil {
+		return err
+	}
+	if _, err := encrypter.Write(plaintext.Bytes()); err != nil {
+		return err
+	}
+	if err := encrypter.Close(); err != nil {
+		return err
+	}
+
+	attachment.StreamID = streamID
+	attachment.Chunks = chunks.chunks
+	return nil
+}
+
+// chunkCollector keeps every write as a separate chunk, like the rows written by chunkWriter
+type chunkCollector struct {
+	chunks [][]byte
+}
+
+// Write stores a copy of p as the next chunk
+func (c *chunkCollector) Write(p []byte) (int, error) {
+	c.chunks = append(c.chunks, bytes.Clone(p))
+	return len(p), nil
+}
+
+// ListQuarantine returns the quarantined entries, oldest first
+func ListQuarantine(db *sql.DB) ([]*QuarantinedEntry, error) {
+	var entries []*QuarantinedEntry
+	err := queryEach(db, "SELECT id, entry_uuid, service, username, reason, quarantined_at FROM quarantine ORDER BY id;",
+		func(rows *sql.Rows) error {
+			var entry QuarantinedEntry
+			var uuid sql.NullString
+			err := rows.Scan(&entry.ID, &uuid, &entry.Service, &entry.Username, &entry.Reason, &entry.QuarantinedAt)
+			entry.UUID = uuid.String
+			entries = append(entries, &entry)
+			return err
+		})
+	if err != nil {
+		log.Printf("Error reading quarantine: %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// DeleteQuarantined permanently deletes a quarantined entry
+func DeleteQuarantined(db *sql.DB, id int) error {
+	result, err := db.Exec("DELETE FROM quarantine WHERE id = ?;", id)
+	if err != nil {
+		log.Printf("Error deleting quarantined entry: %v", err)
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrQuarantineNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// JSONFileFormat identifies single-file JSON vaults
+const JSONFileFormat = "passlock-json"
+
+// jsonFileVersion is the current single-file JSON vault format version
+const jsonFileVersion = 1
+
+// ErrNotJSONVault is returned when a file is not a PassLock JSON vault
+var ErrNotJSONVault = errors.New("file is not a PassLock JSON vault")
+
+// =-- Single-File Encrypted JSON Backend --= //
+
+// jsonFile is the on-disk layout, metadata stays readable so the vault can be unlocked
+type jsonFile struct {
+	Format   string         `json:"format"`
+	Version  int            `json:"version"`
+	Metadata *VaultMetadata `json:"metadata,omitempty"`
+	Data     string         `json:"data"` // AES-GCM encrypted jsonContents
+}
+
+// jsonContents is the encrypted part of the file
+type jsonContents struct {
+	NextID  int                   `json:"next_id"`
+	Entries []PasswordInformation `json:"entries"`
+}
+
+// JSONFileStore is a Store kept in a single encrypted JSON file for portability
+type JSONFileStore struct {
+	memory        *MemoryStore
+	path          string
+	encryptionKey string
+	mutex         sync.Mutex
+}
+
+// OpenJSONFileStore opens (or creates on first write) a JSON vault file, decrypting it with encryptionKey
+func OpenJSONFileStore(path string, encryptionKey string) (*JSONFileStore, error) {
+	store := &JSONFileStore{
+		memory:        NewMemoryStore(),
+		path:          path,
+		encryptionKey: encryptionKey,
+	}
+
+	file, err := readJSONFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := encryption.Decrypt(file.Data, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	var contents jsonContents
+	err = json.Unmarshal([]byte(plaintext), &contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range contents.Entries {
+		store.memory.entries[entry.ID] = entry
+	}
+	store.memory.nextID = contents.NextID
+	store.memory.metadata = file.Metadata
+
+	return store, nil
+}
+
+// ReadJSONFileMetadata reads the unencrypted metadata of a JSON vault file (needed before unlocking)
+func ReadJSONFileMetadata(path string) (*VaultMetadata, error) {
+	file, err := readJSONFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.Metadata == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return file.Metadata, nil
+}
+
+// readJSONFile reads and checks the outer layout of a JSON vault file
+func readJSONFile(path string) (*jsonFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file jsonFile
+	err = json.Unmarshal(data, &file)
+	if err != nil || file.Format != JSONFileFormat {
+		return nil, ErrNotJSONVault
+	}
+	if file.Version > jsonFileVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrNotJSONVault, file.Version)
+	}
+
+	return &file, nil
+}
+
+// save encrypts the current contents and atomically replaces the file
+func (store *JSONFileStore) save() error {
+	store.memory.mutex.RLock()
+	contents := jsonContents{NextID: store.memory.nextID}
+	for _, entry := range sortedEntries(store.memory.entries) {
+		contents.Entries = append(contents.Entries, *entry)
+	}
+	metadata := store.memory.metadata
+	store.memory.mutex.RUnlock()
+
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	data, err := encryption.Encrypt(string(plaintext), store.encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(jsonFile{
+		Format:   JSONFileFormat,
+		Version:  jsonFileVersion,
+		Metadata: metadata,
+		Data:     data,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path, output, 0600)
+}
+
+// update applies a change to the in-memory copy and saves the file, undoing the change if saving fails so
+// memory never holds entries the file does not
+func (store *JSONFileStore) update(change func() error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.memory.mutex.RLock()
+	entries := make(map[int]PasswordInformation, len(store.memory.entries))
+	for id, entry := range store.memory.entries {
+		entries[id] = entry
+	}
+	nextID, metadata := store.memory.nextID, store.memory.metadata
+	store.memory.mutex.RUnlock()
+
+	err := change()
+	if err == nil {
+		err = store.save()
+		if err != nil {
+			store.memory.mutex.Lock()
+			store.memory.entries, store.memory.nextID, store.memory.metadata = entries, nextID, metadata
+			store.memory.mutex.Unlock()
+		}
+	}
+
+	return err
+}
+
+// StorePassword stores a new entry and saves the file
+func (store *JSONFileStore) StorePassword(entry PasswordEntry) (*PasswordInformation, error) {
+	var stored *PasswordInformation
+	err := store.update(func() error {
+		var err error
+		stored, err = store.memory.StorePassword(entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// GetEntryFromID returns a single entry
+func (store *JSONFileStore) GetEntryFromID(id int) (*PasswordInformation, error) {
+	return store.memory.GetEntryFromID(id)
+}
+
+// GetEntriesFromService returns every entry with the given service
+func (store *JSONFileStore) GetEntriesFromService(service string) ([]*PasswordInformation, error) {
+	return store.memory.GetEntriesFromService(service)
+}
+
+// GetAllEntries returns every entry ordered by ID
+func (store *JSONFileStore) GetAllEntries() ([]*PasswordInformation, error) {
+	return store.memory.GetAllEntries()
+}
+
+// DeleteEntryFromID deletes a single entry and saves the file
+func (store *JSONFileStore) DeleteEntryFromID(id int) error {
+	return store.update(func() error {
+		return store.memory.DeleteEntryFromID(id)
+	})
+}
+
+// ClearDatabase deletes every entry and saves the file
+func (store *JSONFileStore) ClearDatabase() error {
+	return store.update(store.memory.ClearDatabase)
+}
+
+// GetMetadata returns the vault metadata
+func (store *JSONFileStore) GetMetadata() (*VaultMetadata, error) {
+	return store.memory.GetMetadata()
+}
+
+// SetMetadata replaces the vault metadata and saves the file
+func (store *JSONFileStore) SetMetadata(metadata VaultMetadata) error {
+	return store.update(func() error {
+		return store.memory.SetMetadata(metadata)
+	})
+}
+
+// Close forgets the in-memory copy, everything is already saved
+func (store *JSONFileStore) Close() error {
+	store.encryptionKey = ""
+	return store.memory.Close()
+}
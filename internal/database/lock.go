@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// ErrVaultLocked is returned when another process has a vault open for writing
+var ErrVaultLocked = errors.New("vault is open for writing in another process")
+
+// errLockHeld is returned by lockFile when another open file holds the lock
+var errLockHeld = errors.New("lock is held")
+
+// lockFileSuffix is appended to a vault's path to name its advisory lock file
+const lockFileSuffix = ".lock"
+
+// =-- Vault Sessions --= //
+
+// VaultSession is a vault opened for the duration of a user session. Only one session at a time, across
+// all processes, can write to a vault, any other session is opened read-only.
+type VaultSession struct {
+	DB       *sql.DB // Open vault, also usable with the package-level functions
+	Path     string  // Vault file path
+	ReadOnly bool    // Whether another process holds the write lock, in which case writes fail
+
+	lock *fileLock
+}
+
+// OpenVaultSession opens an existing vault by name for a session
+func OpenVaultSession(vaultName string) (*VaultSession, error) {
+	path, err := existingVaultPath(vaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenVaultFileSession(path)
+}
+
+// OpenVaultFileSession opens an existing vault file for a session, taking its write lock if it is free and
+// falling back to read-only otherwise
+func OpenVaultFileSession(path string) (*VaultSession, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, path)
+	}
+
+	lock, err := acquireLock(path)
+	if errors.Is(err, ErrVaultLocked) {
+		return openReadOnlySession(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openVaultFile(path, true)
+	if err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+
+	return &VaultSession{DB: db, Path: path, lock: lock}, nil
+}
+
+// openReadOnlySession opens a vault another process is writing to
+func openReadOnlySession(path string) (*VaultSession, error) {
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older vaults cannot be upgraded without the write lock
+	pending, err := needsMigration(db)
+	if err == nil && pending {
+		err = ErrVaultLocked
+	}
+	if err != nil {
+		_ = db.Close()
+		log.Printf("Error opening vault %s read-only: %v", path, err)
+		return nil, err
+	}
+
+	log.Printf("Vault %s is open in another process, opened read-only", path)
+	return &VaultSession{DB: db, Path: path, ReadOnly: true}, nil
+}
+
+// openReadSession opens an existing vault file to read it, holding a shared lock so it is not written to,
+// restored or migrated meanwhile. A vault another process is writing to is opened read-only instead, and
+// one that still needs migrating is opened for writing.
+func openReadSession(path string) (*VaultSession, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, path)
+	}
+
+	lock, err := acquireReadLock(path)
+	if errors.Is(err, ErrVaultLocked) {
+		return openReadOnlySession(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+	pending, err := needsMigration(db)
+	if err != nil || pending {
+		_ = db.Close()
+		_ = lock.release()
+		if err != nil {
+			return nil, err
+		}
+		// Migrating takes the write lock, which the shared lock would refuse
+		return OpenVaultFileSession(path)
+	}
+
+	return &VaultSession{DB: db, Path: path, ReadOnly: true, lock: lock}, nil
+}
+
+// Close closes the vault and releases its lock
+func (session *VaultSession) Close() error {
+	err := session.DB.Close()
+	if session.lock != nil {
+		if lockErr := session.lock.release(); err == nil {
+			err = lockErr
+		}
+		session.lock = nil
+	}
+
+	return err
+}
+
+// =-- Advisory File Locks --= //
+
+// fileLock is an exclusive or shared advisory lock on a vault's lock file
+type fileLock struct {
+	file *os.File
+}
+
+// acquireLock takes the write lock of a vault without waiting, returning ErrVaultLocked if it is held.
+// Locks belong to an open file, so a second session in the same process is also refused.
+func acquireLock(vaultPath string) (*fileLock, error) {
+	return lockVault(vaultPath, true)
+}
+
+// acquireReadLock takes a shared lock of a vault without waiting, returning ErrVaultLocked if the write
+// lock is held. Any number of readers can hold it, but no session can write while they do.
+func acquireReadLock(vaultPath string) (*fileLock, error) {
+	return lockVault(vaultPath, false)
+}
+
+// lockVault takes the exclusive or shared lock of a vault without waiting
+func lockVault(vaultPath string, exclusive bool) (*fileLock, error) {
+	file, err := os.OpenFile(vaultPath+lockFileSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		log.Printf("Error opening lock file of vault %s: %v", vaultPath, err)
+		return nil, err
+	}
+
+	err = lockFile(file, exclusive)
+	if err != nil {
+		_ = file.Close()
+		if errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("%w: %s", ErrVaultLocked, vaultPath)
+		}
+		log.Printf("Error locking vault %s: %v", vaultPath, err)
+		return nil, err
+	}
+
+	return &fileLock{file: file}, nil
+}
+
+// release unlocks and closes the lock file (it is left in place, removing it would race with new lockers)
+func (lock *fileLock) release() error {
+	err := unlockFile(lock.file)
+	if closeErr := lock.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package database
+
+import "os"
+
+// lockFile does nothing on platforms without file locks, every session can write
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile does nothing on platforms without file locks
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// sqliteSideFiles are the suffixes of files SQLite may keep next to a vault
+var sqliteSideFiles = []string{"-journal", "-wal", "-shm"}
+
+// =-- Vault Management Functions --= //
+
+// RenameVault renames a vault file in place and updates the name stored in its metadata
+func RenameVault(oldName string, newName string) error {
+	oldPath, err := existingVaultPath(oldName)
+	if err != nil {
+		return err
+	}
+	err = ValidateVaultName(newName)
+	if err != nil {
+		return err
+	}
+
+	// The vault stays in its directory, only the file name changes
+	newPath := filepath.Join(filepath.Dir(oldPath), newName+VaultExtension)
+	err = checkRenameTarget(newName, oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	// A vault open in another process cannot be renamed under it
+	lock, err := acquireLock(oldPath)
+	if err != nil {
+		return err
+	}
+	defer removeLock(lock, oldPath)
+
+	err = setStoredVaultName(oldPath, newName)
+	if err != nil {
+		return err
+	}
+
+	err = renameVaultFiles(oldPath, newPath)
+	if err != nil {
+		// Put the old name back so the metadata matches the file again
+		if revertErr := setStoredVaultName(oldPath, oldName); revertErr != nil {
+			log.Printf("Error restoring name of vault %s: %v", oldName, revertErr)
+		}
+		log.Printf("Error renaming vault %s: %v", oldName, err)
+		return err
+	}
+
+	// Backups follow the vault to its new name
+	err = os.Rename(backupDirectory(oldPath), backupDirectory(newPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error moving backups of vault %s: %v", oldName, err)
+	}
+
+	// Keep the registration and archive flag under the new name
+	return updateRegistry(func(registry *vaultRegistry) error {
+		if _, ok := registry.Vaults[oldName]; ok {
+			delete(registry.Vaults, oldName)
+			registry.Vaults[newName] = newPath
+		}
+		if registry.Archived[oldName] {
+			delete(registry.Archived, oldName)
+			registry.Archived[newName] = true
+		}
+		return nil
+	})
+}
+
+// CloneVault copies a vault into the vault directory under a new name, keeping the same master password
+func CloneVault(sourceName string, targetName string) error {
+	targetPath, lock, err := cloneVault(sourceName, targetName)
+	if err != nil {
+		return err
+	}
+	removeLock(lock, targetPath)
+
+	return nil
+}
+
+// CloneVaultWithKeys copies a vault into the vault directory under a new name and re-keys the copy, so it
+// is unlocked with a different master password. oldEncryptionKey is the source vault's encryption key.
+func CloneVaultWithKeys(sourceName string, targetName string, oldEncryptionKey string, newKeys VaultKeys) error {
+	targetPath, lock, err := cloneVault(sourceName, targetName)
+	if err != nil {
+		return err
+	}
+	defer removeLock(lock, targetPath)
+
+	// The copy is not backed up, a backup would still unlock with the old password
+	db, err := openVaultFile(targetPath, true)
+	if err == nil {
+		err = rekeyVaultTx(db, oldEncryptionKey, newKeys)
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		// Never leave a copy that is still unlocked by the old password
+		_ = os.Remove(targetPath)
+		return err
+	}
+
+	return nil
+}
+
+// cloneVault writes a consistent copy of a vault to the vault directory and returns its path, together with
+// the copy's write lock so nothing opens it before the caller is done with it
+func cloneVault(sourceName string, targetName string) (string, *fileLock, error) {
+	sourcePath, err := existingVaultPath(sourceName)
+	if err != nil {
+		return "", nil, err
+	}
+	targetPath, err := VaultPath(targetName)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(targetPath); err == nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrVaultExists, targetName)
+	}
+
+	session, err := openReadSession(sourcePath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func(session *VaultSession) {
+		err := session.Close()
+		if err != nil {
+			log.Printf("Error closing vault %s: %v", sourceName, err)
+		}
+	}(session)
+
+	lock, err := acquireLock(targetPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = createPrivateFile(targetPath)
+	if err != nil {
+		removeLock(lock, targetPath)
+		return "", nil, err
+	}
+
+	// VACUUM INTO writes a compacted, transactionally consistent copy
+	_, err = session.DB.Exec("VACUUM INTO ?;", targetPath)
+	if err != nil {
+		log.Printf("Error copying vault %s: %v", sourceName, err)
+	} else {
+		err = setStoredVaultName(targetPath, targetName)
+	}
+	if err != nil {
+		_ = os.Remove(targetPath)
+		removeLock(lock, targetPath)
+		return "", nil, err
+	}
+
+	return targetPath, lock, nil
+}
+
+// ArchiveVault hides a vault from ListVaults without deleting it
+func ArchiveVault(vaultName string) error {
+	_, err := existingVaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+
+	return updateRegistry(func(registry *vaultRegistry) error {
+		registry.Archived[vaultName] = true
+		return nil
+	})
+}
+
+// UnarchiveVault lists an archived vault again
+func UnarchiveVault(vaultName string) error {
+	return updateRegistry(func(registry *vaultRegistry) error {
+		if !registry.Archived[vaultName] {
+			return fmt.Errorf("%w: %s is not archived", ErrVaultNotFound, vaultName)
+		}
+		delete(registry.Archived, vaultName)
+		return nil
+	})
+}
+
+// ListArchivedVaults lists the archived vaults that still exist
+func ListArchivedVaults() ([]string, error) {
+	archived, err := archivedVaults()
+	if err != nil {
+		return nil, err
+	}
+	all, err := allVaults()
+	if err != nil {
+		return nil, err
+	}
+
+	var vaults []string
+	for _, vaultName := range all {
+		if archived[vaultName] {
+			vaults = append(vaults, vaultName)
+		}
+	}
+
+	return vaults, nil
+}
+
+// =-- Vault Management Helpers --= //
+
+// existingVaultPath returns the path of a vault, or ErrVaultNotFound if it does not exist
+func existingVaultPath(vaultName string) (string, error) {
+	path, err := VaultPath(vaultName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ErrVaultNotFound, vaultName)
+	}
+
+	return path, nil
+}
+
+// checkRenameTarget returns ErrVaultExists if newName or newPath belongs to a different vault
+func checkRenameTarget(newName string, oldPath string, newPath string) error {
+	oldInfo, err := os.Stat(oldPath)
+	if err != nil {
+		return err
+	}
+
+	// A case-only rename finds the vault itself on case-insensitive file systems
+	for _, path := range []string{newPath, GetDatabasePath(newName)} {
+		info, err := os.Stat(path)
+		if err == nil && !os.SameFile(info, oldInfo) {
+			return fmt.Errorf("%w: %s", ErrVaultExists, newName)
+		}
+	}
+
+	return nil
+}
+
+// setStoredVaultName updates the vault name stored in a vault's metadata. The caller holds the vault's
+// write lock.
+func setStoredVaultName(path string, vaultName string) error {
+	db, err := openVaultFile(path, true)
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}(db)
+
+	_, err = db.Exec("UPDATE vault_metadata SET vault_name = ?;", vaultName)
+	if err != nil {
+		log.Printf("Error updating vault metadata: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// removeLock releases a vault's lock and removes its lock file, once the vault file is gone
+func removeLock(lock *fileLock, vaultPath string) {
+	err := lock.release()
+	if err != nil {
+		log.Printf("Error releasing lock of vault %s: %v", vaultPath, err)
+	}
+	if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+		_ = os.Remove(vaultPath + lockFileSuffix)
+	}
+}
+
+// renameVaultFiles moves a vault file and any SQLite side files to a new path
+func renameVaultFiles(oldPath string, newPath string) error {
+	err := os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	for _, suffix := range sqliteSideFiles {
+		err := os.Rename(oldPath+suffix, newPath+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// =-- In-Memory Backend --= //
+
+// MemoryStore is a Store that keeps entries in memory only, for tests and ephemeral sessions
+type MemoryStore struct {
+	mutex    sync.RWMutex
+	entries  map[int]PasswordInformation
+	nextID   int
+	metadata *VaultMetadata
+}
+
+// NewMemoryStore returns an empty in-memory Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[int]PasswordInformation),
+		nextID:  1,
+	}
+}
+
+// StorePassword stores a new entry in memory
+func (store *MemoryStore) StorePassword(entry PasswordEntry) (*PasswordInformation, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored, err := storedEntry(store.nextID, entry)
+	if err != nil {
+		return nil, err
+	}
+	store.entries[stored.ID] = stored
+	store.nextID++
+
+	return &stored, nil
+}
+
+// GetEntryFromID returns a single entry
+func (store *MemoryStore) GetEntryFromID(id int) (*PasswordInformation, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	entry, ok := store.entries[id]
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+
+	return &entry, nil
+}
+
+// GetEntriesFromService returns every entry with the given service
+func (store *MemoryStore) GetEntriesFromService(service string) ([]*PasswordInformation, error) {
+	entries, err := store.GetAllEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*PasswordInformation
+	for _, entry := range entries {
+		if entry.Service == service {
+			matches = append(matches, entry)
+		}
+	}
+
+	return matches, nil
+}
+
+// GetAllEntries returns every entry ordered by ID
+func (store *MemoryStore) GetAllEntries() ([]*PasswordInformation, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return sortedEntries(store.entries), nil
+}
+
+// DeleteEntryFromID deletes a single entry
+func (store *MemoryStore) DeleteEntryFromID(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.entries[id]; !ok {
+		return ErrEntryNotFound
+	}
+	delete(store.entries, id)
+
+	return nil
+}
+
+// ClearDatabase deletes every entry (IDs are not reused, matching SQLite AUTOINCREMENT)
+func (store *MemoryStore) ClearDatabase() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.entries = make(map[int]PasswordInformation)
+
+	return nil
+}
+
+// GetMetadata returns the vault metadata
+func (store *MemoryStore) GetMetadata() (*VaultMetadata, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if store.metadata == nil {
+		return nil, sql.ErrNoRows
+	}
+	metadata := *store.metadata
+
+	return &metadata, nil
+}
+
+// SetMetadata creates or replaces the vault metadata
+func (store *MemoryStore) SetMetadata(metadata VaultMetadata) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.metadata = &metadata
+
+	return nil
+}
+
+// Close discards all entries
+func (store *MemoryStore) Close() error {
+	return store.ClearDatabase()
+}
+
+// =-- Shared Backend Helpers --= //
+
+// storedEntry converts an input entry into a stored entry with the given ID, a new UUID and the current
+// time, filled in the same way as the SQLite backend
+func storedEntry(id int, entry PasswordEntry) (PasswordInformation, error) {
+	if entry.EntryType == "" {
+		entry.EntryType = EntryLogin
+	}
+	uuid, err := newEntryUUID()
+	if err != nil {
+		return PasswordInformation{}, err
+	}
+
+	now := time.Now().UTC()
+	changedAt := now
+	if !entry.PasswordChangedAt.IsZero() {
+		changedAt = entry.PasswordChangedAt.UTC()
+	}
+
+	return PasswordInformation{
+		ID:                id,
+		Service:           entry.Service,
+		Username:          entry.Username,
+		EncryptedPassword: entry.EncryptedPassword,
+		EncryptedNotes:    entry.EncryptedNotes,
+		CreatedAt:         now.Format(time.RFC3339), // Format the SQLite driver reads CURRENT_TIMESTAMP in
+		FolderID:          entry.FolderID,
+		EntryType:         entry.EntryType,
+		UUID:              uuid,
+		ModifiedAt:        now.Format(syncTimeFormat),
+		PasswordChangedAt: changedAt.Format(syncTimeFormat),
+	}, nil
+}
+
+// newEntryUUID returns a random (version 4) UUID in the format of sqlNewUUID
+func newEntryUUID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	raw[6] = raw[6]&0x0f | 0x40
+	raw[8] = raw[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:16]), nil
+}
+
+// sortedEntries returns copies of the entries in a map ordered by ID
+func sortedEntries(entries map[int]PasswordInformation) []*PasswordInformation {
+	list := make([]*PasswordInformation, 0, len(entries))
+	for _, entry := range entries {
+		entry := entry
+		list = append(list, &entry)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].ID < list[b].ID
+	})
+
+	return list
+}
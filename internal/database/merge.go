@@ -0,0 +1,737 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+var (
+	ErrSyncVaultMismatch = errors.New("vault files are not copies of the same vault")
+	ErrSyncKeyMismatch   = errors.New("vault copies have different master passwords")
+	ErrSyncSameFile      = errors.New("cannot sync a vault file with itself")
+	ErrConflictNotFound  = errors.New("sync conflict not found")
+)
+
+// =-- Sync Data Structures --= //
+
+// SyncEntry stores the decrypted contents of an entry as compared when merging two copies of a vault
+type SyncEntry struct {
+	Service           string        `json:"service"`
+	Username          string        `json:"username"`
+	Password          string        `json:"password"`
+	Notes             string        `json:"notes,omitempty"`
+	EntryType         EntryType     `json:"entry_type"`
+	Folder            string        `json:"folder,omitempty"`              // Folder UUID (empty if unfiled)
+	Tags              []string      `json:"tags,omitempty"`                // Tag names ordered by name
+	Fields            []ImportField `json:"fields,omitempty"`              // Custom fields in display order
+	ExpiresAt         string        `json:"expires_at,omitempty"`          // Expiry date in DateFormat (empty if none)
+	ModifiedAt        string        `json:"modified_at,omitempty"`         // Time of the last change, not compared
+	PasswordChangedAt string        `json:"password_changed_at,omitempty"` // Time the password was last changed, not compared
+}
+
+// SyncConflict is an entry changed differently in two copies, left for the user to resolve
+type SyncConflict struct {
+	ID         int        // Unique ID
+	UUID       string     // Entry UUID
+	Peer       string     // Other copy the conflict was found with
+	Local      *SyncEntry // Entry in this copy (nil if deleted here)
+	Remote     *SyncEntry // Entry in the other copy (nil if deleted there)
+	DetectedAt string     // Timestamp the conflict was found
+}
+
+// SyncSummary reports what a sync changed
+type SyncSummary struct {
+	Pulled    int // Objects changed in this copy
+	Pushed    int // Objects changed in the other copy
+	Merged    int // Entries edited in both copies whose changes were combined
+	Conflicts int // Entries left for the user to resolve
+}
+
+// syncFolder stores a folder as compared when merging
+type syncFolder struct {
+	Name         string `json:"name"`
+	Parent       string `json:"parent,omitempty"` // Parent folder UUID (empty for top-level folders)
+	RotationDays int    `json:"rotation_days,omitempty"`
+	ModifiedAt   string `json:"modified_at,omitempty"`
+}
+
+// syncAttachment stores an attachment as compared when merging, attachments never change once added
+type syncAttachment struct {
+	Entry string `json:"entry"` // Entry UUID
+	Name  string `json:"name"`
+}
+
+// syncSnapshot is an object as it was after the last sync, the common ancestor of the next merge
+type syncSnapshot struct {
+	Kind       ChangeKind      `json:"kind"`
+	Entry      *SyncEntry      `json:"entry,omitempty"`
+	Folder     *syncFolder     `json:"folder,omitempty"`
+	Attachment *syncAttachment `json:"attachment,omitempty"`
+}
+
+// syncSide is one copy of the vault taking part in a merge, read and written inside a transaction
+type syncSide struct {
+	tx          *sql.Tx
+	folders     map[string]*syncFolder
+	entries     map[string]*SyncEntry
+	attachments map[string]*syncAttachment
+	tombstones  map[string]string // Deletion time by UUID
+}
+
+// syncer merges two copies of a vault
+type syncer struct {
+	local         *syncSide
+	remote        *syncSide
+	encryptionKey string
+	peer          string
+	base          map[string]*syncSnapshot // Common ancestors by UUID
+	conflicts     map[string]string        // Peer of every unresolved conflict by entry UUID
+	summary       SyncSummary
+}
+
+// =-- Sync Functions --= //
+
+// SyncVaults merges this vault with another copy of it at path, in both directions. Objects changed in
+// only one copy are taken from that copy, entries edited in both are merged field by field using the
+// state after the previous sync with that copy, and entries whose changes clash are recorded as
+// conflicts and left alone in both copies until resolved. The vault is backed up first.
+func SyncVaults(db *sql.DB, encryptionKey string, path string) (*SyncSummary, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return SyncVaultCopy(db, encryptionKey, path, path, nil)
+}
+
+// SyncVaultCopy merges this vault with a copy of it at path like SyncVaults, naming the copy peer in the
+// sync state. If publish is set it is called with the merged copy and the summary before this vault is
+// committed, and this vault is left unchanged if it fails (e.g., to upload a downloaded copy back).
+func SyncVaultCopy(db *sql.DB, encryptionKey string, path string, peer string, publish func(copy *sql.DB, summary *SyncSummary) error) (*SyncSummary, error) {
+	var localPath string
+	err := db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main';").Scan(&localPath)
+	if err != nil {
+		return nil, err
+	}
+	localInfo, localErr := os.Stat(localPath)
+	remoteInfo, remoteErr := os.Stat(path)
+	if localErr == nil && remoteErr == nil && os.SameFile(localInfo, remoteInfo) {
+		return nil, ErrSyncSameFile
+	}
+
+	session, err := OpenVaultFileSession(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(session *VaultSession) {
+		err := session.Close()
+		if err != nil {
+			log.Printf("Error closing vault %s: %v", path, err)
+		}
+	}(session)
+	if session.ReadOnly {
+		return nil, fmt.Errorf("%w: %s", ErrVaultLocked, path)
+	}
+
+	err = backupOpenVault(db, BackupSync)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncDatabases(db, session.DB, encryptionKey, peer, publish)
+}
+
+// WriteSyncCopy writes a consistent copy of an open vault to path without its own sync state, to start
+// a new shared copy of the vault
+func WriteSyncCopy(db *sql.DB, path string) error {
+	lock, err := acquireLock(path)
+	if err != nil {
+		return err
+	}
+	defer removeLock(lock, path)
+
+	err = createPrivateFile(path)
+	if err != nil {
+		return err
+	}
+
+	// VACUUM INTO writes a compacted, transactionally consistent copy
+	_, err = db.Exec("VACUUM INTO ?;", path)
+	if err != nil {
+		_ = os.Remove(path)
+		log.Printf("Error copying vault to %s: %v", path, err)
+		return err
+	}
+
+	copyDB, err := openVaultFile(path, true)
+	if err != nil {
+		return err
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}(copyDB)
+
+	// Common ancestors, conflicts and quarantined entries only concern this copy
+	_, err = copyDB.Exec("DELETE FROM sync_base; DELETE FROM sync_peers; DELETE FROM sync_conflicts; DELETE FROM quarantine;")
+	if err != nil {
+		log.Printf("Error clearing sync state of %s: %v", path, err)
+		return err
+	}
+
+	return nil
+}
+
+// syncDatabases merges two open copies of a vault, peer names the remote copy in this copy's sync state
+func syncDatabases(local *sql.DB, remote *sql.DB, encryptionKey string, peer string, publish func(copy *sql.DB, summary *SyncSummary) error) (*SyncSummary, error) {
+	err := checkSyncPeer(local, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	localTx, err := local.Begin()
+	if err != nil {
+		return nil, err
+	}
+	remoteTx, err := remote.Begin()
+	if err != nil {
+		_ = localTx.Rollback()
+		return nil, err
+	}
+
+	s := &syncer{
+		local:         &syncSide{tx: localTx},
+		remote:        &syncSide{tx: remoteTx},
+		encryptionKey: encryptionKey,
+		peer:          peer,
+	}
+	err = s.run()
+	if err != nil {
+		_ = remoteTx.Rollback()
+		_ = localTx.Rollback()
+		log.Printf("Error syncing with %s: %v", peer, err)
+		return nil, err
+	}
+
+	// The other copy is committed first, if this copy then fails the next sync finds both copies
+	// already agree on everything that was merged
+	err = remoteTx.Commit()
+	if err != nil {
+		_ = localTx.Rollback()
+		log.Printf("Error committing sync to %s: %v", peer, err)
+		return nil, err
+	}
+	if publish != nil {
+		err = publish(remote, &s.summary)
+		if err != nil {
+			_ = localTx.Rollback()
+			return nil, err
+		}
+	}
+	err = localTx.Commit()
+	if err != nil {
+		log.Printf("Error committing sync with %s: %v", peer, err)
+		return nil, err
+	}
+
+	return &s.summary, nil
+}
+
+// checkSyncPeer makes sure two databases are copies of one vault protected by the same master password
+func checkSyncPeer(local *sql.DB, remote *sql.DB) error {
+	var localID, localAuth, remoteID, remoteAuth string
+	query := "SELECT s.vault_id, m.auth_key FROM sync_state s, vault_metadata m LIMIT 1;"
+	err := local.QueryRow(query).Scan(&localID, &localAuth)
+	if err != nil {
+		return err
+	}
+	err = remote.QueryRow(query).Scan(&remoteID, &remoteAuth)
+	if err != nil {
+		return err
+	}
+
+	if localID != remoteID {
+		return ErrSyncVaultMismatch
+	}
+	if !sameAuthKey(localAuth, remoteAuth) {
+		return ErrSyncKeyMismatch
+	}
+
+	return nil
+}
+
+// run merges folders, then entries, then attachments, and stores the new common ancestors
+func (s *syncer) run() error {
+	err := s.loadState()
+	if err != nil {
+		return err
+	}
+
+	for _, side := range []*syncSide{s.local, s.remote} {
+		err = side.loadFolders()
+		if err != nil {
+			return err
+		}
+		err = side.loadTombstones()
+		if err != nil {
+			return err
+		}
+	}
+	err = s.mergeFolders()
+	if err != nil {
+		return err
+	}
+
+	// Entries are read after folders are merged, so both copies refer to the same folders
+	for _, side := range []*syncSide{s.local, s.remote} {
+		err = side.loadEntries(s.encryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.mergeEntries()
+	if err != nil {
+		return err
+	}
+
+	for _, side := range []*syncSide{s.local, s.remote} {
+		err = side.loadAttachments()
+		if err != nil {
+			return err
+		}
+	}
+	err = s.mergeAttachments()
+	if err != nil {
+		return err
+	}
+
+	err = s.saveState()
+	if err != nil {
+		return err
+	}
+
+	detail := fmt.Sprintf("%s: %d pulled, %d pushed, %d merged, %d conflicts",
+		s.peer, s.summary.Pulled, s.summary.Pushed, s.summary.Merged, s.summary.Conflicts)
+	return appendAudit(s.local.tx, s.encryptionKey, []AuditRecord{{Event: AuditSync, Detail: detail}})
+}
+
+// =-- Merging --= //
+
+// mergeFolders merges folders, folder edits that clash are resolved in favour of the latest one
+func (s *syncer) mergeFolders() error {
+	merged := make(map[string]*syncFolder)
+	for _, uuid := range syncUUIDs(s.base, ChangeFolder, s.local.folders, s.remote.folders) {
+		local, remote := s.local.folders[uuid], s.remote.folders[uuid]
+		var base *syncFolder
+		snapshot, hasBase := s.base[uuid]
+		if hasBase {
+			base = snapshot.Folder
+		}
+
+		var result *syncFolder
+		switch {
+		case sameFolder(local, remote):
+			result = local
+		case hasBase && sameFolder(local, base):
+			result = remote
+		case hasBase && sameFolder(remote, base):
+			result = local
+		case local != nil && remote != nil:
+			result = latestFolder(local, remote)
+			if hasBase && base != nil {
+				// Keep a rename from one copy and a move from the other
+				name, nameOK := mergeValue(base.Name, local.Name, remote.Name)
+				parent, parentOK := mergeValue(base.Parent, local.Parent, remote.Parent)
+				rotation, rotationOK := mergeValue(base.RotationDays, local.RotationDays, remote.RotationDays)
+				if nameOK && parentOK && rotationOK {
+					result = &syncFolder{Name: name, Parent: parent, RotationDays: rotation, ModifiedAt: result.ModifiedAt}
+				}
+			}
+		case local == nil:
+			// Deleted here, an edit in the other copy (or one made after the deletion) wins
+			result = remote
+			if !hasBase && !modifiedAfter(remote.ModifiedAt, s.local.tombstones[uuid]) {
+				result = nil
+			}
+		default:
+			result = local
+			if !hasBase && !modifiedAfter(local.ModifiedAt, s.remote.tombstones[uuid]) {
+				result = nil
+			}
+		}
+
+		if result != nil {
+			merged[uuid] = result
+			s.base[uuid] = &syncSnapshot{Kind: ChangeFolder, Folder: result}
+		} else {
+			delete(s.base, uuid)
+		}
+	}
+
+	for _, side := range []*syncSide{s.local, s.remote} {
+		changed, err := side.applyFolders(merged)
+		if err != nil {
+			return err
+		}
+		s.count(side, changed)
+	}
+
+	return nil
+}
+
+// mergeEntries merges entries, recording a conflict for every entry both copies changed differently
+func (s *syncer) mergeEntries() error {
+	for _, uuid := range syncUUIDs(s.base, ChangeEntry, s.local.entries, s.remote.entries) {
+		local, remote := s.local.entries[uuid], s.remote.entries[uuid]
+		var base *SyncEntry
+		snapshot, hasBase := s.base[uuid]
+		if hasBase {
+			base = snapshot.Entry
+		}
+
+		// Entries waiting for the user are left alone, the conflict is kept up to date with this peer
+		if peer, ok := s.conflicts[uuid]; ok {
+			if peer == s.peer && !sameEntry(remote, base) {
+				err := s.recordConflict(uuid, local, remote)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		result := local
+		conflict := false
+		merged := false
+		switch {
+		case sameEntry(local, remote):
+		case hasBase && sameEntry(local, base):
+			result = remote
+		case hasBase && sameEntry(remote, base):
+		case hasBase && base != nil && local != nil && remote != nil:
+			result, merged = mergeEntry(base, local, remote)
+			conflict = !merged
+		case !hasBase && local == nil:
+			// Only in the other copy: new there, or deleted here before the copies were ever synced (an
+			// edit made after the deletion keeps the entry)
+			result = remote
+			if deletedAt, deleted := s.local.tombstones[uuid]; deleted && !modifiedAfter(remote.ModifiedAt, deletedAt) {
+				result = nil
+			}
+		case !hasBase && remote == nil:
+			if deletedAt, deleted := s.remote.tombstones[uuid]; deleted && !modifiedAfter(local.ModifiedAt, deletedAt) {
+				result = nil
+			}
+		default:
+			conflict = true
+		}
+
+		if conflict {
+			err := s.recordConflict(uuid, local, remote)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if merged {
+			s.summary.Merged++
+		}
+
+		for _, side := range []*syncSide{s.local, s.remote} {
+			if sameEntry(side.entries[uuid], result) {
+				continue
+			}
+			err := side.applyEntry(s.encryptionKey, uuid, result)
+			if err != nil {
+				return err
+			}
+			s.count(side, 1)
+		}
+
+		if result != nil {
+			s.base[uuid] = &syncSnapshot{Kind: ChangeEntry, Entry: result}
+		} else {
+			delete(s.base, uuid)
+		}
+	}
+
+	return nil
+}
+
+// mergeAttachments copies new attachments across and removes deleted ones
+func (s *syncer) mergeAttachments() error {
+	for _, uuid := range syncUUIDs(s.base, ChangeAttachment, s.local.attachments, s.remote.attachments) {
+		local, remote := s.local.attachments[uuid], s.remote.attachments[uuid]
+		_, hasBase := s.base[uuid]
+
+		var err error
+		switch {
+		case local != nil && s.inConflict(local.Entry), remote != nil && s.inConflict(remote.Entry):
+			// Removing or copying attachments waits until the entry's conflict is resolved
+		case local != nil && remote != nil:
+			s.base[uuid] = &syncSnapshot{Kind: ChangeAttachment, Attachment: local}
+		case local == nil && remote == nil:
+			delete(s.base, uuid)
+		case local != nil:
+			err = s.mergeAttachment(uuid, local, hasBase, s.local, s.remote)
+		default:
+			err = s.mergeAttachment(uuid, remote, hasBase, s.remote, s.local)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeAttachment handles an attachment found only in src, either deleting it or copying it to dst
+func (s *syncer) mergeAttachment(uuid string, attachment *syncAttachment, hasBase bool, src *syncSide, dst *syncSide) error {
+	_, deleted := dst.tombstones[uuid]
+	if hasBase || deleted {
+		_, err := src.tx.Exec("DELETE FROM attachments WHERE uuid = ?;", uuid)
+		if err != nil {
+			return err
+		}
+		delete(s.base, uuid)
+		s.count(src, 1)
+		return nil
+	}
+
+	copied, err := copyAttachment(src.tx, dst.tx, uuid, attachment.Entry)
+	if err != nil || !copied {
+		return err
+	}
+	s.base[uuid] = &syncSnapshot{Kind: ChangeAttachment, Attachment: attachment}
+	s.count(dst, 1)
+
+	return nil
+}
+
+// recordConflict stores or updates the conflict of an entry, and makes the other copy's version the
+// common ancestor so the user's resolution is pushed to it by the next sync
+func (s *syncer) recordConflict(uuid string, local *SyncEntry, remote *SyncEntry) error {
+	localSnapshot, err := encryptSyncEntry(local, s.encryptionKey)
+	if err != nil {
+		return err
+	}
+	remoteSnapshot, err := encryptSyncEntry(remote, s.encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.local.tx.Exec(`
+	INSERT INTO sync_conflicts (uuid, peer, local, remote) VALUES (?, ?, ?, ?)
+	ON CONFLICT (uuid) DO UPDATE SET local = excluded.local, remote = excluded.remote, detected_at = CURRENT_TIMESTAMP;`,
+		uuid, s.peer, localSnapshot, remoteSnapshot)
+	if err != nil {
+		log.Printf("Error recording sync conflict of entry %s: %v", uuid, err)
+		return err
+	}
+
+	if remote != nil {
+		s.base[uuid] = &syncSnapshot{Kind: ChangeEntry, Entry: remote}
+	} else {
+		delete(s.base, uuid)
+	}
+	s.conflicts[uuid] = s.peer
+	s.summary.Conflicts++
+
+	return nil
+}
+
+// inConflict returns whether an entry has an unresolved conflict
+func (s *syncer) inConflict(uuid string) bool {
+	_, ok := s.conflicts[uuid]
+	return ok
+}
+
+// count adds changes made to a side to the summary
+func (s *syncer) count(side *syncSide, changes int) {
+	if side == s.local {
+		s.summary.Pulled += changes
+	} else {
+		s.summary.Pushed += changes
+	}
+}
+
+// syncUUIDs returns the UUIDs of a kind in either copy or the common ancestors, sorted for a stable order
+func syncUUIDs[T any](base map[string]*syncSnapshot, kind ChangeKind, local map[string]*T, remote map[string]*T) []string {
+	seen := make(map[string]bool)
+	for uuid := range local {
+		seen[uuid] = true
+	}
+	for uuid := range remote {
+		seen[uuid] = true
+	}
+	for uuid, snapshot := range base {
+		if snapshot.Kind == kind {
+			seen[uuid] = true
+		}
+	}
+
+	uuids := make([]string, 0, len(seen))
+	for uuid := range seen {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// mergeEntry combines the changes both copies made to an entry part by part, ok is false if any part
+// was changed differently in each copy
+func mergeEntry(base *SyncEntry, local *SyncEntry, remote *SyncEntry) (*SyncEntry, bool) {
+	merged := &SyncEntry{ModifiedAt: max(local.ModifiedAt, remote.ModifiedAt)}
+
+	var ok [9]bool
+	merged.Service, ok[0] = mergeValue(base.Service, local.Service, remote.Service)
+	merged.Username, ok[1] = mergeValue(base.Username, local.Username, remote.Username)
+	merged.Password, ok[2] = mergeValue(base.Password, local.Password, remote.Password)
+	merged.PasswordChangedAt = local.PasswordChangedAt
+	if merged.Password != local.Password {
+		merged.PasswordChangedAt = remote.PasswordChangedAt
+	}
+	merged.Notes, ok[3] = mergeValue(base.Notes, local.Notes, remote.Notes)
+	merged.EntryType, ok[4] = mergeValue(base.EntryType, local.EntryType, remote.EntryType)
+	merged.Folder, ok[5] = mergeValue(base.Folder, local.Folder, remote.Folder)
+	merged.ExpiresAt, ok[8] = mergeValue(base.ExpiresAt, local.ExpiresAt, remote.ExpiresAt)
+
+	// Tags and custom fields are each compared as a whole
+	merged.Tags, ok[6] = mergeSlice(base.Tags, local.Tags, remote.Tags, strings.EqualFold)
+	merged.Fields, ok[7] = mergeSlice(base.Fields, local.Fields, remote.Fields, func(a, b ImportField) bool { return a == b })
+
+	return merged, !slices.Contains(ok[:], false)
+}
+
+// mergeValue three-way merges one value, ok is false if both copies changed it differently
+func mergeValue[T comparable](base T, local T, remote T) (T, bool) {
+	switch {
+	case local == remote || base == remote:
+		return local, true
+	case base == local:
+		return remote, true
+	}
+	return local, false
+}
+
+// mergeSlice is mergeValue for slices compared element by element
+func mergeSlice[T any](base []T, local []T, remote []T, equal func(T, T) bool) ([]T, bool) {
+	switch {
+	case slices.EqualFunc(local, remote, equal) || slices.EqualFunc(base, remote, equal):
+		return local, true
+	case slices.EqualFunc(base, local, equal):
+		return remote, true
+	}
+	return local, false
+}
+
+// sameEntry returns whether two entries (either may be nil) have the same contents
+func sameEntry(a *SyncEntry, b *SyncEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Service == b.Service && a.Username == b.Username && a.Password == b.Password &&
+		a.Notes == b.Notes && a.EntryType == b.EntryType && a.Folder == b.Folder && a.ExpiresAt == b.ExpiresAt &&
+		slices.EqualFunc(a.Tags, b.Tags, strings.EqualFold) && slices.Equal(a.Fields, b.Fields)
+}
+
+// sameFolder returns whether two folders (either may be nil) have the same name, parent and rotation policy
+func sameFolder(a *syncFolder, b *syncFolder) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.Parent == b.Parent && a.RotationDays == b.RotationDays
+}
+
+// latestFolder returns whichever folder was changed last
+func latestFolder(a *syncFolder, b *syncFolder) *syncFolder {
+	if modifiedAfter(b.ModifiedAt, a.ModifiedAt) {
+		return b
+	}
+	return a
+}
+
+// modifiedAfter compares two syncTimeFormat timestamps, which sort as strings
+func modifiedAfter(modifiedAt string, other string) bool {
+	return modifiedAt > other
+}
+
+// =-- Sync State --= //
+
+// loadState reads the common ancestors shared with the peer and the unresolved conflicts
+func (s *syncer) loadState() error {
+	s.base = make(map[string]*syncSnapshot)
+	err := queryEach(s.local.tx, "SELECT uuid, snapshot FROM sync_base WHERE peer = ?;",
+		func(rows *sql.Rows) error {
+			var uuid, ciphertext string
+			if err := rows.Scan(&uuid, &ciphertext); err != nil {
+				return err
+			}
+			plaintext, err := encryption.Decrypt(ciphertext, s.encryptionKey)
+			if err != nil {
+				return err
+			}
+			var snapshot syncSnapshot
+			if err := json.Unmarshal([]byte(plaintext), &snapshot); err != nil {
+				return err
+			}
+			s.base[uuid] = &snapshot
+			return nil
+		}, s.peer)
+	if err != nil {
+		log.Printf("Error reading sync state for %s: %v", s.peer, err)
+		return err
+	}
+
+	s.conflicts = make(map[string]string)
+	return queryEach(s.local.tx, "SELECT uuid, peer FROM sync_conflicts;", func(rows *sql.Rows) error {
+		var uuid, peer string
+		err := rows.Scan(&uuid, &peer)
+		s.conflicts[uuid] = peer
+		return err
+	})
+}
+
+// saveState replaces the common ancestors shared with the peer by the merged objects
+func (s *syncer) saveState() error {
+	_, err := s.local.tx.Exec(`
+	INSERT INTO sync_peers (peer) VALUES (?) ON CONFLICT (peer) DO UPDATE SET synced_at = CURRENT_TIMESTAMP;`, s.peer)
+	if err != nil {
+		return err
+	}
+	_, err = s.local.tx.Exec("DELETE FROM sync_base WHERE peer = ?;", s.peer)
+	if err != nil {
+		return err
+	}
+
+	for uuid, snapshot := range s.base {
+		plaintext, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		ciphertext, err := encryption.Encrypt(string(plaintext), s.encryptionKey)
+		if err != nil {
+			return err
+		}
+		_, err = s.local.tx.Exec("INSERT INTO sync_base (peer, uuid, snapshot) VALUES (?, ?, ?);", s.peer, uuid, ciphertext)
+		if err != nil {
+			log.Printf("Error saving sync state for %s: %v", s.peer, err)
+			return err
+		}
+	}
+
+	return nil
+}
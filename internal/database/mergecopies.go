@@ -0,0 +1,411 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Reading Copies --= //
+
+// loadFolders reads every folder with its parent's UUID
+func (side *syncSide) loadFolders() error {
+	side.folders = make(map[string]*syncFolder)
+	return queryEach(side.tx, `
+	SELECT f.uuid, f.name, COALESCE(p.uuid, ''), f.rotation_days, f.modified_at
+	FROM folders f LEFT JOIN folders p ON p.id = f.parent_id;`, func(rows *sql.Rows) error {
+		var uuid string
+		var folder syncFolder
+		err := rows.Scan(&uuid, &folder.Name, &folder.Parent, &folder.RotationDays, &folder.ModifiedAt)
+		side.folders[uuid] = &folder
+		return err
+	})
+}
+
+// loadTombstones reads when every deleted object was deleted
+func (side *syncSide) loadTombstones() error {
+	side.tombstones = make(map[string]string)
+	return queryEach(side.tx, "SELECT uuid, deleted_at FROM sync_tombstones;", func(rows *sql.Rows) error {
+		var uuid, deletedAt string
+		err := rows.Scan(&uuid, &deletedAt)
+		side.tombstones[uuid] = deletedAt
+		return err
+	})
+}
+
+// loadEntries reads and decrypts every entry with its tags and custom fields
+func (side *syncSide) loadEntries(encryptionKey string) error {
+	side.entries = make(map[string]*SyncEntry)
+	err := queryEach(side.tx, `
+	SELECT p.uuid, p.service, p.username, p.password, COALESCE(p.notes, ''), p.entry_type,
+	       COALESCE(f.uuid, ''), p.modified_at,
+	       COALESCE(p.password_changed_at, strftime('%Y-%m-%dT%H:%M:%fZ', p.created_at), ''), COALESCE(p.expires_at, '')
+	FROM passwords p LEFT JOIN folders f ON f.id = p.folder_id;`, func(rows *sql.Rows) error {
+		var uuid string
+		var entry SyncEntry
+		err := rows.Scan(&uuid, &entry.Service, &entry.Username, &entry.Password, &entry.Notes, &entry.EntryType,
+			&entry.Folder, &entry.ModifiedAt, &entry.PasswordChangedAt, &entry.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		entry.Password, err = encryption.Decrypt(entry.Password, encryptionKey)
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", uuid, err)
+		}
+		if entry.Notes != "" {
+			entry.Notes, err = encryption.Decrypt(entry.Notes, encryptionKey)
+			if err != nil {
+				return fmt.Errorf("entry %s: %w", uuid, err)
+			}
+		}
+		side.entries[uuid] = &entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = queryEach(side.tx, `
+	SELECT p.uuid, t.name FROM entry_tags et
+	JOIN tags t ON t.id = et.tag_id JOIN passwords p ON p.id = et.entry_id
+	ORDER BY t.name COLLATE NOCASE;`, func(rows *sql.Rows) error {
+		var uuid, tag string
+		err := rows.Scan(&uuid, &tag)
+		if entry, ok := side.entries[uuid]; ok {
+			entry.Tags = append(entry.Tags, tag)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return queryEach(side.tx, `
+	SELECT p.uuid, c.name, c.field_type, c.value FROM custom_fields c
+	JOIN passwords p ON p.id = c.entry_id
+	ORDER BY c.entry_id, c.position, c.id;`, func(rows *sql.Rows) error {
+		var uuid string
+		var field ImportField
+		err := rows.Scan(&uuid, &field.Name, &field.Type, &field.Value)
+		if err != nil {
+			return err
+		}
+		field.Value, err = encryption.Decrypt(field.Value, encryptionKey)
+		if err != nil {
+			return fmt.Errorf("custom field of entry %s: %w", uuid, err)
+		}
+		if entry, ok := side.entries[uuid]; ok {
+			entry.Fields = append(entry.Fields, field)
+		}
+		return nil
+	})
+}
+
+// loadAttachments reads the name and entry of every attachment
+func (side *syncSide) loadAttachments() error {
+	side.attachments = make(map[string]*syncAttachment)
+	return queryEach(side.tx, `
+	SELECT a.uuid, p.uuid, a.name FROM attachments a JOIN passwords p ON p.id = a.entry_id;`, func(rows *sql.Rows) error {
+		var uuid string
+		var attachment syncAttachment
+		err := rows.Scan(&uuid, &attachment.Entry, &attachment.Name)
+		side.attachments[uuid] = &attachment
+		return err
+	})
+}
+
+// queryEach calls scan for every row a query returns
+func queryEach(q execQuerier, query string, scan func(rows *sql.Rows) error, args ...any) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// =-- Writing Copies --= //
+
+// applyFolders brings a side's folders in line with the merged folders, returning how many changed
+func (side *syncSide) applyFolders(merged map[string]*syncFolder) (int, error) {
+	changed := 0
+
+	// Parents are written before their subfolders, folders whose parent is missing become top-level
+	pending := make([]string, 0, len(merged))
+	for uuid, folder := range merged {
+		if !sameFolder(side.folders[uuid], folder) {
+			pending = append(pending, uuid)
+		}
+	}
+	sort.Strings(pending)
+	for len(pending) > 0 {
+		var waiting []string
+		for _, uuid := range pending {
+			parent := merged[uuid].Parent
+			if parent != "" && slices.Contains(pending, parent) && !slices.Contains(waiting, uuid) {
+				waiting = append(waiting, uuid)
+			}
+		}
+		if len(waiting) == len(pending) {
+			// Every remaining folder waits on another, a cycle from moves in both copies
+			waiting = waiting[1:]
+		}
+
+		for _, uuid := range pending {
+			if slices.Contains(waiting, uuid) {
+				continue
+			}
+			err := side.applyFolder(uuid, merged[uuid])
+			if err != nil {
+				return changed, err
+			}
+			changed++
+		}
+		pending = waiting
+	}
+
+	// Deleting a folder deletes its subfolders, which may have been moved out of it above
+	for uuid := range side.folders {
+		if _, ok := merged[uuid]; ok {
+			continue
+		}
+		result, err := side.tx.Exec("DELETE FROM folders WHERE uuid = ?;", uuid)
+		if err != nil {
+			return changed, err
+		}
+		if deleted, _ := result.RowsAffected(); deleted > 0 {
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// applyFolder inserts or updates a folder, without ever making it its own ancestor
+func (side *syncSide) applyFolder(uuid string, folder *syncFolder) error {
+	var id int
+	err := side.tx.QueryRow("SELECT id FROM folders WHERE uuid = ?;", uuid).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	parentID, err := side.objectID("folders", folder.Parent)
+	if err != nil {
+		return err
+	}
+	for ancestorID := parentID; ancestorID != 0 && id != 0; {
+		if ancestorID == id {
+			parentID = 0
+			break
+		}
+		var next sql.NullInt64
+		err = side.tx.QueryRow("SELECT parent_id FROM folders WHERE id = ?;", ancestorID).Scan(&next)
+		if err != nil {
+			return err
+		}
+		ancestorID = int(next.Int64)
+	}
+
+	if id == 0 {
+		err = side.restoreUUID(uuid)
+		if err == nil {
+			_, err = side.tx.Exec("INSERT INTO folders (name, parent_id, rotation_days, uuid, modified_at) VALUES (?, ?, ?, ?, ?);",
+				folder.Name, nullableID(parentID), folder.RotationDays, uuid, folder.ModifiedAt)
+		}
+	} else {
+		_, err = side.tx.Exec("UPDATE folders SET name = ?, parent_id = ?, rotation_days = ?, modified_at = ? WHERE id = ?;",
+			folder.Name, nullableID(parentID), folder.RotationDays, folder.ModifiedAt, id)
+	}
+	if err != nil {
+		log.Printf("Error syncing folder %s: %v", uuid, err)
+	}
+
+	return err
+}
+
+// applyEntry inserts, replaces or (if entry is nil) deletes an entry
+func (side *syncSide) applyEntry(encryptionKey string, uuid string, entry *SyncEntry) error {
+	id, err := side.objectID("passwords", uuid)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		_, err = side.tx.Exec("DELETE FROM passwords WHERE id = ?;", id)
+		return err
+	}
+
+	password, err := encryption.Encrypt(entry.Password, encryptionKey)
+	if err != nil {
+		return err
+	}
+	notes := ""
+	if entry.Notes != "" {
+		notes, err = encryption.Encrypt(entry.Notes, encryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+	folderID, err := side.objectID("folders", entry.Folder)
+	if err != nil {
+		return err
+	}
+
+	if id == 0 {
+		// The contents are written below, together with those of existing entries
+		err = side.restoreUUID(uuid)
+		if err != nil {
+			return err
+		}
+		result, err := side.tx.Exec("INSERT INTO passwords (service, username, password, uuid) VALUES (?, ?, ?, ?);",
+			entry.Service, entry.Username, password, uuid)
+		if err != nil {
+			log.Printf("Error syncing entry %s: %v", uuid, err)
+			return err
+		}
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = int(lastID)
+	} else {
+		_, err = side.tx.Exec("DELETE FROM custom_fields WHERE entry_id = ?;", id)
+		if err == nil {
+			_, err = side.tx.Exec("DELETE FROM entry_tags WHERE entry_id = ?;", id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range entry.Fields {
+		value, err := encryption.Encrypt(field.Value, encryptionKey)
+		if err != nil {
+			return err
+		}
+		_, err = insertCustomField(side.tx, id, CustomFieldEntry{Name: field.Name, Type: field.Type, EncryptedValue: value})
+		if err != nil {
+			return err
+		}
+	}
+	for _, tag := range entry.Tags {
+		err = tagEntry(side.tx, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The password change time is only taken along with a different password
+	var passwordChangedAt any
+	if current := side.entries[uuid]; current == nil || current.Password != entry.Password {
+		passwordChangedAt = entry.PasswordChangedAt
+		if entry.PasswordChangedAt == "" {
+			passwordChangedAt = time.Now().UTC().Format(syncTimeFormat)
+		}
+	}
+
+	// Written last, so the modification time is the merged one rather than that of the field changes
+	_, err = side.tx.Exec(`
+	UPDATE passwords SET service = ?, username = ?, password = ?, notes = ?, folder_id = ?, entry_type = ?, modified_at = ?,
+	    password_changed_at = COALESCE(?, password_changed_at), expires_at = NULLIF(?, '')
+	WHERE id = ?;`,
+		entry.Service, entry.Username, password, notes, nullableID(folderID), string(entry.EntryType), entry.ModifiedAt,
+		passwordChangedAt, entry.ExpiresAt, id)
+	if err != nil {
+		log.Printf("Error syncing entry %s: %v", uuid, err)
+		return err
+	}
+
+	_, err = side.tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM entry_tags);")
+	return err
+}
+
+// objectID returns the row ID of an object in a side, 0 if the UUID is empty or not found
+func (side *syncSide) objectID(table string, uuid string) (int, error) {
+	if uuid == "" {
+		return 0, nil
+	}
+
+	var id int
+	err := side.tx.QueryRow("SELECT id FROM "+table+" WHERE uuid = ?;", uuid).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// restoreUUID removes the tombstone of an object about to be inserted again under the same UUID
+func (side *syncSide) restoreUUID(uuid string) error {
+	_, err := side.tx.Exec("DELETE FROM sync_tombstones WHERE uuid = ?;", uuid)
+	return err
+}
+
+// copyAttachment copies an attachment's encrypted chunks as they are (both copies share the encryption
+// key), returning false if its entry does not exist in dst
+func copyAttachment(src *sql.Tx, dst *sql.Tx, uuid string, entryUUID string) (bool, error) {
+	var entryID int
+	err := dst.QueryRow("SELECT id FROM passwords WHERE uuid = ?;", entryUUID).Scan(&entryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var id int
+	var name, modifiedAt string
+	var size int64
+	var streamID []byte
+	err = src.QueryRow("SELECT id, name, size, stream_id, modified_at FROM attachments WHERE uuid = ?;", uuid).
+		Scan(&id, &name, &size, &streamID, &modifiedAt)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = dst.Exec("DELETE FROM sync_tombstones WHERE uuid = ?;", uuid)
+	if err != nil {
+		return false, err
+	}
+	result, err := dst.Exec(
+		"INSERT INTO attachments (entry_id, name, size, stream_id, uuid, modified_at) VALUES (?, ?, ?, ?, ?, ?);",
+		entryID, name, size, streamID, uuid, modifiedAt)
+	if err != nil {
+		log.Printf("Error syncing attachment %s: %v", uuid, err)
+		return false, err
+	}
+	copiedID, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+
+	err = queryEach(src, "SELECT seq, data FROM attachment_chunks WHERE attachment_id = ? ORDER BY seq;",
+		func(rows *sql.Rows) error {
+			var seq int
+			var data []byte
+			if err := rows.Scan(&seq, &data); err != nil {
+				return err
+			}
+			_, err := dst.Exec("INSERT INTO attachment_chunks (attachment_id, seq, data) VALUES (?, ?, ?);", copiedID, seq, data)
+			return err
+		}, id)
+
+	return err == nil, err
+}
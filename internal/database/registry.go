@@ -0,0 +1,185 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cpainter1/PassLock/internal/config"
+)
+
+// =-- Vault Registry --= //
+
+// The registry remembers vaults opened or created outside the vault directories, by name, and which
+// vaults are archived
+
+// registryMutex serializes registry reads and writes within the process
+var registryMutex sync.Mutex
+
+// vaultRegistry is the on-disk registry layout
+type vaultRegistry struct {
+	Vaults   map[string]string `json:"vaults"`             // Absolute vault file paths by vault name
+	Archived map[string]bool   `json:"archived,omitempty"` // Archived vault names
+}
+
+// RegisterVault makes an existing vault file available under vaultName
+func RegisterVault(vaultName string, path string) error {
+	err := ValidateVaultName(vaultName)
+	if err != nil {
+		return err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if !IsVaultFile(path) {
+		return fmt.Errorf("%w: %s", ErrNotVault, path)
+	}
+	err = checkVaultNameFree(vaultName, path)
+	if err != nil {
+		return err
+	}
+
+	return updateRegistry(func(registry *vaultRegistry) error {
+		registry.Vaults[vaultName] = path
+		return nil
+	})
+}
+
+// UnregisterVault forgets a registered vault without deleting its file
+func UnregisterVault(vaultName string) error {
+	return updateRegistry(func(registry *vaultRegistry) error {
+		if _, ok := registry.Vaults[vaultName]; !ok {
+			return fmt.Errorf("%w: %s is not registered", ErrVaultNotFound, vaultName)
+		}
+		delete(registry.Vaults, vaultName)
+		delete(registry.Archived, vaultName)
+		return nil
+	})
+}
+
+// RegisteredVaults returns the registered vault paths by vault name
+func RegisteredVaults() (map[string]string, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.Vaults, nil
+}
+
+// updateRegistry loads the registry, applies update and saves it
+func updateRegistry(update func(registry *vaultRegistry) error) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry, err := loadRegistry()
+	if err != nil {
+		return err
+	}
+	err = update(registry)
+	if err != nil {
+		return err
+	}
+
+	return saveRegistry(registry)
+}
+
+// archivedVaults returns the set of archived vault names
+func archivedVaults() (map[string]bool, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.Archived, nil
+}
+
+// IsVaultFile returns whether path is an SQLite file containing vault metadata
+func IsVaultFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	// Opened read-only so checking a file never modifies it
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM vault_metadata;").Scan(&count)
+	return err == nil && count > 0
+}
+
+// loadRegistry reads the registry file, a missing file is an empty registry
+func loadRegistry() (*vaultRegistry, error) {
+	registry := &vaultRegistry{Vaults: make(map[string]string), Archived: make(map[string]bool)}
+
+	data, err := os.ReadFile(config.RegistryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		log.Printf("Error reading vault registry: %v", err)
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, registry)
+	if err != nil {
+		log.Printf("Error parsing vault registry: %v", err)
+		return nil, err
+	}
+	if registry.Vaults == nil {
+		registry.Vaults = make(map[string]string)
+	}
+	if registry.Archived == nil {
+		registry.Archived = make(map[string]bool)
+	}
+
+	return registry, nil
+}
+
+// saveRegistry atomically replaces the registry file
+func saveRegistry(registry *vaultRegistry) error {
+	path := config.RegistryPath()
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		log.Printf("Could not create config directory: %s", err)
+		return err
+	}
+
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// sortedKeys returns the keys of a string map in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
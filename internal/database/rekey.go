@@ -0,0 +1,315 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Re-Keying --= //
+
+// VaultKeys holds everything derived from a master password that protects a vault
+type VaultKeys struct {
+	EncryptionKey string                  // Key every secret is encrypted with
+	AuthKey       string                  // Authentication key stored in vault_metadata
+	Salt          string                  // Key derivation salt
+	KDF           encryption.Argon2Params // Key derivation settings
+}
+
+// DeriveVaultKeys derives new vault keys from a master password with a fresh salt
+func DeriveVaultKeys(password string, params encryption.Argon2Params) (*VaultKeys, error) {
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, authKey, err := encryption.DeriveMasterKeysWithParams(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VaultKeys{EncryptionKey: encryptionKey, AuthKey: authKey, Salt: salt, KDF: params}, nil
+}
+
+// RekeyVault re-encrypts every secret in a vault from oldEncryptionKey to the new keys and stores the new
+// authentication metadata, all in one transaction. File-backed vaults are backed up first.
+func RekeyVault(db *sql.DB, oldEncryptionKey string, newKeys VaultKeys) error {
+	err := newKeys.KDF.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = backupOpenVault(db, BackupRekey)
+	if err != nil {
+		return err
+	}
+
+	return rekeyVaultTx(db, oldEncryptionKey, newKeys)
+}
+
+// rekeyVaultTx is RekeyVault without the backup, for vaults that are new copies
+func rekeyVaultTx(db *sql.DB, oldEncryptionKey string, newKeys VaultKeys) error {
+	err := newKeys.KDF.Validate()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = rekeyVault(tx, oldEncryptionKey, newKeys)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error re-keying vault: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rekeyVault re-encrypts entries, custom fields, the audit key, sync state, quarantined entries and
+// attachments inside a transaction
+func rekeyVault(tx *sql.Tx, oldKey string, newKeys VaultKeys) error {
+	newKey := newKeys.EncryptionKey
+
+	// Passwords and notes
+	err := reencryptColumns(tx, "passwords", []string{"password", "notes"}, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	// Custom field values
+	err = reencryptColumns(tx, "custom_fields", []string{"value"}, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	// The audit log is encrypted with its own key, only that key changes
+	err = reencryptColumns(tx, "audit_state", []string{"audit_key"}, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	err = reencryptAuditMarker(tx, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	// Common ancestors of the last sync and unresolved conflicts hold encrypted copies of entries
+	err = reencryptColumns(tx, "sync_base", []string{"snapshot"}, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	err = reencryptColumns(tx, "sync_conflicts", []string{"local", "remote"}, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	// Quarantined entries keep their values encrypted for manual recovery
+	err = reencryptQuarantine(tx, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	// Attachments are rewritten one at a time under a new stream ID, keeping their IDs
+	ids, err := queryIDs(tx, "SELECT id FROM attachments ORDER BY id;")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = rekeyAttachment(tx, id, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A vault whose audit log was started keeps its authentication key sealed
+	authKey := newKeys.AuthKey
+	var storedAuthKey string
+	err = tx.QueryRow("SELECT auth_key FROM vault_metadata LIMIT 1;").Scan(&storedAuthKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if isSealedAuthKey(storedAuthKey) {
+		authKey = sealAuthKey(authKey)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE vault_metadata SET auth_key = ?, salt = ?, kdf_time = ?, kdf_memory = ?, kdf_threads = ?;",
+		authKey, newKeys.Salt, newKeys.KDF.Time, newKeys.KDF.Memory, newKeys.KDF.Threads)
+
+	return err
+}
+
+// reencryptColumns re-encrypts the given columns of every row in a table, empty values stay empty
+func reencryptColumns(tx *sql.Tx, table string, columns []string, oldKey string, newKey string) error {
+	for _, column := range columns {
+		rows, err := tx.Query("SELECT rowid, COALESCE(" + column + ", '') FROM " + table + ";")
+		if err != nil {
+			return err
+		}
+
+		// Read everything before writing, rows cannot stay open while the table is updated
+		values := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			values[id] = value
+		}
+		if err := rows.Err(); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		for id, value := range values {
+			if value == "" {
+				continue
+			}
+			plaintext, err := encryption.Decrypt(value, oldKey)
+			if err != nil {
+				log.Printf("Error decrypting %s.%s of row %d: %v", table, column, id, err)
+				return err
+			}
+			ciphertext, err := encryption.Encrypt(plaintext, newKey)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("UPDATE "+table+" SET "+column+" = ? WHERE rowid = ?;", ciphertext, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// rekeyAttachment re-encrypts an attachment chunk by chunk under a new stream ID, so it is never held in
+// memory as a whole. New chunks are written after the old ones and renumbered once the old ones are gone.
+func rekeyAttachment(tx *sql.Tx, id int, oldKey string, newKey string) error {
+	var oldStreamID []byte
+	var size int64
+	var lastSeq int
+	err := tx.QueryRow("SELECT a.stream_id, a.size, COALESCE(MAX(c.seq), -1) FROM attachments a "+
+		"LEFT JOIN attachment_chunks c ON c.attachment_id = a.id WHERE a.id = ? GROUP BY a.id;", id).Scan(&oldStreamID, &size, &lastSeq)
+	if err != nil {
+		return err
+	}
+
+	decrypter, err := encryption.NewDecryptReader(&seqChunkReader{tx: tx, attachmentID: id, seq: -1, lastSeq: lastSeq}, oldKey, oldStreamID)
+	if err != nil {
+		log.Printf("Error decrypting attachment with ID %d: %v", id, err)
+		if errors.Is(err, encryption.ErrStreamHeader) {
+			return ErrAttachmentIncomplete
+		}
+		return err
+	}
+
+	streamID := make([]byte, 16)
+	_, err = rand.Read(streamID)
+	if err != nil {
+		return err
+	}
+	encrypter, err := encryption.NewEncryptWriter(&chunkWriter{tx: tx, attachmentID: int64(id), seq: lastSeq + 1}, newKey, streamID)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(encrypter, decrypter)
+	if err != nil {
+		log.Printf("Error re-encrypting attachment with ID %d: %v", id, err)
+		return err
+	}
+	if written != size {
+		return ErrAttachmentSize
+	}
+	err = encrypter.Close()
+	if err != nil {
+		return err
+	}
+
+	// Drop the old chunks, then shift the new ones down through negative numbers so none collide
+	_, err = tx.Exec("DELETE FROM attachment_chunks WHERE attachment_id = ? AND seq <= ?;", id, lastSeq)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE attachment_chunks SET seq = ? - seq WHERE attachment_id = ?;", lastSeq, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE attachment_chunks SET seq = -1 - seq WHERE attachment_id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE attachments SET stream_id = ? WHERE id = ?;", streamID, id)
+	return err
+}
+
+// seqChunkReader reads the chunks of an attachment up to lastSeq one row at a time, without keeping a
+// query open, so new chunks can be written while it is read
+type seqChunkReader struct {
+	tx           *sql.Tx
+	attachmentID int
+	seq          int
+	lastSeq      int
+	current      []byte
+}
+
+// Read returns data from the current chunk, fetching the next chunk when needed
+func (r *seqChunkReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.seq >= r.lastSeq {
+			return 0, io.EOF
+		}
+		err := r.tx.QueryRow("SELECT seq, data FROM attachment_chunks WHERE attachment_id = ? AND seq > ? AND seq <= ? ORDER BY seq LIMIT 1;",
+			r.attachmentID, r.seq, r.lastSeq).Scan(&r.seq, &r.current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+
+	return n, nil
+}
+
+// queryIDs returns the integer IDs selected by a query
+func queryIDs(q execQuerier, query string, args ...any) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
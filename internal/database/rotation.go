@@ -0,0 +1,302 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Rotation Policies --= //
+
+const (
+	RotationInherit = 0  // Folder takes the policy of its parent folder, or the vault's
+	RotationNever   = -1 // Folder's passwords never need rotating, whatever the vault's policy
+)
+
+var (
+	ErrInvalidRotation = errors.New("invalid rotation period")
+	ErrInvalidExpiry   = errors.New("invalid expiry date, expected YYYY-MM-DD")
+)
+
+// rotatedTypes lists the entry types whose secret is a credential that should be rotated
+var rotatedTypes = map[EntryType]bool{
+	EntryLogin:    true,
+	EntryDatabase: true,
+	EntryWiFi:     true,
+	EntryAPIToken: true,
+	EntrySSHKey:   true,
+}
+
+// expiryFields maps entry types that have their own expiry field to the field's key
+var expiryFields = map[EntryType]string{
+	EntryCard:     "expiry",
+	EntryAPIToken: "expires",
+}
+
+// DueReason is why an entry needs attention
+type DueReason string
+
+const (
+	DueRotation DueReason = "rotation" // Password is older than its rotation policy allows
+	DueExpiry   DueReason = "expiry"   // Entry, card or token expires
+)
+
+// DueEntry is an entry whose password must be rotated or which expires soon
+type DueEntry struct {
+	EntryID      int       // Entry ID
+	Service      string    // Entry service
+	Username     string    // Entry username
+	EntryType    EntryType // Kind of entry
+	Reason       DueReason // Why the entry is due
+	DueDate      time.Time // Day the password must be rotated by or the entry expires (UTC)
+	Overdue      bool      // Whether the due date has passed
+	RotationDays int       // Rotation period that applies (0 for expiries)
+}
+
+// GetVaultRotation returns the vault's rotation period in days, 0 if passwords do not need rotating
+func GetVaultRotation(db *sql.DB) (int, error) {
+	var days int
+	err := db.QueryRow("SELECT rotation_days FROM vault_metadata LIMIT 1;").Scan(&days)
+	if err != nil {
+		log.Printf("Error reading vault rotation policy: %v", err)
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// SetVaultRotation sets the rotation period of every entry not covered by a folder policy, 0 disables it
+func SetVaultRotation(db *sql.DB, days int) error {
+	if days < 0 {
+		return fmt.Errorf("%w: %d days", ErrInvalidRotation, days)
+	}
+
+	_, err := db.Exec("UPDATE vault_metadata SET rotation_days = ?;", days)
+	if err != nil {
+		log.Printf("Error setting vault rotation policy: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetFolderRotation sets the rotation period of the entries in a folder and its subfolders, days may also
+// be RotationInherit or RotationNever
+func SetFolderRotation(db *sql.DB, id int, days int) error {
+	if days < RotationNever {
+		return fmt.Errorf("%w: %d days", ErrInvalidRotation, days)
+	}
+	if _, err := GetFolder(db, id); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("UPDATE folders SET rotation_days = ? WHERE id = ?;", days, id)
+	if err != nil {
+		log.Printf("Error setting rotation policy of folder with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// SetEntryExpiry sets the date (DateFormat) an entry expires, an empty date removes it
+func SetEntryExpiry(db *sql.DB, id int, expiresAt string) error {
+	expiresAt = strings.TrimSpace(expiresAt)
+	if _, err := time.Parse(DateFormat, expiresAt); err != nil && expiresAt != "" {
+		return fmt.Errorf("%w: %q", ErrInvalidExpiry, expiresAt)
+	}
+	if _, err := GetEntryFromID(db, id); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("UPDATE passwords SET expires_at = NULLIF(?, '') WHERE id = ?;", expiresAt, id)
+	if err != nil {
+		log.Printf("Error setting expiry of entry with ID %d: %v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// FolderRotation returns the rotation period that applies to entries in a folder (0 for unfiled entries),
+// taken from the nearest folder with a policy or else the vault, 0 if none applies
+func FolderRotation(db *sql.DB, folderID int) (int, error) {
+	policies, err := loadRotationPolicies(db)
+	if err != nil {
+		return 0, err
+	}
+	return policies.days(folderID), nil
+}
+
+// GetDueEntries returns the entries whose password must be rotated, or which expire, within the next
+// withinDays days of now, overdue ones included, ordered by due date
+func GetDueEntries(db *sql.DB, encryptionKey string, now time.Time, withinDays int) ([]*DueEntry, error) {
+	policies, err := loadRotationPolicies(db)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := GetAllEntries(db)
+	if err != nil {
+		return nil, err
+	}
+
+	today := startOfDay(now)
+	limit := today.AddDate(0, 0, withinDays)
+	var due []*DueEntry
+	add := func(entry *PasswordInformation, reason DueReason, date time.Time, days int) {
+		if date.After(limit) {
+			return
+		}
+		due = append(due, &DueEntry{
+			EntryID:      entry.ID,
+			Service:      entry.Service,
+			Username:     entry.Username,
+			EntryType:    entry.EntryType,
+			Reason:       reason,
+			DueDate:      date,
+			Overdue:      date.Before(today),
+			RotationDays: days,
+		})
+	}
+
+	for _, entry := range entries {
+		entryType := entry.EntryType
+		if entryType == "" {
+			entryType = EntryLogin
+		}
+
+		if days := policies.days(entry.FolderID); days > 0 && rotatedTypes[entryType] {
+			changedAt, err := time.Parse(time.RFC3339Nano, entry.PasswordChangedAt)
+			if err == nil {
+				add(entry, DueRotation, startOfDay(changedAt).AddDate(0, 0, days), days)
+			}
+		}
+
+		expiresAt, err := entryExpiry(db, encryptionKey, entry, entryType)
+		if err != nil {
+			return nil, err
+		}
+		if !expiresAt.IsZero() {
+			add(entry, DueExpiry, expiresAt, 0)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].DueDate.Before(due[j].DueDate)
+	})
+
+	return due, nil
+}
+
+// entryExpiry returns the day an entry expires, its own expiry date taking precedence over the expiry
+// field of cards and tokens, zero if it does not expire
+func entryExpiry(db *sql.DB, encryptionKey string, entry *PasswordInformation, entryType EntryType) (time.Time, error) {
+	if entry.ExpiresAt != "" {
+		expiresAt, err := time.Parse(DateFormat, entry.ExpiresAt)
+		if err != nil {
+			log.Printf("Ignoring invalid expiry date of entry with ID %d: %v", entry.ID, err)
+			return time.Time{}, nil
+		}
+		return expiresAt, nil
+	}
+
+	key, ok := expiryFields[entryType]
+	if !ok {
+		return time.Time{}, nil
+	}
+	schema, err := GetEntrySchema(entryType)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var label string
+	for _, field := range schema.Fields {
+		if field.Key == key {
+			label = field.Label
+		}
+	}
+
+	fields, err := GetCustomFields(db, entry.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, field := range fields {
+		if field.Name != label {
+			continue
+		}
+		value, err := encryption.Decrypt(field.EncryptedValue, encryptionKey)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		// Values were validated when stored, but imports and synced copies may hold anything
+		var expiresAt time.Time
+		if entryType == EntryCard {
+			expiresAt, err = ParseCardExpiry(value)
+		} else {
+			expiresAt, err = time.Parse(DateFormat, strings.TrimSpace(value))
+		}
+		if err != nil {
+			return time.Time{}, nil
+		}
+		return startOfDay(expiresAt), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// startOfDay returns midnight UTC of a time's UTC date
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// rotationPolicies are the rotation periods of the vault and every folder
+type rotationPolicies struct {
+	vault   int
+	folders map[int]*Folder
+}
+
+// loadRotationPolicies reads the vault's and every folder's rotation period
+func loadRotationPolicies(db *sql.DB) (*rotationPolicies, error) {
+	vault, err := GetVaultRotation(db)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := ListFolders(db)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := &rotationPolicies{vault: vault, folders: make(map[int]*Folder, len(folders))}
+	for _, folder := range folders {
+		policies.folders[folder.ID] = folder
+	}
+
+	return policies, nil
+}
+
+// days returns the rotation period of entries in a folder, 0 if none applies
+func (policies *rotationPolicies) days(folderID int) int {
+	// Folders form a tree, the step limit only guards against a damaged vault
+	for step := 0; folderID != 0 && step <= len(policies.folders); step++ {
+		folder, ok := policies.folders[folderID]
+		if !ok {
+			break
+		}
+		switch {
+		case folder.RotationDays == RotationNever:
+			return 0
+		case folder.RotationDays > 0:
+			return folder.RotationDays
+		}
+		folderID = folder.ParentID
+	}
+
+	return policies.vault
+}
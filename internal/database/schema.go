@@ -0,0 +1,342 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// =-- Schema Migrations --= //
+
+// migrations lists every schema change in order, the vault's PRAGMA user_version stores how many have been applied
+var migrations = []string{
+	// 1: Base password and metadata tables (vaults created before versioning already have these)
+	`
+	CREATE TABLE IF NOT EXISTS passwords (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    service TEXT NOT NULL,
+	    username TEXT NOT NULL,
+	    password TEXT NOT NULL, -- AES-256 encrypted
+	    notes TEXT,             -- Optional encrypted field
+	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS vault_metadata (
+	    vault_name TEXT PRIMARY KEY,
+	    auth_key TEXT NOT NULL,
+	    salt TEXT NOT NULL
+	);`,
+
+	// 2: Nested folders and free-form tags
+	`
+	CREATE TABLE folders (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    name TEXT NOT NULL,
+	    parent_id INTEGER REFERENCES folders(id) ON DELETE CASCADE, -- NULL for top-level folders
+	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE tags (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    name TEXT NOT NULL UNIQUE COLLATE NOCASE
+	);
+	CREATE TABLE entry_tags (
+	    entry_id INTEGER NOT NULL REFERENCES passwords(id) ON DELETE CASCADE,
+	    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	    PRIMARY KEY (entry_id, tag_id)
+	);
+	ALTER TABLE passwords ADD COLUMN folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL;`,
+
+	// 3: Typed custom fields on entries
+	`
+	CREATE TABLE custom_fields (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    entry_id INTEGER NOT NULL REFERENCES passwords(id) ON DELETE CASCADE,
+	    name TEXT NOT NULL,
+	    field_type TEXT NOT NULL,
+	    value TEXT NOT NULL, -- AES-256 encrypted
+	    position INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX custom_fields_entry ON custom_fields (entry_id);`,
+
+	// 4: Entry types beyond logins
+	`ALTER TABLE passwords ADD COLUMN entry_type TEXT NOT NULL DEFAULT 'login';`,
+
+	// 5: Encrypted file attachments, stored as a sequence of encrypted stream chunks
+	`
+	CREATE TABLE attachments (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    entry_id INTEGER NOT NULL REFERENCES passwords(id) ON DELETE CASCADE,
+	    name TEXT NOT NULL,
+	    size INTEGER NOT NULL DEFAULT 0, -- Plaintext size in bytes
+	    stream_id BLOB NOT NULL,          -- Random ID authenticated with every chunk
+	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE attachment_chunks (
+	    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+	    seq INTEGER NOT NULL,
+	    data BLOB NOT NULL,
+	    PRIMARY KEY (attachment_id, seq)
+	);`,
+
+	// 6: Per-vault key derivation settings (defaults match the parameters every earlier vault used)
+	`
+	ALTER TABLE vault_metadata ADD COLUMN kdf_time INTEGER NOT NULL DEFAULT 6;
+	ALTER TABLE vault_metadata ADD COLUMN kdf_memory INTEGER NOT NULL DEFAULT 65536;
+	ALTER TABLE vault_metadata ADD COLUMN kdf_threads INTEGER NOT NULL DEFAULT 4;`,
+
+	// 7: Record of unencrypted exports
+	`
+	CREATE TABLE plaintext_exports (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    format TEXT NOT NULL,
+	    path TEXT NOT NULL,
+	    entries INTEGER NOT NULL,
+	    exported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// 8: Hash-chained audit log, append-only (failed unlocks wait unencrypted until the next unlock)
+	`
+	CREATE TABLE audit_log (
+	    id INTEGER PRIMARY KEY, -- Consecutive from 1
+	    record TEXT NOT NULL,   -- Encrypted with the audit key
+	    mac TEXT NOT NULL       -- HMAC-SHA256 chaining the record to the previous one
+	);
+	CREATE TABLE audit_state (
+	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	    audit_key TEXT NOT NULL, -- AES-256 encrypted
+	    head TEXT NOT NULL       -- MAC over the record count and latest record, detects truncation
+	);
+	CREATE TABLE audit_failed_unlocks (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    actor TEXT NOT NULL,
+	    attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;`,
+
+	// 9: UUIDs, modification times and a logical clock for sync, maintained by triggers
+	syncTrackingMigration(),
+
+	// 10: Merge state per sync peer (the common ancestor of each object) and unresolved conflicts
+	`
+	CREATE TABLE sync_peers (
+	    peer TEXT PRIMARY KEY, -- Path or URL of the other copy
+	    synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE sync_base (
+	    peer TEXT NOT NULL REFERENCES sync_peers(peer) ON DELETE CASCADE,
+	    uuid TEXT NOT NULL,
+	    snapshot TEXT NOT NULL, -- AES-256 encrypted JSON of the object after the last sync
+	    PRIMARY KEY (peer, uuid)
+	);
+	CREATE TABLE sync_conflicts (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    uuid TEXT NOT NULL UNIQUE, -- Entry in conflict
+	    peer TEXT NOT NULL,
+	    local TEXT NOT NULL,  -- AES-256 encrypted JSON, empty if deleted here
+	    remote TEXT NOT NULL, -- AES-256 encrypted JSON, empty if deleted in the other copy
+	    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// 11: Entries moved out of the vault by an integrity repair, kept as stored for manual recovery
+	`
+	CREATE TABLE quarantine (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    entry_uuid TEXT,
+	    service TEXT NOT NULL,
+	    username TEXT NOT NULL,
+	    reason TEXT NOT NULL,
+	    record TEXT NOT NULL, -- JSON of the entry's rows, values still encrypted
+	    quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// 12: Time each password was last changed (NULL for older entries, read as their creation time)
+	`ALTER TABLE passwords ADD COLUMN password_changed_at TEXT;`,
+
+	// 13: Password rotation policies (days, see RotationInherit and RotationNever) and entry expiry dates
+	`
+	ALTER TABLE passwords ADD COLUMN expires_at TEXT; -- DateFormat, NULL if the entry does not expire
+	ALTER TABLE folders ADD COLUMN rotation_days INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE vault_metadata ADD COLUMN rotation_days INTEGER NOT NULL DEFAULT 0;`,
+
+	// 14: Marker that the vault has an audit log, so deleting the log together with its key is detected
+	`ALTER TABLE vault_metadata ADD COLUMN audit_marker TEXT; -- AES-256 encrypted, NULL until the log is started`,
+}
+
+// =-- Sync Tracking --= //
+
+// syncTables maps the tables whose rows are synced to the change kind they report
+var syncTables = []struct {
+	table string
+	kind  ChangeKind
+}{
+	{"passwords", ChangeEntry},
+	{"folders", ChangeFolder},
+	{"tags", ChangeTag},
+	{"attachments", ChangeAttachment},
+}
+
+// sqlNewUUID is an SQL expression generating a random (version 4) UUID
+const sqlNewUUID = `(lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' ||
+	substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+	substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6))))`
+
+// sqlNow is an SQL expression for the current UTC time in syncTimeFormat
+const sqlNow = `strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`
+
+// syncTrackingMigration builds migration 9. Every change to a synced row takes the next value of the
+// vault's logical clock as its version, and deletions leave a tombstone. Writes that set a version
+// themselves (when merging another copy) keep it and only move the clock forward.
+func syncTrackingMigration() string {
+	var migration strings.Builder
+	migration.WriteString(`
+	CREATE TABLE sync_state (
+	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	    vault_id TEXT NOT NULL, -- Shared by every copy of the vault
+	    clock INTEGER NOT NULL  -- Latest version handed out
+	);
+	INSERT INTO sync_state (id, vault_id, clock) VALUES (1, ` + sqlNewUUID + `, 1);
+	CREATE TABLE sync_tombstones (
+	    uuid TEXT PRIMARY KEY,
+	    kind TEXT NOT NULL,
+	    version INTEGER NOT NULL,
+	    deleted_at TEXT NOT NULL
+	);`)
+
+	for _, synced := range syncTables {
+		replacer := strings.NewReplacer("{table}", synced.table, "{kind}", string(synced.kind), "{uuid}", sqlNewUUID, "{now}", sqlNow)
+		migration.WriteString(replacer.Replace(`
+	ALTER TABLE {table} ADD COLUMN uuid TEXT;
+	ALTER TABLE {table} ADD COLUMN modified_at TEXT;
+	ALTER TABLE {table} ADD COLUMN version INTEGER;
+	UPDATE {table} SET uuid = {uuid}, modified_at = {now}, version = 1;
+	CREATE UNIQUE INDEX {table}_uuid ON {table} (uuid);
+	CREATE TRIGGER {table}_sync_insert AFTER INSERT ON {table} WHEN NEW.version IS NULL
+	BEGIN
+	    UPDATE sync_state SET clock = clock + 1;
+	    UPDATE {table} SET uuid = COALESCE(NEW.uuid, {uuid}), modified_at = COALESCE(NEW.modified_at, {now}),
+	        version = (SELECT clock FROM sync_state) WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER {table}_sync_update AFTER UPDATE ON {table} WHEN NEW.version IS OLD.version
+	BEGIN
+	    UPDATE sync_state SET clock = clock + 1;
+	    UPDATE {table} SET version = (SELECT clock FROM sync_state),
+	        modified_at = CASE WHEN NEW.modified_at IS OLD.modified_at THEN {now} ELSE NEW.modified_at END
+	    WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER {table}_sync_versioned AFTER UPDATE OF version ON {table} WHEN NEW.version > (SELECT clock FROM sync_state)
+	BEGIN
+	    UPDATE sync_state SET clock = NEW.version;
+	END;
+	CREATE TRIGGER {table}_sync_insert_versioned AFTER INSERT ON {table} WHEN NEW.version > (SELECT clock FROM sync_state)
+	BEGIN
+	    UPDATE sync_state SET clock = NEW.version;
+	END;
+	CREATE TRIGGER {table}_sync_delete AFTER DELETE ON {table} WHEN OLD.uuid IS NOT NULL
+	BEGIN
+	    UPDATE sync_state SET clock = clock + 1;
+	    INSERT OR REPLACE INTO sync_tombstones (uuid, kind, version, deleted_at)
+	    SELECT OLD.uuid, '{kind}', clock, {now} FROM sync_state;
+	END;`))
+	}
+
+	// Custom fields and tag assignments are part of their entry
+	for _, child := range []struct{ table, events string }{
+		{"custom_fields", "INSERT UPDATE DELETE"},
+		{"entry_tags", "INSERT DELETE"},
+	} {
+		for _, event := range strings.Fields(child.events) {
+			row := "NEW"
+			if event == "DELETE" {
+				row = "OLD"
+			}
+			replacer := strings.NewReplacer("{table}", child.table, "{event}", event, "{lower}", strings.ToLower(event), "{row}", row, "{now}", sqlNow)
+			migration.WriteString(replacer.Replace(`
+	CREATE TRIGGER {table}_sync_{lower} AFTER {event} ON {table}
+	BEGIN
+	    UPDATE sync_state SET clock = clock + 1;
+	    UPDATE passwords SET version = (SELECT clock FROM sync_state), modified_at = {now} WHERE id = {row}.entry_id;
+	END;`))
+		}
+	}
+
+	return migration.String()
+}
+
+// migrate applies any schema migrations the vault has not yet seen
+func migrate(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		log.Printf("Error reading schema version: %v", err)
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		// Each migration and its version bump are applied atomically
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			log.Printf("Error applying schema migration %d: %v", i+1, err)
+			return err
+		}
+
+		// PRAGMA statements do not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// needsMigration returns whether an existing vault (one that already has entries tables) has pending migrations
+func needsMigration(db *sql.DB) (bool, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		return false, err
+	}
+	if version >= len(migrations) {
+		return false, nil
+	}
+
+	var tables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'passwords';").Scan(&tables)
+	return tables > 0, err
+}
+
+// busyTimeoutMillis is how long a connection waits for another connection or process to release the
+// database before failing with "database is locked"
+const busyTimeoutMillis = 5000
+
+// openSQLite opens an SQLite database file with the connection settings every vault requires
+func openSQLite(dbPath string) (*sql.DB, error) {
+	// Foreign keys are required for folder and tag cascades. WAL lets readers continue while another
+	// connection writes, and immediate transactions take the write lock up front so two transactions
+	// never deadlock upgrading from read to write (which the busy timeout cannot resolve).
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate",
+		escapeSQLitePath(dbPath), busyTimeoutMillis))
+}
+
+// openSQLiteReadOnly opens an SQLite database file without allowing writes (or creating the file)
+func openSQLiteReadOnly(dbPath string) (*sql.DB, error) {
+	// Read-only mode is only accepted in URI file names
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", escapeSQLitePath(dbPath), busyTimeoutMillis))
+}
+
+// escapeSQLitePath escapes the characters that would end the path part of an SQLite URI
+func escapeSQLitePath(dbPath string) string {
+	return strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(dbPath)
+}
@@ -2,117 +2,241 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
+	"unicode"
 
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/encryption"
 	_ "github.com/mattn/go-sqlite3" // REQUIRED - Used to init SQLite driver
 )
 
-// GetVaultDirectoryPath returns the vault directory path depending on OS
-func GetVaultDirectoryPath() string {
-	var vaultPath string
+// VaultExtension is the file extension of SQLite vaults
+const VaultExtension = ".sqlite"
+
+// maxVaultNameLength is the longest accepted vault name (characters)
+const maxVaultNameLength = 64
+
+var (
+	ErrInvalidVaultName = errors.New("invalid vault name")
+	ErrVaultExists      = errors.New("vault already exists")
+	ErrVaultNotFound    = fmt.Errorf("vault does not exist: %w", os.ErrNotExist)
+	ErrNotVault         = errors.New("file is not a PassLock vault")
+)
+
+// =-- Vault Names --= //
+
+// reservedVaultNames are device names Windows will not accept as file names, with or without an extension
+var reservedVaultNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ValidateVaultName checks that a vault name is safe to use as a file name on every OS
+func ValidateVaultName(vaultName string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidVaultName, vaultName, reason)
+	}
 
-	switch runtime.GOOS {
-	case "darwin": // MacOS
-		vaultPath = filepath.Join(os.Getenv("HOME"), "Library", "Application Support", "PassLock", "vaults")
-	case "linux":
-		vaultPath = filepath.Join(os.Getenv("HOME"), ".config", "passlock", "vaults")
-	case "windows":
-		vaultPath = filepath.Join(os.Getenv("APPDATA"), "PassLock", "vaults")
-	default:
-		vaultPath = "./vaults" // Fallback to current directory
+	if strings.TrimSpace(vaultName) == "" {
+		return invalid("name cannot be empty")
+	}
+	if len([]rune(vaultName)) > maxVaultNameLength {
+		return invalid(fmt.Sprintf("name cannot be longer than %d characters", maxVaultNameLength))
+	}
+	if vaultName != strings.TrimSpace(vaultName) {
+		return invalid("name cannot start or end with spaces")
+	}
+	if strings.HasPrefix(vaultName, ".") || strings.HasSuffix(vaultName, ".") {
+		return invalid("name cannot start or end with a period")
 	}
 
-	return vaultPath
+	for _, r := range vaultName {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return invalid(fmt.Sprintf("name cannot contain %q", r))
+		}
+	}
+
+	base := strings.ToUpper(strings.SplitN(vaultName, ".", 2)[0])
+	if reservedVaultNames[base] {
+		return invalid("name is reserved by the operating system")
+	}
+
+	return nil
 }
 
-// GetDatabasePath returns the OS-specific path for a specific vault
-func GetDatabasePath(vaultName string) string {
-	var basePath string
+// VaultNameFromPath returns the vault name a vault file is registered under by default
+func VaultNameFromPath(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), VaultExtension)
+}
+
+// =-- Vault Paths --= //
 
-	switch runtime.GOOS {
-	case "darwin": // MacOS
-		basePath = filepath.Join(os.Getenv("HOME"), "Library", "Application Support", "PassLock", "vaults")
-	case "linux":
-		basePath = filepath.Join(os.Getenv("HOME"), ".config", "passlock", "vaults")
-	case "windows":
-		basePath = filepath.Join(os.Getenv("APPDATA"), "PassLock", "vaults")
-	default:
-		basePath = "./vaults" // Fallback to current directory
+// GetVaultDirectoryPath returns the directory new vaults are created in
+func GetVaultDirectoryPath() string {
+	return config.Current().VaultDirectory
+}
+
+// VaultPath returns the path of a vault from its name: a registered path, an existing vault in one of the
+// vault directories, or otherwise the path a new vault would be created at
+func VaultPath(vaultName string) (string, error) {
+	err := ValidateVaultName(vaultName)
+	if err != nil {
+		return "", err
+	}
+
+	registered, err := RegisteredVaults()
+	if err != nil {
+		return "", err
+	}
+	if path, ok := registered[vaultName]; ok {
+		return path, nil
 	}
 
+	for _, dir := range config.Current().VaultSearchPaths() {
+		path := filepath.Join(dir, vaultName+VaultExtension)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	basePath := GetVaultDirectoryPath()
+
 	// Ensure the directory exists
-	err := os.MkdirAll(basePath, 0700)
+	err = os.MkdirAll(basePath, 0700)
 	if err != nil {
 		log.Printf("Could not create database directory: %s", err)
+		return "", err
+	}
+
+	return filepath.Join(basePath, vaultName+VaultExtension), nil
+}
+
+// GetDatabasePath returns the path of a specific vault, or "" if the name is invalid
+func GetDatabasePath(vaultName string) string {
+	path, err := VaultPath(vaultName)
+	if err != nil {
+		log.Printf("Error resolving vault path: %v", err)
 		return ""
 	}
 
-	return filepath.Join(basePath, vaultName+".sqlite")
+	return path
 }
 
+// =-- Vault Management Functions --= //
+
 // CreateVault creates an SQLite vault given vaultName and authentication key authKey
 func CreateVault(vaultName string, hashedAuthKey string, authKeySalt string) error {
-	dbPath := GetDatabasePath(vaultName)
+	return CreateVaultWithKDF(vaultName, hashedAuthKey, authKeySalt, encryption.DefaultArgon2Params)
+}
 
-	// Ensure the vault does not already exist
-	if _, err := os.Stat(dbPath); err == nil {
-		log.Printf("Vault %s already exists", vaultName)
-		return nil
-	} else if !os.IsNotExist(err) {
+// CreateVaultWithKDF is CreateVault for keys derived with non-default Argon2 parameters, which are
+// recorded so the vault can be unlocked later
+func CreateVaultWithKDF(vaultName string, hashedAuthKey string, authKeySalt string, params encryption.Argon2Params) error {
+	dbPath, err := VaultPath(vaultName)
+	if err != nil {
 		return err
 	}
 
-	// Create the SQLite database file
-	file, err := os.OpenFile(dbPath, os.O_CREATE, 0600)
+	return createVaultFile(dbPath, vaultName, hashedAuthKey, authKeySalt, params)
+}
+
+// CreateVaultAt creates a vault at an explicit file path and registers it, returning its vault name
+func CreateVaultAt(path string, hashedAuthKey string, authKeySalt string, params encryption.Argon2Params) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	vaultName := VaultNameFromPath(path)
+
+	err = checkVaultNameFree(vaultName, path)
+	if err != nil {
+		return "", err
+	}
+
+	err = createVaultFile(path, vaultName, hashedAuthKey, authKeySalt, params)
+	if err != nil {
+		return "", err
+	}
+
+	return vaultName, RegisterVault(vaultName, path)
+}
+
+// createVaultFile creates a new vault file, failing with ErrVaultExists if the file is already there
+func createVaultFile(dbPath string, vaultName string, hashedAuthKey string, authKeySalt string, params encryption.Argon2Params) error {
+	err := ValidateVaultName(vaultName)
+	if err != nil {
+		return err
+	}
+	err = params.Validate()
+	if err != nil {
+		return err
+	}
+
+	// Create the SQLite database file, O_EXCL makes sure an existing vault is never reused
+	file, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		log.Printf("Vault %s already exists", vaultName)
+		return fmt.Errorf("%w: %s", ErrVaultExists, vaultName)
+	}
 	if err != nil {
 		log.Printf("Error creating database: %s", err)
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Printf("Error closing database: %s", err)
-		}
-	}(file)
+	err = file.Close()
+	if err != nil {
+		log.Printf("Error closing database: %s", err)
+		return err
+	}
+
+	err = initVaultFile(dbPath, vaultName, hashedAuthKey, authKeySalt, params)
+	if err != nil {
+		// Do not leave a half-created vault behind
+		_ = os.Remove(dbPath)
+		return err
+	}
+
+	return nil
+}
 
+// initVaultFile creates the tables and metadata of a new, empty vault file
+func initVaultFile(dbPath string, vaultName string, hashedAuthKey string, authKeySalt string, params encryption.Argon2Params) error {
 	// Open the database
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := openSQLite(dbPath)
 	if err != nil {
 		log.Printf("Error opening database: %s", err)
 		return err
 	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			log.Printf("Error closing database: %s", err)
+		}
+	}(db)
 
 	// Create necessary tables
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS passwords (
-	    id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    service TEXT NOT NULL,
-	    username TEXT NOT NULL,
-	    password TEXT NOT NULL, -- AES-256 encrypted
-	    notes TEXT,             -- Optional encrypted field
-	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE TABLE IF NOT EXISTS vault_metadata (
-	    vault_name TEXT PRIMARY KEY,
-	    auth_key TEXT NOT NULL,
-	    salt TEXT NOT NULL
-	);`
-
-	_, err = db.Exec(createTableSQL)
+	err = migrate(db)
 	if err != nil {
-		log.Printf("Error creating table: %s", err)
+		log.Printf("Error creating tables: %s", err)
 		return err
 	}
 
 	// Store the authentication key in vault_metadata
 	_, err = db.Exec(
-		"INSERT INTO vault_metadata (vault_name, auth_key, salt) VALUES (?, ?, ?)",
+		"INSERT INTO vault_metadata (vault_name, auth_key, salt, kdf_time, kdf_memory, kdf_threads) VALUES (?, ?, ?, ?, ?, ?)",
 		vaultName,
 		hashedAuthKey,
 		authKeySalt,
+		params.Time,
+		params.Memory,
+		params.Threads,
 	)
 	if err != nil {
 		log.Printf("Error inserting metadata: %s", err)
@@ -123,39 +247,140 @@ func CreateVault(vaultName string, hashedAuthKey string, authKeySalt string) err
 
 // InitDB returns a database instance for an existing database
 func InitDB(vaultName string) (*sql.DB, error) {
-	dbPath := GetDatabasePath(vaultName)
+	dbPath, err := VaultPath(vaultName)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if the database exists
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		log.Printf("Vault %s does not exist", vaultName)
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, vaultName)
+	}
+
+	return OpenVaultFile(dbPath)
+}
+
+// OpenVaultFile returns a database instance for an existing vault at an explicit file path
+func OpenVaultFile(path string) (*sql.DB, error) {
+	return openVaultFile(path, false)
+}
+
+// openVaultFile opens an existing vault file and migrates it, taking the vault's write lock for the
+// migration unless the caller already holds it
+func openVaultFile(path string, locked bool) (*sql.DB, error) {
+	// Check if the database exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Printf("Vault file %s does not exist", path)
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, path)
 	}
 
 	// Open SQLite database
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := openSQLite(path)
 	if err != nil {
 		log.Printf("Error opening database: %s", err)
 		return nil, err
 	}
 
+	// Back up vaults created by older versions, then bring them up to the current schema
+	pending, err := needsMigration(db)
+	if err == nil && pending {
+		err = migrateVaultFile(db, path, locked)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
-// ListVaults lists all vaults in the vault directory
+// migrateVaultFile backs up and migrates an open vault, holding its write lock so no other process
+// migrates or writes to it at the same time
+func migrateVaultFile(db *sql.DB, path string, locked bool) error {
+	if !locked {
+		lock, err := acquireLock(path)
+		if err != nil {
+			return err
+		}
+		defer func(lock *fileLock) {
+			err := lock.release()
+			if err != nil {
+				log.Printf("Error releasing lock of vault %s: %v", path, err)
+			}
+		}(lock)
+
+		// Another process may have migrated the vault while the lock was held
+		pending, err := needsMigration(db)
+		if err != nil || !pending {
+			return err
+		}
+	}
+
+	err := backupOpenVault(db, BackupMigration)
+	if err != nil {
+		return err
+	}
+
+	return migrate(db)
+}
+
+// ListVaults lists all registered vaults and vaults in every configured vault directory, except archived ones
 func ListVaults() ([]string, error) {
-	vaultDir := GetVaultDirectoryPath()
+	archived, err := archivedVaults()
+	if err != nil {
+		return nil, err
+	}
 
-	// Read files in directory
-	files, err := os.ReadDir(vaultDir)
+	all, err := allVaults()
 	if err != nil {
 		return nil, err
 	}
 
-	// Iterate through files
 	var vaults []string
-	for _, file := range files {
-		if !file.IsDir() && filepath.Ext(file.Name()) == ".sqlite" {
-			vaultName := file.Name()[:len(file.Name())-len(".sqlite")] // Remove .sqlite extension
+	for _, vaultName := range all {
+		if !archived[vaultName] {
+			vaults = append(vaults, vaultName)
+		}
+	}
+
+	return vaults, nil
+}
+
+// allVaults lists every vault, archived or not
+func allVaults() ([]string, error) {
+	seen := make(map[string]bool)
+	var vaults []string
+
+	for _, vaultDir := range config.Current().VaultSearchPaths() {
+		// Read files in directory, directories that do not exist yet are skipped
+		files, err := os.ReadDir(vaultDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Iterate through files, a name found in an earlier directory shadows later ones
+		for _, file := range files {
+			if !file.IsDir() && filepath.Ext(file.Name()) == VaultExtension {
+				vaultName := VaultNameFromPath(file.Name())
+				if !seen[vaultName] && ValidateVaultName(vaultName) == nil {
+					seen[vaultName] = true
+					vaults = append(vaults, vaultName)
+				}
+			}
+		}
+	}
+
+	registered, err := RegisteredVaults()
+	if err != nil {
+		return nil, err
+	}
+	for _, vaultName := range sortedKeys(registered) {
+		if !seen[vaultName] {
+			seen[vaultName] = true
 			vaults = append(vaults, vaultName)
 		}
 	}
@@ -163,22 +388,108 @@ func ListVaults() ([]string, error) {
 	return vaults, nil
 }
 
-// DeleteVault deletes a specific vault given its file name
+// DeleteVault deletes a specific vault given its name, registered vaults are also unregistered
 func DeleteVault(vaultName string) error {
-	vaultPath := GetDatabasePath(vaultName)
+	vaultPath, err := VaultPath(vaultName)
+	if err != nil {
+		return err
+	}
 
 	// Check if vault exists
 	if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
 		log.Printf("Error: vault %s does not exist", vaultName)
+		return fmt.Errorf("%w: %s", ErrVaultNotFound, vaultName)
+	}
+
+	// A vault open in another process cannot be deleted under it
+	lock, err := acquireLock(vaultPath)
+	if err != nil {
 		return err
 	}
+	defer removeLock(lock, vaultPath)
 
 	// Attempt to remove vault
-	err := os.Remove(vaultPath)
+	err = os.Remove(vaultPath)
 	if err != nil {
 		log.Printf("Error deleting vault: %v", err)
 		return err
 	}
+	for _, suffix := range sqliteSideFiles {
+		_ = os.Remove(vaultPath + suffix)
+	}
+
+	// Forget the vault's registration and archive flag
+	return updateRegistry(func(registry *vaultRegistry) error {
+		delete(registry.Vaults, vaultName)
+		delete(registry.Archived, vaultName)
+		return nil
+	})
+}
+
+// checkVaultNameFree returns ErrVaultExists if vaultName already refers to a vault other than path
+func checkVaultNameFree(vaultName string, path string) error {
+	existing, err := VaultPath(vaultName)
+	if err != nil {
+		return err
+	}
+	if existing == path {
+		return nil
+	}
+	if _, err := os.Stat(existing); err == nil {
+		return fmt.Errorf("%w: %s", ErrVaultExists, vaultName)
+	}
+
+	return nil
+}
+
+// =-- File Helpers --= //
+
+// createPrivateFile creates an empty file only the current user can read, for VACUUM INTO to write a copy
+// of a vault into, as the file SQLite creates itself is readable by others under a permissive umask
+func createPrivateFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+
+	// Remove the temporary file if anything fails before the rename
+	success := false
+	defer func() {
+		if !success {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	if err := temp.Chmod(perm); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return err
+	}
 
+	success = true
 	return nil
 }
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// ErrEntryNotFound is returned by stores when no entry has the requested ID
+var ErrEntryNotFound = errors.New("password entry not found")
+
+// =-- Storage Backend Interface --= //
+
+// VaultMetadata stores the unencrypted information needed to unlock a vault
+type VaultMetadata struct {
+	VaultName string // Vault name
+	AuthKey   string // Authentication key compared when unlocking
+	Salt      string // Key derivation salt
+}
+
+// Store is a vault storage backend. Values are stored exactly as given, so passwords and notes must
+// already be encrypted by the caller. It only covers entries and unlock metadata: folders, tags, custom
+// fields, attachments, the audit log and sync state are relational and only exist in SQLite vaults.
+type Store interface {
+	// StorePassword stores a new entry and returns it with its assigned ID and creation time
+	StorePassword(entry PasswordEntry) (*PasswordInformation, error)
+	// GetEntryFromID returns a single entry, or ErrEntryNotFound
+	GetEntryFromID(id int) (*PasswordInformation, error)
+	// GetEntriesFromService returns every entry with exactly the given service
+	GetEntriesFromService(service string) ([]*PasswordInformation, error)
+	// GetAllEntries returns every entry ordered by ID
+	GetAllEntries() ([]*PasswordInformation, error)
+	// DeleteEntryFromID deletes a single entry, or returns ErrEntryNotFound
+	DeleteEntryFromID(id int) error
+	// ClearDatabase deletes every entry
+	ClearDatabase() error
+	// GetMetadata returns the vault metadata, or sql.ErrNoRows if it was never set
+	GetMetadata() (*VaultMetadata, error)
+	// SetMetadata creates or replaces the vault metadata
+	SetMetadata(metadata VaultMetadata) error
+	// Close releases the backend
+	Close() error
+}
+
+// =-- SQLite Backend --= //
+
+// SQLiteStore is the Store backed by an SQLite vault file
+type SQLiteStore struct {
+	DB *sql.DB // Underlying database, also usable with the package-level functions
+}
+
+// NewSQLiteStore wraps an open vault database as a Store
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{DB: db}
+}
+
+// OpenSQLiteStore opens an existing vault from the vault directory as a Store
+func OpenSQLiteStore(vaultName string) (*SQLiteStore, error) {
+	db, err := InitDB(vaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLiteStore(db), nil
+}
+
+// OpenMemoryDB returns an SQLite vault database that only exists in memory, for tests and ephemeral sessions
+func OpenMemoryDB() (*sql.DB, error) {
+	// Every connection to ":memory:" is a new database, so pin the pool to a single connection
+	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	err = migrate(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// StorePassword stores a new entry in the vault
+func (store *SQLiteStore) StorePassword(entry PasswordEntry) (*PasswordInformation, error) {
+	return StorePassword(store.DB, entry)
+}
+
+// GetEntryFromID returns a single entry
+func (store *SQLiteStore) GetEntryFromID(id int) (*PasswordInformation, error) {
+	entry, err := GetEntryFromID(store.DB, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEntryNotFound
+	}
+	return entry, err
+}
+
+// GetEntriesFromService returns every entry with the given service
+func (store *SQLiteStore) GetEntriesFromService(service string) ([]*PasswordInformation, error) {
+	return GetEntriesFromService(store.DB, service)
+}
+
+// GetAllEntries returns every entry in the vault
+func (store *SQLiteStore) GetAllEntries() ([]*PasswordInformation, error) {
+	return GetAllEntries(store.DB)
+}
+
+// DeleteEntryFromID deletes a single entry
+func (store *SQLiteStore) DeleteEntryFromID(id int) error {
+	var exists int
+	err := store.DB.QueryRow("SELECT COUNT(*) FROM passwords WHERE id = ?;", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrEntryNotFound
+	}
+
+	return DeleteEntryFromID(store.DB, id)
+}
+
+// ClearDatabase deletes every entry
+func (store *SQLiteStore) ClearDatabase() error {
+	return ClearDatabase(store.DB)
+}
+
+// GetMetadata returns the vault metadata
+func (store *SQLiteStore) GetMetadata() (*VaultMetadata, error) {
+	var metadata VaultMetadata
+	err := store.DB.QueryRow("SELECT vault_name, auth_key, salt FROM vault_metadata LIMIT 1;").Scan(
+		&metadata.VaultName, &metadata.AuthKey, &metadata.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// SetMetadata creates or replaces the vault metadata (a vault has a single metadata row)
+func (store *SQLiteStore) SetMetadata(metadata VaultMetadata) error {
+	tx, err := store.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM vault_metadata;")
+	if err == nil {
+		_, err = tx.Exec(
+			"INSERT INTO vault_metadata (vault_name, auth_key, salt) VALUES (?, ?, ?);",
+			metadata.VaultName, metadata.AuthKey, metadata.Salt)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		log.Printf("Error writing vault metadata: %v", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close closes the underlying database
+func (store *SQLiteStore) Close() error {
+	return store.DB.Close()
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// ChangeKind is the kind of object a sync change belongs to
+type ChangeKind string
+
+const (
+	ChangeEntry      ChangeKind = "entry"      // Password entry, including its custom fields and tags
+	ChangeFolder     ChangeKind = "folder"     // Folder
+	ChangeTag        ChangeKind = "tag"        // Tag name
+	ChangeAttachment ChangeKind = "attachment" // Attached file
+)
+
+// syncTimeFormat is the layout of modified_at and deleted_at values (UTC with milliseconds)
+const syncTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// ErrObjectNotFound is returned when no object has the requested UUID
+var ErrObjectNotFound = errors.New("no object with this UUID")
+
+// Change describes the latest change to a synced object
+type Change struct {
+	Kind       ChangeKind // Kind of object
+	UUID       string     // Stable ID, the same in every copy of the vault
+	ID         int        // Row ID in this copy (0 for deletions)
+	Version    int64      // Logical clock value of the change
+	ModifiedAt time.Time  // When the change was made (UTC)
+	Deleted    bool       // Whether the object was deleted
+}
+
+// =-- Sync Tracking Functions --= //
+
+// GetVaultID returns the ID shared by every copy of a vault
+func GetVaultID(db *sql.DB) (string, error) {
+	var vaultID string
+	err := db.QueryRow("SELECT vault_id FROM sync_state WHERE id = 1;").Scan(&vaultID)
+	if err != nil {
+		log.Printf("Error reading vault ID: %v", err)
+		return "", err
+	}
+
+	return vaultID, nil
+}
+
+// GetVaultClock returns the vault's logical clock, the version of its latest change
+func GetVaultClock(db *sql.DB) (int64, error) {
+	var clock int64
+	err := db.QueryRow("SELECT clock FROM sync_state WHERE id = 1;").Scan(&clock)
+	if err != nil {
+		log.Printf("Error reading vault clock: %v", err)
+		return 0, err
+	}
+
+	return clock, nil
+}
+
+// ChangesSince returns every object changed or deleted after version, oldest change first. Passing the
+// clock from an earlier call returns only what changed since then.
+func ChangesSince(db *sql.DB, version int64) ([]Change, error) {
+	var changes []Change
+	for _, synced := range syncTables {
+		rows, err := db.Query("SELECT id, uuid, version, modified_at FROM "+synced.table+" WHERE version > ?;", version)
+		if err != nil {
+			log.Printf("Error reading changes to %s: %v", synced.table, err)
+			return nil, err
+		}
+		found, err := scanChanges(rows, synced.kind, false)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, found...)
+	}
+
+	rows, err := db.Query("SELECT 0, uuid, version, deleted_at, kind FROM sync_tombstones WHERE version > ?;", version)
+	if err != nil {
+		log.Printf("Error reading deletions: %v", err)
+		return nil, err
+	}
+	deleted, err := scanChanges(rows, "", true)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, deleted...)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Version < changes[j].Version
+	})
+	return changes, nil
+}
+
+// scanChanges reads id, uuid, version and time columns, followed by the kind for tombstones
+func scanChanges(rows *sql.Rows, kind ChangeKind, deleted bool) ([]Change, error) {
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var changes []Change
+	for rows.Next() {
+		change := Change{Kind: kind, Deleted: deleted}
+		var modifiedAt string
+		dest := []any{&change.ID, &change.UUID, &change.Version, &modifiedAt}
+		if deleted {
+			dest = append(dest, &change.Kind)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		change.ModifiedAt = parseSyncTime(modifiedAt)
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// GetEntryByUUID returns the entry with a UUID, or ErrObjectNotFound
+func GetEntryByUUID(db *sql.DB, uuid string) (*PasswordInformation, error) {
+	entry, err := scanEntry(db.QueryRow("SELECT "+entryColumns+" FROM passwords WHERE uuid = ? LIMIT 1;", uuid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching entry %s: %v", uuid, err)
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// parseSyncTime parses a modified_at or deleted_at value, returning the zero time if it is malformed
+func parseSyncTime(value string) time.Time {
+	parsed, err := time.Parse(syncTimeFormat, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
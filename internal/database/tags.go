@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+)
+
+// ErrEmptyTag is returned when assigning a blank tag
+var ErrEmptyTag = errors.New("tag cannot be empty")
+
+// =-- Tag Management Functions --= //
+
+// AddTagToEntry assigns a tag to an entry, creating the tag if it does not exist yet
+func AddTagToEntry(db *sql.DB, entryID int, tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return ErrEmptyTag
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = tagEntry(tx, entryID, tag)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// tagEntry assigns a trimmed, non-empty tag to an entry using either a database or a transaction
+func tagEntry(q execQuerier, entryID int, tag string) error {
+	// Tags are matched case-insensitively, keep the first spelling used
+	_, err := q.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?);", tag)
+	if err != nil {
+		log.Printf("Error creating tag '%s': %v", tag, err)
+		return err
+	}
+
+	_, err = q.Exec(`
+	INSERT OR IGNORE INTO entry_tags (entry_id, tag_id)
+	SELECT ?, id FROM tags WHERE name = ?;`, entryID, tag)
+	if err != nil {
+		log.Printf("Error tagging entry %d with '%s': %v", entryID, tag, err)
+		return err
+	}
+
+	return nil
+}
+
+// RemoveTagFromEntry unassigns a tag from an entry, unused tags are removed
+func RemoveTagFromEntry(db *sql.DB, entryID int, tag string) error {
+	_, err := db.Exec(`
+	DELETE FROM entry_tags
+	WHERE entry_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?);`, entryID, strings.TrimSpace(tag))
+	if err != nil {
+		log.Printf("Error removing tag '%s' from entry %d: %v", tag, entryID, err)
+		return err
+	}
+
+	return deleteUnusedTags(db)
+}
+
+// SetEntryTags replaces all tags of an entry with the given list
+func SetEntryTags(db *sql.DB, entryID int, tags []string) error {
+	_, err := db.Exec("DELETE FROM entry_tags WHERE entry_id = ?;", entryID)
+	if err != nil {
+		log.Printf("Error clearing tags for entry %d: %v", entryID, err)
+		return err
+	}
+
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		err = AddTagToEntry(db, entryID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deleteUnusedTags(db)
+}
+
+// GetTagsForEntry returns the tags assigned to an entry ordered by name
+func GetTagsForEntry(db *sql.DB, entryID int) ([]string, error) {
+	return queryTagNames(db, `
+	SELECT tags.name FROM tags
+	JOIN entry_tags ON entry_tags.tag_id = tags.id
+	WHERE entry_tags.entry_id = ?
+	ORDER BY tags.name COLLATE NOCASE;`, entryID)
+}
+
+// ListTags returns every tag in the vault ordered by name
+func ListTags(db *sql.DB) ([]string, error) {
+	return queryTagNames(db, "SELECT name FROM tags ORDER BY name COLLATE NOCASE;")
+}
+
+// GetEntriesWithTag returns all entries assigned the given tag
+func GetEntriesWithTag(db *sql.DB, tag string) ([]*PasswordInformation, error) {
+	rows, err := db.Query(`
+	SELECT `+entryColumns+` FROM passwords
+	WHERE id IN (
+	    SELECT entry_tags.entry_id FROM entry_tags
+	    JOIN tags ON tags.id = entry_tags.tag_id
+	    WHERE tags.name = ?
+	);`, strings.TrimSpace(tag))
+	if err != nil {
+		log.Printf("Error fetching entries for tag '%s': %v", tag, err)
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+// GetAllEntryTags returns the tags of every tagged entry keyed by entry ID
+func GetAllEntryTags(db *sql.DB) (map[int][]string, error) {
+	rows, err := db.Query(`
+	SELECT entry_tags.entry_id, tags.name FROM entry_tags
+	JOIN tags ON tags.id = entry_tags.tag_id
+	ORDER BY tags.name COLLATE NOCASE;`)
+	if err != nil {
+		log.Printf("Error fetching entry tags: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var entryID int
+		var name string
+		if err := rows.Scan(&entryID, &name); err != nil {
+			return nil, err
+		}
+		tags[entryID] = append(tags[entryID], name)
+	}
+
+	return tags, rows.Err()
+}
+
+// =-- Tag Helpers --= //
+
+// queryTagNames runs a query returning a single column of tag names
+func queryTagNames(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error fetching tags: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+
+	return tags, rows.Err()
+}
+
+// deleteUnusedTags removes tags that are no longer assigned to any entry
+func deleteUnusedTags(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM entry_tags);")
+	if err != nil {
+		log.Printf("Error removing unused tags: %v", err)
+	}
+
+	return err
+}
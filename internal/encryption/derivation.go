@@ -3,6 +3,8 @@ package encryption
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+
 	"golang.org/x/crypto/argon2"
 )
 
@@ -23,6 +25,33 @@ var DefaultArgon2Params = Argon2Params{
 	KeyLen:  64,        // For two 32-byte key for AES-256 (K_enc, K_auth)
 }
 
+// Upper bounds on Argon2 parameters, so parameters read from a file cannot exhaust memory or hang
+// before the password is even checked
+const (
+	MaxArgon2Time    = 100             // Iterations
+	MaxArgon2Memory  = 4 * 1024 * 1024 // KB (4 GB)
+	MaxArgon2Threads = 64              // Threads
+)
+
+// ErrInvalidArgon2Params is returned when key derivation parameters are unusable
+var ErrInvalidArgon2Params = errors.New("invalid Argon2 parameters")
+
+// Validate checks that the parameters can derive both master keys within the upper bounds
+func (params Argon2Params) Validate() error {
+	if params.Time == 0 || params.Threads == 0 || params.KeyLen != 64 {
+		return ErrInvalidArgon2Params
+	}
+	// Argon2 requires at least 8 KB of memory per thread
+	if params.Memory < 8*uint32(params.Threads) {
+		return ErrInvalidArgon2Params
+	}
+	if params.Time > MaxArgon2Time || params.Memory > MaxArgon2Memory || params.Threads > MaxArgon2Threads {
+		return ErrInvalidArgon2Params
+	}
+
+	return nil
+}
+
 // =-- Primary Functions --= //
 
 // GenerateSalt Generates a randomized salt given size in bytes
@@ -41,6 +70,16 @@ func GenerateSalt(size int) (string, error) {
 
 // DeriveMasterKeys Derives two keys (encryption, auth) from password using argon2 given salt
 func DeriveMasterKeys(password string, saltB64 string) (string, string, error) {
+	return DeriveMasterKeysWithParams(password, saltB64, DefaultArgon2Params)
+}
+
+// DeriveMasterKeysWithParams is DeriveMasterKeys with the Argon2 parameters a vault was created with
+func DeriveMasterKeysWithParams(password string, saltB64 string, params Argon2Params) (string, string, error) {
+	err := params.Validate()
+	if err != nil {
+		return "", "", err
+	}
+
 	// Decode and format salt
 	salt, err := base64.StdEncoding.DecodeString(saltB64)
 	if err != nil {
@@ -48,7 +87,6 @@ func DeriveMasterKeys(password string, saltB64 string) (string, string, error) {
 	}
 
 	// Derive key
-	params := DefaultArgon2Params
 	masterKey := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
 
 	// Split the master 64-byte key into K_auth and K_enc
@@ -0,0 +1,249 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// =-- Streaming Encryption Parameters --= //
+
+// Streams are split into chunks that are each sealed with AES-GCM 256. Every chunk nonce is built from a
+// random per-stream prefix, the chunk counter and a final-chunk flag, so reordered, dropped or truncated
+// chunks fail authentication (the STREAM construction).
+const (
+	StreamChunkSize   = 64 * 1024 // Plaintext bytes per chunk
+	streamVersion     = 1         // Format version written in the stream header
+	streamPrefixSize  = 7         // Random nonce prefix size (bytes)
+	streamHeaderSize  = 1 + streamPrefixSize
+	streamTagSize     = 16 // AES-GCM authentication tag size (bytes)
+	streamSealedChunk = StreamChunkSize + streamTagSize
+)
+
+var (
+	ErrStreamHeader    = errors.New("invalid encrypted stream header")
+	ErrStreamCorrupt   = errors.New("encrypted stream failed authentication")
+	ErrStreamTruncated = errors.New("encrypted stream is truncated")
+	ErrStreamTooLong   = errors.New("encrypted stream has too many chunks")
+	ErrStreamClosed    = errors.New("encrypted stream writer is closed")
+)
+
+// newStreamAEAD creates the AES-GCM cipher used by both stream directions
+func newStreamAEAD(keyB64 string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// streamNonce builds the nonce for a chunk from the stream prefix, counter and final flag
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// =-- Encryption --= //
+
+// encryptWriter encrypts everything written to it as a chunked stream
+type encryptWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	buffer  []byte
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer that encrypts to dst with key, binding every chunk to associatedData.
+// Close must be called to write the final chunk, otherwise the stream will not decrypt.
+func NewEncryptWriter(dst io.Writer, keyB64 string, associatedData []byte) (io.WriteCloser, error) {
+	aead, err := newStreamAEAD(keyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: version byte followed by the random nonce prefix
+	header := make([]byte, streamHeaderSize)
+	header[0] = streamVersion
+	_, err = rand.Read(header[1:])
+	if err != nil {
+		return nil, err
+	}
+	_, err = dst.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		dst:    dst,
+		aead:   aead,
+		aad:    associatedData,
+		prefix: header[1:],
+		buffer: make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+// Write buffers plaintext and seals every full chunk once more data is known to follow
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrStreamClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, so the last chunk can be flagged final
+		if len(w.buffer) == StreamChunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buffer[len(w.buffer):StreamChunkSize], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the remaining buffered plaintext as the final chunk
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	return w.seal(true)
+}
+
+// seal encrypts the buffered plaintext as one chunk and writes it to the destination
+func (w *encryptWriter) seal(final bool) error {
+	if w.counter == math.MaxUint32 {
+		return ErrStreamTooLong
+	}
+
+	sealed := w.aead.Seal(nil, streamNonce(w.prefix, w.counter, final), w.buffer, w.aad)
+	_, err := w.dst.Write(sealed)
+	if err != nil {
+		return err
+	}
+
+	w.counter++
+	w.buffer = w.buffer[:0]
+
+	return nil
+}
+
+// =-- Decryption --= //
+
+// decryptReader decrypts and authenticates a chunked stream
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	sealed  []byte
+	opened  []byte
+	plain   []byte
+	done    bool
+}
+
+// NewDecryptReader returns a reader that decrypts a stream written by NewEncryptWriter. Data is only
+// returned after its chunk authenticates, but callers must discard everything read if an error occurs.
+func NewDecryptReader(src io.Reader, keyB64 string, associatedData []byte) (io.Reader, error) {
+	aead, err := newStreamAEAD(keyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	_, err = io.ReadFull(src, header)
+	if err != nil || header[0] != streamVersion {
+		return nil, ErrStreamHeader
+	}
+
+	return &decryptReader{
+		src:    bufio.NewReaderSize(src, streamSealedChunk+1),
+		aead:   aead,
+		aad:    associatedData,
+		prefix: header[1:],
+		sealed: make([]byte, streamSealedChunk),
+		opened: make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+// Read returns decrypted plaintext, opening the next chunk when the current one is exhausted
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+// open reads and authenticates the next chunk
+func (r *decryptReader) open() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	// A short chunk, or a full one with nothing after it, must be the final chunk
+	final := n < len(r.sealed)
+	if !final {
+		if _, peekErr := r.src.Peek(1); errors.Is(peekErr, io.EOF) {
+			final = true
+		}
+	}
+
+	if n < streamTagSize {
+		return ErrStreamTruncated
+	}
+
+	// Open into a separate buffer, a failed in-place open would clobber the ciphertext
+	plain, err := r.aead.Open(r.opened[:0], streamNonce(r.prefix, r.counter, final), r.sealed[:n], r.aad)
+	if err != nil {
+		// A non-final chunk at the end of the data means the final chunk was cut off
+		if final {
+			if _, retryErr := r.aead.Open(nil, streamNonce(r.prefix, r.counter, false), r.sealed[:n], r.aad); retryErr == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return ErrStreamCorrupt
+	}
+
+	r.counter++
+	r.plain = plain
+	r.done = final
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"bytes"
+	"database/sql"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Decrypted Vault Contents --= //
+
+// Field is a decrypted custom field
+type Field struct {
+	Name  string
+	Type  database.FieldType
+	Value string
+}
+
+// Attachment is a decrypted attached file
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Item is the decrypted contents of one entry
+type Item struct {
+	Entry       *database.PasswordInformation // Stored entry
+	Password    string                        // Decrypted password
+	Notes       string                        // Decrypted notes
+	Folder      []string                      // Folder path from the top level
+	Tags        []string                      // Tags
+	Fields      []Field                       // Custom fields in display order
+	Attachments []Attachment                  // Attached files (only if requested)
+	CreatedAt   time.Time                     // Creation time (zero if unknown)
+}
+
+// collectItems decrypts every entry in the vault, with attachments if withAttachments is set
+func collectItems(db *sql.DB, encryptionKey string, withAttachments bool) ([]*Item, error) {
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := database.GetAllEntryTags(db)
+	if err != nil {
+		return nil, err
+	}
+	folderPaths, err := folderPaths(db)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(entries))
+	for _, entry := range entries {
+		item := &Item{
+			Entry:     entry,
+			Folder:    folderPaths[entry.FolderID],
+			Tags:      tags[entry.ID],
+			CreatedAt: parseTimestamp(entry.CreatedAt),
+		}
+
+		item.Password, err = encryption.Decrypt(entry.EncryptedPassword, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if entry.EncryptedNotes != "" {
+			item.Notes, err = encryption.Decrypt(entry.EncryptedNotes, encryptionKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fields, err := database.GetCustomFields(db, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			value, err := encryption.Decrypt(field.EncryptedValue, encryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			item.Fields = append(item.Fields, Field{Name: field.Name, Type: field.Type, Value: value})
+		}
+
+		if withAttachments {
+			attachments, err := database.ListAttachments(db, entry.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, attachment := range attachments {
+				var data bytes.Buffer
+				err = database.ExtractAttachment(db, encryptionKey, attachment.ID, &data)
+				if err != nil {
+					return nil, err
+				}
+				item.Attachments = append(item.Attachments, Attachment{Name: attachment.Name, Data: data.Bytes()})
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// folderPaths returns the path of every folder by ID
+func folderPaths(db *sql.DB) (map[int][]string, error) {
+	folders, err := database.ListFolders(db)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*database.Folder)
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+
+	paths := make(map[int][]string)
+	var pathOf func(id int, depth int) []string
+	pathOf = func(id int, depth int) []string {
+		folder, ok := byID[id]
+		if !ok || depth > len(byID) {
+			return nil
+		}
+		if path, ok := paths[id]; ok {
+			return path
+		}
+		path := append(append([]string(nil), pathOf(folder.ParentID, depth+1)...), folder.Name)
+		paths[id] = path
+		return path
+	}
+	for id := range byID {
+		pathOf(id, 0)
+	}
+
+	return paths, nil
+}
+
+// parseTimestamp reads an SQLite timestamp, zero if it has an unknown layout
+func parseTimestamp(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/importer"
+	"github.com/cpainter1/PassLock/internal/kdbx"
+)
+
+// KDBXExtension is the file extension of KeePass databases
+const KDBXExtension = ".kdbx"
+
+// =-- KeePass Export Functions --= //
+
+// ExportKDBX writes every entry, folder, tag, custom field and attachment of the vault to a KeePass KDBX 4
+// database protected by password. Folders become groups and non-login entries keep their type in an
+// extra string so importing the file again restores them.
+func ExportKDBX(db *sql.DB, encryptionKey string, w io.Writer, password string, options kdbx.Options) error {
+	items, err := collectItems(db, encryptionKey, true)
+	if err != nil {
+		return err
+	}
+
+	name := "PassLock"
+	if metadata, err := database.NewSQLiteStore(db).GetMetadata(); err == nil {
+		name = metadata.VaultName
+	}
+
+	root := &kdbx.Group{UUID: kdbx.NewUUID(), Name: name}
+	groups, err := folderGroups(db, root)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		group := root
+		if item.Entry.FolderID != 0 {
+			group = groups[item.Entry.FolderID]
+		}
+		group.Entries = append(group.Entries, keePassEntry(item))
+	}
+
+	err = kdbx.Write(w, &kdbx.Database{Name: name, Root: root}, password, options)
+	if err != nil {
+		return err
+	}
+
+	return database.AppendAudit(db, encryptionKey, database.AuditRecord{
+		Event:  database.AuditExport,
+		Detail: fmt.Sprintf("%d entries as a KeePass database", len(items)),
+	})
+}
+
+// folderGroups mirrors the folder tree as KeePass groups below root, returning the groups by folder ID
+func folderGroups(db *sql.DB, root *kdbx.Group) (map[int]*kdbx.Group, error) {
+	folders, err := database.ListFolders(db)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[int]*kdbx.Group)
+	for _, folder := range folders {
+		groups[folder.ID] = &kdbx.Group{UUID: kdbx.NewUUID(), Name: folder.Name}
+	}
+	for _, folder := range folders {
+		parent, ok := groups[folder.ParentID]
+		if !ok {
+			parent = root
+		}
+		parent.Groups = append(parent.Groups, groups[folder.ID])
+	}
+
+	return groups, nil
+}
+
+// keePassEntry converts a decrypted item into a KeePass entry
+func keePassEntry(item *Item) *kdbx.Entry {
+	entry := &kdbx.Entry{
+		UUID:     kdbx.NewUUID(),
+		Tags:     item.Tags,
+		Created:  item.CreatedAt,
+		Modified: item.CreatedAt,
+	}
+	entry.Set(kdbx.KeyTitle, item.Entry.Service, false)
+	entry.Set(kdbx.KeyUserName, item.Entry.Username, false)
+	entry.Set(kdbx.KeyPassword, item.Password, true)
+	entry.Set(kdbx.KeyNotes, item.Notes, false)
+
+	if item.Entry.EntryType != "" && item.Entry.EntryType != database.EntryLogin {
+		entry.Set(importer.EntryTypeKey, string(item.Entry.EntryType), false)
+	}
+
+	// KeePass string names must be unique and must not shadow the standard strings
+	used := map[string]bool{kdbx.KeyTitle: true, kdbx.KeyUserName: true, kdbx.KeyPassword: true,
+		kdbx.KeyNotes: true, importer.EntryTypeKey: true}
+	for _, field := range item.Fields {
+		if strings.EqualFold(field.Name, kdbx.KeyURL) && !used[kdbx.KeyURL] {
+			entry.Set(kdbx.KeyURL, field.Value, false)
+			used[kdbx.KeyURL] = true
+			continue
+		}
+
+		key := field.Name
+		for n := 2; used[key] || kdbx.IsStandardKey(key); n++ {
+			key = fmt.Sprintf("%s (%d)", field.Name, n)
+		}
+		used[key] = true
+		entry.Set(key, field.Value, field.Type.IsSecret())
+	}
+
+	names := make(map[string]bool)
+	for _, attachment := range item.Attachments {
+		name := attachment.Name
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("%d-%s", n, attachment.Name)
+		}
+		names[name] = true
+		entry.Attachments = append(entry.Attachments, kdbx.Attachment{Name: name, Data: attachment.Data})
+	}
+	sort.SliceStable(entry.Attachments, func(i, j int) bool {
+		return entry.Attachments[i].Name < entry.Attachments[j].Name
+	})
+
+	return entry
+}
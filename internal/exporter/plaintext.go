@@ -0,0 +1,272 @@
+package exporter
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// PlaintextFormat is the file format of an unencrypted export
+type PlaintextFormat string
+
+const (
+	PlaintextJSON PlaintextFormat = "json" // Every entry with folders, tags, fields and attachments
+	PlaintextCSV  PlaintextFormat = "csv"  // Common interchange columns only
+)
+
+var (
+	ErrUnknownPlaintextFormat = errors.New("unknown plaintext export format")
+	ErrWorldReadable          = errors.New("export location is readable by other users")
+)
+
+// plaintextCSVHeader lists the CSV columns, recognized by the CSV importers of most password managers
+var plaintextCSVHeader = []string{"title", "url", "username", "password", "notes", "folder", "tags", "totp"}
+
+// =-- Plaintext Export Functions --= //
+
+// ExportPlaintext writes every entry of the vault, decrypted, to path as JSON or CSV and returns how many
+// entries were written. The master password must be entered again, the file is only readable by its owner,
+// and locations other users can read are refused unless force is set. The export is recorded in the vault.
+func ExportPlaintext(db *sql.DB, encryptionKey string, masterPassword string, path string, format PlaintextFormat, force bool) (int, error) {
+	if format != PlaintextJSON && format != PlaintextCSV {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownPlaintextFormat, format)
+	}
+
+	err := database.VerifyMasterPassword(db, masterPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	if !force {
+		err = checkPrivateLocation(path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	items, err := collectItems(db, encryptionKey, format == PlaintextJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	err = writePrivateFile(path, func(w io.Writer) error {
+		if format == PlaintextCSV {
+			return writePlaintextCSV(w, items)
+		}
+		return writePlaintextJSON(w, db, items)
+	})
+	if err != nil {
+		log.Printf("Error writing plaintext export: %v", err)
+		return 0, err
+	}
+
+	err = database.RecordPlaintextExport(db, string(format), path, len(items))
+	if err != nil {
+		return 0, err
+	}
+	err = database.AppendAudit(db, encryptionKey, database.AuditRecord{
+		Event:  database.AuditExport,
+		Detail: fmt.Sprintf("%d entries as plaintext %s to %s", len(items), format, path),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
+
+// checkPrivateLocation refuses a destination whose directory, or existing file, other users can read
+func checkPrivateLocation(path string) error {
+	// Windows does not use Unix permission bits
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0o004 != 0 {
+		return fmt.Errorf("%w: %s", ErrWorldReadable, dir)
+	}
+
+	info, err = os.Stat(path)
+	if err == nil && info.Mode().Perm()&0o004 != 0 {
+		return fmt.Errorf("%w: %s", ErrWorldReadable, path)
+	}
+
+	return nil
+}
+
+// writePrivateFile writes a file with owner-only permissions, replacing path only once it is complete
+func writePrivateFile(path string, write func(w io.Writer) error) error {
+	// CreateTemp creates files with 0600 permissions
+	file, err := os.CreateTemp(filepath.Dir(path), ".passlock-export-*")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, 0o600)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
+
+// =-- JSON Export --= //
+
+// plaintextVault is the document written by JSON exports
+type plaintextVault struct {
+	Vault      string           `json:"vault"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Folders    [][]string       `json:"folders"`
+	Entries    []plaintextEntry `json:"entries"`
+}
+
+// plaintextEntry is a decrypted entry in a JSON export
+type plaintextEntry struct {
+	Type        database.EntryType    `json:"type"`
+	Service     string                `json:"service"`
+	Username    string                `json:"username"`
+	Password    string                `json:"password"`
+	Notes       string                `json:"notes,omitempty"`
+	Folder      []string              `json:"folder,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Fields      []plaintextField      `json:"fields,omitempty"`
+	Attachments []plaintextAttachment `json:"attachments,omitempty"`
+	CreatedAt   *time.Time            `json:"created_at,omitempty"`
+}
+
+// plaintextField is a decrypted custom field in a JSON export
+type plaintextField struct {
+	Name  string             `json:"name"`
+	Type  database.FieldType `json:"type"`
+	Value string             `json:"value"`
+}
+
+// plaintextAttachment is an attached file in a JSON export, its data is base64 encoded
+type plaintextAttachment struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// writePlaintextJSON writes the full structure of the vault
+func writePlaintextJSON(w io.Writer, db *sql.DB, items []*Item) error {
+	vault := plaintextVault{ExportedAt: time.Now().UTC(), Folders: [][]string{}, Entries: []plaintextEntry{}}
+	if metadata, err := database.NewSQLiteStore(db).GetMetadata(); err == nil {
+		vault.Vault = metadata.VaultName
+	}
+
+	// Folders are listed separately so empty folders are kept
+	paths, err := folderPaths(db)
+	if err != nil {
+		return err
+	}
+	folders, err := database.ListFolders(db)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		vault.Folders = append(vault.Folders, paths[folder.ID])
+	}
+
+	for _, item := range items {
+		entry := plaintextEntry{
+			Type:     item.Entry.EntryType,
+			Service:  item.Entry.Service,
+			Username: item.Entry.Username,
+			Password: item.Password,
+			Notes:    item.Notes,
+			Folder:   item.Folder,
+			Tags:     item.Tags,
+		}
+		if entry.Type == "" {
+			entry.Type = database.EntryLogin
+		}
+		if !item.CreatedAt.IsZero() {
+			entry.CreatedAt = &item.CreatedAt
+		}
+		for _, field := range item.Fields {
+			entry.Fields = append(entry.Fields, plaintextField(field))
+		}
+		for _, attachment := range item.Attachments {
+			entry.Attachments = append(entry.Attachments, plaintextAttachment(attachment))
+		}
+		vault.Entries = append(vault.Entries, entry)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(vault)
+}
+
+// =-- CSV Export --= //
+
+// writePlaintextCSV writes one row per entry with the common interchange columns
+func writePlaintextCSV(w io.Writer, items []*Item) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(plaintextCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var rawURL, totp string
+		for _, field := range item.Fields {
+			switch {
+			case strings.EqualFold(field.Name, "URL") && rawURL == "":
+				rawURL = field.Value
+			case strings.EqualFold(field.Name, "TOTP") && totp == "":
+				totp = field.Value
+			}
+		}
+
+		err = writer.Write([]string{
+			item.Entry.Service,
+			rawURL,
+			item.Entry.Username,
+			item.Password,
+			item.Notes,
+			strings.Join(item.Folder, "/"),
+			strings.Join(item.Tags, ","),
+			totp,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
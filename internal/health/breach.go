@@ -0,0 +1,174 @@
+package health
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrBreachData is returned when a breach dataset is not in the Have I Been Pwned format
+var ErrBreachData = errors.New("invalid breach data")
+
+const (
+	breachPrefixLen = 5   // Hash characters in a range file's name
+	maxBreachLine   = 128 // Longest accepted line of a breach dataset
+	breachScanSize  = 4096
+)
+
+// =-- Breach Data --= //
+
+// BreachData is a local copy of the Have I Been Pwned passwords, either the single file of SHA-1 hashes
+// sorted by hash or a directory of range files named by the first 5 characters of the hash. Lines are
+// "HASH:COUNT", with the prefix left out in range files. Lookups binary search the files on disk.
+type BreachData struct {
+	Path string
+
+	file *os.File // Single sorted file, nil for a range directory
+	size int64
+}
+
+// OpenBreachData opens a sorted hash file or a range directory
+func OpenBreachData(path string) (*BreachData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Error opening breach data %s: %v", path, err)
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachData{Path: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening breach data %s: %v", path, err)
+		return nil, err
+	}
+
+	return &BreachData{Path: path, file: file, size: info.Size()}, nil
+}
+
+// Close closes the sorted hash file
+func (data *BreachData) Close() error {
+	if data.file == nil {
+		return nil
+	}
+	return data.file.Close()
+}
+
+// BreachCount returns how many times a password appears in the breach data, 0 if it was never seen
+func (data *BreachData) BreachCount(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if data.file != nil {
+		return searchSorted(data.file, data.size, hash)
+	}
+
+	// Downloaders name range files with or without an extension
+	var file *os.File
+	var err error
+	for _, name := range []string{hash[:breachPrefixLen] + ".txt", hash[:breachPrefixLen]} {
+		file, err = os.Open(filepath.Join(data.Path, name))
+		if !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		log.Printf("Error opening breach range %s: %v", hash[:breachPrefixLen], err)
+		return 0, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return searchSorted(file, info.Size(), hash[breachPrefixLen:])
+}
+
+// searchSorted finds the count of key in a file of "KEY:COUNT" lines sorted by key. It bisects byte
+// offsets until the key is within a small window, then scans the window's lines.
+func searchSorted(r io.ReaderAt, size int64, key string) (int, error) {
+	// Every line starting before low has a smaller key, the line starting at high (if any) does not
+	low, high := int64(0), size
+	buffer := make([]byte, 2*maxBreachLine)
+	for high-low > breachScanSize {
+		middle := low + (high-low)/2
+		n, err := r.ReadAt(buffer, middle)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		newline := bytes.IndexByte(buffer[:n], '\n')
+		if newline < 0 {
+			return 0, fmt.Errorf("%w: line longer than %d bytes", ErrBreachData, maxBreachLine)
+		}
+		start := middle + int64(newline) + 1
+		if start >= high {
+			break
+		}
+
+		lineKey, _, err := parseBreachLine(buffer[newline+1 : n])
+		if err != nil {
+			return 0, err
+		}
+		if lineKey < key {
+			low = start
+		} else {
+			high = start
+		}
+	}
+
+	window := make([]byte, min(high-low+maxBreachLine, size-low))
+	n, err := r.ReadAt(window, low)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	for _, line := range bytes.Split(window[:n], []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		lineKey, count, err := parseBreachLine(line)
+		if err != nil {
+			// The window may end in the middle of a line past the key
+			break
+		}
+		if lineKey == key {
+			return count, nil
+		}
+		if lineKey > key {
+			break
+		}
+	}
+
+	return 0, nil
+}
+
+// parseBreachLine reads the key and count of the first line in data, a line without a count counts once
+func parseBreachLine(data []byte) (string, int, error) {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	key, countText, hasCount := strings.Cut(strings.TrimSpace(string(line)), ":")
+	if key == "" {
+		return "", 0, fmt.Errorf("%w: empty line", ErrBreachData)
+	}
+	if !hasCount {
+		return strings.ToUpper(key), 1, nil
+	}
+
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: bad count %q", ErrBreachData, countText)
+	}
+	return strings.ToUpper(key), count, nil
+}
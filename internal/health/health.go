@@ -0,0 +1,341 @@
+package health
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// Issue is a problem found with an entry's credentials
+type Issue string
+
+const (
+	IssueBreached Issue = "breached" // Password appears in known data breaches
+	IssueWeak     Issue = "weak"     // Password is easy to guess
+	IssueReused   Issue = "reused"   // Same password as another entry
+	IssueSimilar  Issue = "similar"  // Password nearly the same as another entry's
+	IssueOld      Issue = "old"      // Password not changed for longer than the maximum age
+	IssueInsecure Issue = "insecure" // Service or URL uses unencrypted http://
+	IssueNo2FA    Issue = "no_2fa"   // Login without a one-time password or 2FA marker
+)
+
+// issuePenalty is how much every issue lowers an entry's score out of 100
+var issuePenalty = map[Issue]int{
+	IssueBreached: 60,
+	IssueWeak:     40,
+	IssueReused:   30,
+	IssueSimilar:  15,
+	IssueOld:      10,
+	IssueInsecure: 15,
+	IssueNo2FA:    5,
+}
+
+// DefaultMaxAgeDays is the default age after which a password is reported as old
+const DefaultMaxAgeDays = 365
+
+// checkedTypes lists the entry types whose secret is a password
+var checkedTypes = map[database.EntryType]bool{
+	database.EntryLogin:    true,
+	database.EntryDatabase: true,
+	database.EntryWiFi:     true,
+}
+
+// ChecksEntryType reports whether entries of a type have a password that is checked
+func ChecksEntryType(entryType database.EntryType) bool {
+	return checkedTypes[entryType] || entryType == ""
+}
+
+// twoFactorNames are custom field names and tags that mark an entry as protected by a second factor
+var twoFactorNames = map[string]bool{"totp": true, "otp": true, "2fa": true, "mfa": true, "one-time password": true}
+
+// =-- Health Report Data Structures --= //
+
+// Options controls what the health report checks
+type Options struct {
+	MaxAgeDays int         // Passwords older than this are reported (0 disables)
+	Others     []Source    // Other unlocked vaults checked for reuse
+	Breaches   *BreachData // Known breached passwords (nil disables)
+}
+
+// Source is an unlocked vault whose passwords are compared with the reported vault's
+type Source struct {
+	Name          string  // Vault name shown in the report
+	DB            *sql.DB // Open vault
+	EncryptionKey string  // Vault encryption key
+}
+
+// EntryReport lists the issues found with one entry
+type EntryReport struct {
+	EntryID    int      `json:"entry_id"`
+	Service    string   `json:"service"`
+	Username   string   `json:"username,omitempty"`
+	Strength   Strength `json:"strength"` // 0 (very weak) to 4 (very strong)
+	Entropy    float64  `json:"entropy_bits"`
+	Breaches   int      `json:"breaches,omitempty"` // Times the password appears in known breaches
+	AgeDays    int      `json:"age_days"`           // Days since the password was changed
+	Issues     []Issue  `json:"issues"`
+	ReusedWith []string `json:"reused_with,omitempty"` // Entries with the same password
+	SimilarTo  []string `json:"similar_to,omitempty"`  // Entries with a nearly identical password
+}
+
+// Report is the password health of a vault, it never contains passwords
+type Report struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Checked     int            `json:"checked"` // Entries with a password that were checked
+	Score       int            `json:"score"`   // Overall health from 0 to 100
+	Counts      map[Issue]int  `json:"counts"`  // Entries with each issue
+	Entries     []*EntryReport `json:"entries"` // Entries with at least one issue, worst first
+}
+
+// credential is a decrypted password with what the checks need to know about its entry
+type credential struct {
+	entry     *database.PasswordInformation
+	label     string // Entry name used in other entries' reports
+	password  string
+	base      string // Normalized password compared for near duplicates
+	changedAt time.Time
+	insecure  bool
+	twoFactor bool
+}
+
+// =-- Health Report Functions --= //
+
+// BuildReport checks every password of an unlocked vault for strength, reuse, age, insecure URLs and a
+// missing second factor, comparing with any other vaults in options for reuse
+func BuildReport(db *sql.DB, encryptionKey string, options Options) (*Report, error) {
+	credentials, err := loadCredentials(db, encryptionKey, "")
+	if err != nil {
+		return nil, err
+	}
+	var others []*credential
+	for _, source := range options.Others {
+		loaded, err := loadCredentials(source.DB, source.EncryptionKey, source.Name)
+		if err != nil {
+			return nil, fmt.Errorf("vault %s: %w", source.Name, err)
+		}
+		others = append(others, loaded...)
+	}
+
+	compared := append(append([]*credential(nil), credentials...), others...)
+
+	now := time.Now()
+	report := &Report{GeneratedAt: now.UTC(), Checked: len(credentials), Counts: make(map[Issue]int)}
+	penalties := 0
+	for _, cred := range credentials {
+		entryReport := &EntryReport{
+			EntryID:  cred.entry.ID,
+			Service:  cred.entry.Service,
+			Username: cred.entry.Username,
+			Strength: EstimateStrength(cred.password),
+			Entropy:  math.Round(EstimateEntropy(cred.password)*10) / 10,
+		}
+		if options.Breaches != nil {
+			entryReport.Breaches, err = options.Breaches.BreachCount(cred.password)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !cred.changedAt.IsZero() {
+			entryReport.AgeDays = int(now.Sub(cred.changedAt).Hours() / 24)
+		}
+
+		for _, other := range compared {
+			switch {
+			case other == cred:
+			case other.password == cred.password:
+				entryReport.ReusedWith = append(entryReport.ReusedWith, other.label)
+			case similar(cred, other):
+				entryReport.SimilarTo = append(entryReport.SimilarTo, other.label)
+			}
+		}
+
+		// Checked from the most to the least severe
+		for _, check := range []struct {
+			issue Issue
+			found bool
+		}{
+			{IssueBreached, entryReport.Breaches > 0},
+			{IssueWeak, entryReport.Strength < StrengthFair},
+			{IssueReused, len(entryReport.ReusedWith) > 0},
+			{IssueSimilar, len(entryReport.SimilarTo) > 0},
+			{IssueInsecure, cred.insecure},
+			{IssueOld, options.MaxAgeDays > 0 && entryReport.AgeDays > options.MaxAgeDays},
+			{IssueNo2FA, cred.entry.EntryType == database.EntryLogin && !cred.twoFactor},
+		} {
+			if check.found {
+				entryReport.Issues = append(entryReport.Issues, check.issue)
+			}
+		}
+		if len(entryReport.Issues) == 0 {
+			continue
+		}
+
+		for _, issue := range entryReport.Issues {
+			report.Counts[issue]++
+		}
+		penalties += min(entryPenalty(entryReport), 100)
+		report.Entries = append(report.Entries, entryReport)
+	}
+
+	report.Score = 100
+	if len(credentials) > 0 {
+		report.Score = 100 - int(math.Round(float64(penalties)/float64(len(credentials))))
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		return entryPenalty(report.Entries[i]) > entryPenalty(report.Entries[j])
+	})
+
+	return report, nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (report *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// entryPenalty adds up the penalties of an entry's issues
+func entryPenalty(entry *EntryReport) int {
+	penalty := 0
+	for _, issue := range entry.Issues {
+		penalty += issuePenalty[issue]
+	}
+	return penalty
+}
+
+// loadCredentials decrypts every password of a vault, labelling entries with vaultName if it is set
+func loadCredentials(db *sql.DB, encryptionKey string, vaultName string) ([]*credential, error) {
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := database.GetAllEntryTags(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []*credential
+	for _, entry := range entries {
+		if !ChecksEntryType(entry.EntryType) {
+			continue
+		}
+		password, err := encryption.Decrypt(entry.EncryptedPassword, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if password == "" {
+			continue
+		}
+
+		cred := &credential{
+			entry:     entry,
+			label:     entry.Service,
+			password:  password,
+			base:      normalize(password),
+			changedAt: parseTimestamp(entry.PasswordChangedAt),
+			insecure:  isInsecureURL(entry.Service),
+		}
+		if cred.changedAt.IsZero() {
+			cred.changedAt = parseTimestamp(entry.CreatedAt)
+		}
+		if entry.Username != "" {
+			cred.label += " (" + entry.Username + ")"
+		}
+		if vaultName != "" {
+			cred.label = vaultName + ": " + cred.label
+		}
+
+		for _, tag := range tags[entry.ID] {
+			cred.twoFactor = cred.twoFactor || twoFactorNames[strings.ToLower(tag)]
+		}
+		fields, err := database.GetCustomFields(db, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if twoFactorNames[strings.ToLower(field.Name)] {
+				cred.twoFactor = true
+			}
+			if field.Type != database.FieldURL && !strings.EqualFold(field.Name, "URL") {
+				continue
+			}
+			value, err := encryption.Decrypt(field.EncryptedValue, encryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			cred.insecure = cred.insecure || isInsecureURL(value)
+		}
+
+		credentials = append(credentials, cred)
+	}
+
+	return credentials, nil
+}
+
+// similar reports whether two different passwords are near duplicates: the same base with other
+// capitals, substitutions or suffix, or at most two edits apart
+func similar(a *credential, b *credential) bool {
+	if len(a.base) >= 4 && a.base == b.base {
+		return true
+	}
+	if len(a.password) < 8 || len(b.password) < 8 {
+		return false
+	}
+	return editDistance(a.password, b.password, 2) <= 2
+}
+
+// editDistance returns the Levenshtein distance between two strings, or limit+1 once it exceeds limit
+func editDistance(a string, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > limit || -diff > limit {
+		return limit + 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// isInsecureURL reports whether a service or URL is an unencrypted http:// address
+func isInsecureURL(value string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "http://")
+}
+
+// parseTimestamp reads an entry timestamp, zero if it has an unknown layout
+func parseTimestamp(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
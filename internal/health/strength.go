@@ -0,0 +1,137 @@
+package health
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// =-- Strength Estimation --= //
+
+// Strength rates how hard a password is to guess, from StrengthVeryWeak to StrengthVeryStrong
+type Strength int
+
+const (
+	StrengthVeryWeak Strength = iota
+	StrengthWeak
+	StrengthFair
+	StrengthStrong
+	StrengthVeryStrong
+)
+
+// strengthBits are the estimated entropy (bits) needed for every strength above StrengthVeryWeak
+var strengthBits = []float64{28, 40, 60, 80}
+
+// String returns the display name of a strength
+func (strength Strength) String() string {
+	return [...]string{"very weak", "weak", "fair", "strong", "very strong"}[strength]
+}
+
+// commonPasswords lists widely used passwords and their common bases, which are guessed first
+var commonPasswords = map[string]bool{
+	"123456": true, "password": true, "12345678": true, "qwerty": true, "123456789": true, "12345": true,
+	"1234": true, "111111": true, "1234567": true, "dragon": true, "123123": true, "baseball": true,
+	"abc123": true, "football": true, "monkey": true, "letmein": true, "696969": true, "shadow": true,
+	"master": true, "666666": true, "qwertyuiop": true, "123321": true, "mustang": true, "1234567890": true,
+	"michael": true, "654321": true, "superman": true, "1qaz2wsx": true, "7777777": true, "121212": true,
+	"000000": true, "qazwsx": true, "123qwe": true, "killer": true, "trustno1": true, "jordan": true,
+	"jennifer": true, "zxcvbnm": true, "asdfgh": true, "hunter": true, "buster": true, "soccer": true,
+	"harley": true, "batman": true, "andrew": true, "tigger": true, "sunshine": true, "iloveyou": true,
+	"charlie": true, "robert": true, "thomas": true, "hockey": true, "ranger": true, "daniel": true,
+	"starwars": true, "football1": true, "112233": true, "george": true, "computer": true, "michelle": true,
+	"jessica": true, "pepper": true, "zxcvbn": true, "555555": true, "131313": true, "freedom": true,
+	"passw0rd": true, "maggie": true, "159753": true, "aaaaaa": true, "ginger": true, "princess": true,
+	"joshua": true, "cheese": true, "amanda": true, "summer": true, "love": true, "ashley": true,
+	"nicole": true, "chelsea": true, "biteme": true, "matthew": true, "access": true, "yankees": true,
+	"987654321": true, "dallas": true, "austin": true, "thunder": true, "taylor": true, "matrix": true,
+	"welcome": true, "admin": true, "login": true, "secret": true, "changeme": true, "root": true,
+	"hunter2": true, "test": true, "guest": true, "winter": true, "spring": true, "autumn": true,
+	"hello": true, "flower": true, "lovely": true, "whatever": true, "qwerty123": true, "asdf": true,
+}
+
+// leetReplacer undoes common character substitutions before comparing with known passwords
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// EstimateEntropy estimates the bits of entropy of a password from its character classes, discounting
+// repeated and sequential characters and passwords built on a common one
+func EstimateEntropy(password string) float64 {
+	if password == "" {
+		return 0
+	}
+	if commonPasswords[strings.ToLower(password)] {
+		return 0
+	}
+
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	bitsPerChar := math.Log2(float64(pool))
+
+	// A character repeating or continuing a sequence (e.g., "aaa", "abc", "321") adds almost nothing
+	var bits float64
+	runes := []rune(password)
+	for i, r := range runes {
+		if i > 0 && (r == runes[i-1] || r == runes[i-1]+1 || r == runes[i-1]-1) {
+			bits++
+			continue
+		}
+		bits += bitsPerChar
+	}
+
+	// A common password with substitutions, capitals or a digit and symbol suffix only adds the bits of
+	// the changes
+	if base := normalize(password); commonPasswords[base] {
+		suffix := float64(len(runes) - len([]rune(base)))
+		bits = math.Min(bits, suffix*math.Log2(10+33)+10)
+	}
+
+	return bits
+}
+
+// EstimateStrength rates a password by its estimated entropy
+func EstimateStrength(password string) Strength {
+	bits := EstimateEntropy(password)
+	strength := StrengthVeryWeak
+	for _, threshold := range strengthBits {
+		if bits < threshold {
+			break
+		}
+		strength++
+	}
+	return strength
+}
+
+// normalize reduces a password to its guessable base: lowercase, substitutions undone and any digits or
+// symbols at the end removed
+func normalize(password string) string {
+	base := strings.ToLower(password)
+	base = strings.TrimRightFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if base == "" {
+		// Passwords without letters are compared as they are
+		return strings.ToLower(password)
+	}
+	return leetReplacer.Replace(base)
+}
@@ -0,0 +1,399 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	ErrNotBitwardenJSON     = errors.New("file is not a Bitwarden JSON export")
+	ErrBitwardenAccountKey  = errors.New("export is encrypted with a Bitwarden account key, export it with a password instead")
+	ErrBitwardenPassword    = errors.New("incorrect Bitwarden export password")
+	ErrBitwardenUnsupported = errors.New("unsupported Bitwarden export encryption")
+	ErrBitwardenCorrupt     = errors.New("invalid encrypted Bitwarden data")
+)
+
+// Bitwarden item and custom field types
+const (
+	bitwardenLogin    = 1
+	bitwardenNote     = 2
+	bitwardenCard     = 3
+	bitwardenIdentity = 4
+	bitwardenSSHKey   = 5
+
+	bitwardenFieldText    = 0
+	bitwardenFieldHidden  = 1
+	bitwardenFieldBoolean = 2
+	bitwardenFieldLinked  = 3
+
+	bitwardenKDFPBKDF2   = 0
+	bitwardenKDFArgon2id = 1
+)
+
+// =-- Bitwarden Export Format --= //
+
+// bitwardenExport is the top level of a Bitwarden JSON export, encrypted or not
+type bitwardenExport struct {
+	Encrypted         bool   `json:"encrypted"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	Salt              string `json:"salt"`
+	KDFType           int    `json:"kdfType"`
+	KDFIterations     int    `json:"kdfIterations"`
+	KDFMemory         int    `json:"kdfMemory"`
+	KDFParallelism    int    `json:"kdfParallelism"`
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string `json:"data"`
+
+	Folders     []bitwardenFolder `json:"folders"`
+	Collections []bitwardenFolder `json:"collections"`
+	Items       []bitwardenItem   `json:"items"`
+}
+
+// bitwardenFolder is a folder or, in organization exports, a collection
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// bitwardenItem is a single vault item
+type bitwardenItem struct {
+	Type          int       `json:"type"`
+	Name          string    `json:"name"`
+	Notes         string    `json:"notes"`
+	FolderID      string    `json:"folderId"`
+	CollectionIDs []string  `json:"collectionIds"`
+	RevisionDate  time.Time `json:"revisionDate"`
+	Fields        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		Type  int    `json:"type"`
+	} `json:"fields"`
+	Login *struct {
+		URIs []struct {
+			URI string `json:"uri"`
+		} `json:"uris"`
+		Username             string            `json:"username"`
+		Password             string            `json:"password"`
+		PasswordRevisionDate time.Time         `json:"passwordRevisionDate"`
+		TOTP                 string            `json:"totp"`
+		FIDO2Credentials     []json.RawMessage `json:"fido2Credentials"`
+	} `json:"login"`
+	Card *struct {
+		CardholderName string `json:"cardholderName"`
+		Brand          string `json:"brand"`
+		Number         string `json:"number"`
+		ExpMonth       string `json:"expMonth"`
+		ExpYear        string `json:"expYear"`
+		Code           string `json:"code"`
+	} `json:"card"`
+	Identity *struct {
+		Title          string `json:"title"`
+		FirstName      string `json:"firstName"`
+		MiddleName     string `json:"middleName"`
+		LastName       string `json:"lastName"`
+		Address1       string `json:"address1"`
+		Address2       string `json:"address2"`
+		Address3       string `json:"address3"`
+		City           string `json:"city"`
+		State          string `json:"state"`
+		PostalCode     string `json:"postalCode"`
+		Country        string `json:"country"`
+		Company        string `json:"company"`
+		Email          string `json:"email"`
+		Phone          string `json:"phone"`
+		SSN            string `json:"ssn"`
+		Username       string `json:"username"`
+		PassportNumber string `json:"passportNumber"`
+		LicenseNumber  string `json:"licenseNumber"`
+	} `json:"identity"`
+	SSHKey *struct {
+		PrivateKey     string `json:"privateKey"`
+		PublicKey      string `json:"publicKey"`
+		KeyFingerprint string `json:"keyFingerprint"`
+	} `json:"sshKey"`
+	PasswordHistory []struct {
+		LastUsedDate time.Time `json:"lastUsedDate"`
+		Password     string    `json:"password"`
+	} `json:"passwordHistory"`
+}
+
+// =-- Bitwarden Import Functions --= //
+
+// ParseBitwardenJSON reads a Bitwarden JSON export, decrypting it with password if it is password
+// protected. Item types, folders (or collections), custom fields, TOTP seeds and password history are kept.
+func ParseBitwardenJSON(r io.Reader, password string) (*Result, error) {
+	var export bitwardenExport
+	err := json.NewDecoder(r).Decode(&export)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotBitwardenJSON, err)
+	}
+
+	if export.Encrypted {
+		if !export.PasswordProtected {
+			return nil, ErrBitwardenAccountKey
+		}
+		data, err := decryptBitwardenExport(&export, password)
+		if err != nil {
+			return nil, err
+		}
+		export = bitwardenExport{}
+		err = json.Unmarshal(data, &export)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotBitwardenJSON, err)
+		}
+	}
+	if export.Items == nil {
+		return nil, ErrNotBitwardenJSON
+	}
+
+	folders := make(map[string][]string)
+	for _, folder := range append(export.Folders, export.Collections...) {
+		folders[folder.ID] = splitFolderPath(folder.Name, "/", "")
+	}
+
+	result := &Result{Format: FormatBitwardenJSON, DryRun: true}
+	for i, item := range export.Items {
+		record, reason := bitwardenRecord(result, item)
+		if reason != "" {
+			result.Skipped = append(result.Skipped, SkippedRow{Line: i + 1, Reason: reason})
+			continue
+		}
+
+		record.Folder = folders[item.FolderID]
+		if item.FolderID == "" && len(item.CollectionIDs) > 0 {
+			record.Folder = folders[item.CollectionIDs[0]]
+		}
+		result.Records = append(result.Records, *record)
+	}
+
+	return result, nil
+}
+
+// ImportBitwardenJSON reads a Bitwarden JSON export and, unless dryRun is set, stores its entries in the vault
+func ImportBitwardenJSON(db *sql.DB, encryptionKey string, r io.Reader, password string, dryRun bool) (*Result, error) {
+	result, err := ParseBitwardenJSON(r, password)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(result.Records) == 0 {
+		return result, nil
+	}
+
+	return result, Apply(db, encryptionKey, result)
+}
+
+// bitwardenRecord converts a Bitwarden item, or returns why it was skipped
+func bitwardenRecord(result *Result, item bitwardenItem) (*database.ImportRecord, string) {
+	title := strings.TrimSpace(item.Name)
+	record := &database.ImportRecord{Service: title, Notes: item.Notes, EntryType: database.EntryLogin, ChangedAt: item.RevisionDate}
+
+	entryType := database.EntryLogin
+	values := make(map[string]string)
+	switch item.Type {
+	case bitwardenLogin:
+		var urls []string
+		if login := item.Login; login != nil {
+			for _, uri := range login.URIs {
+				urls = append(urls, uri.URI)
+			}
+			record.Username = login.Username
+			record.Password = login.Password
+			// Only set once the password was changed, the item's revision date covers any edit
+			if !login.PasswordRevisionDate.IsZero() {
+				record.ChangedAt = login.PasswordRevisionDate
+			}
+			if totp := strings.TrimSpace(login.TOTP); totp != "" {
+				record.Fields = append(record.Fields, database.ImportField{Name: "TOTP", Type: database.FieldHidden, Value: totp})
+			}
+			if len(login.FIDO2Credentials) > 0 {
+				result.warn(title, "passkeys cannot be imported")
+			}
+		}
+		setService(record, title, urls)
+
+	case bitwardenNote:
+		entryType = database.EntrySecureNote
+		record.Password, record.Notes = item.Notes, ""
+
+	case bitwardenCard:
+		entryType = database.EntryCard
+		if card := item.Card; card != nil {
+			record.Username = card.CardholderName
+			record.Password = card.Number
+			values["expiry"] = cardExpiry(card.ExpMonth, card.ExpYear)
+			values["cvv"] = card.Code
+			values["brand"] = card.Brand
+		}
+
+	case bitwardenIdentity:
+		entryType = database.EntryIdentity
+		if identity := item.Identity; identity != nil {
+			record.Username = joinNonEmpty(" ", identity.Title, identity.FirstName, identity.MiddleName, identity.LastName)
+			values["email"] = identity.Email
+			values["phone"] = identity.Phone
+			values["address"] = joinNonEmpty(", ", identity.Address1, identity.Address2, identity.Address3)
+			values["city"] = identity.City
+			values["postal_code"] = identity.PostalCode
+			values["country"] = identity.Country
+			values["id_number"] = identity.SSN
+			addTextField(record, "State", identity.State, database.FieldText)
+			addTextField(record, "Company", identity.Company, database.FieldText)
+			addTextField(record, "Username", identity.Username, database.FieldText)
+			addTextField(record, "Passport number", identity.PassportNumber, database.FieldHidden)
+			addTextField(record, "License number", identity.LicenseNumber, database.FieldHidden)
+		}
+
+	case bitwardenSSHKey:
+		entryType = database.EntrySSHKey
+		if key := item.SSHKey; key != nil {
+			record.Password = key.PrivateKey
+			values["public_key"] = key.PublicKey
+			addTextField(record, "Fingerprint", key.KeyFingerprint, database.FieldText)
+		}
+
+	default:
+		return nil, fmt.Sprintf("unsupported item type %d", item.Type)
+	}
+
+	if record.Service == "" {
+		return nil, "item has no name"
+	}
+
+	for _, field := range item.Fields {
+		name := strings.TrimSpace(field.Name)
+		if name == "" {
+			name = "Field"
+		}
+		switch field.Type {
+		case bitwardenFieldHidden:
+			addTextField(record, name, field.Value, database.FieldHidden)
+		case bitwardenFieldText, bitwardenFieldBoolean:
+			addTextField(record, name, field.Value, database.FieldText)
+		case bitwardenFieldLinked:
+			result.warn(title, "linked field %q cannot be imported", name)
+		}
+	}
+
+	seen := map[string]bool{record.Password: true}
+	for _, previous := range item.PasswordHistory {
+		if previous.Password == "" || seen[previous.Password] {
+			continue
+		}
+		seen[previous.Password] = true
+		record.Fields = append(record.Fields, previousPasswordField(previous.Password, previous.LastUsedDate))
+	}
+
+	if entryType != database.EntryLogin {
+		if err := setEntryType(record, entryType, values); err != nil {
+			result.warn(title, "imported as a login: %v", err)
+		}
+	}
+
+	return record, ""
+}
+
+// =-- Password Protected Exports --= //
+
+// decryptBitwardenExport derives the export key from the password and decrypts the items
+func decryptBitwardenExport(export *bitwardenExport, password string) ([]byte, error) {
+	var key []byte
+	var err error
+	switch export.KDFType {
+	case bitwardenKDFPBKDF2:
+		if export.KDFIterations < 1 {
+			return nil, ErrBitwardenUnsupported
+		}
+		key, err = pbkdf2.Key(sha256.New, password, []byte(export.Salt), export.KDFIterations, 32)
+		if err != nil {
+			return nil, err
+		}
+	case bitwardenKDFArgon2id:
+		if export.KDFIterations < 1 || export.KDFMemory < 1 || export.KDFParallelism < 1 {
+			return nil, ErrBitwardenUnsupported
+		}
+		salt := sha256.Sum256([]byte(export.Salt))
+		key = argon2.IDKey([]byte(password), salt[:], uint32(export.KDFIterations),
+			uint32(export.KDFMemory)*1024, uint8(export.KDFParallelism), 32)
+	default:
+		return nil, fmt.Errorf("%w: KDF type %d", ErrBitwardenUnsupported, export.KDFType)
+	}
+
+	// The derived key is stretched into separate encryption and MAC keys
+	encKey, err := hkdf.Expand(sha256.New, key, "enc", 32)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := hkdf.Expand(sha256.New, key, "mac", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decryptBitwardenString(export.EncKeyValidation, encKey, macKey); err != nil {
+		return nil, err
+	}
+	return decryptBitwardenString(export.Data, encKey, macKey)
+}
+
+// decryptBitwardenString decrypts an "2.iv|data|mac" string (AES-256-CBC with HMAC-SHA256)
+func decryptBitwardenString(value string, encKey []byte, macKey []byte) ([]byte, error) {
+	encType, rest, found := strings.Cut(value, ".")
+	if !found {
+		return nil, ErrBitwardenCorrupt
+	}
+	if encType != "2" {
+		return nil, fmt.Errorf("%w: encryption type %s", ErrBitwardenUnsupported, encType)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) != 3 {
+		return nil, ErrBitwardenCorrupt
+	}
+	var decoded [3][]byte
+	for i, part := range parts {
+		data, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, ErrBitwardenCorrupt
+		}
+		decoded[i] = data
+	}
+	iv, ciphertext, tag := decoded[0], decoded[1], decoded[2]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, ErrBitwardenPassword
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrBitwardenCorrupt
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrBitwardenCorrupt
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
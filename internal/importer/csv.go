@@ -0,0 +1,340 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+var (
+	ErrEmptyCSV         = errors.New("CSV file is empty")
+	ErrUnrecognizedCSV  = errors.New("CSV columns were not recognized")
+	ErrNoImportableRows = errors.New("CSV file has no importable rows")
+)
+
+// =-- CSV Column Layouts --= //
+
+// column is the entry field a CSV column is read into
+type column int
+
+const (
+	columnExtra    column = iota // Kept as a custom field
+	columnIgnore                 // Not imported
+	columnTitle                  // Entry name
+	columnURL                    // Website address, becomes the service
+	columnUsername               // Username
+	columnPassword               // Password
+	columnNotes                  // Notes
+	columnFolder                 // Folder path
+	columnTags                   // Comma separated tags
+	columnTOTP                   // One-time password secret, kept as a hidden custom field
+	columnType                   // Item type (Bitwarden)
+	columnFields                 // "name: value" lines of custom fields (Bitwarden)
+)
+
+// csvLayout describes the columns of one application's CSV export
+type csvLayout struct {
+	format     Format
+	signature  []string          // Lowercase headers that must all be present
+	columns    map[string]column // Column meaning by lowercase header, other columns are extras
+	folderSep  string            // Separator of nested folder names
+	folderRoot string            // Name of the root folder included in folder paths
+}
+
+// csvLayouts are tried in order, more specific layouts first
+var csvLayouts = []csvLayout{
+	{
+		format:    FormatBitwarden,
+		signature: []string{"login_uri", "login_username", "login_password"},
+		columns: map[string]column{
+			"folder": columnFolder, "favorite": columnIgnore, "type": columnType, "name": columnTitle,
+			"notes": columnNotes, "fields": columnFields, "reprompt": columnIgnore, "login_uri": columnURL,
+			"login_username": columnUsername, "login_password": columnPassword, "login_totp": columnTOTP,
+		},
+		folderSep: "/",
+	},
+	{
+		format:    FormatLastPass,
+		signature: []string{"url", "username", "password", "extra", "name", "grouping"},
+		columns: map[string]column{
+			"url": columnURL, "username": columnUsername, "password": columnPassword, "totp": columnTOTP,
+			"extra": columnNotes, "name": columnTitle, "grouping": columnFolder, "fav": columnIgnore,
+		},
+		folderSep: `\`,
+	},
+	{
+		format:    FormatKeePassXC,
+		signature: []string{"group", "title", "username", "password", "url", "notes"},
+		columns: map[string]column{
+			"group": columnFolder, "title": columnTitle, "username": columnUsername, "password": columnPassword,
+			"url": columnURL, "notes": columnNotes, "totp": columnTOTP, "icon": columnIgnore,
+			"last modified": columnIgnore, "created": columnIgnore,
+		},
+		folderSep:  "/",
+		folderRoot: "Root",
+	},
+	{
+		format:    Format1Password,
+		signature: []string{"title", "url", "username", "password", "otpauth"},
+		columns: map[string]column{
+			"title": columnTitle, "url": columnURL, "username": columnUsername, "password": columnPassword,
+			"otpauth": columnTOTP, "favorite": columnIgnore, "archived": columnIgnore, "tags": columnTags,
+			"notes": columnNotes,
+		},
+	},
+	{
+		format:    FormatFirefox,
+		signature: []string{"url", "username", "password", "httprealm", "formactionorigin"},
+		columns: map[string]column{
+			"url": columnURL, "username": columnUsername, "password": columnPassword,
+			"httprealm": columnIgnore, "formactionorigin": columnIgnore, "guid": columnIgnore,
+			"timecreated": columnIgnore, "timelastused": columnIgnore, "timepasswordchanged": columnIgnore,
+		},
+	},
+	{
+		format:    FormatChrome,
+		signature: []string{"name", "url", "username", "password"},
+		columns: map[string]column{
+			"name": columnTitle, "url": columnURL, "username": columnUsername, "password": columnPassword,
+			"note": columnNotes,
+		},
+	},
+}
+
+// genericColumns recognizes common column names of CSV files from other applications
+var genericColumns = map[string]column{
+	"title": columnTitle, "name": columnTitle, "service": columnTitle, "account": columnTitle,
+	"url": columnURL, "uri": columnURL, "website": columnURL, "web site": columnURL, "login_uri": columnURL,
+	"username": columnUsername, "user": columnUsername, "login": columnUsername, "email": columnUsername,
+	"login_username": columnUsername, "user name": columnUsername,
+	"password": columnPassword, "pass": columnPassword, "login_password": columnPassword,
+	"notes": columnNotes, "note": columnNotes, "comments": columnNotes, "extra": columnNotes,
+	"folder": columnFolder, "group": columnFolder, "grouping": columnFolder, "category": columnFolder,
+	"tags": columnTags, "totp": columnTOTP, "otp": columnTOTP, "otpauth": columnTOTP,
+}
+
+// detectLayout picks the layout matching a CSV header row
+func detectLayout(headers []string) (*csvLayout, error) {
+	present := make(map[string]bool)
+	for _, header := range headers {
+		present[header] = true
+	}
+
+	for i := range csvLayouts {
+		layout := &csvLayouts[i]
+		matches := true
+		for _, header := range layout.signature {
+			if !present[header] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return layout, nil
+		}
+	}
+
+	// Any other file needs at least a password and a name or URL column
+	mapped := make(map[column]bool)
+	for _, header := range headers {
+		mapped[genericColumns[header]] = true
+	}
+	if !mapped[columnPassword] || (!mapped[columnTitle] && !mapped[columnURL]) {
+		return nil, fmt.Errorf("%w: %s", ErrUnrecognizedCSV, strings.Join(headers, ", "))
+	}
+
+	return &csvLayout{format: FormatGenericCSV, columns: genericColumns, folderSep: "/"}, nil
+}
+
+// =-- CSV Import Functions --= //
+
+// ParseCSV reads a CSV export, detecting which application wrote it, without touching any vault
+func ParseCSV(r io.Reader) (*Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	headerRow, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrEmptyCSV
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Headers are matched case-insensitively, the original spelling names extra fields
+	names := make([]string, len(headerRow))
+	headers := make([]string, len(headerRow))
+	for i, header := range headerRow {
+		if i == 0 {
+			header = strings.TrimPrefix(header, "\ufeff")
+		}
+		names[i] = strings.TrimSpace(header)
+		headers[i] = strings.ToLower(names[i])
+	}
+
+	layout, err := detectLayout(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Format: layout.format, DryRun: true}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Skipped = append(result.Skipped, SkippedRow{Line: parseErr.StartLine, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(row) > len(headers) {
+			result.Skipped = append(result.Skipped, SkippedRow{
+				Line:   line,
+				Reason: fmt.Sprintf("row has %d columns, expected %d", len(row), len(headers)),
+			})
+			continue
+		}
+
+		record, reason := layout.record(headers, names, row)
+		if reason != "" {
+			result.Skipped = append(result.Skipped, SkippedRow{Line: line, Reason: reason})
+			continue
+		}
+		result.Records = append(result.Records, *record)
+	}
+
+	if len(result.Records) == 0 && len(result.Skipped) == 0 {
+		return nil, ErrNoImportableRows
+	}
+
+	return result, nil
+}
+
+// ImportCSV reads a CSV export and, unless dryRun is set, stores its entries in the vault in one transaction
+func ImportCSV(db *sql.DB, encryptionKey string, r io.Reader, dryRun bool) (*Result, error) {
+	result, err := ParseCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(result.Records) == 0 {
+		return result, nil
+	}
+
+	return result, Apply(db, encryptionKey, result)
+}
+
+// record converts a CSV row into an import record, or returns why the row was skipped
+func (layout *csvLayout) record(headers []string, names []string, row []string) (*database.ImportRecord, string) {
+	record := &database.ImportRecord{EntryType: database.EntryLogin}
+	var title, rawURL, totp string
+	var extras []database.ImportField
+	empty := true
+
+	for i, value := range row {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		empty = false
+
+		switch layout.columns[headers[i]] {
+		case columnTitle:
+			title = strings.TrimSpace(value)
+		case columnURL:
+			rawURL = strings.TrimSpace(value)
+		case columnUsername:
+			record.Username = value
+		case columnPassword:
+			record.Password = value
+		case columnNotes:
+			record.Notes = value
+		case columnFolder:
+			record.Folder = splitFolderPath(value, layout.folderSep, layout.folderRoot)
+		case columnTags:
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					record.Tags = append(record.Tags, tag)
+				}
+			}
+		case columnTOTP:
+			totp = strings.TrimSpace(value)
+		case columnType:
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "login":
+			case "note":
+				record.EntryType = database.EntrySecureNote
+			default:
+				return nil, fmt.Sprintf("unsupported item type %q", value)
+			}
+		case columnFields:
+			extras = append(extras, parseFieldLines(value)...)
+		case columnExtra:
+			if names[i] != "" {
+				extras = append(extras, database.ImportField{Name: names[i], Type: database.FieldText, Value: value})
+			}
+		}
+	}
+
+	if empty {
+		return nil, "empty row"
+	}
+
+	// LastPass marks secure notes with this placeholder URL
+	if layout.format == FormatLastPass && rawURL == "http://sn" {
+		record.EntryType = database.EntrySecureNote
+		rawURL = ""
+	}
+	// A secure note's text is its secret, as in the Bitwarden and 1PUX importers
+	if record.EntryType == database.EntrySecureNote && record.Password == "" {
+		record.Password, record.Notes = record.Notes, ""
+	}
+
+	record.Service = serviceFromURL(rawURL)
+	if record.Service == "" {
+		record.Service = title
+	}
+	if record.Service == "" {
+		return nil, "row has no name or URL"
+	}
+
+	if title != "" && title != record.Service {
+		record.Fields = append(record.Fields, database.ImportField{Name: "Title", Type: database.FieldText, Value: title})
+	}
+	if rawURL != "" && rawURL != record.Service {
+		record.Fields = append(record.Fields, urlField(rawURL))
+	}
+	if totp != "" {
+		record.Fields = append(record.Fields, database.ImportField{Name: "TOTP", Type: database.FieldHidden, Value: totp})
+	}
+	record.Fields = append(record.Fields, extras...)
+
+	return record, ""
+}
+
+// parseFieldLines parses Bitwarden's "name: value" custom field lines
+func parseFieldLines(value string) []database.ImportField {
+	var fields []database.ImportField
+	for _, line := range strings.Split(value, "\n") {
+		name, fieldValue, found := strings.Cut(strings.TrimRight(line, "\r"), ": ")
+		if !found {
+			name, fieldValue = line, ""
+		}
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		fields = append(fields, database.ImportField{Name: strings.TrimSpace(name), Type: database.FieldText, Value: fieldValue})
+	}
+
+	return fields
+}
@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// =-- Import Formats --= //
+
+// Format identifies the application an import file was exported from
+type Format string
+
+const (
+	FormatChrome        Format = "chrome"         // Chrome, Edge and other Chromium browsers
+	FormatFirefox       Format = "firefox"        // Firefox
+	FormatBitwarden     Format = "bitwarden"      // Bitwarden
+	FormatLastPass      Format = "lastpass"       // LastPass
+	Format1Password     Format = "1password"      // 1Password
+	FormatKeePassXC     Format = "keepassxc"      // KeePassXC
+	FormatGenericCSV    Format = "csv"            // Any CSV file with recognizable column names
+	FormatKeePass       Format = "keepass"        // KeePass KDBX 4 database
+	FormatBitwardenJSON Format = "bitwarden-json" // Bitwarden JSON export, optionally password protected
+	Format1PUX          Format = "1pux"           // 1Password 1PUX archive
+	FormatPass          Format = "pass"           // pass (password-store) directory
+)
+
+// =-- Import Results --= //
+
+// SkippedRow reports an item of the import file that was not imported
+type SkippedRow struct {
+	Line   int    // Line (or item number) in the import file
+	Reason string // Why the item was skipped
+}
+
+// Warning reports part of an imported item that PassLock could not represent
+type Warning struct {
+	Item    string // Title of the item
+	Message string // What was lost or changed
+}
+
+// Result is the outcome of reading, and unless it was a dry run storing, an import file
+type Result struct {
+	Format         Format                  // Detected file format
+	Records        []database.ImportRecord // Entries read from the file
+	Skipped        []SkippedRow            // Items that could not be imported
+	Warnings       []Warning               // Data of imported items that could not be represented
+	DryRun         bool                    // Whether the records were only previewed
+	Imported       int                     // Entries stored in the vault
+	FoldersCreated int                     // Folders created in the vault
+}
+
+// Apply stores the records of a previewed result in the vault, in a single transaction
+func Apply(db *sql.DB, encryptionKey string, result *Result) error {
+	summary, err := database.ImportEntries(db, encryptionKey, result.Records)
+	if err != nil {
+		return err
+	}
+
+	result.DryRun = false
+	result.Imported = summary.Imported
+	result.FoldersCreated = summary.FoldersCreated
+	return nil
+}
+
+// =-- Import Helpers --= //
+
+// serviceFromURL returns the host name of a URL without "www.", or "" if it has none
+func serviceFromURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// urlField returns a custom field keeping the full URL of an entry
+func urlField(rawURL string) database.ImportField {
+	fieldType := database.FieldURL
+	if database.ValidateFieldValue(fieldType, rawURL) != nil {
+		fieldType = database.FieldText
+	}
+
+	return database.ImportField{Name: "URL", Type: fieldType, Value: rawURL}
+}
+
+// splitFolderPath splits a folder path on sep, dropping empty parts and a leading root folder name
+func splitFolderPath(path string, sep string, root string) []string {
+	var folders []string
+	for i, name := range strings.Split(path, sep) {
+		name = strings.TrimSpace(name)
+		if name == "" || (i == 0 && root != "" && strings.EqualFold(name, root)) {
+			continue
+		}
+		folders = append(folders, name)
+	}
+
+	return folders
+}
+
+// warn records that part of an item could not be represented
+func (result *Result) warn(item string, format string, args ...any) {
+	result.Warnings = append(result.Warnings, Warning{Item: item, Message: fmt.Sprintf(format, args...)})
+}
+
+// previousPasswordField keeps an earlier password of an entry as a hidden field named after its date
+func previousPasswordField(password string, changed time.Time) database.ImportField {
+	name := "Previous password"
+	if !changed.IsZero() {
+		name = fmt.Sprintf("Previous password (%s)", changed.Local().Format(database.DateFormat))
+	}
+
+	return database.ImportField{Name: name, Type: database.FieldHidden, Value: password}
+}
+
+// setEntryType stores type-specific values (keyed by TypeField.Key) as the fields the entry type expects.
+// If the values fail the type's validation the record stays a login and the reason is returned.
+func setEntryType(record *database.ImportRecord, entryType database.EntryType, values map[string]string) error {
+	schema, err := database.GetEntrySchema(entryType)
+	if err != nil {
+		return err
+	}
+
+	validationErr := database.ValidateTypedEntry(&database.TypedEntry{
+		Type:     entryType,
+		Title:    record.Service,
+		Username: record.Username,
+		Secret:   record.Password,
+		Fields:   values,
+	})
+
+	var fields []database.ImportField
+	for _, field := range schema.Fields {
+		value := values[field.Key]
+		if value == "" {
+			continue
+		}
+		fieldType := field.Type
+		if database.ValidateFieldValue(fieldType, value) != nil {
+			fieldType = database.FieldText
+		}
+		fields = append(fields, database.ImportField{Name: field.Label, Type: fieldType, Value: value})
+	}
+	record.Fields = append(fields, record.Fields...)
+
+	if validationErr != nil {
+		record.EntryType = database.EntryLogin
+		return validationErr
+	}
+	record.EntryType = entryType
+	return nil
+}
+
+// uniqueFieldName returns name, or name with a number if a field of the record already uses it
+func uniqueFieldName(record *database.ImportRecord, name string) string {
+	used := make(map[string]bool)
+	for _, field := range record.Fields {
+		used[field.Name] = true
+	}
+
+	unique := name
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s %d", name, n)
+	}
+	return unique
+}
+
+// setService sets the service from the first URL, or the title if there is none, keeping the title and
+// every URL as fields when they differ from the service
+func setService(record *database.ImportRecord, title string, urls []string) {
+	var cleaned []string
+	for _, rawURL := range urls {
+		if rawURL = strings.TrimSpace(rawURL); rawURL != "" {
+			cleaned = append(cleaned, rawURL)
+		}
+	}
+
+	record.Service = ""
+	if len(cleaned) > 0 {
+		record.Service = serviceFromURL(cleaned[0])
+	}
+	if record.Service == "" {
+		record.Service = title
+	}
+
+	var fields []database.ImportField
+	if title != "" && title != record.Service {
+		fields = append(fields, database.ImportField{Name: "Title", Type: database.FieldText, Value: title})
+	}
+	count := 0
+	for _, rawURL := range cleaned {
+		if rawURL == record.Service {
+			continue
+		}
+		field := urlField(rawURL)
+		if count++; count > 1 {
+			field.Name = fmt.Sprintf("URL %d", count)
+		}
+		fields = append(fields, field)
+	}
+	record.Fields = append(fields, record.Fields...)
+}
+
+// addTextField appends a field if value is not empty, numbering the name if it is already used
+func addTextField(record *database.ImportRecord, name string, value string, fieldType database.FieldType) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	record.Fields = append(record.Fields, database.ImportField{Name: uniqueFieldName(record, name), Type: fieldType, Value: value})
+}
+
+// cardExpiry formats an expiry month and year as MM/YY, or returns "" if either is missing
+func cardExpiry(month string, year string) string {
+	month, year = strings.TrimSpace(month), strings.TrimSpace(year)
+	if month == "" || year == "" {
+		return ""
+	}
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	if len(year) == 4 {
+		year = year[2:]
+	}
+
+	return month + "/" + year
+}
+
+// joinNonEmpty joins the non-empty values with sep
+func joinNonEmpty(sep string, values ...string) string {
+	var parts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, value)
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/kdbx"
+)
+
+// EntryTypeKey is the KeePass string recording the PassLock entry type of non-login entries
+const EntryTypeKey = "PassLock Type"
+
+// =-- KeePass Import Functions --= //
+
+// ParseKDBX decrypts a KeePass database and maps its groups and entries onto import records. Entries in
+// the recycle bin are skipped, and earlier passwords from an entry's history are kept as hidden fields.
+func ParseKDBX(r io.Reader, password string) (*Result, error) {
+	keepass, err := kdbx.Read(r, password)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Format: FormatKeePass, DryRun: true}
+	item := 0
+	var walk func(group *kdbx.Group, path []string, recycled bool)
+	walk = func(group *kdbx.Group, path []string, recycled bool) {
+		recycled = recycled || (keepass.RecycleBin != kdbx.UUID{} && group.UUID == keepass.RecycleBin)
+
+		for _, entry := range group.Entries {
+			item++
+			if recycled {
+				result.Skipped = append(result.Skipped, SkippedRow{Line: item, Reason: "entry is in the recycle bin"})
+				continue
+			}
+
+			record, reason := keePassRecord(entry, path)
+			if reason != "" {
+				result.Skipped = append(result.Skipped, SkippedRow{Line: item, Reason: reason})
+				continue
+			}
+			result.Records = append(result.Records, *record)
+		}
+
+		for _, subgroup := range group.Groups {
+			walk(subgroup, append(append([]string(nil), path...), subgroup.Name), recycled)
+		}
+	}
+	if keepass.Root != nil {
+		// The root group's name is not part of folder paths
+		walk(keepass.Root, nil, false)
+	}
+
+	return result, nil
+}
+
+// ImportKDBX reads a KeePass database and, unless dryRun is set, stores its entries in the vault in one transaction
+func ImportKDBX(db *sql.DB, encryptionKey string, r io.Reader, password string, dryRun bool) (*Result, error) {
+	result, err := ParseKDBX(r, password)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(result.Records) == 0 {
+		return result, nil
+	}
+
+	return result, Apply(db, encryptionKey, result)
+}
+
+// keePassRecord converts a KeePass entry, or returns why it was skipped
+func keePassRecord(entry *kdbx.Entry, folder []string) (*database.ImportRecord, string) {
+	title := strings.TrimSpace(entry.Get(kdbx.KeyTitle))
+	rawURL := strings.TrimSpace(entry.Get(kdbx.KeyURL))
+
+	record := &database.ImportRecord{
+		Service:   serviceFromURL(rawURL),
+		Username:  entry.Get(kdbx.KeyUserName),
+		Password:  entry.Get(kdbx.KeyPassword),
+		Notes:     entry.Get(kdbx.KeyNotes),
+		EntryType: database.EntryLogin,
+		Folder:    folder,
+		Tags:      entry.Tags,
+		ChangedAt: entry.Modified,
+	}
+	if record.Service == "" {
+		record.Service = title
+	}
+
+	// The password was set by the oldest of the latest versions that already had it
+	for i := len(entry.History) - 1; i >= 0 && entry.History[i].Get(kdbx.KeyPassword) == record.Password; i-- {
+		if !entry.History[i].Modified.IsZero() {
+			record.ChangedAt = entry.History[i].Modified
+		}
+	}
+	if record.Service == "" {
+		return nil, "entry has no title or URL"
+	}
+
+	if title != "" && title != record.Service {
+		record.Fields = append(record.Fields, database.ImportField{Name: "Title", Type: database.FieldText, Value: title})
+	}
+	if rawURL != "" && rawURL != record.Service {
+		record.Fields = append(record.Fields, urlField(rawURL))
+	}
+
+	for _, s := range entry.Strings {
+		if kdbx.IsStandardKey(s.Key) {
+			continue
+		}
+		if s.Key == EntryTypeKey {
+			if _, err := database.GetEntrySchema(database.EntryType(s.Value)); err == nil {
+				record.EntryType = database.EntryType(s.Value)
+				continue
+			}
+		}
+
+		fieldType := database.FieldText
+		if s.Protected {
+			fieldType = database.FieldHidden
+		}
+		record.Fields = append(record.Fields, database.ImportField{Name: s.Key, Type: fieldType, Value: s.Value})
+	}
+
+	// Keep earlier passwords, newest first, without repeating the current one
+	seen := map[string]bool{record.Password: true}
+	for i := len(entry.History) - 1; i >= 0; i-- {
+		previous := entry.History[i].Get(kdbx.KeyPassword)
+		if previous == "" || seen[previous] {
+			continue
+		}
+		seen[previous] = true
+		record.Fields = append(record.Fields, previousPasswordField(previous, entry.History[i].Modified))
+	}
+
+	for _, attachment := range entry.Attachments {
+		record.Attachments = append(record.Attachments, database.ImportAttachment{Name: attachment.Name, Data: attachment.Data})
+	}
+
+	return record, ""
+}
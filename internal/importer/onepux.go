@@ -0,0 +1,535 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+var ErrNot1PUX = errors.New("file is not a 1Password 1PUX export")
+
+// onePUXData is the name of the JSON document inside a 1PUX archive
+const onePUXData = "export.data"
+
+// 1Password item categories with a matching PassLock entry type
+const (
+	onePUXLogin    = "001"
+	onePUXCard     = "002"
+	onePUXNote     = "003"
+	onePUXIdentity = "004"
+	onePUXPassword = "005"
+	onePUXDocument = "006"
+	onePUXDatabase = "102"
+	onePUXRouter   = "109"
+	onePUXAPI      = "112"
+	onePUXSSHKey   = "114"
+)
+
+// =-- 1PUX Export Format --= //
+
+// onePUXExport is the export.data document of a 1PUX archive
+type onePUXExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePUXItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+// onePUXItem is a single item of a vault
+type onePUXItem struct {
+	State        string `json:"state"`
+	Trashed      bool   `json:"trashed"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string          `json:"title"`
+			Fields []onePUXSection `json:"fields"`
+		} `json:"sections"`
+		PasswordHistory []struct {
+			Value string `json:"value"`
+			Time  int64  `json:"time"`
+		} `json:"passwordHistory"`
+		DocumentAttributes *onePUXFile `json:"documentAttributes"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Tags []string `json:"tags"`
+	} `json:"overview"`
+}
+
+// onePUXSection is a field of an item section, its value is an object with a single typed key
+type onePUXSection struct {
+	Title string                     `json:"title"`
+	ID    string                     `json:"id"`
+	Value map[string]json.RawMessage `json:"value"`
+}
+
+// onePUXFile refers to a file stored in the archive's files directory
+type onePUXFile struct {
+	FileName   string `json:"fileName"`
+	DocumentID string `json:"documentId"`
+}
+
+// onePUXAddress is the value of an address field
+type onePUXAddress struct {
+	Street  string `json:"street"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+	Zip     string `json:"zip"`
+	State   string `json:"state"`
+}
+
+// onePUXField is a decoded section field
+type onePUXField struct {
+	ID    string
+	Name  string
+	Kind  string             // Key of the value object (e.g., "concealed")
+	Value string             // Value as text
+	Type  database.FieldType // Field type to store the value with
+	Raw   json.RawMessage    // Undecoded value
+	used  bool
+}
+
+// =-- 1PUX Import Functions --= //
+
+// Parse1PUX reads a 1Password 1PUX archive. Vaults become folders, categories with a matching entry type
+// keep their type, and section fields, tags, password history and files are kept.
+func Parse1PUX(r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNot1PUX, err)
+	}
+
+	var export onePUXExport
+	files := make(map[string]*zip.File)
+	found := false
+	for _, file := range archive.File {
+		switch {
+		case file.Name == onePUXData:
+			err = readZipJSON(file, &export)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrNot1PUX, err)
+			}
+			found = true
+		case strings.HasPrefix(file.Name, "files/"):
+			// Files are stored as files/<document ID>__<file name>
+			documentID, _, _ := strings.Cut(path.Base(file.Name), "__")
+			files[documentID] = file
+		}
+	}
+	if !found {
+		return nil, ErrNot1PUX
+	}
+
+	result := &Result{Format: Format1PUX, DryRun: true}
+	number := 0
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, item := range vault.Items {
+				number++
+				if item.Trashed || item.State == "deleted" {
+					result.Skipped = append(result.Skipped, SkippedRow{Line: number, Reason: "item is in the trash"})
+					continue
+				}
+
+				record, reason := onePUXRecord(result, item, files)
+				if reason != "" {
+					result.Skipped = append(result.Skipped, SkippedRow{Line: number, Reason: reason})
+					continue
+				}
+				record.Folder = splitFolderPath(vault.Attrs.Name, "/", "")
+				if item.State == "archived" {
+					record.Tags = append(record.Tags, "Archived")
+				}
+				result.Records = append(result.Records, *record)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Import1PUX reads a 1Password 1PUX archive and, unless dryRun is set, stores its entries in the vault
+func Import1PUX(db *sql.DB, encryptionKey string, r io.Reader, dryRun bool) (*Result, error) {
+	result, err := Parse1PUX(r)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(result.Records) == 0 {
+		return result, nil
+	}
+
+	return result, Apply(db, encryptionKey, result)
+}
+
+// onePUXRecord converts a 1Password item, or returns why it was skipped
+func onePUXRecord(result *Result, item onePUXItem, files map[string]*zip.File) (*database.ImportRecord, string) {
+	title := strings.TrimSpace(item.Overview.Title)
+	record := &database.ImportRecord{
+		Service:   title,
+		Notes:     item.Details.NotesPlain,
+		EntryType: database.EntryLogin,
+		Tags:      item.Overview.Tags,
+	}
+
+	var fields []*onePUXField
+	for _, section := range item.Details.Sections {
+		for _, sectionField := range section.Fields {
+			field := decodeOnePUXField(sectionField)
+			if field.Raw == nil || (field.Kind != "" && field.Kind != "file" && field.Value == "") {
+				continue
+			}
+			fields = append(fields, field)
+		}
+	}
+	take := func(ids ...string) string {
+		for _, id := range ids {
+			for _, field := range fields {
+				if !field.used && field.ID == id {
+					field.used = true
+					return field.Value
+				}
+			}
+		}
+		return ""
+	}
+	takeRaw := func(id string, kind string, v any) bool {
+		for _, field := range fields {
+			if !field.used && field.ID == id && field.Kind == kind {
+				field.used = json.Unmarshal(field.Raw, v) == nil
+				return field.used
+			}
+		}
+		return false
+	}
+
+	var urls []string
+	if item.Overview.URL != "" {
+		urls = append(urls, item.Overview.URL)
+	}
+	for _, u := range item.Overview.URLs {
+		if u.URL != item.Overview.URL {
+			urls = append(urls, u.URL)
+		}
+	}
+
+	entryType := database.EntryLogin
+	values := make(map[string]string)
+	switch item.CategoryUUID {
+	case onePUXLogin, onePUXPassword:
+		setOnePUXCredentials(record, item)
+
+	case onePUXCard:
+		entryType = database.EntryCard
+		record.Username = take("cardholder")
+		record.Password = take("ccnum")
+		var expiry int
+		if takeRaw("expiry", "monthYear", &expiry) && expiry > 0 {
+			values["expiry"] = fmt.Sprintf("%02d/%02d", expiry%100, expiry/100%100)
+		}
+		values["cvv"] = take("cvv")
+		values["pin"] = take("pin")
+		values["brand"] = take("type")
+
+	case onePUXNote, onePUXDocument:
+		entryType = database.EntrySecureNote
+		record.Password, record.Notes = item.Details.NotesPlain, ""
+		if record.Password == "" && item.Details.DocumentAttributes != nil {
+			record.Password = item.Details.DocumentAttributes.FileName
+		}
+
+	case onePUXIdentity:
+		entryType = database.EntryIdentity
+		record.Username = joinNonEmpty(" ", take("firstname"), take("initial"), take("lastname"))
+		values["email"] = take("email")
+		values["phone"] = take("defphone", "cellphone", "homephone", "busphone")
+		values["birth_date"] = take("birthdate")
+		var address onePUXAddress
+		if takeRaw("address", "address", &address) {
+			values["address"] = address.Street
+			values["city"] = address.City
+			values["postal_code"] = address.Zip
+			values["country"] = address.Country
+			addTextField(record, "State", address.State, database.FieldText)
+		}
+
+	case onePUXDatabase:
+		entryType = database.EntryDatabase
+		if host := take("hostname"); host != "" {
+			record.Service = host
+		}
+		record.Username = take("username")
+		record.Password = take("password")
+		values["engine"] = take("database_type")
+		values["port"] = take("port")
+		values["database"] = take("database")
+
+	case onePUXRouter:
+		entryType = database.EntryWiFi
+		if ssid := take("network_name"); ssid != "" {
+			record.Service = ssid
+		}
+		record.Password = take("wireless_password")
+		values["security"] = wifiSecurity(take("wireless_security"))
+
+	case onePUXAPI:
+		entryType = database.EntryAPIToken
+		record.Username = take("username")
+		record.Password = take("credential")
+		values["endpoint"] = take("hostname")
+		values["expires"] = take("expires")
+
+	case onePUXSSHKey:
+		entryType = database.EntrySSHKey
+		var key struct {
+			PrivateKey string `json:"privateKey"`
+			Metadata   struct {
+				PublicKey   string `json:"publicKey"`
+				Fingerprint string `json:"fingerprint"`
+			} `json:"metadata"`
+		}
+		if takeRaw("private_key", "sshKey", &key) {
+			record.Password = key.PrivateKey
+			values["public_key"] = key.Metadata.PublicKey
+			addTextField(record, "Fingerprint", key.Metadata.Fingerprint, database.FieldText)
+		}
+
+	default:
+		result.warn(title, "1Password category %s has no matching entry type and was imported as a login", item.CategoryUUID)
+		setOnePUXCredentials(record, item)
+	}
+
+	if entryType == database.EntryLogin {
+		setService(record, title, urls)
+	} else {
+		if title != "" && title != record.Service {
+			record.Fields = append(record.Fields, database.ImportField{Name: "Title", Type: database.FieldText, Value: title})
+		}
+		for _, rawURL := range urls {
+			field := urlField(rawURL)
+			field.Name = uniqueFieldName(record, "URL")
+			record.Fields = append(record.Fields, field)
+		}
+	}
+	if record.Service == "" {
+		return nil, "item has no title"
+	}
+
+	// Section fields without a dedicated place are kept as custom fields
+	for _, field := range fields {
+		if field.used {
+			continue
+		}
+		switch field.Kind {
+		case "file":
+			var file onePUXFile
+			if json.Unmarshal(field.Raw, &file) == nil {
+				addOnePUXFile(result, record, title, file, files)
+			}
+		case "":
+			result.warn(title, "field %q has an unsupported value and was not imported", field.Name)
+		default:
+			fieldType := field.Type
+			if database.ValidateFieldValue(fieldType, field.Value) != nil {
+				fieldType = database.FieldText
+			}
+			addTextField(record, field.Name, field.Value, fieldType)
+		}
+	}
+
+	if document := item.Details.DocumentAttributes; document != nil {
+		addOnePUXFile(result, record, title, *document, files)
+	}
+
+	seen := map[string]bool{record.Password: true}
+	for _, previous := range item.Details.PasswordHistory {
+		if previous.Value == "" || seen[previous.Value] {
+			continue
+		}
+		seen[previous.Value] = true
+		changed := time.Time{}
+		if previous.Time > 0 {
+			changed = time.Unix(previous.Time, 0)
+		}
+		record.Fields = append(record.Fields, previousPasswordField(previous.Value, changed))
+	}
+
+	if entryType != database.EntryLogin {
+		if err := setEntryType(record, entryType, values); err != nil {
+			result.warn(title, "imported as a login: %v", err)
+		}
+	}
+
+	return record, ""
+}
+
+// setOnePUXCredentials sets the username and password of a login or password item
+func setOnePUXCredentials(record *database.ImportRecord, item onePUXItem) {
+	for _, loginField := range item.Details.LoginFields {
+		switch loginField.Designation {
+		case "username":
+			record.Username = loginField.Value
+		case "password":
+			record.Password = loginField.Value
+		}
+	}
+	if record.Password == "" {
+		record.Password = item.Details.Password
+	}
+}
+
+// decodeOnePUXField converts a section field value to text, Kind is "" if the value type is unsupported
+func decodeOnePUXField(section onePUXSection) *onePUXField {
+	field := &onePUXField{ID: section.ID, Name: strings.TrimSpace(section.Title), Type: database.FieldText}
+	if field.Name == "" {
+		field.Name = section.ID
+	}
+	if field.Name == "" {
+		field.Name = "Field"
+	}
+
+	for kind, raw := range section.Value {
+		field.Raw = raw
+		var text string
+		isText := json.Unmarshal(raw, &text) == nil
+
+		switch kind {
+		case "concealed", "totp", "creditCardNumber":
+			field.Kind, field.Value, field.Type = kind, text, database.FieldHidden
+		case "string", "phone", "menu", "creditCardType", "gender", "reference":
+			field.Kind, field.Value = kind, text
+		case "url":
+			field.Kind, field.Value, field.Type = kind, text, database.FieldURL
+		case "email":
+			if !isText {
+				var email struct {
+					Address string `json:"email_address"`
+				}
+				_ = json.Unmarshal(raw, &email)
+				text = email.Address
+			}
+			field.Kind, field.Value, field.Type = kind, text, database.FieldEmail
+		case "date":
+			var seconds int64
+			if json.Unmarshal(raw, &seconds) == nil && seconds != 0 {
+				field.Value = time.Unix(seconds, 0).UTC().Format(database.DateFormat)
+			}
+			field.Kind, field.Type = kind, database.FieldDate
+		case "monthYear":
+			var monthYear int
+			if json.Unmarshal(raw, &monthYear) == nil && monthYear > 0 {
+				field.Value = fmt.Sprintf("%02d/%04d", monthYear%100, monthYear/100)
+			}
+			field.Kind = kind
+		case "address":
+			var address onePUXAddress
+			if json.Unmarshal(raw, &address) == nil {
+				field.Value = joinNonEmpty(", ", address.Street, address.City, address.State, address.Zip, address.Country)
+			}
+			field.Kind = kind
+		case "sshKey":
+			var key struct {
+				PrivateKey string `json:"privateKey"`
+			}
+			_ = json.Unmarshal(raw, &key)
+			field.Kind, field.Value, field.Type = kind, key.PrivateKey, database.FieldHidden
+		case "file":
+			field.Kind = kind
+		default:
+			if isText {
+				field.Kind, field.Value = kind, text
+			}
+		}
+	}
+
+	return field
+}
+
+// addOnePUXFile attaches a file from the archive to the record, warning if the archive does not contain it
+func addOnePUXFile(result *Result, record *database.ImportRecord, title string, file onePUXFile, files map[string]*zip.File) {
+	archived, ok := files[file.DocumentID]
+	if !ok {
+		result.warn(title, "file %q is missing from the archive", file.FileName)
+		return
+	}
+	if archived.UncompressedSize64 > uint64(database.MaxAttachmentSize) {
+		result.warn(title, "file %q is too large to import", file.FileName)
+		return
+	}
+
+	reader, err := archived.Open()
+	if err != nil {
+		result.warn(title, "file %q could not be read: %v", file.FileName, err)
+		return
+	}
+	defer func(reader io.Closer) {
+		_ = reader.Close()
+	}(reader)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		result.warn(title, "file %q could not be read: %v", file.FileName, err)
+		return
+	}
+	record.Attachments = append(record.Attachments, database.ImportAttachment{Name: file.FileName, Data: data})
+}
+
+// readZipJSON decodes a JSON document stored in a zip archive
+func readZipJSON(file *zip.File, v any) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func(reader io.Closer) {
+		_ = reader.Close()
+	}(reader)
+
+	return json.NewDecoder(reader).Decode(v)
+}
+
+// wifiSecurity maps 1Password's wireless security menu values onto PassLock's security modes
+func wifiSecurity(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case value == "":
+		return ""
+	case value == "none":
+		return "Open"
+	case strings.HasPrefix(value, "wep"):
+		return "WEP"
+	case strings.HasPrefix(value, "wpa3"):
+		return "WPA3"
+	case strings.HasPrefix(value, "wpa2"):
+		return "WPA2"
+	case strings.HasPrefix(value, "wpa"):
+		return "WPA"
+	}
+	return value
+}
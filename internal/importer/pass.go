@@ -0,0 +1,239 @@
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+var (
+	ErrNotPasswordStore = errors.New("directory is not a pass password store")
+	ErrNoPrivateKey     = errors.New("key file does not contain an OpenPGP private key")
+	ErrKeyPassphrase    = errors.New("incorrect passphrase for the OpenPGP private key")
+)
+
+// passFileExtension is the extension of encrypted entries in a password store
+const passFileExtension = ".gpg"
+
+// =-- pass Import Functions --= //
+
+// ParsePass walks a pass password store and decrypts every entry with an OpenPGP private key (armored or
+// binary, unlocked with passphrase if it is protected). The first line of an entry is the password and
+// "key: value" lines become the username, URL or custom fields. Directories become folders.
+// RSA, ElGamal and elliptic curve (e.g., cv25519) keys are supported; entries that cannot be decrypted are skipped.
+func ParsePass(dir string, privateKey io.Reader, passphrase string) (*Result, error) {
+	keyring, err := readPrivateKeyring(privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrNotPasswordStore
+	}
+
+	result := &Result{Format: FormatPass, DryRun: true}
+	number := 0
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip git metadata, extensions and other hidden files
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != passFileExtension {
+			return nil
+		}
+
+		number++
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := decryptPassFile(path, keyring)
+		if err != nil {
+			result.Skipped = append(result.Skipped, SkippedRow{Line: number, Reason: fmt.Sprintf("%s: %v", relative, err)})
+			return nil
+		}
+
+		folder := splitFolderPath(filepath.ToSlash(filepath.Dir(relative)), "/", ".")
+		title := strings.TrimSuffix(entry.Name(), passFileExtension)
+		result.Records = append(result.Records, passRecord(title, folder, content))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if number == 0 {
+		return nil, ErrNotPasswordStore
+	}
+
+	return result, nil
+}
+
+// ImportPass reads a pass password store and, unless dryRun is set, stores its entries in the vault
+func ImportPass(db *sql.DB, encryptionKey string, dir string, privateKey io.Reader, passphrase string, dryRun bool) (*Result, error) {
+	result, err := ParsePass(dir, privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(result.Records) == 0 {
+		return result, nil
+	}
+
+	return result, Apply(db, encryptionKey, result)
+}
+
+// passRecord converts the decrypted contents of an entry
+func passRecord(title string, folder []string, content string) database.ImportRecord {
+	record := database.ImportRecord{EntryType: database.EntryLogin, Folder: folder}
+	var urls, notes []string
+	var extras []database.ImportField
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i == 0 {
+			record.Password = line
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "otpauth://") {
+			extras = append(extras, database.ImportField{Name: "TOTP", Type: database.FieldHidden, Value: trimmed})
+			continue
+		}
+
+		// Bare URLs are common below the password
+		if strings.HasPrefix(trimmed, "http://") || strings.HasPrefix(trimmed, "https://") {
+			urls = append(urls, trimmed)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || key == "" || value == "" {
+			notes = append(notes, line)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "user", "username", "login":
+			if record.Username == "" {
+				record.Username = value
+				continue
+			}
+		case "url", "website", "site":
+			urls = append(urls, value)
+			continue
+		case "notes", "comment":
+			notes = append(notes, value)
+			continue
+		case "email", "e-mail":
+			extras = append(extras, database.ImportField{Name: key, Type: database.FieldEmail, Value: value})
+			continue
+		}
+		extras = append(extras, database.ImportField{Name: key, Type: database.FieldText, Value: value})
+	}
+
+	record.Notes = strings.TrimSpace(strings.Join(notes, "\n"))
+	record.Fields = extras
+	setService(&record, title, urls)
+
+	for i := range record.Fields {
+		if database.ValidateFieldValue(record.Fields[i].Type, record.Fields[i].Value) != nil {
+			record.Fields[i].Type = database.FieldText
+		}
+	}
+
+	return record
+}
+
+// =-- OpenPGP Decryption --= //
+
+// readPrivateKeyring reads armored or binary private keys and unlocks them with the passphrase
+func readPrivateKeyring(r io.Reader, passphrase string) (openpgp.EntityList, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNoPrivateKey, err)
+		}
+	}
+
+	found := false
+	for _, entity := range keyring {
+		keys := []*packet.PrivateKey{entity.PrivateKey}
+		for _, subkey := range entity.Subkeys {
+			keys = append(keys, subkey.PrivateKey)
+		}
+
+		for _, key := range keys {
+			if key == nil {
+				continue
+			}
+			found = true
+			if key.Encrypted {
+				if err := key.Decrypt([]byte(passphrase)); err != nil {
+					return nil, ErrKeyPassphrase
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNoPrivateKey
+	}
+
+	return keyring, nil
+}
+
+// decryptPassFile decrypts an armored or binary OpenPGP message
+func decryptPassFile(path string, keyring openpgp.EntityList) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var message io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP MESSAGE-----")) {
+		block, err := armor.Decode(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		message = block.Body
+	}
+
+	details, err := openpgp.ReadMessage(message, keyring, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
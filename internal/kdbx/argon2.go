@@ -0,0 +1,294 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// =-- Argon2 --= //
+
+// KeePass databases usually use Argon2d, which golang.org/x/crypto/argon2 does not expose, so this is a
+// small single-threaded implementation of Argon2 version 1.3 (RFC 9106) supporting every variant.
+
+const (
+	argon2d  = 0
+	argon2i  = 1
+	argon2id = 2
+
+	argon2Version     = 0x13
+	argon2BlockWords  = 128 // 64-bit words per 1 KiB block
+	argon2SyncPoints  = 4   // Slices per pass
+	argon2AddressSize = argon2BlockWords
+)
+
+// argon2Block is one 1 KiB memory block
+type argon2Block [argon2BlockWords]uint64
+
+// argon2Key derives keyLen bytes with the given Argon2 variant (memory in KiB)
+func argon2Key(mode int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, threads, keyLen)
+
+	// Memory is rounded down to a multiple of 4 blocks per lane
+	memory = memory / (argon2SyncPoints * threads) * (argon2SyncPoints * threads)
+	if memory < 2*argon2SyncPoints*threads {
+		memory = 2 * argon2SyncPoints * threads
+	}
+
+	blocks := argon2InitBlocks(h0, memory, threads)
+	argon2Fill(blocks, mode, time, memory, threads)
+
+	return argon2Extract(blocks, memory, threads, keyLen)
+}
+
+// argon2InitHash computes H0 from every input and parameter
+func argon2InitHash(mode int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+	h, _ := blake2b.New512(nil)
+
+	var word [4]byte
+	writeWord := func(v uint32) {
+		binary.LittleEndian.PutUint32(word[:], v)
+		h.Write(word[:])
+	}
+	writeBytes := func(b []byte) {
+		writeWord(uint32(len(b)))
+		h.Write(b)
+	}
+
+	writeWord(threads)
+	writeWord(keyLen)
+	writeWord(memory)
+	writeWord(time)
+	writeWord(argon2Version)
+	writeWord(uint32(mode))
+	writeBytes(password)
+	writeBytes(salt)
+	writeBytes(secret)
+	writeBytes(data)
+
+	return h.Sum(nil)
+}
+
+// argon2InitBlocks fills the first two blocks of every lane from H0
+func argon2InitBlocks(h0 []byte, memory, threads uint32) []argon2Block {
+	blocks := make([]argon2Block, memory)
+	laneLength := memory / threads
+
+	input := make([]byte, len(h0)+8)
+	copy(input, h0)
+	output := make([]byte, 1024)
+
+	for lane := uint32(0); lane < threads; lane++ {
+		binary.LittleEndian.PutUint32(input[len(h0)+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(input[len(h0):], i)
+			argon2Hash(output, input)
+			block := &blocks[lane*laneLength+i]
+			for j := range block {
+				block[j] = binary.LittleEndian.Uint64(output[j*8:])
+			}
+		}
+	}
+
+	return blocks
+}
+
+// argon2Fill runs every pass over memory, one segment at a time
+func argon2Fill(blocks []argon2Block, mode int, time, memory, threads uint32) {
+	laneLength := memory / threads
+	segmentLength := laneLength / argon2SyncPoints
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < threads; lane++ {
+				dataIndependent := mode == argon2i || (mode == argon2id && pass == 0 && slice < argon2SyncPoints/2)
+
+				var addresses, input, zero argon2Block
+				if dataIndependent {
+					input[0] = uint64(pass)
+					input[1] = uint64(lane)
+					input[2] = uint64(slice)
+					input[3] = uint64(memory)
+					input[4] = uint64(time)
+					input[5] = uint64(mode)
+				}
+
+				index := uint32(0)
+				if pass == 0 && slice == 0 {
+					// The first two blocks were already computed
+					index = 2
+					if dataIndependent {
+						input[6]++
+						argon2Compress(&addresses, &input, &zero, false)
+						argon2Compress(&addresses, &addresses, &zero, false)
+					}
+				}
+
+				offset := lane*laneLength + slice*segmentLength + index
+				for ; index < segmentLength; index, offset = index+1, offset+1 {
+					previous := offset - 1
+					if index == 0 && slice == 0 {
+						previous += laneLength
+					}
+
+					var random uint64
+					if dataIndependent {
+						if index%argon2AddressSize == 0 {
+							input[6]++
+							argon2Compress(&addresses, &input, &zero, false)
+							argon2Compress(&addresses, &addresses, &zero, false)
+						}
+						random = addresses[index%argon2AddressSize]
+					} else {
+						random = blocks[previous][0]
+					}
+
+					reference := argon2Reference(random, laneLength, segmentLength, threads, pass, slice, lane, index)
+					argon2Compress(&blocks[offset], &blocks[previous], &blocks[reference], true)
+				}
+			}
+		}
+	}
+}
+
+// argon2Reference maps a pseudo-random value to the index of the block referenced by the current block
+func argon2Reference(random uint64, laneLength, segmentLength, threads, pass, slice, lane, index uint32) uint32 {
+	referenceLane := uint32(random>>32) % threads
+	if pass == 0 && slice == 0 {
+		referenceLane = lane
+	}
+
+	// Size and start of the area blocks may be referenced from
+	areaSize, start := 3*segmentLength, ((slice+1)%argon2SyncPoints)*segmentLength
+	if lane == referenceLane {
+		areaSize += index
+	}
+	if pass == 0 {
+		areaSize, start = slice*segmentLength, 0
+		if slice == 0 || lane == referenceLane {
+			areaSize += index
+		}
+	}
+	if index == 0 || lane == referenceLane {
+		areaSize--
+	}
+
+	p := random & 0xFFFFFFFF
+	p = (p * p) >> 32
+	p = (p * uint64(areaSize)) >> 32
+
+	return referenceLane*laneLength + uint32((uint64(start)+uint64(areaSize)-(p+1))%uint64(laneLength))
+}
+
+// argon2Extract XORs the last block of every lane and hashes it into the key
+func argon2Extract(blocks []argon2Block, memory, threads, keyLen uint32) []byte {
+	laneLength := memory / threads
+	final := blocks[memory-1]
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, v := range blocks[lane*laneLength+laneLength-1] {
+			final[i] ^= v
+		}
+	}
+
+	input := make([]byte, 1024)
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(input[i*8:], v)
+	}
+
+	key := make([]byte, keyLen)
+	argon2Hash(key, input)
+	return key
+}
+
+// =-- Argon2 Primitives --= //
+
+// argon2Compress is the compression function G, XORed into out when xor is set
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	q := r
+
+	// Rows of 16 words, then columns of pairs of words
+	for i := 0; i < argon2BlockWords; i += 16 {
+		argon2Permute(&q, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+	}
+	for i := 0; i < argon2BlockWords/8; i += 2 {
+		argon2Permute(&q, i, i+1, i+16, i+17, i+32, i+33, i+48, i+49, i+64, i+65, i+80, i+81, i+96, i+97, i+112, i+113)
+	}
+
+	for i := range q {
+		if xor {
+			out[i] ^= r[i] ^ q[i]
+		} else {
+			out[i] = r[i] ^ q[i]
+		}
+	}
+}
+
+// argon2Permute applies the BlaMka permutation to 16 words of a block
+func argon2Permute(b *argon2Block, i00, i01, i02, i03, i04, i05, i06, i07, i08, i09, i10, i11, i12, i13, i14, i15 int) {
+	argon2Mix(b, i00, i04, i08, i12)
+	argon2Mix(b, i01, i05, i09, i13)
+	argon2Mix(b, i02, i06, i10, i14)
+	argon2Mix(b, i03, i07, i11, i15)
+	argon2Mix(b, i00, i05, i10, i15)
+	argon2Mix(b, i01, i06, i11, i12)
+	argon2Mix(b, i02, i07, i08, i13)
+	argon2Mix(b, i03, i04, i09, i14)
+}
+
+// argon2Mix is the BlaMka variant of the BLAKE2b mixing function
+func argon2Mix(v *argon2Block, a, b, c, d int) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+	rotr := func(x uint64, n uint) uint64 {
+		return x>>n | x<<(64-n)
+	}
+
+	v[a] = fBlaMka(v[a], v[b])
+	v[d] = rotr(v[d]^v[a], 32)
+	v[c] = fBlaMka(v[c], v[d])
+	v[b] = rotr(v[b]^v[c], 24)
+	v[a] = fBlaMka(v[a], v[b])
+	v[d] = rotr(v[d]^v[a], 16)
+	v[c] = fBlaMka(v[c], v[d])
+	v[b] = rotr(v[b]^v[c], 63)
+}
+
+// argon2Hash is the variable-length hash function H'
+func argon2Hash(out []byte, in []byte) {
+	var h hash.Hash
+	if len(out) < blake2b.Size {
+		h, _ = blake2b.New(len(out), nil)
+	} else {
+		h, _ = blake2b.New512(nil)
+	}
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+	h.Write(length[:])
+	h.Write(in)
+	if len(out) <= blake2b.Size {
+		h.Sum(out[:0])
+		return
+	}
+
+	// Longer outputs chain 64-byte hashes, keeping the first half of each
+	v := h.Sum(nil)
+	copy(out, v[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		next := blake2b.Sum512(v)
+		v = next[:]
+		copy(out, v[:32])
+		out = out[32:]
+	}
+
+	last, _ := blake2b.New(len(out), nil)
+	last.Write(v)
+	last.Sum(out[:0])
+}
@@ -0,0 +1,324 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+	"golang.org/x/crypto/twofish"
+)
+
+// =-- Algorithm Identifiers --= //
+
+var (
+	cipherAES256   = UUID{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = UUID{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	cipherTwofish  = UUID{0xad, 0x68, 0xf2, 0x9f, 0x57, 0x6f, 0x4b, 0xb9, 0xa3, 0x6a, 0xd4, 0x7a, 0xf9, 0x65, 0x34, 0x6c}
+
+	kdfAES      = UUID{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfArgon2d  = UUID{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = UUID{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// Inner random stream IDs protecting values inside the XML
+const (
+	innerStreamSalsa20  = 2
+	innerStreamChaCha20 = 3
+)
+
+// salsa20Nonce is the fixed nonce of the Salsa20 inner stream
+var salsa20Nonce = []byte{0xe8, 0x30, 0x09, 0x4b, 0x97, 0x20, 0x5d, 0x2a}
+
+// =-- Key Derivation --= //
+
+// compositeKey hashes the password the way KeePass combines key components (key files are not supported)
+func compositeKey(password string) []byte {
+	passwordHash := sha256.Sum256([]byte(password))
+	key := sha256.Sum256(passwordHash[:])
+	return key[:]
+}
+
+// transformKey applies the KDF described by the header's KDF parameters
+func transformKey(composite []byte, params variantDictionary) ([]byte, error) {
+	uuid, ok := params.bytes("$UUID")
+	if !ok || len(uuid) != 16 {
+		return nil, fmt.Errorf("%w: missing KDF identifier", ErrCorrupt)
+	}
+
+	switch UUID(uuid) {
+	case kdfAES:
+		seed, ok := params.bytes("S")
+		rounds, ok2 := params.uint64("R")
+		if !ok || !ok2 || len(seed) != 32 {
+			return nil, fmt.Errorf("%w: invalid AES-KDF parameters", ErrCorrupt)
+		}
+		// Like Argon2's costs, the round count is read before the header can be authenticated
+		if rounds > maxAESRounds {
+			return nil, fmt.Errorf("%w: %d AES-KDF rounds", ErrUnsupportedKDF, rounds)
+		}
+		return aesKDF(composite, seed, rounds)
+
+	case kdfArgon2d, kdfArgon2id:
+		salt, ok := params.bytes("S")
+		iterations, ok2 := params.uint64("I")
+		memory, ok3 := params.uint64("M")
+		parallelism, ok4 := params.uint32("P")
+		if !ok || !ok2 || !ok3 || !ok4 {
+			return nil, fmt.Errorf("%w: invalid Argon2 parameters", ErrCorrupt)
+		}
+		if version, ok := params.uint32("V"); ok && version != argon2Version {
+			return nil, fmt.Errorf("%w: Argon2 version %#x", ErrUnsupportedKDF, version)
+		}
+		// The header is only authenticated once the key is derived, so its costs are capped like a vault's
+		if iterations == 0 || iterations > encryption.MaxArgon2Time || parallelism == 0 ||
+			parallelism > encryption.MaxArgon2Threads || memory/1024 > encryption.MaxArgon2Memory ||
+			memory/1024 < 8*uint64(parallelism) {
+			return nil, fmt.Errorf("%w: unusable Argon2 parameters", ErrUnsupportedKDF)
+		}
+		secret, _ := params.bytes("K")
+		data, _ := params.bytes("A")
+
+		mode := argon2d
+		if UUID(uuid) == kdfArgon2id {
+			mode = argon2id
+		}
+		return argon2Key(mode, composite, salt, secret, data, uint32(iterations), uint32(memory/1024), parallelism, 32), nil
+	}
+
+	return nil, ErrUnsupportedKDF
+}
+
+// maxAESRounds is the most AES-KDF rounds a file may ask for, a few times what KeePass picks for one second
+const maxAESRounds = 100_000_000
+
+// aesKDF encrypts the key with AES-256 in ECB mode for the given number of rounds
+func aesKDF(composite []byte, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	key := bytes.Clone(composite)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(key[:16], key[:16])
+		block.Encrypt(key[16:], key[16:])
+	}
+
+	transformed := sha256.Sum256(key)
+	return transformed[:], nil
+}
+
+// fileKeys are the keys protecting a file, derived from the transformed key and the header's master seed
+type fileKeys struct {
+	cipherKey []byte // Outer encryption key
+	hmacBase  []byte // Base of the per-block HMAC keys
+}
+
+// deriveFileKeys combines the master seed with the transformed key
+func deriveFileKeys(masterSeed []byte, transformed []byte) fileKeys {
+	cipherKey := sha256.Sum256(append(bytes.Clone(masterSeed), transformed...))
+	hmacBase := sha512.Sum512(append(append(bytes.Clone(masterSeed), transformed...), 0x01))
+
+	return fileKeys{cipherKey: cipherKey[:], hmacBase: hmacBase[:]}
+}
+
+// blockHMAC authenticates a payload block, or the header for index math.MaxUint64
+func (keys fileKeys) blockHMAC(index uint64, data []byte) []byte {
+	var indexBytes [8]byte
+	binary.LittleEndian.PutUint64(indexBytes[:], index)
+	blockKey := sha512.Sum512(append(indexBytes[:], keys.hmacBase...))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	if index != math.MaxUint64 {
+		mac.Write(indexBytes[:])
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(len(data)))
+		mac.Write(size[:])
+	}
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// =-- HMAC Block Stream --= //
+
+// hmacBlockSize is the payload size of written blocks
+const hmacBlockSize = 1024 * 1024
+
+// maxHMACBlockSize is the largest block accepted when reading; KeePass and KeePassXC write 1 MiB blocks
+const maxHMACBlockSize = 64 * 1024 * 1024
+
+// readHMACBlocks reads and verifies every payload block, returning the concatenated ciphertext
+func readHMACBlocks(r io.Reader, keys fileKeys) ([]byte, error) {
+	var payload bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var prefix [36]byte
+		_, err := io.ReadFull(r, prefix[:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated payload", ErrCorrupt)
+		}
+
+		size := binary.LittleEndian.Uint32(prefix[32:])
+		if size > maxHMACBlockSize {
+			return nil, fmt.Errorf("%w: invalid block size", ErrCorrupt)
+		}
+		// The size is unauthenticated, so the block only grows as far as the input actually goes
+		data, err := io.ReadAll(io.LimitReader(r, int64(size)))
+		if err != nil || len(data) != int(size) {
+			return nil, fmt.Errorf("%w: truncated payload", ErrCorrupt)
+		}
+
+		if !hmac.Equal(prefix[:32], keys.blockHMAC(index, data)) {
+			return nil, fmt.Errorf("%w: block %d failed authentication", ErrCorrupt, index)
+		}
+		if size == 0 {
+			return payload.Bytes(), nil
+		}
+		payload.Write(data)
+	}
+}
+
+// writeHMACBlocks splits the ciphertext into authenticated blocks, ending with an empty block
+func writeHMACBlocks(w io.Writer, keys fileKeys, payload []byte) error {
+	for index := uint64(0); ; index++ {
+		size := min(len(payload), hmacBlockSize)
+		data := payload[:size]
+		payload = payload[size:]
+
+		var sizeBytes [4]byte
+		binary.LittleEndian.PutUint32(sizeBytes[:], uint32(size))
+		for _, part := range [][]byte{keys.blockHMAC(index, data), sizeBytes[:], data} {
+			if _, err := w.Write(part); err != nil {
+				return err
+			}
+		}
+
+		if size == 0 {
+			return nil
+		}
+	}
+}
+
+// =-- Outer Encryption --= //
+
+// decryptPayload decrypts the payload with the header's cipher
+func decryptPayload(cipherID UUID, key []byte, iv []byte, data []byte) ([]byte, error) {
+	switch cipherID {
+	case cipherChaCha20:
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		plaintext := make([]byte, len(data))
+		stream.XORKeyStream(plaintext, data)
+		return plaintext, nil
+
+	case cipherAES256, cipherTwofish:
+		block, err := newBlockCipher(cipherID, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+			return nil, fmt.Errorf("%w: invalid ciphertext length", ErrCorrupt)
+		}
+		plaintext := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+		// Remove PKCS#7 padding
+		padding := int(plaintext[len(plaintext)-1])
+		if padding == 0 || padding > block.BlockSize() {
+			return nil, fmt.Errorf("%w: invalid padding", ErrCorrupt)
+		}
+		return plaintext[:len(plaintext)-padding], nil
+	}
+
+	return nil, ErrUnsupportedCipher
+}
+
+// encryptPayload encrypts the payload with the given cipher
+func encryptPayload(cipherID UUID, key []byte, iv []byte, data []byte) ([]byte, error) {
+	switch cipherID {
+	case cipherChaCha20:
+		stream, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext := make([]byte, len(data))
+		stream.XORKeyStream(ciphertext, data)
+		return ciphertext, nil
+
+	case cipherAES256, cipherTwofish:
+		block, err := newBlockCipher(cipherID, key)
+		if err != nil {
+			return nil, err
+		}
+		padding := block.BlockSize() - len(data)%block.BlockSize()
+		padded := append(bytes.Clone(data), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+		return padded, nil
+	}
+
+	return nil, ErrUnsupportedCipher
+}
+
+// newBlockCipher returns the block cipher used in CBC mode
+func newBlockCipher(cipherID UUID, key []byte) (cipher.Block, error) {
+	if cipherID == cipherTwofish {
+		return twofish.NewCipher(key)
+	}
+	return aes.NewCipher(key)
+}
+
+// =-- Inner Random Stream --= //
+
+// newInnerStream returns the key stream protected values are XORed with
+func newInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case innerStreamChaCha20:
+		hash := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+	case innerStreamSalsa20:
+		return &salsa20Stream{key: sha256.Sum256(key), used: 64}, nil
+	}
+
+	return nil, fmt.Errorf("%w: inner stream %d", ErrUnsupportedCipher, id)
+}
+
+// salsa20Stream is a stateful Salsa20 key stream with the fixed KeePass nonce
+type salsa20Stream struct {
+	key     [32]byte
+	counter uint64
+	block   [64]byte
+	used    int
+}
+
+// XORKeyStream XORs src with the next bytes of the key stream
+func (stream *salsa20Stream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic(errors.New("kdbx: output smaller than input"))
+	}
+
+	for i := range src {
+		if stream.used == len(stream.block) {
+			var input [16]byte
+			copy(input[:8], salsa20Nonce)
+			binary.LittleEndian.PutUint64(input[8:], stream.counter)
+			var zero [64]byte
+			salsa.XORKeyStream(stream.block[:], zero[:], &input, &stream.key)
+			stream.counter++
+			stream.used = 0
+		}
+		dst[i] = src[i] ^ stream.block[stream.used]
+		stream.used++
+	}
+}
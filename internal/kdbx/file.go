@@ -0,0 +1,245 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+)
+
+// =-- Reading --= //
+
+// maxDecompressedSize caps the inner header and XML a compressed payload may expand to
+const maxDecompressedSize = 512 * 1024 * 1024
+
+// Read decrypts a KDBX 4 database protected by a password
+func Read(r io.Reader, password string) (*Database, error) {
+	header, err := readOuterHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks [64]byte
+	if _, err := io.ReadFull(r, checks[:]); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+	headerHash := sha256.Sum256(header.raw)
+	if !hmac.Equal(checks[:32], headerHash[:]) {
+		return nil, fmt.Errorf("%w: header checksum mismatch", ErrCorrupt)
+	}
+
+	transformed, err := transformKey(compositeKey(password), header.kdf)
+	if err != nil {
+		return nil, err
+	}
+	keys := deriveFileKeys(header.masterSeed, transformed)
+
+	// The header HMAC is the first value that depends on the password
+	if !hmac.Equal(checks[32:], keys.blockHMAC(math.MaxUint64, header.raw)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	ciphertext, err := readHMACBlocks(r, keys)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decryptPayload(header.cipherID, keys.cipherKey, header.iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var content io.Reader = bytes.NewReader(payload)
+	var decompressed *io.LimitedReader
+	if header.compressed {
+		gz, err := gzip.NewReader(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		// One byte past the limit is let through to tell a file at the limit from one above it
+		decompressed = &io.LimitedReader{R: gz, N: maxDecompressedSize + 1}
+		content = decompressed
+	}
+
+	inner, err := readInnerHeader(content)
+	if err != nil {
+		return nil, err
+	}
+	document, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if decompressed != nil && decompressed.N == 0 {
+		return nil, fmt.Errorf("%w: decompressed payload is over %d bytes", ErrCorrupt, maxDecompressedSize)
+	}
+
+	stream, err := newInnerStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return nil, err
+	}
+	document, err = transformProtected(document, stream, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var file xmlFile
+	err = xml.Unmarshal(document, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	root, err := groupFromXML(&file.Root.Group, inner.binaries)
+	if err != nil {
+		return nil, err
+	}
+
+	database := &Database{
+		Name:      file.Meta.DatabaseName,
+		Generator: file.Meta.Generator,
+		Root:      root,
+	}
+	if isTrue(file.Meta.RecycleBinEnabled) {
+		database.RecycleBin = parseUUID(file.Meta.RecycleBinUUID)
+	}
+
+	return database, nil
+}
+
+// =-- Writing --= //
+
+// Write encrypts a database as KDBX 4 with a password
+func Write(w io.Writer, database *Database, password string, options Options) error {
+	header := &outerHeader{
+		compressed: options.Compress,
+		masterSeed: randomBytes(32),
+		kdf:        make(variantDictionary),
+	}
+
+	switch options.Cipher {
+	case CipherAES256, "":
+		header.cipherID, header.iv = cipherAES256, randomBytes(16)
+	case CipherTwofish:
+		header.cipherID, header.iv = cipherTwofish, randomBytes(16)
+	case CipherChaCha20:
+		header.cipherID, header.iv = cipherChaCha20, randomBytes(12)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedCipher, options.Cipher)
+	}
+
+	switch options.KDF {
+	case KDFArgon2d, KDFArgon2id, "":
+		kdfID := kdfArgon2d
+		if options.KDF == KDFArgon2id {
+			kdfID = kdfArgon2id
+		}
+		header.kdf.setBytes("$UUID", kdfID[:])
+		header.kdf.setBytes("S", randomBytes(32))
+		header.kdf.setUint64("I", options.Iterations)
+		header.kdf.setUint64("M", options.MemoryKiB*1024)
+		header.kdf.setUint32("P", options.Parallelism)
+		header.kdf.setUint32("V", argon2Version)
+	case KDFAES:
+		header.kdf.setBytes("$UUID", kdfAES[:])
+		header.kdf.setBytes("S", randomBytes(32))
+		header.kdf.setUint64("R", options.Rounds)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKDF, options.KDF)
+	}
+
+	transformed, err := transformKey(compositeKey(password), header.kdf)
+	if err != nil {
+		return err
+	}
+	keys := deriveFileKeys(header.masterSeed, transformed)
+
+	document, binaries, err := encodeDocument(database)
+	if err != nil {
+		return err
+	}
+	inner := &innerHeader{streamID: innerStreamChaCha20, streamKey: randomBytes(64), binaries: binaries}
+	stream, err := newInnerStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return err
+	}
+	document, err = transformProtected(document, stream, true)
+	if err != nil {
+		return err
+	}
+
+	payload := append(inner.marshal(), document...)
+	if options.Compress {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(payload); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		payload = compressed.Bytes()
+	}
+
+	ciphertext, err := encryptPayload(header.cipherID, keys.cipherKey, header.iv, payload)
+	if err != nil {
+		return err
+	}
+
+	raw := header.marshal()
+	headerHash := sha256.Sum256(raw)
+	for _, part := range [][]byte{raw, headerHash[:], keys.blockHMAC(math.MaxUint64, raw)} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+
+	return writeHMACBlocks(w, keys, ciphertext)
+}
+
+// encodeDocument marshals the XML document (with protected values still in plaintext) and its binary pool
+func encodeDocument(database *Database) ([]byte, [][]byte, error) {
+	root := database.Root
+	if root == nil {
+		root = &Group{Name: "Root"}
+	}
+
+	generator := database.Generator
+	if generator == "" {
+		generator = "PassLock"
+	}
+
+	pool := &binaryPool{}
+	file := xmlFile{
+		Meta: xmlMeta{
+			Generator:    generator,
+			DatabaseName: database.Name,
+			MemoryProtection: xmlMemoryProtection{
+				ProtectTitle:    formatBool(false),
+				ProtectUserName: formatBool(false),
+				ProtectPassword: formatBool(true),
+				ProtectURL:      formatBool(false),
+				ProtectNotes:    formatBool(false),
+			},
+			RecycleBinEnabled: formatBool(database.RecycleBin != UUID{}),
+			RecycleBinUUID:    formatUUID(database.RecycleBin),
+		},
+		Root: xmlRoot{Group: groupToXML(root, pool)},
+	}
+
+	document, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append([]byte(xml.Header), document...), pool.binaries, nil
+}
+
+// randomBytes returns n bytes from the system random source
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
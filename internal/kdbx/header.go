@@ -0,0 +1,333 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// File signature and version
+const (
+	signature1        = 0x9aa2d903
+	signature2        = 0xb54bfb67
+	majorVersion      = 4
+	maxHeaderFieldLen = 1024 * 1024
+)
+
+// Outer header field IDs
+const (
+	headerEnd              = 0
+	headerCipherID         = 2
+	headerCompressionFlags = 3
+	headerMasterSeed       = 4
+	headerEncryptionIV     = 7
+	headerKDFParameters    = 11
+	headerPublicCustomData = 12
+)
+
+// Inner header field IDs
+const (
+	innerHeaderEnd           = 0
+	innerHeaderStreamID      = 1
+	innerHeaderStreamKey     = 2
+	innerHeaderBinary        = 3
+	innerHeaderMaxBinarySize = math.MaxInt32
+)
+
+// =-- Outer Header --= //
+
+// outerHeader is the unencrypted header of a KDBX 4 file
+type outerHeader struct {
+	cipherID   UUID
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDictionary
+	raw        []byte // Header bytes covered by the header hash and HMAC
+}
+
+// readOuterHeader reads the signature, version and header fields
+func readOuterHeader(r io.Reader) (*outerHeader, error) {
+	var raw bytes.Buffer
+	tee := io.TeeReader(r, &raw)
+
+	var prefix [12]byte
+	if _, err := io.ReadFull(tee, prefix[:]); err != nil {
+		return nil, ErrNotKDBX
+	}
+	if binary.LittleEndian.Uint32(prefix[0:]) != signature1 || binary.LittleEndian.Uint32(prefix[4:]) != signature2 {
+		return nil, ErrNotKDBX
+	}
+	if major := binary.LittleEndian.Uint16(prefix[10:]); major != majorVersion {
+		return nil, fmt.Errorf("%w (found version %d)", ErrUnsupportedVersion, major)
+	}
+
+	header := &outerHeader{}
+	var haveCipher bool
+	for {
+		var fieldPrefix [5]byte
+		if _, err := io.ReadFull(tee, fieldPrefix[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+		}
+		size := binary.LittleEndian.Uint32(fieldPrefix[1:])
+		if size > maxHeaderFieldLen {
+			return nil, fmt.Errorf("%w: header field too large", ErrCorrupt)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(tee, data); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+		}
+
+		switch fieldPrefix[0] {
+		case headerEnd:
+			header.raw = raw.Bytes()
+			if !haveCipher || len(header.masterSeed) != 32 || header.kdf == nil {
+				return nil, fmt.Errorf("%w: incomplete header", ErrCorrupt)
+			}
+			return header, nil
+		case headerCipherID:
+			if len(data) != 16 {
+				return nil, fmt.Errorf("%w: invalid cipher ID", ErrCorrupt)
+			}
+			header.cipherID = UUID(data)
+			haveCipher = true
+		case headerCompressionFlags:
+			if len(data) != 4 || binary.LittleEndian.Uint32(data) > 1 {
+				return nil, fmt.Errorf("%w: invalid compression flags", ErrCorrupt)
+			}
+			header.compressed = binary.LittleEndian.Uint32(data) == 1
+		case headerMasterSeed:
+			header.masterSeed = data
+		case headerEncryptionIV:
+			header.iv = data
+		case headerKDFParameters:
+			kdf, err := parseVariantDictionary(data)
+			if err != nil {
+				return nil, err
+			}
+			header.kdf = kdf
+		}
+	}
+}
+
+// marshal encodes the header fields after the signature and version
+func (header *outerHeader) marshal() []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{signature1, signature2})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{0, majorVersion})
+
+	compression := uint32(0)
+	if header.compressed {
+		compression = 1
+	}
+	compressionBytes := binary.LittleEndian.AppendUint32(nil, compression)
+
+	writeField(&buf, headerCipherID, header.cipherID[:])
+	writeField(&buf, headerCompressionFlags, compressionBytes)
+	writeField(&buf, headerMasterSeed, header.masterSeed)
+	writeField(&buf, headerEncryptionIV, header.iv)
+	writeField(&buf, headerKDFParameters, header.kdf.marshal())
+	writeField(&buf, headerEnd, []byte("\r\n\r\n"))
+
+	return buf.Bytes()
+}
+
+// writeField writes a header field as ID, little-endian size and data
+func writeField(buf *bytes.Buffer, id byte, data []byte) {
+	buf.WriteByte(id)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+// =-- Variant Dictionary --= //
+
+// Variant dictionary value types
+const (
+	variantEnd       = 0x00
+	variantUInt32    = 0x04
+	variantUInt64    = 0x05
+	variantBool      = 0x08
+	variantInt32     = 0x0c
+	variantInt64     = 0x0d
+	variantString    = 0x18
+	variantByteArray = 0x42
+)
+
+// variantValue is a typed value of a variant dictionary
+type variantValue struct {
+	kind byte
+	data []byte
+}
+
+// variantDictionary is the typed key-value format of the KDF parameters, keys are written sorted
+type variantDictionary map[string]variantValue
+
+// parseVariantDictionary decodes a serialized variant dictionary
+func parseVariantDictionary(data []byte) (variantDictionary, error) {
+	invalid := fmt.Errorf("%w: invalid KDF parameters", ErrCorrupt)
+	if len(data) < 2 || data[1] != 0x01 {
+		return nil, invalid
+	}
+	data = data[2:]
+
+	dictionary := make(variantDictionary)
+	for {
+		if len(data) < 1 {
+			return nil, invalid
+		}
+		kind := data[0]
+		if kind == variantEnd {
+			return dictionary, nil
+		}
+
+		if len(data) < 5 {
+			return nil, invalid
+		}
+		keyLen := binary.LittleEndian.Uint32(data[1:])
+		if uint64(len(data)) < 5+uint64(keyLen)+4 {
+			return nil, invalid
+		}
+		key := string(data[5 : 5+keyLen])
+		data = data[5+keyLen:]
+
+		valueLen := binary.LittleEndian.Uint32(data)
+		if uint64(len(data)) < 4+uint64(valueLen) {
+			return nil, invalid
+		}
+		dictionary[key] = variantValue{kind: kind, data: data[4 : 4+valueLen]}
+		data = data[4+valueLen:]
+	}
+}
+
+// marshal encodes the dictionary with version 1.0
+func (dictionary variantDictionary) marshal() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x00, 0x01})
+
+	for _, key := range sortedVariantKeys(dictionary) {
+		value := dictionary[key]
+		buf.WriteByte(value.kind)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(key)))
+		buf.WriteString(key)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(value.data)))
+		buf.Write(value.data)
+	}
+	buf.WriteByte(variantEnd)
+
+	return buf.Bytes()
+}
+
+// bytes returns a byte array value
+func (dictionary variantDictionary) bytes(key string) ([]byte, bool) {
+	value, ok := dictionary[key]
+	if !ok || value.kind != variantByteArray {
+		return nil, false
+	}
+	return value.data, true
+}
+
+// uint32 returns a UInt32 value
+func (dictionary variantDictionary) uint32(key string) (uint32, bool) {
+	value, ok := dictionary[key]
+	if !ok || value.kind != variantUInt32 || len(value.data) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(value.data), true
+}
+
+// uint64 returns a UInt64 value
+func (dictionary variantDictionary) uint64(key string) (uint64, bool) {
+	value, ok := dictionary[key]
+	if !ok || value.kind != variantUInt64 || len(value.data) != 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(value.data), true
+}
+
+// setBytes, setUint32 and setUint64 store typed values
+func (dictionary variantDictionary) setBytes(key string, data []byte) {
+	dictionary[key] = variantValue{kind: variantByteArray, data: data}
+}
+
+func (dictionary variantDictionary) setUint32(key string, v uint32) {
+	dictionary[key] = variantValue{kind: variantUInt32, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func (dictionary variantDictionary) setUint64(key string, v uint64) {
+	dictionary[key] = variantValue{kind: variantUInt64, data: binary.LittleEndian.AppendUint64(nil, v)}
+}
+
+// sortedVariantKeys returns the dictionary keys in a stable order
+func sortedVariantKeys(dictionary variantDictionary) []string {
+	keys := make([]string, 0, len(dictionary))
+	for key := range dictionary {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// =-- Inner Header --= //
+
+// innerHeader is the encrypted header in front of the XML
+type innerHeader struct {
+	streamID  uint32
+	streamKey []byte
+	binaries  [][]byte
+}
+
+// readInnerHeader reads the inner header fields from the decrypted payload
+func readInnerHeader(r io.Reader) (*innerHeader, error) {
+	header := &innerHeader{}
+	for {
+		var fieldPrefix [5]byte
+		if _, err := io.ReadFull(r, fieldPrefix[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated inner header", ErrCorrupt)
+		}
+		size := binary.LittleEndian.Uint32(fieldPrefix[1:])
+		if size > innerHeaderMaxBinarySize {
+			return nil, fmt.Errorf("%w: inner header field too large", ErrCorrupt)
+		}
+		data, err := io.ReadAll(io.LimitReader(r, int64(size)))
+		if err != nil || len(data) != int(size) {
+			return nil, fmt.Errorf("%w: truncated inner header", ErrCorrupt)
+		}
+
+		switch fieldPrefix[0] {
+		case innerHeaderEnd:
+			if header.streamKey == nil {
+				return nil, fmt.Errorf("%w: missing inner stream key", ErrCorrupt)
+			}
+			return header, nil
+		case innerHeaderStreamID:
+			if len(data) != 4 {
+				return nil, fmt.Errorf("%w: invalid inner stream ID", ErrCorrupt)
+			}
+			header.streamID = binary.LittleEndian.Uint32(data)
+		case innerHeaderStreamKey:
+			header.streamKey = data
+		case innerHeaderBinary:
+			if len(data) < 1 {
+				return nil, fmt.Errorf("%w: invalid binary", ErrCorrupt)
+			}
+			// The first byte holds flags, only memory protection is defined
+			header.binaries = append(header.binaries, data[1:])
+		}
+	}
+}
+
+// marshal encodes the inner header
+func (header *innerHeader) marshal() []byte {
+	var buf bytes.Buffer
+	writeField(&buf, innerHeaderStreamID, binary.LittleEndian.AppendUint32(nil, header.streamID))
+	writeField(&buf, innerHeaderStreamKey, header.streamKey)
+	for _, binaryData := range header.binaries {
+		writeField(&buf, innerHeaderBinary, append([]byte{0x00}, binaryData...))
+	}
+	writeField(&buf, innerHeaderEnd, nil)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,164 @@
+package kdbx
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotKDBX            = errors.New("file is not a KeePass database")
+	ErrUnsupportedVersion = errors.New("unsupported KeePass database version, only KDBX 4 is supported")
+	ErrUnsupportedCipher  = errors.New("unsupported KeePass database cipher")
+	ErrUnsupportedKDF     = errors.New("unsupported KeePass key derivation function")
+	ErrInvalidCredentials = errors.New("wrong password for KeePass database")
+	ErrCorrupt            = errors.New("KeePass database is corrupted")
+)
+
+// Standard entry string keys
+const (
+	KeyTitle    = "Title"
+	KeyUserName = "UserName"
+	KeyPassword = "Password"
+	KeyURL      = "URL"
+	KeyNotes    = "Notes"
+)
+
+// =-- Database Model --= //
+
+// UUID identifies groups and entries
+type UUID [16]byte
+
+// NewUUID returns a random UUID
+func NewUUID() UUID {
+	var uuid UUID
+	_, _ = rand.Read(uuid[:])
+	return uuid
+}
+
+// Database is the decrypted contents of a KDBX file
+type Database struct {
+	Name       string // Database name
+	Generator  string // Application that wrote the file
+	Root       *Group // Root group, whose name is not part of group paths
+	RecycleBin UUID   // Recycle bin group (zero if there is none)
+}
+
+// Group is a (possibly nested) group of entries
+type Group struct {
+	UUID    UUID     // Unique ID
+	Name    string   // Display name
+	Notes   string   // Group notes
+	Groups  []*Group // Subgroups
+	Entries []*Entry // Entries directly in this group
+}
+
+// Entry is a single KeePass entry
+type Entry struct {
+	UUID        UUID         // Unique ID
+	Strings     []String     // Standard and custom strings, in file order
+	Attachments []Attachment // Attached files
+	Tags        []string     // Tags
+	Created     time.Time    // Creation time
+	Modified    time.Time    // Last modification time
+	History     []*Entry     // Previous versions, oldest first
+}
+
+// String is a named entry value, protected values are encrypted inside the file
+type String struct {
+	Key       string
+	Value     string
+	Protected bool
+}
+
+// Attachment is a file attached to an entry
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Get returns the value of an entry string, or "" if the entry has none
+func (entry *Entry) Get(key string) string {
+	for _, s := range entry.Strings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// Set replaces or appends an entry string
+func (entry *Entry) Set(key string, value string, protected bool) {
+	for i := range entry.Strings {
+		if entry.Strings[i].Key == key {
+			entry.Strings[i] = String{Key: key, Value: value, Protected: protected}
+			return
+		}
+	}
+	entry.Strings = append(entry.Strings, String{Key: key, Value: value, Protected: protected})
+}
+
+// IsStandardKey returns whether key is one of the strings every KeePass entry has
+func IsStandardKey(key string) bool {
+	switch key {
+	case KeyTitle, KeyUserName, KeyPassword, KeyURL, KeyNotes:
+		return true
+	}
+	return false
+}
+
+// splitTags splits a KeePass tag list, which may use ';' or ',' as separator
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// =-- Write Options --= //
+
+// Cipher identifies the outer encryption of a KDBX file
+type Cipher string
+
+const (
+	CipherAES256   Cipher = "aes256"   // AES-256 in CBC mode
+	CipherChaCha20 Cipher = "chacha20" // ChaCha20
+	CipherTwofish  Cipher = "twofish"  // Twofish in CBC mode
+)
+
+// KDF identifies how the master key is derived from the password
+type KDF string
+
+const (
+	KDFArgon2d  KDF = "argon2d"  // Argon2d, the KeePass default
+	KDFArgon2id KDF = "argon2id" // Argon2id
+	KDFAES      KDF = "aes"      // AES-KDF, compatible with older clients
+)
+
+// Options controls how Write encrypts a database
+type Options struct {
+	Cipher      Cipher // Outer encryption
+	KDF         KDF    // Key derivation function
+	Iterations  uint64 // Argon2 iterations
+	MemoryKiB   uint64 // Argon2 memory (KiB)
+	Parallelism uint32 // Argon2 lanes
+	Rounds      uint64 // AES-KDF rounds
+	Compress    bool   // Gzip the XML payload
+}
+
+// DefaultOptions returns the settings KeePassXC uses for new databases
+func DefaultOptions() Options {
+	return Options{
+		Cipher:      CipherAES256,
+		KDF:         KDFArgon2d,
+		Iterations:  10,
+		MemoryKiB:   64 * 1024,
+		Parallelism: 2,
+		Rounds:      600000,
+		Compress:    true,
+	}
+}
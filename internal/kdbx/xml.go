@@ -0,0 +1,395 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// =-- XML Document --= //
+
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    xmlRoot  `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator         string              `xml:"Generator"`
+	DatabaseName      string              `xml:"DatabaseName"`
+	MemoryProtection  xmlMemoryProtection `xml:"MemoryProtection"`
+	RecycleBinEnabled string              `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    string              `xml:"RecycleBinUUID"`
+}
+
+type xmlMemoryProtection struct {
+	ProtectTitle    string `xml:"ProtectTitle"`
+	ProtectUserName string `xml:"ProtectUserName"`
+	ProtectPassword string `xml:"ProtectPassword"`
+	ProtectURL      string `xml:"ProtectURL"`
+	ProtectNotes    string `xml:"ProtectNotes"`
+}
+
+type xmlRoot struct {
+	Group          xmlGroup `xml:"Group"`
+	DeletedObjects struct{} `xml:"DeletedObjects"`
+}
+
+type xmlGroup struct {
+	UUID       string     `xml:"UUID"`
+	Name       string     `xml:"Name"`
+	Notes      string     `xml:"Notes"`
+	IconID     int        `xml:"IconID"`
+	Times      xmlTimes   `xml:"Times"`
+	IsExpanded string     `xml:"IsExpanded"`
+	Entries    []xmlEntry `xml:"Entry"`
+	Groups     []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID     string      `xml:"UUID"`
+	IconID   int         `xml:"IconID"`
+	Tags     string      `xml:"Tags"`
+	Times    xmlTimes    `xml:"Times"`
+	Strings  []xmlString `xml:"String"`
+	Binaries []xmlBinary `xml:"Binary"`
+	History  *xmlHistory `xml:"History,omitempty"`
+}
+
+type xmlHistory struct {
+	Entries []xmlEntry `xml:"Entry"`
+}
+
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+type xmlString struct {
+	Key   string   `xml:"Key"`
+	Value xmlValue `xml:"Value"`
+}
+
+type xmlValue struct {
+	Protected string `xml:"Protected,attr,omitempty"`
+	Text      string `xml:",chardata"`
+}
+
+type xmlBinary struct {
+	Key   string         `xml:"Key"`
+	Value xmlBinaryValue `xml:"Value"`
+}
+
+type xmlBinaryValue struct {
+	Ref int `xml:"Ref,attr"`
+}
+
+// =-- Protected Values --= //
+
+// transformProtected XORs every protected value with the inner stream in document order. When decrypting,
+// base64 values are replaced by their plaintext; when encrypting, plaintext is replaced by base64.
+func transformProtected(document []byte, stream cipher.Stream, encrypt bool) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	var output bytes.Buffer
+	encoder := xml.NewEncoder(&output)
+
+	protectedDepth := 0
+	var text []byte
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if protectedDepth > 0 {
+				return nil, fmt.Errorf("%w: nested element in protected value", ErrCorrupt)
+			}
+			if t.Name.Local == "Value" && isProtected(t.Attr) {
+				protectedDepth = 1
+				text = text[:0]
+			}
+		case xml.CharData:
+			if protectedDepth > 0 {
+				text = append(text, t...)
+				continue
+			}
+		case xml.EndElement:
+			if protectedDepth > 0 {
+				protectedDepth = 0
+				value, err := xorProtected(text, stream, encrypt)
+				if err != nil {
+					return nil, err
+				}
+				if len(value) > 0 {
+					if err := encoder.EncodeToken(xml.CharData(value)); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// xorProtected decrypts a base64 value or encrypts a plaintext value with the next bytes of the stream
+func xorProtected(text []byte, stream cipher.Stream, encrypt bool) ([]byte, error) {
+	if encrypt {
+		out := make([]byte, len(text))
+		stream.XORKeyStream(out, text)
+		return []byte(base64.StdEncoding.EncodeToString(out)), nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid protected value", ErrCorrupt)
+	}
+	stream.XORKeyStream(data, data)
+	return data, nil
+}
+
+// isProtected returns whether a Value element carries Protected="True"
+func isProtected(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// =-- Conversion --= //
+
+// kdbxEpoch is the zero time of KDBX 4 timestamps
+var kdbxEpoch = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parseTime reads a KDBX 4 (base64 seconds) or KDBX 3 (RFC 3339) timestamp
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC()
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(data) != 8 {
+		return time.Time{}
+	}
+	seconds := int64(binary.LittleEndian.Uint64(data))
+	return time.Unix(seconds+kdbxEpoch.Unix(), 0).UTC()
+}
+
+// formatTime writes a KDBX 4 timestamp
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	seconds := t.Unix() - kdbxEpoch.Unix()
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(seconds)))
+}
+
+// parseUUID reads a base64 UUID, zero if invalid
+func parseUUID(value string) UUID {
+	var uuid UUID
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err == nil && len(data) == len(uuid) {
+		copy(uuid[:], data)
+	}
+	return uuid
+}
+
+// formatUUID writes a base64 UUID
+func formatUUID(uuid UUID) string {
+	return base64.StdEncoding.EncodeToString(uuid[:])
+}
+
+// formatBool writes a KeePass boolean
+func formatBool(value bool) string {
+	if value {
+		return "True"
+	}
+	return "False"
+}
+
+// groupFromXML converts a decoded group, resolving attachment references against the binary pool
+func groupFromXML(x *xmlGroup, binaries [][]byte) (*Group, error) {
+	group := &Group{UUID: parseUUID(x.UUID), Name: x.Name, Notes: x.Notes}
+
+	for i := range x.Entries {
+		entry, err := entryFromXML(&x.Entries[i], binaries)
+		if err != nil {
+			return nil, err
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+	for i := range x.Groups {
+		subgroup, err := groupFromXML(&x.Groups[i], binaries)
+		if err != nil {
+			return nil, err
+		}
+		group.Groups = append(group.Groups, subgroup)
+	}
+
+	return group, nil
+}
+
+// entryFromXML converts a decoded entry and its history
+func entryFromXML(x *xmlEntry, binaries [][]byte) (*Entry, error) {
+	entry := &Entry{
+		UUID:     parseUUID(x.UUID),
+		Tags:     splitTags(x.Tags),
+		Created:  parseTime(x.Times.CreationTime),
+		Modified: parseTime(x.Times.LastModificationTime),
+	}
+
+	for _, s := range x.Strings {
+		entry.Strings = append(entry.Strings, String{Key: s.Key, Value: s.Value.Text, Protected: isTrue(s.Value.Protected)})
+	}
+	for _, b := range x.Binaries {
+		if b.Value.Ref < 0 || b.Value.Ref >= len(binaries) {
+			return nil, fmt.Errorf("%w: attachment %q references a missing binary", ErrCorrupt, b.Key)
+		}
+		entry.Attachments = append(entry.Attachments, Attachment{Name: b.Key, Data: binaries[b.Value.Ref]})
+	}
+
+	if x.History != nil {
+		for i := range x.History.Entries {
+			previous, err := entryFromXML(&x.History.Entries[i], binaries)
+			if err != nil {
+				return nil, err
+			}
+			entry.History = append(entry.History, previous)
+		}
+	}
+
+	return entry, nil
+}
+
+// isTrue reads a KeePass boolean
+func isTrue(value string) bool {
+	return strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// binaryPool collects attachment data for the inner header, storing identical files once
+type binaryPool struct {
+	binaries [][]byte
+	index    map[string]int
+}
+
+// add returns the reference of an attachment's data
+func (pool *binaryPool) add(data []byte) int {
+	if pool.index == nil {
+		pool.index = make(map[string]int)
+	}
+	if ref, ok := pool.index[string(data)]; ok {
+		return ref
+	}
+	pool.binaries = append(pool.binaries, data)
+	pool.index[string(data)] = len(pool.binaries) - 1
+	return len(pool.binaries) - 1
+}
+
+// groupToXML converts a group for encoding, adding attachments to the binary pool
+func groupToXML(group *Group, pool *binaryPool) xmlGroup {
+	if group.UUID == (UUID{}) {
+		group.UUID = NewUUID()
+	}
+	now := formatTime(time.Now())
+	x := xmlGroup{
+		UUID:       formatUUID(group.UUID),
+		Name:       group.Name,
+		Notes:      group.Notes,
+		IconID:     48,
+		Times:      xmlTimes{CreationTime: now, LastModificationTime: now, LastAccessTime: now, ExpiryTime: now, Expires: "False", LocationChanged: now},
+		IsExpanded: "True",
+	}
+	for _, entry := range group.Entries {
+		x.Entries = append(x.Entries, entryToXML(entry, pool, true))
+	}
+	for _, subgroup := range group.Groups {
+		x.Groups = append(x.Groups, groupToXML(subgroup, pool))
+	}
+
+	return x
+}
+
+// entryToXML converts an entry for encoding, including its history unless it is itself a history item
+func entryToXML(entry *Entry, pool *binaryPool, withHistory bool) xmlEntry {
+	if entry.UUID == (UUID{}) {
+		entry.UUID = NewUUID()
+	}
+	modified := formatTime(entry.Modified)
+	x := xmlEntry{
+		UUID: formatUUID(entry.UUID),
+		Tags: strings.Join(entry.Tags, ";"),
+		Times: xmlTimes{
+			CreationTime:         formatTime(entry.Created),
+			LastModificationTime: modified,
+			LastAccessTime:       modified,
+			ExpiryTime:           modified,
+			Expires:              "False",
+			LocationChanged:      modified,
+		},
+	}
+
+	// Every entry has the standard strings, even if they are empty
+	for _, key := range []string{KeyTitle, KeyUserName, KeyPassword, KeyURL, KeyNotes} {
+		found := false
+		for _, s := range entry.Strings {
+			found = found || s.Key == key
+		}
+		if !found {
+			x.Strings = append(x.Strings, xmlString{Key: key, Value: xmlValue{Protected: protectedAttr(key == KeyPassword)}})
+		}
+	}
+	for _, s := range entry.Strings {
+		x.Strings = append(x.Strings, xmlString{Key: s.Key, Value: xmlValue{Protected: protectedAttr(s.Protected), Text: s.Value}})
+	}
+
+	for _, attachment := range entry.Attachments {
+		x.Binaries = append(x.Binaries, xmlBinary{Key: attachment.Name, Value: xmlBinaryValue{Ref: pool.add(attachment.Data)}})
+	}
+
+	if withHistory && len(entry.History) > 0 {
+		x.History = &xmlHistory{}
+		for _, previous := range entry.History {
+			x.History.Entries = append(x.History.Entries, entryToXML(previous, pool, false))
+		}
+	}
+
+	return x
+}
+
+// protectedAttr returns the Protected attribute value of a string
+func protectedAttr(protected bool) string {
+	if protected {
+		return "True"
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package remote
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound       = errors.New("no shared copy of the vault was found")
+	ErrVersionChanged = errors.New("shared copy of the vault was changed by another device")
+	ErrNoVersion      = errors.New("server does not report versions of the shared copy")
+	ErrServer         = errors.New("sync server returned an error")
+	ErrUnreadableBlob = errors.New("shared copy cannot be decrypted with this vault's key")
+	ErrUnsupportedURL = errors.New("sync URL must start with http:// or https://")
+)
+
+// =-- Sync Backends --= //
+
+// Backend stores the shared, encrypted copy of a vault that devices sync through. Every stored copy has
+// an opaque version that changes whenever it is replaced, so concurrent uploads can be detected.
+type Backend interface {
+	// Name identifies the shared copy in the vault's sync state, it must not contain credentials
+	Name() string
+
+	// Download writes the shared copy to w and returns its version, or ErrNotFound if there is none
+	Download(w io.Writer) (string, error)
+
+	// Upload replaces the shared copy if it is still at version (an empty version only creates a new
+	// one) and returns the new version, or ErrVersionChanged if another device replaced it first
+	Upload(r io.ReadSeeker, version string) (string, error)
+}
@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// BlobExtension is the file extension of shared copies stored in a directory
+const BlobExtension = ".plsync"
+
+// =-- Directory Backend --= //
+
+// Directory keeps the shared copy as a file in a local directory, such as a NAS mount or a folder kept in
+// sync by Syncthing. Versions are content hashes, so a copy replaced by the folder sync is detected.
+type Directory struct {
+	Path string // Path of the shared copy
+}
+
+// NewDirectory returns a backend keeping the shared copy of vaultName in dir
+func NewDirectory(dir string, vaultName string) *Directory {
+	return &Directory{Path: filepath.Join(dir, vaultName+BlobExtension)}
+}
+
+// Name returns the absolute path of the shared copy
+func (d *Directory) Name() string {
+	path, err := filepath.Abs(d.Path)
+	if err != nil {
+		return d.Path
+	}
+	return path
+}
+
+// Download copies the shared copy to w and returns its hash
+func (d *Directory) Download(w io.Writer) (string, error) {
+	file, err := os.Open(d.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("Error closing %s: %v", d.Path, err)
+		}
+	}(file)
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, hash), file)
+	if err != nil {
+		log.Printf("Error reading %s: %v", d.Path, err)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Upload replaces the shared copy through a temporary file, so other devices never see a partial copy
+func (d *Directory) Upload(r io.ReadSeeker, version string) (string, error) {
+	current, err := d.Download(io.Discard)
+	if errors.Is(err, ErrNotFound) {
+		current, err = "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if current != version {
+		return "", ErrVersionChanged
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(d.Path), "."+filepath.Base(d.Path)+"-*.tmp")
+	if err != nil {
+		log.Printf("Error creating file next to %s: %v", d.Path, err)
+		return "", err
+	}
+	defer func(path string) {
+		// Only left behind if the upload failed
+		_ = os.Remove(path)
+	}(temp.Name())
+
+	hash := sha256.New()
+	_, err = r.Seek(0, io.SeekStart)
+	if err == nil {
+		_, err = io.Copy(io.MultiWriter(temp, hash), r)
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), d.Path)
+	}
+	if err != nil {
+		log.Printf("Error writing %s: %v", d.Path, err)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,160 @@
+package remote
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Sync Parameters --= //
+
+// syncAttempts limits how often a sync starts over after another device replaced the shared copy
+const syncAttempts = 3
+
+// blobAssociatedData binds every shared copy to its purpose, so no other encrypted stream passes for one
+var blobAssociatedData = []byte("passlock-sync-v1")
+
+// =-- Sync Functions --= //
+
+// Sync merges the vault with the shared copy kept by backend, in both directions, and uploads the merged
+// copy. The copy is encrypted as a whole with the vault key, so the backend never sees vault data. If
+// another device uploads in the meantime, the sync starts over with its copy.
+func Sync(db *sql.DB, encryptionKey string, backend Backend) (*database.SyncSummary, error) {
+	for attempt := 1; ; attempt++ {
+		summary, err := syncOnce(db, encryptionKey, backend)
+		if !errors.Is(err, ErrVersionChanged) || attempt == syncAttempts {
+			return summary, err
+		}
+		log.Printf("Shared copy %s changed during sync, starting over", backend.Name())
+	}
+}
+
+// syncOnce downloads the shared copy, merges it and uploads it if it changed
+func syncOnce(db *sql.DB, encryptionKey string, backend Backend) (*database.SyncSummary, error) {
+	// The temporary directory is only readable by the current user
+	dir, err := os.MkdirTemp("", "passlock-sync-")
+	if err != nil {
+		return nil, err
+	}
+	defer func(dir string) {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			log.Printf("Error removing %s: %v", dir, err)
+		}
+	}(dir)
+
+	copyPath := filepath.Join(dir, "Shared.sqlite")
+	version, err := download(backend, encryptionKey, dir, copyPath)
+	if errors.Is(err, ErrNotFound) {
+		// The first device to sync starts the shared copy from its own vault
+		version = ""
+		err = database.WriteSyncCopy(db, copyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	publish := func(copyDB *sql.DB, summary *database.SyncSummary) error {
+		if version != "" && summary.Pushed == 0 {
+			return nil
+		}
+		return upload(backend, encryptionKey, dir, copyDB, version)
+	}
+	return database.SyncVaultCopy(db, encryptionKey, copyPath, backend.Name(), publish)
+}
+
+// download fetches the shared copy, decrypts it to path and returns its version
+func download(backend Backend, encryptionKey string, dir string, path string) (string, error) {
+	blob, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	defer closeFile(blob)
+
+	version, err := backend.Download(blob)
+	if err != nil {
+		return "", err
+	}
+	_, err = blob.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := encryption.NewDecryptReader(blob, encryptionKey, blobAssociatedData)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnreadableBlob, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, plaintext)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, encryption.ErrStreamCorrupt) || errors.Is(err, encryption.ErrStreamHeader) {
+		return "", fmt.Errorf("%w: %v", ErrUnreadableBlob, err)
+	}
+	if err != nil {
+		log.Printf("Error decrypting shared copy %s: %v", backend.Name(), err)
+		return "", err
+	}
+
+	return version, nil
+}
+
+// upload encrypts a consistent copy of the merged vault and uploads it in place of version
+func upload(backend Backend, encryptionKey string, dir string, copyDB *sql.DB, version string) error {
+	snapshotPath := filepath.Join(dir, "Upload.sqlite")
+	_ = os.Remove(snapshotPath)
+	// VACUUM INTO writes a single file holding everything committed, including pages still in the WAL
+	_, err := copyDB.Exec("VACUUM INTO ?;", snapshotPath)
+	if err != nil {
+		log.Printf("Error copying merged vault: %v", err)
+		return err
+	}
+	snapshot, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer closeFile(snapshot)
+
+	blob, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return err
+	}
+	defer closeFile(blob)
+	ciphertext, err := encryption.NewEncryptWriter(blob, encryptionKey, blobAssociatedData)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ciphertext, snapshot)
+	if closeErr := ciphertext.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error encrypting merged vault: %v", err)
+		return err
+	}
+
+	_, err = backend.Upload(blob, version)
+	if err != nil && !errors.Is(err, ErrVersionChanged) {
+		log.Printf("Error uploading shared copy %s: %v", backend.Name(), err)
+	}
+	return err
+}
+
+// closeFile closes a temporary file
+func closeFile(file *os.File) {
+	err := file.Close()
+	if err != nil {
+		log.Printf("Error closing %s: %v", file.Name(), err)
+	}
+}
@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// =-- WebDAV Parameters --= //
+
+const (
+	webDAVTimeout    = 2 * time.Minute        // Limit on a whole request, including the transfer
+	requestAttempts  = 3                      // Tries per request before giving up on a server
+	requestBaseDelay = 500 * time.Millisecond // Wait after the first failed try, doubled after each one
+)
+
+// =-- WebDAV Backend --= //
+
+// WebDAV keeps the shared copy as a file on a WebDAV server (e.g., Nextcloud), using ETags as versions
+// and conditional PUT requests so an upload never replaces a copy it has not merged
+type WebDAV struct {
+	URL      string       // URL of the shared copy
+	Username string       // Basic auth username (empty sends no credentials)
+	Password string       // Basic auth password
+	Client   *http.Client // Client requests are sent with
+}
+
+// NewWebDAV returns a backend keeping the shared copy at rawURL
+func NewWebDAV(rawURL string, username string, password string) (*WebDAV, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, rawURL)
+	}
+
+	return &WebDAV{
+		URL:      rawURL,
+		Username: username,
+		Password: password,
+		Client:   &http.Client{Timeout: webDAVTimeout},
+	}, nil
+}
+
+// Name returns the URL of the shared copy without credentials
+func (w *WebDAV) Name() string {
+	parsed, err := url.Parse(w.URL)
+	if err != nil {
+		return w.URL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// Download fetches the shared copy and returns its ETag
+func (w *WebDAV) Download(dst io.Writer) (string, error) {
+	resp, err := w.do(http.MethodGet, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%w: GET %s: %s", ErrServer, w.Name(), resp.Status)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", ErrNoVersion
+	}
+
+	_, err = io.Copy(dst, resp.Body)
+	if err != nil {
+		log.Printf("Error downloading %s: %v", w.Name(), err)
+		return "", err
+	}
+
+	return etag, nil
+}
+
+// Upload replaces the shared copy if its ETag still matches version
+func (w *WebDAV) Upload(r io.ReadSeeker, version string) (string, error) {
+	header := make(http.Header)
+	if version == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", version)
+	}
+
+	resp, err := w.do(http.MethodPut, r, header)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return "", ErrVersionChanged
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("%w: PUT %s: %s", ErrServer, w.Name(), resp.Status)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+
+	// Not every server reports the new ETag of an upload
+	head, err := w.do(http.MethodHead, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(head)
+	etag := head.Header.Get("ETag")
+	if head.StatusCode != http.StatusOK || etag == "" {
+		return "", ErrNoVersion
+	}
+
+	return etag, nil
+}
+
+// do sends a request, retrying with growing delays while the server cannot be reached or is overloaded
+func (w *WebDAV) do(method string, body io.ReadSeeker, header http.Header) (*http.Response, error) {
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: webDAVTimeout}
+	}
+
+	delay := requestBaseDelay
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(method, w.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			// Every try sends the whole body again, with its length as some servers refuse chunked uploads
+			req.ContentLength, err = body.Seek(0, io.SeekEnd)
+			if err == nil {
+				_, err = body.Seek(0, io.SeekStart)
+			}
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(body)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if w.Username != "" {
+			req.SetBasicAuth(w.Username, w.Password)
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt == requestAttempts {
+			if err != nil {
+				log.Printf("Error sending %s %s: %v", method, w.Name(), err)
+				return nil, err
+			}
+			return resp, nil
+		}
+		if err == nil {
+			closeBody(resp)
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryableStatus reports whether a response status means the request may succeed if sent again
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// closeBody drains and closes a response body so the connection can be reused
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	err := resp.Body.Close()
+	if err != nil {
+		log.Printf("Error closing response body: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package search
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// =-- Field Weights --= //
+
+// Weights applied to the best match score of each searchable field
+const (
+	serviceWeight  = 1.0
+	usernameWeight = 0.85
+	tagWeight      = 0.9
+	notesWeight    = 0.6
+)
+
+// Scores for the different kinds of token matches (before field weighting)
+const (
+	exactScore     = 1.0  // Field equals the token
+	wordScore      = 0.9  // A word in the field equals the token
+	prefixScore    = 0.8  // A word in the field starts with the token
+	substringScore = 0.65 // The token appears anywhere in the field
+	fuzzyMaxScore  = 0.5  // Upper bound for subsequence (fuzzy) matches
+	fuzzyMinScore  = 0.2  // Sparser subsequences are not considered a match
+)
+
+// =-- Searchable Data Structures --= //
+
+// Document stores the searchable information for a single password entry
+type Document struct {
+	ID       int      // Unique entry ID
+	Service  string   // Service (e.g., "https://github.com/login")
+	Username string   // Username for the account
+	Tags     []string // Tags assigned to the entry
+	Notes    string   // Decrypted notes (held in memory only)
+}
+
+// Result stores a single scored search result
+type Result struct {
+	ID    int     // Unique entry ID
+	Score float64 // Relevance score between 0 and 1
+	Field string  // Name of the field with the strongest match
+}
+
+// field stores a pre-processed (lowercase and tokenized) searchable field
+type field struct {
+	name   string
+	weight float64
+	text   string
+	words  []string
+}
+
+// Index stores pre-processed documents for fast repeated searches
+type Index struct {
+	docs   []Document
+	fields [][]field
+}
+
+// =-- Index Construction --= //
+
+// NewIndex builds a search index from a list of documents
+func NewIndex(docs []Document) *Index {
+	index := &Index{
+		docs:   docs,
+		fields: make([][]field, len(docs)),
+	}
+
+	// Pre-process every field once so each search only compares strings
+	for i, doc := range docs {
+		fields := []field{
+			newField("service", serviceWeight, doc.Service),
+			newField("username", usernameWeight, doc.Username),
+		}
+		for _, tag := range doc.Tags {
+			fields = append(fields, newField("tags", tagWeight, tag))
+		}
+		if doc.Notes != "" {
+			fields = append(fields, newField("notes", notesWeight, doc.Notes))
+		}
+		index.fields[i] = fields
+	}
+
+	return index
+}
+
+// BuildIndex builds a search index from database entries, decrypting notes in memory with encryptionKey
+func BuildIndex(entries []*database.PasswordInformation, encryptionKey string) (*Index, error) {
+	return buildIndex(entries, nil, encryptionKey, false)
+}
+
+// LoadIndex builds a search index over every entry and tag in a vault
+func LoadIndex(db *sql.DB, encryptionKey string) (*Index, error) {
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := database.GetAllEntryTags(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// One damaged entry should not leave the whole vault unsearchable
+	return buildIndex(entries, tags, encryptionKey, true)
+}
+
+// buildIndex converts entries and their tags (keyed by entry ID) into indexed documents. Entries whose notes
+// cannot be decrypted are either logged and left out, or fail the whole index.
+func buildIndex(entries []*database.PasswordInformation, tags map[int][]string, encryptionKey string, skipUnreadable bool) (*Index, error) {
+	docs := make([]Document, 0, len(entries))
+	for _, entry := range entries {
+		doc := Document{
+			ID:       entry.ID,
+			Service:  entry.Service,
+			Username: entry.Username,
+			Tags:     tags[entry.ID],
+		}
+
+		// Notes are optional, only decrypt if present
+		if entry.EncryptedNotes != "" {
+			notes, err := encryption.Decrypt(entry.EncryptedNotes, encryptionKey)
+			if err != nil && skipUnreadable {
+				log.Printf("Error decrypting notes of entry %d, left out of the search index: %v", entry.ID, err)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			doc.Notes = notes
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return NewIndex(docs), nil
+}
+
+// Len returns the number of documents in the index
+func (index *Index) Len() int {
+	return len(index.docs)
+}
+
+// =-- Searching --= //
+
+// Search returns results matching every token of query ordered by descending score, limit <= 0 returns all results
+func (index *Index) Search(query string, limit int) []Result {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var results []Result
+	for i, doc := range index.docs {
+		total := 0.0
+		bestField := ""
+		bestFieldScore := 0.0
+		matched := true
+
+		// Every token must match at least one field
+		for _, token := range tokens {
+			tokenScore := 0.0
+			tokenField := ""
+			for _, f := range index.fields[i] {
+				score := matchScore(token, f) * f.weight
+				if score > tokenScore {
+					tokenScore = score
+					tokenField = f.name
+				}
+			}
+			if tokenScore == 0 {
+				matched = false
+				break
+			}
+
+			total += tokenScore
+			if tokenScore > bestFieldScore {
+				bestFieldScore = tokenScore
+				bestField = tokenField
+			}
+		}
+
+		if matched {
+			results = append(results, Result{
+				ID:    doc.ID,
+				Score: total / float64(len(tokens)),
+				Field: bestField,
+			})
+		}
+	}
+
+	// Highest score first, ties broken by ID for stable output
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].ID < results[b].ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// =-- Matching Helpers --= //
+
+// newField lowercases and tokenizes a field for matching
+func newField(name string, weight float64, text string) field {
+	return field{
+		name:   name,
+		weight: weight,
+		text:   strings.ToLower(text),
+		words:  tokenize(text),
+	}
+}
+
+// tokenize splits text into lowercase words on any non-alphanumeric character
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchScore returns the best score for a token against a field, or 0 if it does not match
+func matchScore(token string, f field) float64 {
+	if f.text == "" {
+		return 0
+	}
+	if f.text == token {
+		return exactScore
+	}
+
+	// Word-level matches rank above plain substrings
+	best := 0.0
+	for _, word := range f.words {
+		if word == token {
+			return wordScore
+		}
+		if strings.HasPrefix(word, token) {
+			best = prefixScore
+		}
+	}
+	if best > 0 {
+		return best
+	}
+
+	if strings.Contains(f.text, token) {
+		return substringScore
+	}
+
+	return fuzzyScore(token, f.text)
+}
+
+// fuzzyScore scores token as an in-order subsequence of text, favouring compact matches
+func fuzzyScore(token string, text string) float64 {
+	tokenRunes := []rune(token)
+	if len(tokenRunes) < 2 {
+		return 0 // Single characters match nearly everything
+	}
+
+	// Find the first and last matched positions of the subsequence
+	start, end := -1, -1
+	ti := 0
+	for i, r := range []rune(text) {
+		if r != tokenRunes[ti] {
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+		ti++
+		if ti == len(tokenRunes) {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return 0
+	}
+
+	// A span equal to the token length is a perfect (contiguous) match
+	span := end - start + 1
+	score := fuzzyMaxScore * float64(len(tokenRunes)) / float64(span)
+	if score < fuzzyMinScore {
+		return 0
+	}
+
+	return score
+}
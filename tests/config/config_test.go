@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// clearConfigEnv removes every PassLock environment override for the rest of the test
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, variable := range []string{config.EnvHome, config.EnvConfig, config.EnvVaultDir, config.EnvPortable} {
+		t.Setenv(variable, "")
+	}
+}
+
+// TestDefaults checks the built-in settings
+func TestDefaults(t *testing.T) {
+	clearConfigEnv(t)
+	home := t.TempDir()
+	t.Setenv(config.EnvHome, home)
+
+	cfg := config.Default()
+	if cfg.VaultDirectory != filepath.Join(home, "vaults") {
+		t.Errorf("Unexpected vault directory %q", cfg.VaultDirectory)
+	}
+	if cfg.KDF.Params() != encryption.DefaultArgon2Params {
+		t.Errorf("Default KDF settings %+v do not match the encryption defaults", cfg.KDF.Params())
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Default settings are invalid: %v", err)
+	}
+}
+
+// TestXDGDirectories checks that Linux follows XDG_CONFIG_HOME and XDG_DATA_HOME and still finds old vaults
+func TestXDGDirectories(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG directories are only used on Linux")
+	}
+	clearConfigEnv(t)
+	home, configHome, dataHome := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	if path := config.ConfigPath(); path != filepath.Join(configHome, "passlock", config.FileName) {
+		t.Errorf("Unexpected config path %q", path)
+	}
+
+	paths := config.Default().VaultSearchPaths()
+	expected := []string{
+		filepath.Join(dataHome, "passlock", "vaults"),
+		filepath.Join(home, ".config", "passlock", "vaults"),
+	}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Errorf("Expected search paths %v, got %v", expected, paths)
+	}
+}
+
+// TestLoadFile checks that the config file and environment override the defaults
+func TestLoadFile(t *testing.T) {
+	clearConfigEnv(t)
+	home := t.TempDir()
+	t.Setenv(config.EnvHome, home)
+
+	path := filepath.Join(home, config.FileName)
+	err := os.WriteFile(path, []byte(`
+vault_directory = "my-vaults"
+search_paths = ["/srv/shared-vaults"]
+auto_lock_minutes = 5
+breach_data = "hibp"
+
+[kdf]
+time = 3
+memory_kib = 32768
+threads = 2
+
+[ui]
+theme = "dark"
+
+[backup]
+directory = "my-backups"
+keep = 3
+`), 0600)
+	if err != nil {
+		t.Fatalf("Error writing config file: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	// Relative paths are relative to the config file
+	if cfg.VaultDirectory != filepath.Join(home, "my-vaults") {
+		t.Errorf("Unexpected vault directory %q", cfg.VaultDirectory)
+	}
+	if cfg.Backup.Directory != filepath.Join(home, "my-backups") || cfg.Backup.Keep != 3 {
+		t.Errorf("Backup settings were not applied: %+v", cfg.Backup)
+	}
+	if cfg.BreachData != filepath.Join(home, "hibp") {
+		t.Errorf("Unexpected breach data path %q", cfg.BreachData)
+	}
+	if len(cfg.SearchPaths) != 1 || cfg.SearchPaths[0] != "/srv/shared-vaults" {
+		t.Errorf("Unexpected search paths %v", cfg.SearchPaths)
+	}
+	if cfg.AutoLockMinutes != 5 || cfg.UI.Theme != "dark" {
+		t.Errorf("File settings were not applied: %+v", cfg)
+	}
+	if cfg.KDF.Time != 3 || cfg.KDF.MemoryKiB != 32768 || cfg.KDF.Threads != 2 {
+		t.Errorf("KDF settings were not applied: %+v", cfg.KDF)
+	}
+	// Settings missing from the file keep their defaults
+	if cfg.UI.ClipboardClearSeconds != config.Default().UI.ClipboardClearSeconds {
+		t.Errorf("Missing setting lost its default: %d", cfg.UI.ClipboardClearSeconds)
+	}
+
+	// The environment wins over the file
+	override := t.TempDir()
+	t.Setenv(config.EnvVaultDir, override)
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.VaultDirectory != override {
+		t.Errorf("Expected %s to override the vault directory, got %q", config.EnvVaultDir, cfg.VaultDirectory)
+	}
+}
+
+// TestLoadInvalid checks that out of range settings are rejected
+func TestLoadInvalid(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), config.FileName)
+
+	for _, contents := range []string{
+		"auto_lock_minutes = -1",
+		"[ui]\ntheme = \"purple\"",
+		"[kdf]\nthreads = 0",
+		"[backup]\nkeep = -1",
+		"not toml",
+	} {
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("Error writing config file: %v", err)
+		}
+		if _, err := config.LoadFile(path); err == nil {
+			t.Errorf("Expected an error loading %q", contents)
+		}
+	}
+
+	if _, err := config.LoadFile(path); errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("Syntax errors should not be reported as ErrInvalidConfig")
+	}
+}
+
+// TestSaveAndLoad checks that saved settings load back unchanged
+func TestSaveAndLoad(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv(config.EnvHome, t.TempDir())
+
+	cfg := config.Default()
+	cfg.AutoLockMinutes = 0
+	cfg.UI.Theme = "light"
+	cfg.SearchPaths = []string{t.TempDir()}
+	if err := config.Save(cfg); err != nil {
+		t.Fatalf("Error saving config: %v", err)
+	}
+
+	info, err := os.Stat(config.ConfigPath())
+	if err != nil {
+		t.Fatalf("Config file was not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected config file permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := config.Load()
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if loaded.AutoLockMinutes != 0 || loaded.UI.Theme != "light" || loaded.SearchPaths[0] != cfg.SearchPaths[0] {
+		t.Errorf("Loaded settings %+v do not match saved settings %+v", loaded, cfg)
+	}
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// TestAttachments adds, lists, extracts, and deletes an attachment spanning several chunks
+func TestAttachments(t *testing.T) {
+	db := openTestVault(t, "AttachmentVault")
+	key := testEncryptionKey(t)
+	entryID := storeTestEntry(t, db, "https://bank.example.com", 0)
+
+	content := make([]byte, 3*encryption.StreamChunkSize+123)
+	_, _ = rand.Read(content)
+
+	attachment, err := database.AddAttachment(db, key, entryID, "/tmp/recovery-codes.pdf", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+	t.Logf("Attachment: %+v", attachment)
+	if attachment.Name != "recovery-codes.pdf" || attachment.Size != int64(len(content)) {
+		t.Fatalf("Unexpected attachment information %+v", attachment)
+	}
+
+	attachments, err := database.ListAttachments(db, entryID)
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("Expected 1 attachment, got %v (%v)", attachments, err)
+	}
+
+	var extracted bytes.Buffer
+	if err := database.ExtractAttachment(db, key, attachment.ID, &extracted); err != nil {
+		t.Fatalf("Error extracting attachment: %v", err)
+	}
+	if !bytes.Equal(extracted.Bytes(), content) {
+		t.Fatalf("Extracted attachment does not match the original")
+	}
+
+	// The stored chunks are not plaintext
+	var firstChunk []byte
+	_ = db.QueryRow("SELECT data FROM attachment_chunks WHERE attachment_id = ? AND seq = 1;", attachment.ID).Scan(&firstChunk)
+	if bytes.Contains(firstChunk, content[:64]) {
+		t.Fatalf("Attachment chunk contains plaintext")
+	}
+
+	// A wrong key fails integrity verification
+	wrongKey := testEncryptionKey(t)
+	if err := database.ExtractAttachment(db, wrongKey, attachment.ID, &bytes.Buffer{}); !errors.Is(err, encryption.ErrStreamCorrupt) {
+		t.Errorf("Expected ErrStreamCorrupt with the wrong key, got %v", err)
+	}
+
+	// Deleting the entry deletes its attachments
+	if err := database.DeleteEntryFromID(db, entryID); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+	var chunkCount int
+	_ = db.QueryRow("SELECT COUNT(*) FROM attachment_chunks;").Scan(&chunkCount)
+	if chunkCount != 0 {
+		t.Fatalf("Expected attachment chunks to be deleted with the entry, %d remain", chunkCount)
+	}
+}
+
+// TestAttachmentIntegrity tests tampered, truncated, and oversized attachments
+func TestAttachmentIntegrity(t *testing.T) {
+	db := openTestVault(t, "AttachmentVault")
+	key := testEncryptionKey(t)
+	entryID := storeTestEntry(t, db, "https://example.com", 0)
+
+	content := make([]byte, 2*encryption.StreamChunkSize)
+	_, _ = rand.Read(content)
+
+	attachment, err := database.AddAttachment(db, key, entryID, "cert.pem", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+
+	// Removing the last chunk row is detected
+	_, err = db.Exec(`DELETE FROM attachment_chunks WHERE attachment_id = ?
+		AND seq = (SELECT MAX(seq) FROM attachment_chunks WHERE attachment_id = ?);`, attachment.ID, attachment.ID)
+	if err != nil {
+		t.Fatalf("Error removing chunk: %v", err)
+	}
+	if err := database.ExtractAttachment(db, key, attachment.ID, &bytes.Buffer{}); !errors.Is(err, encryption.ErrStreamTruncated) {
+		t.Errorf("Expected ErrStreamTruncated, got %v", err)
+	}
+
+	// Attachments larger than the limit are rejected without leaving rows behind
+	previousLimit := database.MaxAttachmentSize
+	database.MaxAttachmentSize = 1024
+	defer func() { database.MaxAttachmentSize = previousLimit }()
+
+	_, err = database.AddAttachment(db, key, entryID, "big.bin", bytes.NewReader(make([]byte, 2048)))
+	if !errors.Is(err, database.ErrAttachmentTooLarge) {
+		t.Fatalf("Expected ErrAttachmentTooLarge, got %v", err)
+	}
+	attachments, _ := database.ListAttachments(db, entryID)
+	if len(attachments) != 1 {
+		t.Fatalf("Expected only the first attachment to remain, got %v", attachments)
+	}
+
+	if _, err := database.AddAttachment(db, key, entryID, " ", bytes.NewReader(nil)); !errors.Is(err, database.ErrAttachmentName) {
+		t.Errorf("Expected ErrAttachmentName, got %v", err)
+	}
+}
+
+// TestAttachmentRekey re-keys a vault with an attachment spanning several chunks
+func TestAttachmentRekey(t *testing.T) {
+	db := openTestVault(t, "AttachmentRekey")
+	key := testEncryptionKey(t)
+	entry, err := database.GetEntryByUUID(db, storeSecretEntry(t, db, key, "https://bank.example.com", "hunter2"))
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+
+	content := make([]byte, 3*encryption.StreamChunkSize+123)
+	_, _ = rand.Read(content)
+	attachment, err := database.AddAttachment(db, key, entry.ID, "codes.pdf", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+	var chunks int
+	_ = db.QueryRow("SELECT COUNT(*) FROM attachment_chunks WHERE attachment_id = ?;", attachment.ID).Scan(&chunks)
+
+	newKeys, err := database.DeriveVaultKeys("new master password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	if err := database.RekeyVault(db, key, *newKeys); err != nil {
+		t.Fatalf("Error re-keying vault: %v", err)
+	}
+
+	var extracted bytes.Buffer
+	if err := database.ExtractAttachment(db, newKeys.EncryptionKey, attachment.ID, &extracted); err != nil {
+		t.Fatalf("Error extracting re-keyed attachment: %v", err)
+	}
+	if !bytes.Equal(extracted.Bytes(), content) {
+		t.Errorf("Re-keyed attachment does not match the original")
+	}
+	if err := database.ExtractAttachment(db, key, attachment.ID, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected the old key to no longer decrypt the attachment")
+	}
+
+	// The new chunks replace the old ones, numbered from 0 without gaps
+	var count, first, last int
+	err = db.QueryRow("SELECT COUNT(*), MIN(seq), MAX(seq) FROM attachment_chunks WHERE attachment_id = ?;", attachment.ID).Scan(&count, &first, &last)
+	if err != nil || count != chunks || first != 0 || last != chunks-1 {
+		t.Errorf("Expected chunks 0 to %d, got %d chunks from %d to %d (%v)", chunks-1, count, first, last, err)
+	}
+}
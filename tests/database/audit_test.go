@@ -0,0 +1,259 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestAuditLog appends records and reads them back in order
+func TestAuditLog(t *testing.T) {
+	db := openTestVault(t, "Audited")
+	key := testEncryptionKey(t)
+
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Expected an empty audit log, got %v (%v)", records, err)
+	}
+
+	for _, record := range []database.AuditRecord{
+		{Event: database.AuditReveal, EntryID: 3, Service: "github.com", Detail: "secret"},
+		{Event: database.AuditCopy, EntryID: 3, Service: "github.com", Detail: "secret"},
+		{Event: database.AuditDelete, EntryID: 3, Service: "github.com"},
+	} {
+		if err := database.AppendAudit(db, key, record); err != nil {
+			t.Fatalf("Error appending audit record: %v", err)
+		}
+	}
+
+	records, err = database.ReadAuditLog(db, key)
+	if err != nil {
+		t.Fatalf("Error reading audit log: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	for i, event := range []database.AuditEvent{database.AuditReveal, database.AuditCopy, database.AuditDelete} {
+		record := records[i]
+		if record.ID != i+1 || record.Event != event || record.Service != "github.com" || record.Actor == "" || record.Time.IsZero() {
+			t.Errorf("Unexpected record %d: %+v", i+1, record)
+		}
+	}
+
+	// Records are encrypted at rest
+	var stored string
+	if err := db.QueryRow("SELECT record FROM audit_log WHERE id = 1;").Scan(&stored); err != nil {
+		t.Fatalf("Error reading stored record: %v", err)
+	}
+	if bytes.Contains([]byte(stored), []byte("github.com")) {
+		t.Errorf("Audit record is stored unencrypted: %s", stored)
+	}
+
+	// The log cannot be changed through SQL without removing its triggers
+	if _, err := db.Exec("DELETE FROM audit_log WHERE id = 3;"); err == nil {
+		t.Errorf("Expected deleting an audit record to fail")
+	}
+	if _, err := db.Exec("UPDATE audit_log SET record = 'x' WHERE id = 1;"); err == nil {
+		t.Errorf("Expected editing an audit record to fail")
+	}
+}
+
+// TestAuditLogTampering checks that edited, removed and truncated records are detected
+func TestAuditLogTampering(t *testing.T) {
+	tamper := map[string]string{
+		"edited":    "UPDATE audit_log SET record = (SELECT record FROM audit_log WHERE id = 1) WHERE id = 2;",
+		"removed":   "DELETE FROM audit_log WHERE id = 2;",
+		"truncated": "DELETE FROM audit_log WHERE id = 3;",
+		"reordered": "UPDATE audit_log SET id = 10 WHERE id = 1;",
+	}
+
+	for name, statement := range tamper {
+		t.Run(name, func(t *testing.T) {
+			db := openTestVault(t, "Tampered")
+			key := testEncryptionKey(t)
+			for _, event := range []database.AuditEvent{database.AuditReveal, database.AuditEdit, database.AuditExport} {
+				if err := database.AppendAudit(db, key, database.AuditRecord{Event: event}); err != nil {
+					t.Fatalf("Error appending audit record: %v", err)
+				}
+			}
+
+			// Someone with direct access to the file can drop the triggers first
+			_, err := db.Exec("DROP TRIGGER audit_log_no_update; DROP TRIGGER audit_log_no_delete;")
+			if err != nil {
+				t.Fatalf("Error dropping triggers: %v", err)
+			}
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("Error tampering with audit log: %v", err)
+			}
+
+			records, err := database.ReadAuditLog(db, key)
+			if !errors.Is(err, database.ErrAuditTampered) {
+				t.Fatalf("Expected ErrAuditTampered, got %v", err)
+			}
+			if name == "truncated" && len(records) != 2 {
+				t.Errorf("Expected the 2 intact records before the break, got %d", len(records))
+			}
+		})
+	}
+}
+
+// TestAuditLogDeleted checks deleting the whole log together with its key is detected and recorded
+func TestAuditLogDeleted(t *testing.T) {
+	db := openTestVault(t, "Emptied")
+	key := testEncryptionKey(t)
+	for _, event := range []database.AuditEvent{database.AuditReveal, database.AuditExport} {
+		if err := database.AppendAudit(db, key, database.AuditRecord{Event: event}); err != nil {
+			t.Fatalf("Error appending audit record: %v", err)
+		}
+	}
+
+	_, err := db.Exec("DROP TRIGGER audit_log_no_delete; DELETE FROM audit_log; DELETE FROM audit_state;")
+	if err != nil {
+		t.Fatalf("Error deleting audit log: %v", err)
+	}
+	if _, err := database.ReadAuditLog(db, key); !errors.Is(err, database.ErrAuditTampered) {
+		t.Fatalf("Expected ErrAuditTampered, got %v", err)
+	}
+
+	// Logging goes on in a new log that starts by recording the deletion
+	if err := database.AppendAudit(db, key, database.AuditRecord{Event: database.AuditCopy}); err != nil {
+		t.Fatalf("Error appending audit record: %v", err)
+	}
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil || len(records) != 2 || records[0].Event != database.AuditLogRestarted || records[1].Event != database.AuditCopy {
+		t.Errorf("Expected the restart to be recorded before the new record, got %+v (%v)", records, err)
+	}
+}
+
+// TestAuditFailedUnlocks checks failed unlocks are chained into the log at the next unlock
+func TestAuditFailedUnlocks(t *testing.T) {
+	db := openTestVault(t, "Unlocks")
+	key := testEncryptionKey(t)
+
+	for range 2 {
+		authenticated, err := database.AuthenticateVault("Unlocks", "wrong auth key")
+		if err != nil || authenticated {
+			t.Fatalf("Expected the wrong key to be denied (authenticated=%v, err=%v)", authenticated, err)
+		}
+	}
+
+	if err := database.RecordUnlock(db, key); err != nil {
+		t.Fatalf("Error recording unlock: %v", err)
+	}
+	if err := database.RecordUnlock(db, key); err != nil {
+		t.Fatalf("Error recording unlock: %v", err)
+	}
+
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil {
+		t.Fatalf("Error reading audit log: %v", err)
+	}
+	var events []database.AuditEvent
+	for _, record := range records {
+		events = append(events, record.Event)
+	}
+	expected := []database.AuditEvent{database.AuditFailedUnlock, database.AuditFailedUnlock, database.AuditUnlock, database.AuditUnlock}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, events)
+			break
+		}
+	}
+}
+
+// TestAuditLogRekeyAndExport checks the log survives re-keying and exports as CSV
+func TestAuditLogRekeyAndExport(t *testing.T) {
+	db := openTestVault(t, "Rekeyed")
+	oldKey := testEncryptionKey(t)
+	err := database.AppendAudit(db, oldKey, database.AuditRecord{Event: database.AuditImport, Detail: "3 entries"})
+	if err != nil {
+		t.Fatalf("Error appending audit record: %v", err)
+	}
+
+	newKeys, err := database.DeriveVaultKeys("new master password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	if err := database.RekeyVault(db, oldKey, *newKeys); err != nil {
+		t.Fatalf("Error re-keying vault: %v", err)
+	}
+	if _, err := database.ReadAuditLog(db, oldKey); err == nil {
+		t.Errorf("Expected the old key to no longer read the audit log")
+	}
+
+	var exported bytes.Buffer
+	if err := database.ExportAuditLog(db, newKeys.EncryptionKey, &exported); err != nil {
+		t.Fatalf("Error exporting audit log: %v", err)
+	}
+	rows, err := csv.NewReader(&exported).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading exported CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][2] != "event" || rows[1][2] != string(database.AuditImport) || rows[1][5] != "3 entries" {
+		t.Errorf("Unexpected exported audit log %v", rows)
+	}
+
+	// The marker follows the new key, so deleting the log is still detected
+	_, err = db.Exec("DROP TRIGGER audit_log_no_delete; DELETE FROM audit_log; DELETE FROM audit_state;")
+	if err != nil {
+		t.Fatalf("Error deleting audit log: %v", err)
+	}
+	if _, err := database.ReadAuditLog(db, newKeys.EncryptionKey); !errors.Is(err, database.ErrAuditTampered) {
+		t.Errorf("Expected ErrAuditTampered after re-keying, got %v", err)
+	}
+}
+
+// TestAuditMarkerRemoved checks clearing the audit marker, with or without deleting the log and its key,
+// is detected while the vault still unlocks
+func TestAuditMarkerRemoved(t *testing.T) {
+	tamper := map[string]string{
+		"nulled":          "UPDATE vault_metadata SET audit_marker = NULL;",
+		"emptied":         "UPDATE vault_metadata SET audit_marker = '';",
+		"nulled with log": "DROP TRIGGER audit_log_no_delete; DELETE FROM audit_log; DELETE FROM audit_state; UPDATE vault_metadata SET audit_marker = NULL;",
+	}
+
+	for name, statement := range tamper {
+		t.Run(name, func(t *testing.T) {
+			db := openTestVault(t, "Unmarked")
+			key := testEncryptionKey(t)
+			for _, event := range []database.AuditEvent{database.AuditReveal, database.AuditExport} {
+				if err := database.AppendAudit(db, key, database.AuditRecord{Event: event}); err != nil {
+					t.Fatalf("Error appending audit record: %v", err)
+				}
+			}
+
+			// Starting the log seals the stored authentication key, which still accepts the right one
+			var authKey string
+			if err := db.QueryRow("SELECT auth_key FROM vault_metadata;").Scan(&authKey); err != nil {
+				t.Fatalf("Error reading vault metadata: %v", err)
+			}
+			if authKey == "hashedAuthKey" {
+				t.Errorf("Expected the authentication key to be sealed once the audit log started")
+			}
+
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("Error tampering with audit marker: %v", err)
+			}
+			if _, err := database.ReadAuditLog(db, key); !errors.Is(err, database.ErrAuditTampered) {
+				t.Fatalf("Expected ErrAuditTampered, got %v", err)
+			}
+			if authenticated, err := database.AuthenticateVault("Unmarked", "hashedAuthKey"); err != nil || !authenticated {
+				t.Fatalf("Expected the vault to still unlock (authenticated=%v, err=%v)", authenticated, err)
+			}
+
+			// The next record puts the marker back
+			if err := database.AppendAudit(db, key, database.AuditRecord{Event: database.AuditCopy}); err != nil {
+				t.Fatalf("Error appending audit record: %v", err)
+			}
+			if _, err := database.ReadAuditLog(db, key); err != nil {
+				t.Errorf("Expected the audit log to be readable again, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// runStoreConformance checks the behaviour every Store implementation must share
+func runStoreConformance(t *testing.T, newStore func(t *testing.T) database.Store) {
+	t.Run("StoreAndGet", func(t *testing.T) {
+		store := newStore(t)
+
+		stored, err := store.StorePassword(database.PasswordEntry{
+			Service:           "github.com",
+			Username:          "octocat",
+			EncryptedPassword: "encryptedPassword",
+			EncryptedNotes:    "encryptedNotes",
+		})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+		if stored.ID == 0 || stored.CreatedAt == "" {
+			t.Fatalf("Stored entry is missing its ID or creation time: %+v", stored)
+		}
+		if stored.EntryType != database.EntryLogin {
+			t.Errorf("Expected default entry type %q, got %q", database.EntryLogin, stored.EntryType)
+		}
+		if stored.UUID == "" || stored.PasswordChangedAt == "" {
+			t.Errorf("Stored entry is missing its UUID or password change time: %+v", stored)
+		}
+
+		fetched, err := store.GetEntryFromID(stored.ID)
+		if err != nil {
+			t.Fatalf("Error fetching entry: %v", err)
+		}
+		if fetched.Service != "github.com" || fetched.Username != "octocat" ||
+			fetched.EncryptedPassword != "encryptedPassword" || fetched.EncryptedNotes != "encryptedNotes" {
+			t.Errorf("Fetched entry does not match the stored entry: %+v", fetched)
+		}
+	})
+
+	t.Run("PasswordChangedAt", func(t *testing.T) {
+		store := newStore(t)
+
+		changedAt := time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)
+		stored, err := store.StorePassword(database.PasswordEntry{Service: "old.example", PasswordChangedAt: changedAt})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+		fresh, err := store.StorePassword(database.PasswordEntry{Service: "new.example"})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+		if stored.PasswordChangedAt != "2024-02-01T09:30:00.000Z" {
+			t.Errorf("Expected the given change time to be kept, got %q", stored.PasswordChangedAt)
+		}
+		if fresh.UUID == stored.UUID {
+			t.Errorf("Entries share the UUID %s", fresh.UUID)
+		}
+	})
+
+	t.Run("QueriesAndOrdering", func(t *testing.T) {
+		store := newStore(t)
+
+		for _, service := range []string{"b.example", "a.example", "b.example"} {
+			if _, err := store.StorePassword(database.PasswordEntry{Service: service}); err != nil {
+				t.Fatalf("Error storing password: %v", err)
+			}
+		}
+
+		entries, err := store.GetAllEntries()
+		if err != nil {
+			t.Fatalf("Error fetching entries: %v", err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 entries, got %d", len(entries))
+		}
+		for i := 1; i < len(entries); i++ {
+			if entries[i-1].ID >= entries[i].ID {
+				t.Errorf("Entries are not ordered by ID")
+			}
+		}
+
+		matches, err := store.GetEntriesFromService("b.example")
+		if err != nil {
+			t.Fatalf("Error fetching entries by service: %v", err)
+		}
+		if len(matches) != 2 {
+			t.Errorf("Expected 2 entries for b.example, got %d", len(matches))
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t)
+
+		stored, err := store.StorePassword(database.PasswordEntry{Service: "example.com"})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+
+		if err := store.DeleteEntryFromID(stored.ID); err != nil {
+			t.Fatalf("Error deleting entry: %v", err)
+		}
+		if _, err := store.GetEntryFromID(stored.ID); !errors.Is(err, database.ErrEntryNotFound) {
+			t.Errorf("Expected ErrEntryNotFound after delete, got %v", err)
+		}
+		if err := store.DeleteEntryFromID(stored.ID); !errors.Is(err, database.ErrEntryNotFound) {
+			t.Errorf("Expected ErrEntryNotFound deleting twice, got %v", err)
+		}
+	})
+
+	t.Run("ClearDoesNotReuseIDs", func(t *testing.T) {
+		store := newStore(t)
+
+		first, err := store.StorePassword(database.PasswordEntry{Service: "example.com"})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+		if err := store.ClearDatabase(); err != nil {
+			t.Fatalf("Error clearing store: %v", err)
+		}
+
+		entries, err := store.GetAllEntries()
+		if err != nil {
+			t.Fatalf("Error fetching entries: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected an empty store, got %d entries", len(entries))
+		}
+
+		second, err := store.StorePassword(database.PasswordEntry{Service: "example.com"})
+		if err != nil {
+			t.Fatalf("Error storing password: %v", err)
+		}
+		if second.ID <= first.ID {
+			t.Errorf("Entry ID %d was reused after clearing", second.ID)
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.GetMetadata(); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("Expected sql.ErrNoRows before metadata is set, got %v", err)
+		}
+
+		for _, authKey := range []string{"authKey1", "authKey2"} {
+			err := store.SetMetadata(database.VaultMetadata{VaultName: "Vault", AuthKey: authKey, Salt: "salt"})
+			if err != nil {
+				t.Fatalf("Error setting metadata: %v", err)
+			}
+		}
+
+		metadata, err := store.GetMetadata()
+		if err != nil {
+			t.Fatalf("Error fetching metadata: %v", err)
+		}
+		if metadata.VaultName != "Vault" || metadata.AuthKey != "authKey2" || metadata.Salt != "salt" {
+			t.Errorf("Metadata was not replaced: %+v", metadata)
+		}
+	})
+}
+
+// closeStore registers a cleanup that closes a store
+func closeStore(t *testing.T, store database.Store) database.Store {
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Logf("Error closing store: %v", err)
+		}
+	})
+	return store
+}
+
+// TestSQLiteStore runs the store conformance checks against an in-memory SQLite vault
+func TestSQLiteStore(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) database.Store {
+		db, err := database.OpenMemoryDB()
+		if err != nil {
+			t.Fatalf("Error opening in-memory database: %v", err)
+		}
+		return closeStore(t, database.NewSQLiteStore(db))
+	})
+}
+
+// TestMemoryStore runs the store conformance checks against the in-memory backend
+func TestMemoryStore(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) database.Store {
+		return closeStore(t, database.NewMemoryStore())
+	})
+}
+
+// TestJSONFileStore runs the store conformance checks against the single-file JSON backend
+func TestJSONFileStore(t *testing.T) {
+	key := testEncryptionKey(t)
+	runStoreConformance(t, func(t *testing.T) database.Store {
+		store, err := database.OpenJSONFileStore(filepath.Join(t.TempDir(), "vault.json"), key)
+		if err != nil {
+			t.Fatalf("Error opening JSON store: %v", err)
+		}
+		return closeStore(t, store)
+	})
+}
+
+// TestJSONFileStorePersistence checks that a JSON vault survives reopening and keeps entries encrypted
+func TestJSONFileStorePersistence(t *testing.T) {
+	key := testEncryptionKey(t)
+	path := filepath.Join(t.TempDir(), "vault.json")
+
+	store, err := database.OpenJSONFileStore(path, key)
+	if err != nil {
+		t.Fatalf("Error opening JSON store: %v", err)
+	}
+	err = store.SetMetadata(database.VaultMetadata{VaultName: "Portable", AuthKey: "authKey", Salt: "salt"})
+	if err != nil {
+		t.Fatalf("Error setting metadata: %v", err)
+	}
+	stored, err := store.StorePassword(database.PasswordEntry{Service: "secret-service.example", Username: "me"})
+	if err != nil {
+		t.Fatalf("Error storing password: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Error closing store: %v", err)
+	}
+
+	// Entries are encrypted, only the unlock metadata is readable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading vault file: %v", err)
+	}
+	if strings.Contains(string(data), "secret-service.example") {
+		t.Errorf("Vault file contains a plaintext service name")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading vault file info: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected vault file permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	metadata, err := database.ReadJSONFileMetadata(path)
+	if err != nil {
+		t.Fatalf("Error reading metadata: %v", err)
+	}
+	if metadata.VaultName != "Portable" || metadata.Salt != "salt" {
+		t.Errorf("Unexpected metadata: %+v", metadata)
+	}
+
+	reopened, err := database.OpenJSONFileStore(path, key)
+	if err != nil {
+		t.Fatalf("Error reopening JSON store: %v", err)
+	}
+	closeStore(t, reopened)
+
+	entry, err := reopened.GetEntryFromID(stored.ID)
+	if err != nil {
+		t.Fatalf("Error fetching entry after reopening: %v", err)
+	}
+	if entry.Service != "secret-service.example" || entry.Username != "me" {
+		t.Errorf("Entry changed after reopening: %+v", entry)
+	}
+
+	next, err := reopened.StorePassword(database.PasswordEntry{Service: "next.example"})
+	if err != nil {
+		t.Fatalf("Error storing password: %v", err)
+	}
+	if next.ID <= stored.ID {
+		t.Errorf("Entry ID %d was reused after reopening", next.ID)
+	}
+
+	// The wrong key cannot open the vault
+	if _, err := database.OpenJSONFileStore(path, testEncryptionKey(t)); err == nil {
+		t.Errorf("Expected an error opening the vault with the wrong key")
+	}
+}
+
+// TestJSONFileStoreRollback checks that a change the file could not be saved with is undone in memory
+func TestJSONFileStoreRollback(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "vaults")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	store, err := database.OpenJSONFileStore(filepath.Join(dir, "vault.json"), testEncryptionKey(t))
+	if err != nil {
+		t.Fatalf("Error opening JSON store: %v", err)
+	}
+	closeStore(t, store)
+	stored, err := store.StorePassword(database.PasswordEntry{Service: "kept.example"})
+	if err != nil {
+		t.Fatalf("Error storing password: %v", err)
+	}
+
+	// Saving fails once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("Error removing directory: %v", err)
+	}
+	if _, err := store.StorePassword(database.PasswordEntry{Service: "lost.example"}); err == nil {
+		t.Fatalf("Expected storing to fail without a directory")
+	}
+	if err := store.DeleteEntryFromID(stored.ID); err == nil {
+		t.Fatalf("Expected deleting to fail without a directory")
+	}
+	if err := store.SetMetadata(database.VaultMetadata{VaultName: "Lost"}); err == nil {
+		t.Fatalf("Expected setting metadata to fail without a directory")
+	}
+
+	entries, err := store.GetAllEntries()
+	if err != nil || len(entries) != 1 || entries[0].ID != stored.ID {
+		t.Errorf("Expected only the saved entry to remain, got %+v (%v)", entries, err)
+	}
+	if _, err := store.GetMetadata(); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected the unsaved metadata to be undone, got %v", err)
+	}
+}
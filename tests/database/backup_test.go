@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// createPasswordVault creates a vault unlocked by password and returns it open
+func createPasswordVault(t *testing.T, vaultName string, password string) *sql.DB {
+	t.Helper()
+
+	keys, err := database.DeriveVaultKeys(password, fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	err = database.CreateVaultWithKDF(vaultName, keys.AuthKey, keys.Salt, keys.KDF)
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+
+	db, err := database.InitDB(vaultName)
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+// useBackupSettings installs backup settings for the rest of the test
+func useBackupSettings(t *testing.T, keep int, intervalHours int) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Backup.Keep = keep
+	cfg.Backup.IntervalHours = intervalHours
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+}
+
+// TestBackupAndRestore backs up a vault, clears it, and restores the backup
+func TestBackupAndRestore(t *testing.T) {
+	useTempVaultHome(t)
+	db := createPasswordVault(t, "Backed", "correct horse")
+	storeTestEntry(t, db, "https://first.example.com", 0)
+
+	manual, err := database.BackupVault("Backed", database.BackupManual)
+	if err != nil {
+		t.Fatalf("Error backing up vault: %v", err)
+	}
+	if manual.Entries != 1 || manual.Reason != database.BackupManual {
+		t.Errorf("Unexpected backup details %+v", manual)
+	}
+
+	// Clearing the vault takes its own backup first
+	storeTestEntry(t, db, "https://second.example.com", 0)
+	if err := database.ClearDatabase(db); err != nil {
+		t.Fatalf("Error clearing vault: %v", err)
+	}
+
+	backups, err := database.ListBackups("Backed")
+	if err != nil {
+		t.Fatalf("Error listing backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %d", len(backups))
+	}
+	if backups[0].Reason != database.BackupClear || backups[0].Entries != 2 {
+		t.Errorf("Expected the newest backup to be the pre-clear backup with 2 entries, got %+v", backups[0])
+	}
+	if !backups[0].CreatedAt.After(backups[1].CreatedAt) {
+		t.Errorf("Backups are not listed newest first")
+	}
+
+	// The backup is only restored with its master password
+	err = database.RestoreBackup("Backed", manual, "wrong password")
+	if !errors.Is(err, database.ErrBackupAuth) {
+		t.Fatalf("Expected ErrBackupAuth, got %v", err)
+	}
+	err = database.RestoreBackup("Backed", manual, "correct horse")
+	if err != nil {
+		t.Fatalf("Error restoring backup: %v", err)
+	}
+
+	entries, err := database.GetAllEntries(db)
+	if err != nil || len(entries) != 1 || entries[0].Service != "https://first.example.com" {
+		t.Errorf("Restored vault does not match the backup: %v (%v)", entries, err)
+	}
+
+	// The restore itself can be undone
+	backups, _ = database.ListBackups("Backed")
+	if len(backups) != 3 || backups[0].Reason != database.BackupRestore || backups[0].Entries != 0 {
+		t.Errorf("Expected a pre-restore backup of the empty vault, got %+v", backups[0])
+	}
+}
+
+// TestBackupRetention checks that only the configured number of backups is kept
+func TestBackupRetention(t *testing.T) {
+	useTempVaultHome(t)
+	useBackupSettings(t, 2, 24)
+	createTestVault(t, "Retained")
+
+	var newest *database.Backup
+	for i := 0; i < 4; i++ {
+		backup, err := database.BackupVault("Retained", database.BackupManual)
+		if err != nil {
+			t.Fatalf("Error backing up vault: %v", err)
+		}
+		newest = backup
+	}
+
+	backups, err := database.ListBackups("Retained")
+	if err != nil {
+		t.Fatalf("Error listing backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups after pruning, got %d", len(backups))
+	}
+	if backups[0].Path != newest.Path {
+		t.Errorf("The newest backup was pruned")
+	}
+}
+
+// TestBackupsPerVaultFile checks vaults sharing a name elsewhere keep separate backups
+func TestBackupsPerVaultFile(t *testing.T) {
+	useTempVaultHome(t)
+	useBackupSettings(t, 2, 24)
+	createTestVault(t, "Shared")
+
+	backup, err := database.BackupVault("Shared", database.BackupManual)
+	if err != nil {
+		t.Fatalf("Error backing up vault: %v", err)
+	}
+	if _, err := database.BackupVault("Shared", database.BackupManual); err != nil {
+		t.Fatalf("Error backing up vault: %v", err)
+	}
+
+	// A copy elsewhere still has "Shared" in its metadata
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		t.Fatalf("Error reading backup: %v", err)
+	}
+	copyPath := filepath.Join(t.TempDir(), "Shared.sqlite")
+	if err := os.WriteFile(copyPath, data, 0600); err != nil {
+		t.Fatalf("Error writing copy: %v", err)
+	}
+	other, err := database.OpenVaultFile(copyPath)
+	if err != nil {
+		t.Fatalf("Error opening copy: %v", err)
+	}
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(other)
+	for i := 0; i < 3; i++ {
+		if err := database.ClearDatabase(other); err != nil {
+			t.Fatalf("Error clearing copy: %v", err)
+		}
+	}
+
+	backups, err := database.ListBackups("Shared")
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("Expected the vault's own 2 backups, got %v (%v)", backups, err)
+	}
+	for _, backup := range backups {
+		if backup.Reason != database.BackupManual {
+			t.Errorf("Expected only manual backups of the vault, got %+v", backup)
+		}
+	}
+
+	if err := database.RegisterVault("Copy", copyPath); err != nil {
+		t.Fatalf("Error registering copy: %v", err)
+	}
+	backups, err = database.ListBackups("Copy")
+	if err != nil || len(backups) != 2 || backups[0].Reason != database.BackupClear {
+		t.Errorf("Expected the copy's own 2 backups, got %v (%v)", backups, err)
+	}
+}
+
+// TestBackupIfDue checks that scheduled backups respect the interval
+func TestBackupIfDue(t *testing.T) {
+	useTempVaultHome(t)
+	useBackupSettings(t, 10, 24)
+	createTestVault(t, "Scheduled")
+
+	backup, err := database.BackupIfDue("Scheduled")
+	if err != nil || backup == nil || backup.Reason != database.BackupScheduled {
+		t.Fatalf("Expected a scheduled backup, got %+v (%v)", backup, err)
+	}
+	backup, err = database.BackupIfDue("Scheduled")
+	if err != nil || backup != nil {
+		t.Errorf("Expected no backup before the interval elapses, got %+v (%v)", backup, err)
+	}
+
+	useBackupSettings(t, 10, 0)
+	if backup, err := database.BackupIfDue("Scheduled"); err != nil || backup != nil {
+		t.Errorf("Expected scheduled backups to be disabled, got %+v (%v)", backup, err)
+	}
+}
+
+// TestMigrationBackup checks that a vault is backed up before its schema is upgraded
+func TestMigrationBackup(t *testing.T) {
+	useTempVaultHome(t)
+
+	legacy, err := sql.Open("sqlite3", database.GetDatabasePath("OldSchema"))
+	if err != nil {
+		t.Fatalf("Error creating legacy vault: %v", err)
+	}
+	_, err = legacy.Exec(`
+	CREATE TABLE passwords (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    service TEXT NOT NULL,
+	    username TEXT NOT NULL,
+	    password TEXT NOT NULL,
+	    notes TEXT,
+	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE vault_metadata (vault_name TEXT PRIMARY KEY, auth_key TEXT NOT NULL, salt TEXT NOT NULL);
+	INSERT INTO vault_metadata VALUES ('OldSchema', 'authKey', 'salt');`)
+	if err != nil {
+		t.Fatalf("Error populating legacy vault: %v", err)
+	}
+	_ = legacy.Close()
+
+	db, err := database.InitDB("OldSchema")
+	if err != nil {
+		t.Fatalf("Error opening legacy vault: %v", err)
+	}
+	_ = db.Close()
+
+	backups, err := database.ListBackups("OldSchema")
+	if err != nil || len(backups) != 1 || backups[0].Reason != database.BackupMigration {
+		t.Fatalf("Expected one migration backup, got %v (%v)", backups, err)
+	}
+
+	// Opening the upgraded vault again does not take another backup
+	db, err = database.InitDB("OldSchema")
+	if err != nil {
+		t.Fatalf("Error reopening vault: %v", err)
+	}
+	_ = db.Close()
+	if backups, _ := database.ListBackups("OldSchema"); len(backups) != 1 {
+		t.Errorf("Expected no further backups, got %d", len(backups))
+	}
+}
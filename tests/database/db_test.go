@@ -2,15 +2,18 @@ package tests
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
 	"testing"
+	"time"
 )
 
 // TestStorePassword tests the password storing database function, simultaneously tests the GetEntriesFromService func
 func TestStorePassword(t *testing.T) {
 	// Initialize db instance
-	db, err := database.InitDB("TestingVault")
+	db, err := database.OpenMemoryDB()
 	if err != nil {
 		t.Errorf("Error connecting to database: %v", err)
 	}
@@ -57,7 +60,7 @@ func TestStorePassword(t *testing.T) {
 // TestGetEntryFromID creates a sample password entry, obtains its ID, and then queries it using GetEntryFromID
 func TestGetEntryFromID(t *testing.T) {
 	// Initialize db instance
-	db, err := database.InitDB("TestingVault")
+	db, err := database.OpenMemoryDB()
 	if err != nil {
 		t.Errorf("Error connecting to database: %v", err)
 	}
@@ -107,7 +110,7 @@ func TestGetEntryFromID(t *testing.T) {
 // TestDeleteEntryFromID creates a password entry and deletes it, querying the whole database and testing GetAllEntries
 func TestDeleteEntryFromID(t *testing.T) {
 	// Initialize db instance
-	db, err := database.InitDB("TestingVault")
+	db, err := database.OpenMemoryDB()
 	if err != nil {
 		t.Errorf("Error connecting to database: %v", err)
 	}
@@ -155,3 +158,42 @@ func TestDeleteEntryFromID(t *testing.T) {
 		t.Errorf("Error clearing database: %v", err)
 	}
 }
+
+// TestUpdateEntryPassword changes an entry's password, checking it is re-encrypted, stamped and audited
+func TestUpdateEntryPassword(t *testing.T) {
+	db := openTestVault(t, "Changed")
+	key := testEncryptionKey(t)
+	id := storeTestEntry(t, db, "https://mail.example.com", 0)
+	if _, err := db.Exec("UPDATE passwords SET password_changed_at = '2020-01-01T00:00:00.000Z' WHERE id = ?;", id); err != nil {
+		t.Fatalf("Error aging password: %v", err)
+	}
+
+	updated, err := database.UpdateEntryPassword(db, key, id, "n3w-passw0rd")
+	if err != nil {
+		t.Fatalf("Error updating password: %v", err)
+	}
+	password, err := encryption.Decrypt(updated.EncryptedPassword, key)
+	if err != nil || password != "n3w-passw0rd" {
+		t.Errorf("Expected the new password to be stored encrypted, got %q (%v)", password, err)
+	}
+	changedAt, err := time.Parse(time.RFC3339Nano, updated.PasswordChangedAt)
+	if err != nil || time.Since(changedAt) > time.Minute {
+		t.Errorf("Expected the password to be marked as changed now, got %q (%v)", updated.PasswordChangedAt, err)
+	}
+
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d (%v)", len(records), err)
+	}
+	if records[0].Event != database.AuditEdit || records[0].EntryID != id || records[0].Service != "https://mail.example.com" {
+		t.Errorf("Unexpected audit record %+v", records[0])
+	}
+
+	// Missing entries are reported and nothing is audited
+	if _, err := database.UpdateEntryPassword(db, key, id+1, "other"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a missing entry, got %v", err)
+	}
+	if records, _ := database.ReadAuditLog(db, key); len(records) != 1 {
+		t.Errorf("Expected the failed update to leave the audit log alone, got %d records", len(records))
+	}
+}
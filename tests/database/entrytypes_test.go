@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"golang.org/x/crypto/ssh"
+)
+
+// testEncryptionKey derives an encryption key for tests that encrypt through the database package
+func testEncryptionKey(t *testing.T) string {
+	t.Helper()
+
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		t.Fatalf("GenerateSalt failed: %v", err)
+	}
+	key, _, err := encryption.DeriveMasterKeys("typedentrypassword", salt)
+	if err != nil {
+		t.Fatalf("DeriveMasterKeys failed: %v", err)
+	}
+
+	return key
+}
+
+// TestValidLuhn tests the card number checksum
+func TestValidLuhn(t *testing.T) {
+	valid := []string{"4111 1111 1111 1111", "5500-0000-0000-0004", "378282246310005"}
+	invalid := []string{"4111 1111 1111 1112", "1234", "4111a11111111111"}
+
+	for _, number := range valid {
+		if !database.ValidLuhn(number) {
+			t.Errorf("Expected %q to pass the Luhn check", number)
+		}
+	}
+	for _, number := range invalid {
+		if database.ValidLuhn(number) {
+			t.Errorf("Expected %q to fail the Luhn check", number)
+		}
+	}
+}
+
+// TestParseCardExpiry tests card expiry parsing
+func TestParseCardExpiry(t *testing.T) {
+	expiry, err := database.ParseCardExpiry("02/28")
+	if err != nil {
+		t.Fatalf("Error parsing expiry: %v", err)
+	}
+	if expiry.Year() != 2028 || expiry.Month() != 2 || expiry.Day() != 29 {
+		t.Errorf("Expected card to be valid until the end of February 2028, got %v", expiry)
+	}
+
+	for _, bad := range []string{"13/28", "2/2028x", "0228", ""} {
+		if _, err := database.ParseCardExpiry(bad); !errors.Is(err, database.ErrInvalidCardExpiry) {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+// TestValidateTypedEntry tests schema validation for several entry types
+func TestValidateTypedEntry(t *testing.T) {
+	cases := []struct {
+		name  string
+		entry database.TypedEntry
+		err   error
+	}{
+		{"card ok", database.TypedEntry{Type: database.EntryCard, Title: "Visa", Secret: "4111111111111111",
+			Fields: map[string]string{"expiry": "12/30"}}, nil},
+		{"card luhn", database.TypedEntry{Type: database.EntryCard, Title: "Visa", Secret: "4111111111111112",
+			Fields: map[string]string{"expiry": "12/30"}}, database.ErrInvalidCardNumber},
+		{"card expiry missing", database.TypedEntry{Type: database.EntryCard, Title: "Visa", Secret: "4111111111111111"},
+			database.ErrMissingField},
+		{"note without title", database.TypedEntry{Type: database.EntrySecureNote, Secret: "text"}, database.ErrMissingField},
+		{"identity email", database.TypedEntry{Type: database.EntryIdentity, Title: "Me",
+			Fields: map[string]string{"email": "not-an-email"}}, database.ErrInvalidFieldValue},
+		{"database port", database.TypedEntry{Type: database.EntryDatabase, Title: "db1", Secret: "pw",
+			Fields: map[string]string{"port": "70000"}}, database.ErrInvalidPort},
+		{"wifi short passphrase", database.TypedEntry{Type: database.EntryWiFi, Title: "Home", Secret: "short"},
+			database.ErrInvalidWiFi},
+		{"wifi open", database.TypedEntry{Type: database.EntryWiFi, Title: "Cafe",
+			Fields: map[string]string{"security": "open"}}, nil},
+		{"ssh key not pem", database.TypedEntry{Type: database.EntrySSHKey, Title: "host", Secret: "ssh-rsa AAAA"},
+			database.ErrInvalidSSHKey},
+		{"unknown type", database.TypedEntry{Type: "spaceship", Title: "x"}, database.ErrUnknownEntryType},
+	}
+
+	for _, c := range cases {
+		err := database.ValidateTypedEntry(&c.entry)
+		if c.err == nil && err != nil {
+			t.Errorf("%s: expected entry to be valid: %v", c.name, err)
+		}
+		if c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+// TestStoreTypedEntry stores a card and an SSH key and reads them back decrypted
+func TestStoreTypedEntry(t *testing.T) {
+	db := openTestVault(t, "TypedVault")
+	key := testEncryptionKey(t)
+
+	card := &database.TypedEntry{
+		Type:     database.EntryCard,
+		Title:    "Travel card",
+		Username: "ALICE EXAMPLE",
+		Secret:   "4111 1111 1111 1111",
+		Notes:    "Lost card hotline in notes",
+		Fields:   map[string]string{"expiry": "09/29", "cvv": "123"},
+	}
+	stored, err := database.StoreTypedEntry(db, key, card)
+	if err != nil {
+		t.Fatalf("Error storing card: %v", err)
+	}
+	if stored.EntryType != database.EntryCard || stored.EncryptedPassword == card.Secret {
+		t.Fatalf("Card stored with wrong type or unencrypted number: %+v", stored)
+	}
+
+	loaded, err := database.GetTypedEntry(db, key, stored.ID)
+	if err != nil {
+		t.Fatalf("Error loading card: %v", err)
+	}
+	if loaded.Secret != card.Secret || loaded.Fields["cvv"] != "123" || loaded.Notes != card.Notes {
+		t.Fatalf("Loaded card does not match: %+v", loaded)
+	}
+
+	// The CVV is stored as a hidden custom field
+	fields, _ := database.GetCustomFields(db, stored.ID)
+	if len(fields) != 2 || !fields[1].Type.IsSecret() {
+		t.Fatalf("Expected expiry and hidden CVV fields, got %v", fields)
+	}
+
+	// SSH keys must be PEM encoded private keys
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	sshEntry := &database.TypedEntry{
+		Type:   database.EntrySSHKey,
+		Title:  "git.example.com",
+		Secret: string(pem.EncodeToMemory(block)),
+	}
+	if _, err := database.StoreTypedEntry(db, key, sshEntry); err != nil {
+		t.Fatalf("Error storing SSH key: %v", err)
+	}
+
+	// Invalid entries are rejected before anything is written
+	card.Secret = "4111 1111 1111 1112"
+	if _, err := database.StoreTypedEntry(db, key, card); !errors.Is(err, database.ErrInvalidCardNumber) {
+		t.Fatalf("Expected ErrInvalidCardNumber, got %v", err)
+	}
+	all, _ := database.GetAllEntries(db)
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 stored entries, got %d", len(all))
+	}
+
+	// Plain StorePassword entries default to logins
+	loginID := storeTestEntry(t, db, "https://example.com", 0)
+	login, _ := database.GetEntryFromID(db, loginID)
+	if login.EntryType != database.EntryLogin {
+		t.Errorf("Expected default entry type login, got %q", login.EntryType)
+	}
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// exportTestVault creates a vault with one entry and exports it, returning the export path
+func exportTestVault(t *testing.T, vaultName string, exportPassword string) string {
+	t.Helper()
+
+	db := createPasswordVault(t, vaultName, "master password")
+	_, err := database.StorePassword(db, database.PasswordEntry{
+		Service: "example.com", Username: "user", EncryptedPassword: "ciphertext"})
+	if err != nil {
+		t.Fatalf("Error storing entry: %v", err)
+	}
+
+	exportPath := filepath.Join(t.TempDir(), database.DefaultExportName(vaultName))
+	err = database.ExportVault(vaultName, exportPath, exportPassword, fastKDF)
+	if err != nil {
+		t.Fatalf("Error exporting vault: %v", err)
+	}
+
+	return exportPath
+}
+
+// TestExportImportVault round-trips a vault through an export file
+func TestExportImportVault(t *testing.T) {
+	useTempVaultHome(t)
+	exportPath := exportTestVault(t, "Exported", "export password")
+
+	info, err := database.ReadExportInfo(exportPath)
+	if err != nil {
+		t.Fatalf("Error reading export header: %v", err)
+	}
+	if info.VaultName != "Exported" || info.KDFTime != fastKDF.Time || info.Salt == "" {
+		t.Errorf("Unexpected export header: %+v", info)
+	}
+
+	if stat, err := os.Stat(exportPath); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("Expected export with mode 0600, got %v (%v)", stat.Mode().Perm(), err)
+	}
+
+	vaultName, err := database.ImportVault(exportPath, "export password", "Imported")
+	if err != nil {
+		t.Fatalf("Error importing vault: %v", err)
+	}
+	if vaultName != "Imported" {
+		t.Errorf("Expected vault Imported, got %s", vaultName)
+	}
+	if storedVaultName(t, vaultName) != "Imported" {
+		t.Errorf("Expected stored vault name to be updated")
+	}
+
+	// The imported vault still unlocks with its own master password
+	salt, err := database.GetSaltFromVault(vaultName)
+	if err != nil {
+		t.Fatalf("Error reading salt: %v", err)
+	}
+	_, authKey, err := encryption.DeriveMasterKeysWithParams("master password", salt, fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	ok, err := database.AuthenticateVault(vaultName, authKey)
+	if err != nil || !ok {
+		t.Errorf("Expected imported vault to authenticate, got %v (%v)", ok, err)
+	}
+
+	db, err := database.InitDB(vaultName)
+	if err != nil {
+		t.Fatalf("Error opening imported vault: %v", err)
+	}
+	defer db.Close()
+	entries, err := database.GetAllEntries(db)
+	if err != nil || len(entries) != 1 || entries[0].Service != "example.com" {
+		t.Errorf("Expected the exported entry, got %v (%v)", entries, err)
+	}
+}
+
+// TestImportVaultNameCollision checks that imports never overwrite an existing vault
+func TestImportVaultNameCollision(t *testing.T) {
+	useTempVaultHome(t)
+	exportPath := exportTestVault(t, "Shared", "export password")
+
+	first, err := database.ImportVault(exportPath, "export password", "")
+	if err != nil {
+		t.Fatalf("Error importing vault: %v", err)
+	}
+	second, err := database.ImportVault(exportPath, "export password", "")
+	if err != nil {
+		t.Fatalf("Error importing vault: %v", err)
+	}
+	if first != "Shared (2)" || second != "Shared (3)" {
+		t.Errorf("Expected Shared (2) and Shared (3), got %s and %s", first, second)
+	}
+
+	if _, err := database.ImportVault(exportPath, "export password", "../escape"); !errors.Is(err, database.ErrInvalidVaultName) {
+		t.Errorf("Expected ErrInvalidVaultName, got %v", err)
+	}
+}
+
+// TestImportVaultRejectsBadInput checks wrong passwords, tampering and non-export files
+func TestImportVaultRejectsBadInput(t *testing.T) {
+	useTempVaultHome(t)
+	exportPath := exportTestVault(t, "Source", "export password")
+
+	if _, err := database.ImportVault(exportPath, "wrong password", "Wrong"); !errors.Is(err, database.ErrExportAuth) {
+		t.Errorf("Expected ErrExportAuth for wrong password, got %v", err)
+	}
+
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		t.Fatalf("Error reading export: %v", err)
+	}
+
+	// Flip a byte in the ciphertext
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-10] ^= 0xff
+	tamperedPath := filepath.Join(t.TempDir(), "tampered.plockdb")
+	_ = os.WriteFile(tamperedPath, tampered, 0600)
+	if _, err := database.ImportVault(tamperedPath, "export password", "Tampered"); !errors.Is(err, database.ErrExportAuth) {
+		t.Errorf("Expected ErrExportAuth for tampered export, got %v", err)
+	}
+
+	// Changing the header invalidates the ciphertext too
+	renamed := []byte(string(data))
+	index := len("PLOCKDB\x00") + 4 + len(`{"version":1,"vault_name":"`)
+	renamed[index] = 'X'
+	renamedPath := filepath.Join(t.TempDir(), "renamed.plockdb")
+	_ = os.WriteFile(renamedPath, renamed, 0600)
+	if _, err := database.ImportVault(renamedPath, "export password", "Renamed"); !errors.Is(err, database.ErrExportAuth) {
+		t.Errorf("Expected ErrExportAuth for modified header, got %v", err)
+	}
+
+	plainPath := filepath.Join(t.TempDir(), "plain.plockdb")
+	_ = os.WriteFile(plainPath, []byte("not an export"), 0600)
+	if _, err := database.ImportVault(plainPath, "export password", "Plain"); !errors.Is(err, database.ErrNotExport) {
+		t.Errorf("Expected ErrNotExport, got %v", err)
+	}
+
+	vaults, err := database.ListVaults()
+	if err != nil || len(vaults) != 1 {
+		t.Errorf("Expected failed imports to leave no vaults behind, got %v (%v)", vaults, err)
+	}
+}
+
+// TestImportVaultOversizedKDF checks an export demanding huge Argon2 costs is rejected before deriving a key
+func TestImportVaultOversizedKDF(t *testing.T) {
+	useTempVaultHome(t)
+	data, err := os.ReadFile(exportTestVault(t, "Oversized", "export password"))
+	if err != nil {
+		t.Fatalf("Error reading export: %v", err)
+	}
+
+	prefix := len("PLOCKDB\x00") + 4
+	headerSize := int(binary.BigEndian.Uint32(data[prefix-4 : prefix]))
+	for name, change := range map[string]func(header map[string]any){
+		"memory":  func(header map[string]any) { header["kdf_memory"] = math.MaxUint32 },
+		"time":    func(header map[string]any) { header["kdf_time"] = math.MaxUint32 },
+		"threads": func(header map[string]any) { header["kdf_threads"] = 255; header["kdf_memory"] = 255 * 8 },
+	} {
+		var header map[string]any
+		if err := json.Unmarshal(data[prefix:prefix+headerSize], &header); err != nil {
+			t.Fatalf("Error parsing header: %v", err)
+		}
+		change(header)
+		encoded, err := json.Marshal(header)
+		if err != nil {
+			t.Fatalf("Error encoding header: %v", err)
+		}
+
+		crafted := append([]byte(nil), data[:prefix-4]...)
+		crafted = binary.BigEndian.AppendUint32(crafted, uint32(len(encoded)))
+		crafted = append(append(crafted, encoded...), data[prefix+headerSize:]...)
+		path := filepath.Join(t.TempDir(), name+".plockdb")
+		if err := os.WriteFile(path, crafted, 0600); err != nil {
+			t.Fatalf("Error writing export: %v", err)
+		}
+
+		if _, err := database.ReadExportInfo(path); !errors.Is(err, database.ErrNotExport) {
+			t.Errorf("Expected ErrNotExport reading an export with oversized %s, got %v", name, err)
+		}
+		if _, err := database.ImportVault(path, "export password", "Crafted"); !errors.Is(err, database.ErrNotExport) {
+			t.Errorf("Expected ErrNotExport importing an export with oversized %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestValidateFieldValue tests validation of each custom field type
+func TestValidateFieldValue(t *testing.T) {
+	cases := []struct {
+		fieldType database.FieldType
+		value     string
+		valid     bool
+	}{
+		{database.FieldText, "anything at all", true},
+		{database.FieldHidden, "s3cr3t", true},
+		{database.FieldURL, "https://bank.example.com/login", true},
+		{database.FieldURL, "bank.example.com", false},
+		{database.FieldEmail, "alice@example.com", true},
+		{database.FieldEmail, "Alice <alice@example.com>", false},
+		{database.FieldDate, "2024-02-29", true},
+		{database.FieldDate, "29/02/2024", false},
+		{database.FieldNumber, "-12.5", true},
+		{database.FieldNumber, "twelve", false},
+		{database.FieldNumber, "", true},
+	}
+
+	for _, c := range cases {
+		err := database.ValidateFieldValue(c.fieldType, c.value)
+		if c.valid && err != nil {
+			t.Errorf("Expected %s value %q to be valid: %v", c.fieldType, c.value, err)
+		}
+		if !c.valid && !errors.Is(err, database.ErrInvalidFieldValue) {
+			t.Errorf("Expected %s value %q to be rejected, got %v", c.fieldType, c.value, err)
+		}
+	}
+
+	if err := database.ValidateFieldValue("color", "red"); !errors.Is(err, database.ErrInvalidFieldType) {
+		t.Errorf("Expected ErrInvalidFieldType, got %v", err)
+	}
+}
+
+// TestCustomFields tests adding, ordering, updating, and deleting custom fields
+func TestCustomFields(t *testing.T) {
+	db := openTestVault(t, "FieldVault")
+	entryID := storeTestEntry(t, db, "https://bank.example.com", 0)
+
+	account, err := database.AddCustomField(db, entryID, database.CustomFieldEntry{
+		Name:           "Account number",
+		Type:           database.FieldText,
+		EncryptedValue: "encrypted-account",
+	})
+	if err != nil {
+		t.Fatalf("Error adding custom field: %v", err)
+	}
+	_, err = database.AddCustomField(db, entryID, database.CustomFieldEntry{
+		Name:           "Security answer",
+		Type:           database.FieldHidden,
+		EncryptedValue: "encrypted-answer",
+	})
+	if err != nil {
+		t.Fatalf("Error adding custom field: %v", err)
+	}
+
+	// Invalid types and blank names are rejected
+	_, err = database.AddCustomField(db, entryID, database.CustomFieldEntry{Name: "Bad", Type: "color"})
+	if !errors.Is(err, database.ErrInvalidFieldType) {
+		t.Errorf("Expected ErrInvalidFieldType, got %v", err)
+	}
+	_, err = database.AddCustomField(db, entryID, database.CustomFieldEntry{Name: " ", Type: database.FieldText})
+	if !errors.Is(err, database.ErrEmptyFieldName) {
+		t.Errorf("Expected ErrEmptyFieldName, got %v", err)
+	}
+
+	fields, err := database.GetCustomFields(db, entryID)
+	if err != nil {
+		t.Fatalf("Error listing custom fields: %v", err)
+	}
+	t.Logf("Custom fields: %v", fields)
+	if len(fields) != 2 || fields[0].Name != "Account number" || !fields[1].Type.IsSecret() {
+		t.Fatalf("Unexpected custom fields %v", fields)
+	}
+
+	err = database.UpdateCustomField(db, account.ID, database.CustomFieldEntry{
+		Name:           "IBAN",
+		Type:           database.FieldText,
+		EncryptedValue: "encrypted-iban",
+	})
+	if err != nil {
+		t.Fatalf("Error updating custom field: %v", err)
+	}
+	updated, _ := database.GetCustomField(db, account.ID)
+	if updated.Name != "IBAN" || updated.EncryptedValue != "encrypted-iban" {
+		t.Fatalf("Custom field was not updated: %+v", updated)
+	}
+
+	// Fields are removed individually and together with their entry
+	if err := database.DeleteCustomField(db, account.ID); err != nil {
+		t.Fatalf("Error deleting custom field: %v", err)
+	}
+	if err := database.DeleteEntryFromID(db, entryID); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+	fields, _ = database.GetCustomFields(db, entryID)
+	if len(fields) != 0 {
+		t.Fatalf("Expected custom fields to be deleted with the entry, got %v", fields)
+	}
+}
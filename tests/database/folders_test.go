@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestCreateNestedFolders creates a folder tree and checks paths and duplicate detection
+func TestCreateNestedFolders(t *testing.T) {
+	db := openTestVault(t, "FolderVault")
+
+	work, err := database.CreateFolder(db, "Work", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	servers, err := database.CreateFolder(db, "Servers", work.ID)
+	if err != nil {
+		t.Fatalf("Error creating subfolder: %v", err)
+	}
+
+	path, err := database.GetFolderPath(db, servers.ID)
+	if err != nil {
+		t.Fatalf("Error getting folder path: %v", err)
+	}
+	t.Logf("Folder path: %v", path)
+	if len(path) != 2 || path[0] != "Work" || path[1] != "Servers" {
+		t.Fatalf("Unexpected folder path %v", path)
+	}
+
+	// Sibling names must be unique, but the same name may exist elsewhere
+	if _, err := database.CreateFolder(db, "work", 0); !errors.Is(err, database.ErrFolderExists) {
+		t.Errorf("Expected ErrFolderExists, got %v", err)
+	}
+	if _, err := database.CreateFolder(db, "Servers", 0); err != nil {
+		t.Errorf("Expected same name in a different parent to succeed: %v", err)
+	}
+	if _, err := database.CreateFolder(db, "  ", 0); !errors.Is(err, database.ErrEmptyFolderName) {
+		t.Errorf("Expected ErrEmptyFolderName, got %v", err)
+	}
+}
+
+// TestRenameAndMoveFolder tests renaming, moving, and cycle prevention
+func TestRenameAndMoveFolder(t *testing.T) {
+	db := openTestVault(t, "FolderVault")
+
+	parent, _ := database.CreateFolder(db, "Parent", 0)
+	child, _ := database.CreateFolder(db, "Child", parent.ID)
+	other, _ := database.CreateFolder(db, "Other", 0)
+
+	if err := database.RenameFolder(db, child.ID, "Renamed"); err != nil {
+		t.Fatalf("Error renaming folder: %v", err)
+	}
+
+	// Moving a folder into its own subtree must fail
+	if err := database.MoveFolder(db, parent.ID, child.ID); !errors.Is(err, database.ErrFolderCycle) {
+		t.Fatalf("Expected ErrFolderCycle, got %v", err)
+	}
+
+	if err := database.MoveFolder(db, child.ID, other.ID); err != nil {
+		t.Fatalf("Error moving folder: %v", err)
+	}
+	moved, err := database.GetFolder(db, child.ID)
+	if err != nil {
+		t.Fatalf("Error getting folder: %v", err)
+	}
+	if moved.Name != "Renamed" || moved.ParentID != other.ID {
+		t.Fatalf("Unexpected folder after rename/move: %+v", moved)
+	}
+
+	// Back to the top level
+	if err := database.MoveFolder(db, child.ID, 0); err != nil {
+		t.Fatalf("Error moving folder to top level: %v", err)
+	}
+}
+
+// TestEntriesInFolder tests listing entries by folder, recursively, and deletion unfiling entries
+func TestEntriesInFolder(t *testing.T) {
+	db := openTestVault(t, "FolderVault")
+
+	work, _ := database.CreateFolder(db, "Work", 0)
+	servers, _ := database.CreateFolder(db, "Servers", work.ID)
+
+	storeTestEntry(t, db, "https://jira.example.com", work.ID)
+	serverEntry := storeTestEntry(t, db, "ssh://db1.example.com", servers.ID)
+	storeTestEntry(t, db, "https://news.example.com", 0)
+
+	direct, err := database.GetEntriesInFolder(db, work.ID, false)
+	if err != nil {
+		t.Fatalf("Error listing folder: %v", err)
+	}
+	recursive, err := database.GetEntriesInFolder(db, work.ID, true)
+	if err != nil {
+		t.Fatalf("Error listing folder recursively: %v", err)
+	}
+	if len(direct) != 1 || len(recursive) != 2 {
+		t.Fatalf("Expected 1 direct and 2 recursive entries, got %d and %d", len(direct), len(recursive))
+	}
+
+	// Move an entry out of its folder
+	if err := database.MoveEntryToFolder(db, serverEntry, 0); err != nil {
+		t.Fatalf("Error unfiling entry: %v", err)
+	}
+	unfiled, err := database.GetEntriesInFolder(db, 0, false)
+	if err != nil {
+		t.Fatalf("Error listing unfiled entries: %v", err)
+	}
+	if len(unfiled) != 2 {
+		t.Fatalf("Expected 2 unfiled entries, got %d", len(unfiled))
+	}
+
+	// Deleting a folder keeps its entries
+	if err := database.DeleteFolder(db, work.ID); err != nil {
+		t.Fatalf("Error deleting folder: %v", err)
+	}
+	all, _ := database.GetAllEntries(db)
+	folders, _ := database.ListFolders(db)
+	if len(all) != 3 || len(folders) != 0 {
+		t.Fatalf("Expected 3 entries and no folders, got %d and %d", len(all), len(folders))
+	}
+	for _, entry := range all {
+		if entry.FolderID != 0 {
+			t.Errorf("Entry %d should be unfiled after folder deletion", entry.ID)
+		}
+	}
+}
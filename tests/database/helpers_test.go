@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// useTempVaultHome points the vault directory at a temporary directory for the rest of the test
+func useTempVaultHome(t *testing.T) {
+	t.Helper()
+	t.Setenv(config.EnvHome, t.TempDir())
+	t.Setenv(config.EnvConfig, "")
+	t.Setenv(config.EnvVaultDir, "")
+}
+
+// openTestVault creates a throwaway vault under a temporary home directory and returns an open database
+func openTestVault(t *testing.T, vaultName string) *sql.DB {
+	t.Helper()
+	useTempVaultHome(t)
+
+	err := database.CreateVault(vaultName, "hashedAuthKey", "salt")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+
+	db, err := database.InitDB(vaultName)
+	if err != nil {
+		t.Fatalf("Error connecting to database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Error closing db: %v", err)
+		}
+	})
+
+	return db
+}
+
+// storeTestEntry stores a simple entry and returns its ID
+func storeTestEntry(t *testing.T, db *sql.DB, service string, folderID int) int {
+	t.Helper()
+
+	entry, err := database.StorePassword(db, database.PasswordEntry{
+		Service:           service,
+		Username:          "user@example.com",
+		EncryptedPassword: "password123",
+		FolderID:          folderID,
+	})
+	if err != nil {
+		t.Fatalf("Error storing password: %v", err)
+	}
+
+	return entry.ID
+}
@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// TestCheckVaultIntegrity checks a healthy vault passes and undecryptable values are reported per entry
+func TestCheckVaultIntegrity(t *testing.T) {
+	db := openTestVault(t, "Checked")
+	key := testEncryptionKey(t)
+	storeSecretEntry(t, db, key, "healthy.example.com", "fine")
+
+	report, err := database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	if !report.Healthy() || report.Entries != 1 {
+		t.Fatalf("Expected a healthy vault with 1 entry, got %+v", report)
+	}
+
+	// One entry has a damaged password, another a custom field encrypted with a different key
+	broken := storeSecretEntry(t, db, key, "broken.example.com", "lost")
+	if _, err := db.Exec("UPDATE passwords SET password = 'not a ciphertext' WHERE uuid = ?;", broken); err != nil {
+		t.Fatalf("Error damaging entry: %v", err)
+	}
+	field, err := database.GetEntryByUUID(db, storeSecretEntry(t, db, key, "field.example.com", "ok"))
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	_, err = database.AddCustomField(db, field.ID, database.CustomFieldEntry{Name: "PIN", Type: database.FieldHidden, EncryptedValue: "garbage"})
+	if err != nil {
+		t.Fatalf("Error adding field: %v", err)
+	}
+
+	report, err = database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	if report.Healthy() || report.Entries != 3 || len(report.CorruptEntries()) != 2 {
+		t.Fatalf("Expected 2 corrupt entries out of 3, got %+v", report)
+	}
+	details := make(map[string]string)
+	for _, issue := range report.Issues {
+		if issue.Kind != database.IssueEntry {
+			t.Errorf("Unexpected issue %+v", issue)
+		}
+		details[issue.Service] = issue.Detail
+	}
+	if !strings.Contains(details["broken.example.com"], "password") || !strings.Contains(details["field.example.com"], `"PIN"`) {
+		t.Errorf("Expected the damaged values to be named, got %v", details)
+	}
+
+	// A wrong key makes every entry undecryptable
+	report, err = database.CheckVaultIntegrity(db, testEncryptionKey(t))
+	if err != nil || len(report.CorruptEntries()) != 3 {
+		t.Errorf("Expected every entry to fail with a wrong key, got %+v (%v)", report, err)
+	}
+}
+
+// TestCheckVaultIntegritySchema checks missing tables and invalid metadata are reported
+func TestCheckVaultIntegritySchema(t *testing.T) {
+	db := openTestVault(t, "Damaged")
+	key := testEncryptionKey(t)
+
+	for _, query := range []string{
+		"DROP TABLE plaintext_exports;",
+		"UPDATE vault_metadata SET kdf_threads = 0;",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("Error damaging vault: %v", err)
+		}
+	}
+
+	report, err := database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	kinds := make(map[database.IssueKind]string)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind] = issue.Detail
+	}
+	if !strings.Contains(kinds[database.IssueSchema], "plaintext_exports") || kinds[database.IssueMetadata] == "" {
+		t.Errorf("Expected schema and metadata issues, got %+v", report.Issues)
+	}
+	if len(report.CorruptEntries()) != 0 {
+		t.Errorf("Expected no corrupt entries, got %v", report.CorruptEntries())
+	}
+}
+
+// TestQuarantineEntries checks corrupt entries are moved out of the vault with their data
+func TestQuarantineEntries(t *testing.T) {
+	db := openTestVault(t, "Quarantined")
+	key := testEncryptionKey(t)
+	storeSecretEntry(t, db, key, "healthy.example.com", "fine")
+	broken := storeSecretEntry(t, db, key, "broken.example.com", "lost")
+	entry, err := database.GetEntryByUUID(db, broken)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.AddTagToEntry(db, entry.ID, "work"); err != nil {
+		t.Fatalf("Error tagging entry: %v", err)
+	}
+	if _, err := database.AddAttachment(db, key, entry.ID, "codes.txt", bytes.NewReader([]byte("123456"))); err != nil {
+		t.Fatalf("Error attaching file: %v", err)
+	}
+	if _, err := db.Exec("UPDATE passwords SET notes = 'damaged' WHERE id = ?;", entry.ID); err != nil {
+		t.Fatalf("Error damaging entry: %v", err)
+	}
+
+	report, err := database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	moved, err := database.QuarantineEntries(db, key, report)
+	if err != nil || moved != 1 {
+		t.Fatalf("Expected 1 entry quarantined, got %d (%v)", moved, err)
+	}
+	if _, err := database.GetEntryFromID(db, entry.ID); err == nil {
+		t.Error("Expected the corrupt entry to be removed from the vault")
+	}
+
+	quarantined, err := database.ListQuarantine(db)
+	if err != nil || len(quarantined) != 1 {
+		t.Fatalf("Expected 1 quarantined entry, got %v (%v)", quarantined, err)
+	}
+	if q := quarantined[0]; q.UUID != broken || q.Service != "broken.example.com" || !strings.Contains(q.Reason, "notes") {
+		t.Errorf("Unexpected quarantined entry %+v", q)
+	}
+	var record string
+	if err := db.QueryRow("SELECT record FROM quarantine;").Scan(&record); err != nil {
+		t.Fatalf("Error reading quarantine: %v", err)
+	}
+	if !strings.Contains(record, "codes.txt") || !strings.Contains(record, "work") || !strings.Contains(record, "damaged") {
+		t.Errorf("Expected the quarantine to keep the entry's attachment, tags and values, got %s", record)
+	}
+
+	report, err = database.CheckVaultIntegrity(db, key)
+	if err != nil || !report.Healthy() || report.Quarantined != 1 || report.Entries != 1 {
+		t.Errorf("Expected a healthy vault with 1 quarantined entry, got %+v (%v)", report, err)
+	}
+
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil || len(records) != 1 || records[0].Event != database.AuditQuarantine || records[0].Service != "broken.example.com" {
+		t.Errorf("Expected a quarantine audit record, got %v (%v)", records, err)
+	}
+
+	if err := database.DeleteQuarantined(db, quarantined[0].ID); err != nil {
+		t.Fatalf("Error deleting quarantined entry: %v", err)
+	}
+	if err := database.DeleteQuarantined(db, quarantined[0].ID); !errors.Is(err, database.ErrQuarantineNotFound) {
+		t.Errorf("Expected ErrQuarantineNotFound, got %v", err)
+	}
+}
+
+// TestQuarantineRekey checks quarantined values that were still readable follow the vault to a new key
+func TestQuarantineRekey(t *testing.T) {
+	db := openTestVault(t, "QuarantineRekey")
+	key := testEncryptionKey(t)
+	entry, err := database.GetEntryByUUID(db, storeSecretEntry(t, db, key, "broken.example.com", "recoverable"))
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if _, err := database.AddAttachment(db, key, entry.ID, "codes.txt", bytes.NewReader([]byte("123456"))); err != nil {
+		t.Fatalf("Error attaching file: %v", err)
+	}
+	if _, err := db.Exec("UPDATE passwords SET notes = 'damaged' WHERE id = ?;", entry.ID); err != nil {
+		t.Fatalf("Error damaging entry: %v", err)
+	}
+	report, err := database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	if moved, err := database.QuarantineEntries(db, key, report); err != nil || moved != 1 {
+		t.Fatalf("Expected 1 entry quarantined, got %d (%v)", moved, err)
+	}
+
+	newKeys, err := database.DeriveVaultKeys("new master password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	if err := database.RekeyVault(db, key, *newKeys); err != nil {
+		t.Fatalf("Error re-keying vault: %v", err)
+	}
+
+	var data string
+	if err := db.QueryRow("SELECT record FROM quarantine;").Scan(&data); err != nil {
+		t.Fatalf("Error reading quarantine: %v", err)
+	}
+	var record struct {
+		Entry struct {
+			EncryptedPassword string
+			EncryptedNotes    string
+		} `json:"entry"`
+		Attachments []struct {
+			StreamID []byte   `json:"stream_id"`
+			Chunks   [][]byte `json:"chunks"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		t.Fatalf("Error decoding quarantined entry: %v", err)
+	}
+
+	// The readable password and attachment use the new key, the damaged notes are kept as they were
+	if password, err := encryption.Decrypt(record.Entry.EncryptedPassword, newKeys.EncryptionKey); err != nil || password != "recoverable" {
+		t.Errorf("Expected the password to decrypt with the new key, got %q (%v)", password, err)
+	}
+	if record.Entry.EncryptedNotes != "damaged" {
+		t.Errorf("Expected the damaged notes to be left alone, got %q", record.Entry.EncryptedNotes)
+	}
+	if len(record.Attachments) != 1 {
+		t.Fatalf("Expected 1 quarantined attachment, got %d", len(record.Attachments))
+	}
+	attachment := record.Attachments[0]
+	decrypter, err := encryption.NewDecryptReader(bytes.NewReader(bytes.Join(attachment.Chunks, nil)), newKeys.EncryptionKey, attachment.StreamID)
+	if err != nil {
+		t.Fatalf("Error decrypting quarantined attachment: %v", err)
+	}
+	if content, err := io.ReadAll(decrypter); err != nil || string(content) != "123456" {
+		t.Errorf("Expected the attachment to decrypt with the new key, got %q (%v)", content, err)
+	}
+}
+
+// TestQuarantineRestoredBySync checks a quarantined entry comes back from a healthy copy instead of being
+// deleted there
+func TestQuarantineRestoredBySync(t *testing.T) {
+	db := openTestVault(t, "Restored")
+	key := testEncryptionKey(t)
+	uuid := storeSecretEntry(t, db, key, "restored.example.com", "original")
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	if _, err := db.Exec("UPDATE passwords SET password = 'damaged' WHERE uuid = ?;", uuid); err != nil {
+		t.Fatalf("Error damaging entry: %v", err)
+	}
+	report, err := database.CheckVaultIntegrity(db, key)
+	if err != nil {
+		t.Fatalf("Error checking vault: %v", err)
+	}
+	if _, err := database.QuarantineEntries(db, key, report); err != nil {
+		t.Fatalf("Error quarantining entries: %v", err)
+	}
+
+	summary := syncTestVaults(t, db, key, path)
+	if summary.Pulled != 1 || summary.Pushed != 0 {
+		t.Errorf("Expected the entry to be restored from the other copy, got %+v", summary)
+	}
+	for name, password := range map[string]string{"this": secretPassword(t, db, key, uuid), "other": secretPassword(t, other, key, uuid)} {
+		if password != "original" {
+			t.Errorf("Expected the %s copy to have the original password, got %q", name, password)
+		}
+	}
+}
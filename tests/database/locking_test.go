@@ -0,0 +1,358 @@
+package tests
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// Environment variables that turn the test binary into a helper process
+const (
+	envLockHelper  = "PASSLOCK_TEST_LOCK_HELPER"
+	envLockVault   = "PASSLOCK_TEST_LOCK_VAULT"
+	envLockEntries = "PASSLOCK_TEST_LOCK_ENTRIES"
+	envLockKey     = "PASSLOCK_TEST_LOCK_KEY"
+)
+
+// TestLockHelperProcess is run in child processes by the locking tests, it does nothing otherwise
+func TestLockHelperProcess(t *testing.T) {
+	mode := os.Getenv(envLockHelper)
+	if mode == "" {
+		t.Skip("only run as a helper process")
+	}
+	vaultName := os.Getenv(envLockVault)
+
+	switch mode {
+	case "write":
+		// Write entries through a separate connection pool, like another PassLock process would
+		count, _ := strconv.Atoi(os.Getenv(envLockEntries))
+		db, err := database.InitDB(vaultName)
+		if err != nil {
+			t.Fatalf("Error opening vault: %v", err)
+		}
+		defer db.Close()
+		writeTestEntries(t, db, os.Getenv(envLockKey), fmt.Sprintf("process-%d", os.Getpid()), count)
+
+	case "hold":
+		// Hold the write lock until the parent closes stdin
+		session, err := database.OpenVaultSession(vaultName)
+		if err != nil {
+			t.Fatalf("Error opening session: %v", err)
+		}
+		defer session.Close()
+		fmt.Printf("read-only=%v\n", session.ReadOnly)
+		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+}
+
+// lockHelper returns a command running TestLockHelperProcess in the given mode
+func lockHelper(mode string, vaultName string, key string, entries int) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(),
+		envLockHelper+"="+mode,
+		envLockVault+"="+vaultName,
+		envLockKey+"="+key,
+		envLockEntries+"="+strconv.Itoa(entries))
+	return cmd
+}
+
+// writeTestEntries stores count tagged entries, logging each one in the audit log inside a transaction
+func writeTestEntries(t *testing.T, db *sql.DB, key string, prefix string, count int) {
+	t.Helper()
+
+	for i := range count {
+		entry, err := database.StorePassword(db, database.PasswordEntry{
+			Service:           fmt.Sprintf("%s-%d", prefix, i),
+			Username:          "user",
+			EncryptedPassword: "password",
+		})
+		if err != nil {
+			t.Errorf("Error storing entry: %v", err)
+			return
+		}
+		if err := database.SetEntryTags(db, entry.ID, []string{"shared", prefix}); err != nil {
+			t.Errorf("Error tagging entry: %v", err)
+			return
+		}
+		if err := database.AppendAudit(db, key, database.AuditRecord{Event: database.AuditCreate, EntryID: entry.ID}); err != nil {
+			t.Errorf("Error appending audit record: %v", err)
+			return
+		}
+	}
+}
+
+// TestConcurrentWriters writes to one vault from many goroutines and processes at once
+func TestConcurrentWriters(t *testing.T) {
+	db := openTestVault(t, "Hammered")
+	key := testEncryptionKey(t)
+	const goroutines, processes, perWriter = 6, 3, 20
+
+	var commands []*exec.Cmd
+	for range processes {
+		cmd := lockHelper("write", "Hammered", key, perWriter)
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Error starting helper process: %v", err)
+		}
+		commands = append(commands, cmd)
+	}
+
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every goroutine uses its own pool, so connections compete like separate processes
+			writer, err := database.InitDB("Hammered")
+			if err != nil {
+				t.Errorf("Error opening vault: %v", err)
+				return
+			}
+			defer writer.Close()
+			writeTestEntries(t, writer, key, fmt.Sprintf("goroutine-%d", i), perWriter)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, cmd := range commands {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("Helper process failed: %v", err)
+		}
+	}
+
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		t.Fatalf("Error listing entries: %v", err)
+	}
+	expected := (goroutines + processes) * perWriter
+	if len(entries) != expected {
+		t.Errorf("Expected %d entries, got %d", expected, len(entries))
+	}
+	tagged, err := database.GetEntriesWithTag(db, "shared")
+	if err != nil || len(tagged) != expected {
+		t.Errorf("Expected %d tagged entries, got %d (%v)", expected, len(tagged), err)
+	}
+
+	// Every writer extended the same chain without breaking it
+	records, err := database.ReadAuditLog(db, key)
+	if err != nil || len(records) != expected {
+		t.Errorf("Expected %d verified audit records, got %d (%v)", expected, len(records), err)
+	}
+}
+
+// TestVaultSessionLocking checks that only one session at a time can write to a vault
+func TestVaultSessionLocking(t *testing.T) {
+	db := openTestVault(t, "Shared")
+	storeTestEntry(t, db, "existing.example.com", 0)
+
+	writer, err := database.OpenVaultSession("Shared")
+	if err != nil {
+		t.Fatalf("Error opening session: %v", err)
+	}
+	if writer.ReadOnly {
+		t.Fatalf("Expected the first session to hold the write lock")
+	}
+
+	reader, err := database.OpenVaultSession("Shared")
+	if err != nil {
+		t.Fatalf("Error opening second session: %v", err)
+	}
+	if !reader.ReadOnly {
+		t.Fatalf("Expected the second session to be read-only")
+	}
+
+	// The read-only session sees entries, including ones written after it was opened
+	storeTestEntry(t, writer.DB, "new.example.com", 0)
+	entries, err := database.GetAllEntries(reader.DB)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries in the read-only session, got %d (%v)", len(entries), err)
+	}
+	_, err = database.StorePassword(reader.DB, database.PasswordEntry{Service: "x", Username: "y", EncryptedPassword: "z"})
+	if err == nil {
+		t.Errorf("Expected writing through a read-only session to fail")
+	}
+
+	// A vault open for writing cannot be renamed or deleted
+	if err := database.RenameVault("Shared", "Moved"); !errors.Is(err, database.ErrVaultLocked) {
+		t.Errorf("Expected ErrVaultLocked renaming, got %v", err)
+	}
+	if err := database.DeleteVault("Shared"); !errors.Is(err, database.ErrVaultLocked) {
+		t.Errorf("Expected ErrVaultLocked deleting, got %v", err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Errorf("Error closing read-only session: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Errorf("Error closing session: %v", err)
+	}
+
+	next, err := database.OpenVaultSession("Shared")
+	if err != nil {
+		t.Fatalf("Error reopening session: %v", err)
+	}
+	defer next.Close()
+	if next.ReadOnly {
+		t.Errorf("Expected the write lock to be free once the writer closed")
+	}
+}
+
+// TestVaultSessionLockAcrossProcesses checks a session in another process makes new sessions read-only
+func TestVaultSessionLockAcrossProcesses(t *testing.T) {
+	openTestVault(t, "CrossProcess")
+
+	cmd := lockHelper("hold", "CrossProcess", "", 0)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Error starting helper process: %v", err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "read-only=false\n" {
+		_ = cmd.Process.Kill()
+		t.Fatalf("Helper did not take the write lock: %q (%v)", line, err)
+	}
+
+	session, err := database.OpenVaultSession("CrossProcess")
+	if err != nil {
+		t.Fatalf("Error opening session: %v", err)
+	}
+	if !session.ReadOnly {
+		t.Errorf("Expected a read-only session while another process holds the lock")
+	}
+	_ = session.Close()
+
+	_ = stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Helper process failed: %v", err)
+	}
+
+	session, err = database.OpenVaultSession("CrossProcess")
+	if err != nil {
+		t.Fatalf("Error opening session: %v", err)
+	}
+	defer session.Close()
+	if session.ReadOnly {
+		t.Errorf("Expected the write lock to be released when the other process exited")
+	}
+}
+
+// TestRestoreAndMigrationTakeLock checks that restoring a backup and migrating a vault wait for its write lock
+func TestRestoreAndMigrationTakeLock(t *testing.T) {
+	useTempVaultHome(t)
+	db := createPasswordVault(t, "Guarded", "correct horse")
+	storeTestEntry(t, db, "https://first.example.com", 0)
+	backup, err := database.BackupVault("Guarded", database.BackupManual)
+	if err != nil {
+		t.Fatalf("Error backing up vault: %v", err)
+	}
+	storeTestEntry(t, db, "https://second.example.com", 0)
+
+	session, err := database.OpenVaultSession("Guarded")
+	if err != nil || session.ReadOnly {
+		t.Fatalf("Error opening session: %v", err)
+	}
+	defer session.Close()
+
+	// Restoring over an open session is refused, restoring through it is not
+	err = database.RestoreBackup("Guarded", backup, "correct horse")
+	if !errors.Is(err, database.ErrVaultLocked) {
+		t.Errorf("Expected ErrVaultLocked restoring, got %v", err)
+	}
+	err = session.RestoreBackup(backup, "correct horse")
+	if err != nil {
+		t.Fatalf("Error restoring backup through the session: %v", err)
+	}
+	entries, err := database.GetAllEntries(session.DB)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected the restored vault to hold 1 entry, got %d (%v)", len(entries), err)
+	}
+
+	// A vault that still needs migrating is not migrated behind the session's back
+	var version int
+	if err := session.DB.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		t.Fatalf("Error reading schema version: %v", err)
+	}
+	if _, err := session.DB.Exec("PRAGMA user_version = 1;"); err != nil {
+		t.Fatalf("Error lowering schema version: %v", err)
+	}
+	_, err = database.InitDB("Guarded")
+	if !errors.Is(err, database.ErrVaultLocked) {
+		t.Errorf("Expected ErrVaultLocked migrating, got %v", err)
+	}
+	if _, err := session.DB.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version)); err != nil {
+		t.Fatalf("Error restoring schema version: %v", err)
+	}
+}
+
+// TestVaultHelpersTakeLock checks that unlocking, exporting, cloning and starting a sync copy respect the
+// write lock of an open session
+func TestVaultHelpersTakeLock(t *testing.T) {
+	db := openTestVault(t, "Busy")
+	storeTestEntry(t, db, "busy.example.com", 0)
+
+	session, err := database.OpenVaultSession("Busy")
+	if err != nil || session.ReadOnly {
+		t.Fatalf("Error opening session: %v", err)
+	}
+	failedUnlocks := func() int {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM audit_failed_unlocks;").Scan(&count); err != nil {
+			t.Fatalf("Error counting failed unlocks: %v", err)
+		}
+		return count
+	}
+
+	// Reading still works while the session writes, but a failed unlock is not written behind its back
+	if authenticated, err := database.AuthenticateVault("Busy", "wrong auth key"); err != nil || authenticated {
+		t.Fatalf("Expected the wrong key to be denied (authenticated=%v, err=%v)", authenticated, err)
+	}
+	if count := failedUnlocks(); count != 0 {
+		t.Errorf("Expected no failed unlock recorded while the vault is locked, got %d", count)
+	}
+	if err := database.ExportVault("Busy", filepath.Join(t.TempDir(), "Busy.plexport"), "export password", fastKDF); err != nil {
+		t.Errorf("Error exporting a vault open in a session: %v", err)
+	}
+	if err := database.CloneVault("Busy", "BusyCopy"); err != nil {
+		t.Errorf("Error cloning a vault open in a session: %v", err)
+	}
+
+	// A sync copy is not written over while it is open
+	path := filepath.Join(t.TempDir(), "Shared.sqlite")
+	if err := database.WriteSyncCopy(db, path); err != nil {
+		t.Fatalf("Error writing sync copy: %v", err)
+	}
+	copySession, err := database.OpenVaultFileSession(path)
+	if err != nil {
+		t.Fatalf("Error opening sync copy: %v", err)
+	}
+	if err := database.WriteSyncCopy(db, path); !errors.Is(err, database.ErrVaultLocked) {
+		t.Errorf("Expected ErrVaultLocked writing over an open sync copy, got %v", err)
+	}
+	_ = copySession.Close()
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("Error closing session: %v", err)
+	}
+	if authenticated, err := database.AuthenticateVault("Busy", "wrong auth key"); err != nil || authenticated {
+		t.Fatalf("Expected the wrong key to be denied (authenticated=%v, err=%v)", authenticated, err)
+	}
+	if count := failedUnlocks(); count != 1 {
+		t.Errorf("Expected the failed unlock to be recorded once the vault is free, got %d", count)
+	}
+}
@@ -0,0 +1,271 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// fastKDF keeps key derivation quick in tests
+var fastKDF = encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+
+// createTestVault creates a closed vault in the temporary vault directory
+func createTestVault(t *testing.T, vaultName string) {
+	t.Helper()
+
+	err := database.CreateVault(vaultName, "hashedAuthKey", "salt")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+}
+
+// storedVaultName returns the vault name recorded in a vault's metadata
+func storedVaultName(t *testing.T, vaultName string) string {
+	t.Helper()
+
+	store, err := database.OpenSQLiteStore(vaultName)
+	if err != nil {
+		t.Fatalf("Error opening vault %s: %v", vaultName, err)
+	}
+	defer store.Close()
+
+	metadata, err := store.GetMetadata()
+	if err != nil {
+		t.Fatalf("Error reading metadata: %v", err)
+	}
+
+	return metadata.VaultName
+}
+
+// TestRenameVault renames a vault and checks its file, metadata and error cases
+func TestRenameVault(t *testing.T) {
+	useTempVaultHome(t)
+	createTestVault(t, "Before")
+	createTestVault(t, "Taken")
+
+	if err := database.RenameVault("Before", "Taken"); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists, got %v", err)
+	}
+	if err := database.RenameVault("Before", "../escape"); !errors.Is(err, database.ErrInvalidVaultName) {
+		t.Errorf("Expected ErrInvalidVaultName, got %v", err)
+	}
+	if err := database.RenameVault("Missing", "Other"); !errors.Is(err, database.ErrVaultNotFound) {
+		t.Errorf("Expected ErrVaultNotFound, got %v", err)
+	}
+
+	err := database.RenameVault("Before", "After")
+	if err != nil {
+		t.Fatalf("Error renaming vault: %v", err)
+	}
+
+	vaults, err := database.ListVaults()
+	if err != nil {
+		t.Fatalf("Error listing vaults: %v", err)
+	}
+	if len(vaults) != 2 || vaults[0] != "After" || vaults[1] != "Taken" {
+		t.Errorf("Expected [After Taken], got %v", vaults)
+	}
+	if name := storedVaultName(t, "After"); name != "After" {
+		t.Errorf("Metadata still names the vault %q", name)
+	}
+	authenticated, err := database.AuthenticateVault("After", "hashedAuthKey")
+	if err != nil || !authenticated {
+		t.Errorf("Could not authenticate renamed vault (authenticated=%v, err=%v)", authenticated, err)
+	}
+}
+
+// TestCloneVault copies a vault under a new name with the same password
+func TestCloneVault(t *testing.T) {
+	db := openTestVault(t, "Source")
+	storeTestEntry(t, db, "https://example.com", 0)
+
+	err := database.CloneVault("Source", "Copy")
+	if err != nil {
+		t.Fatalf("Error cloning vault: %v", err)
+	}
+	if err := database.CloneVault("Source", "Copy"); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists cloning twice, got %v", err)
+	}
+	path, err := database.VaultPath("Copy")
+	if err != nil {
+		t.Fatalf("Error resolving clone path: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the clone to have mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	clone, err := database.InitDB("Copy")
+	if err != nil {
+		t.Fatalf("Error opening clone: %v", err)
+	}
+	defer clone.Close()
+
+	entries, err := database.GetAllEntries(clone)
+	if err != nil || len(entries) != 1 || entries[0].Service != "https://example.com" {
+		t.Errorf("Clone does not contain the source entry: %v (%v)", entries, err)
+	}
+	if name := storedVaultName(t, "Copy"); name != "Copy" {
+		t.Errorf("Clone metadata names the vault %q", name)
+	}
+}
+
+// TestCloneVaultWithKeys clones a vault under a new master password and checks every secret was re-encrypted
+func TestCloneVaultWithKeys(t *testing.T) {
+	db := openTestVault(t, "Rekey")
+	oldKey := testEncryptionKey(t)
+
+	encryptedPassword, _ := encryption.Encrypt("hunter2", oldKey)
+	encryptedNotes, _ := encryption.Encrypt("my notes", oldKey)
+	entry, err := database.StorePassword(db, database.PasswordEntry{
+		Service:           "https://example.com",
+		Username:          "me",
+		EncryptedPassword: encryptedPassword,
+		EncryptedNotes:    encryptedNotes,
+	})
+	if err != nil {
+		t.Fatalf("Error storing password: %v", err)
+	}
+	encryptedValue, _ := encryption.Encrypt("1234", oldKey)
+	_, err = database.AddCustomField(db, entry.ID, database.CustomFieldEntry{
+		Name: "PIN", Type: database.FieldHidden, EncryptedValue: encryptedValue,
+	})
+	if err != nil {
+		t.Fatalf("Error adding custom field: %v", err)
+	}
+	content := bytes.Repeat([]byte("attachment "), 10000)
+	attachment, err := database.AddAttachment(db, oldKey, entry.ID, "file.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+
+	newKeys, err := database.DeriveVaultKeys("new master password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+
+	// The wrong source key fails without leaving a clone behind
+	if err := database.CloneVaultWithKeys("Rekey", "Rekeyed", newKeys.EncryptionKey, *newKeys); err == nil {
+		t.Fatalf("Expected an error cloning with the wrong source key")
+	}
+	if _, err := database.InitDB("Rekeyed"); !errors.Is(err, database.ErrVaultNotFound) {
+		t.Fatalf("A failed clone was left behind: %v", err)
+	}
+
+	err = database.CloneVaultWithKeys("Rekey", "Rekeyed", oldKey, *newKeys)
+	if err != nil {
+		t.Fatalf("Error cloning vault with new keys: %v", err)
+	}
+
+	authenticated, err := database.AuthenticateVault("Rekeyed", newKeys.AuthKey)
+	if err != nil || !authenticated {
+		t.Errorf("Clone does not authenticate with the new key (authenticated=%v, err=%v)", authenticated, err)
+	}
+	params, err := database.GetKDFParamsFromVault("Rekeyed")
+	if err != nil || params != fastKDF {
+		t.Errorf("Clone does not record the new KDF settings: %+v (%v)", params, err)
+	}
+
+	clone, err := database.InitDB("Rekeyed")
+	if err != nil {
+		t.Fatalf("Error opening clone: %v", err)
+	}
+	defer clone.Close()
+
+	cloned, err := database.GetEntryFromID(clone, entry.ID)
+	if err != nil {
+		t.Fatalf("Error fetching cloned entry: %v", err)
+	}
+	if _, err := encryption.Decrypt(cloned.EncryptedPassword, oldKey); err == nil {
+		t.Errorf("Clone password still decrypts with the old key")
+	}
+	for ciphertext, expected := range map[string]string{
+		cloned.EncryptedPassword: "hunter2",
+		cloned.EncryptedNotes:    "my notes",
+	} {
+		if plaintext, err := encryption.Decrypt(ciphertext, newKeys.EncryptionKey); err != nil || plaintext != expected {
+			t.Errorf("Expected %q with the new key, got %q (%v)", expected, plaintext, err)
+		}
+	}
+
+	fields, err := database.GetCustomFields(clone, entry.ID)
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("Expected 1 cloned custom field, got %v (%v)", fields, err)
+	}
+	if value, err := encryption.Decrypt(fields[0].EncryptedValue, newKeys.EncryptionKey); err != nil || value != "1234" {
+		t.Errorf("Custom field was not re-encrypted: %q (%v)", value, err)
+	}
+
+	var extracted bytes.Buffer
+	if err := database.ExtractAttachment(clone, newKeys.EncryptionKey, attachment.ID, &extracted); err != nil {
+		t.Fatalf("Error extracting re-keyed attachment: %v", err)
+	}
+	if !bytes.Equal(extracted.Bytes(), content) {
+		t.Errorf("Re-keyed attachment content differs")
+	}
+
+	// The source vault is unchanged
+	source, err := database.GetEntryFromID(db, entry.ID)
+	if err != nil || source.EncryptedPassword != encryptedPassword {
+		t.Errorf("Source vault was modified: %+v (%v)", source, err)
+	}
+}
+
+// TestArchiveVault hides and restores a vault
+func TestArchiveVault(t *testing.T) {
+	useTempVaultHome(t)
+	createTestVault(t, "Active")
+	createTestVault(t, "Old")
+
+	if err := database.ArchiveVault("Missing"); !errors.Is(err, database.ErrVaultNotFound) {
+		t.Errorf("Expected ErrVaultNotFound, got %v", err)
+	}
+
+	err := database.ArchiveVault("Old")
+	if err != nil {
+		t.Fatalf("Error archiving vault: %v", err)
+	}
+
+	vaults, err := database.ListVaults()
+	if err != nil || len(vaults) != 1 || vaults[0] != "Active" {
+		t.Errorf("Expected [Active], got %v (%v)", vaults, err)
+	}
+	archived, err := database.ListArchivedVaults()
+	if err != nil || len(archived) != 1 || archived[0] != "Old" {
+		t.Errorf("Expected [Old] archived, got %v (%v)", archived, err)
+	}
+
+	// Archived vaults can still be opened and keep their name
+	if err := database.CreateVault("Old", "k", "s"); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists for an archived name, got %v", err)
+	}
+	db, err := database.InitDB("Old")
+	if err != nil {
+		t.Fatalf("Error opening archived vault: %v", err)
+	}
+	_ = db.Close()
+
+	// Renaming keeps the archive flag
+	if err := database.RenameVault("Old", "Older"); err != nil {
+		t.Fatalf("Error renaming archived vault: %v", err)
+	}
+	archived, _ = database.ListArchivedVaults()
+	if len(archived) != 1 || archived[0] != "Older" {
+		t.Errorf("Expected [Older] archived after rename, got %v", archived)
+	}
+
+	err = database.UnarchiveVault("Older")
+	if err != nil {
+		t.Fatalf("Error unarchiving vault: %v", err)
+	}
+	vaults, _ = database.ListVaults()
+	if len(vaults) != 2 {
+		t.Errorf("Expected 2 vaults after unarchiving, got %v", vaults)
+	}
+	if err := database.UnarchiveVault("Older"); !errors.Is(err, database.ErrVaultNotFound) {
+		t.Errorf("Expected ErrVaultNotFound unarchiving twice, got %v", err)
+	}
+}
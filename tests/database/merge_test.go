@@ -0,0 +1,489 @@
+package tests
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// syncTestCopy copies an open vault to a file outside the vault directory and opens the copy
+func syncTestCopy(t *testing.T, db *sql.DB) (string, *sql.DB) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Shared.sqlite")
+	if _, err := db.Exec("VACUUM INTO ?;", path); err != nil {
+		t.Fatalf("Error copying vault: %v", err)
+	}
+	other, err := database.OpenVaultFile(path)
+	if err != nil {
+		t.Fatalf("Error opening copy: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = other.Close()
+	})
+
+	return path, other
+}
+
+// storeSecretEntry stores an entry with an encrypted password and returns its UUID
+func storeSecretEntry(t *testing.T, db *sql.DB, key string, service string, password string) string {
+	t.Helper()
+
+	encrypted, err := encryption.Encrypt(password, key)
+	if err != nil {
+		t.Fatalf("Error encrypting password: %v", err)
+	}
+	entry, err := database.StorePassword(db, database.PasswordEntry{Service: service, Username: "user", EncryptedPassword: encrypted})
+	if err != nil {
+		t.Fatalf("Error storing entry: %v", err)
+	}
+
+	return entry.UUID
+}
+
+// setSecretPassword changes the password of an entry directly, without stamping the change time or auditing
+// it like UpdateEntryPassword, so sync sees a plain edit
+func setSecretPassword(t *testing.T, db *sql.DB, key string, uuid string, password string) {
+	t.Helper()
+
+	encrypted, err := encryption.Encrypt(password, key)
+	if err != nil {
+		t.Fatalf("Error encrypting password: %v", err)
+	}
+	if _, err := db.Exec("UPDATE passwords SET password = ? WHERE uuid = ?;", encrypted, uuid); err != nil {
+		t.Fatalf("Error changing password: %v", err)
+	}
+}
+
+// secretPassword returns the decrypted password of an entry, or "" if the entry does not exist
+func secretPassword(t *testing.T, db *sql.DB, key string, uuid string) string {
+	t.Helper()
+
+	entry, err := database.GetEntryByUUID(db, uuid)
+	if errors.Is(err, database.ErrObjectNotFound) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("Error fetching entry %s: %v", uuid, err)
+	}
+	password, err := encryption.Decrypt(entry.EncryptedPassword, key)
+	if err != nil {
+		t.Fatalf("Error decrypting password: %v", err)
+	}
+
+	return password
+}
+
+// syncTestVaults syncs two copies and fails the test on error
+func syncTestVaults(t *testing.T, db *sql.DB, key string, path string) *database.SyncSummary {
+	t.Helper()
+
+	summary, err := database.SyncVaults(db, key, path)
+	if err != nil {
+		t.Fatalf("Error syncing vaults: %v", err)
+	}
+
+	return summary
+}
+
+// TestSyncVaults merges independent changes made in two copies after a first sync
+func TestSyncVaults(t *testing.T) {
+	db := openTestVault(t, "Home")
+	key := testEncryptionKey(t)
+	edited := storeSecretEntry(t, db, key, "edited.example.com", "original")
+	deleted := storeSecretEntry(t, db, key, "deleted.example.com", "original")
+	path, other := syncTestCopy(t, db)
+
+	summary := syncTestVaults(t, db, key, path)
+	if *summary != (database.SyncSummary{}) {
+		t.Errorf("Expected nothing to change syncing identical copies, got %+v", summary)
+	}
+
+	// This copy adds an entry and a custom field, the other files the same entry and deletes another
+	added := storeSecretEntry(t, db, key, "added.example.com", "new")
+	local, err := database.GetEntryByUUID(db, edited)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	value, _ := encryption.Encrypt("1234", key)
+	_, err = database.AddCustomField(db, local.ID, database.CustomFieldEntry{Name: "PIN", Type: database.FieldHidden, EncryptedValue: value})
+	if err != nil {
+		t.Fatalf("Error adding field: %v", err)
+	}
+
+	folder, err := database.CreateFolder(other, "Work", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	remote, err := database.GetEntryByUUID(other, edited)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.MoveEntryToFolder(other, remote.ID, folder.ID); err != nil {
+		t.Fatalf("Error moving entry: %v", err)
+	}
+	if err := database.AddTagToEntry(other, remote.ID, "work"); err != nil {
+		t.Fatalf("Error tagging entry: %v", err)
+	}
+	removed, err := database.GetEntryByUUID(other, deleted)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.DeleteEntryFromID(other, removed.ID); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+
+	summary = syncTestVaults(t, db, key, path)
+	if summary.Merged != 1 || summary.Conflicts != 0 || summary.Pulled == 0 || summary.Pushed == 0 {
+		t.Errorf("Unexpected sync summary %+v", summary)
+	}
+
+	// Both copies end up with the same entries, the edited one combining both changes
+	for name, copy := range map[string]*sql.DB{"local": db, "remote": other} {
+		if secretPassword(t, copy, key, added) != "new" {
+			t.Errorf("%s: expected the added entry", name)
+		}
+		if secretPassword(t, copy, key, deleted) != "" {
+			t.Errorf("%s: expected the deleted entry to be gone", name)
+		}
+
+		entry, err := database.GetEntryByUUID(copy, edited)
+		if err != nil {
+			t.Fatalf("%s: error fetching entry: %v", name, err)
+		}
+		fields, err := database.GetCustomFields(copy, entry.ID)
+		if err != nil || len(fields) != 1 || fields[0].Name != "PIN" {
+			t.Errorf("%s: expected the PIN field, got %v (%v)", name, fields, err)
+		}
+		tags, err := database.GetTagsForEntry(copy, entry.ID)
+		if err != nil || len(tags) != 1 || tags[0] != "work" {
+			t.Errorf("%s: expected the work tag, got %v (%v)", name, tags, err)
+		}
+		entryFolder, err := database.GetFolder(copy, entry.FolderID)
+		if err != nil || entryFolder.Name != "Work" || entryFolder.UUID != folder.UUID {
+			t.Errorf("%s: expected the entry in the Work folder, got %v (%v)", name, entryFolder, err)
+		}
+	}
+
+	// Syncing again finds nothing left to do
+	summary = syncTestVaults(t, db, key, path)
+	if *summary != (database.SyncSummary{}) {
+		t.Errorf("Expected nothing to change on a second sync, got %+v", summary)
+	}
+}
+
+// TestSyncConflicts checks clashing edits are recorded, left alone, and resolved by the user
+func TestSyncConflicts(t *testing.T) {
+	db := openTestVault(t, "Conflicted")
+	key := testEncryptionKey(t)
+	edited := storeSecretEntry(t, db, key, "edited.example.com", "original")
+	deleted := storeSecretEntry(t, db, key, "deleted.example.com", "original")
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	// Both copies change the same password, and one deletes an entry the other edits
+	setSecretPassword(t, db, key, edited, "mine")
+	setSecretPassword(t, other, key, edited, "theirs")
+	entry, err := database.GetEntryByUUID(db, deleted)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.DeleteEntryFromID(db, entry.ID); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+	setSecretPassword(t, other, key, deleted, "still used")
+
+	summary := syncTestVaults(t, db, key, path)
+	if summary.Conflicts != 2 || summary.Pulled != 0 || summary.Pushed != 0 {
+		t.Errorf("Expected 2 conflicts and no changes, got %+v", summary)
+	}
+	if secretPassword(t, db, key, edited) != "mine" || secretPassword(t, other, key, edited) != "theirs" {
+		t.Errorf("Expected both copies to keep their own version until resolved")
+	}
+
+	conflicts, err := database.ListSyncConflicts(db, key)
+	if err != nil || len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %v (%v)", conflicts, err)
+	}
+	byUUID := make(map[string]*database.SyncConflict)
+	for _, conflict := range conflicts {
+		byUUID[conflict.UUID] = conflict
+		if conflict.Peer != path {
+			t.Errorf("Expected the conflict to name the other copy, got %s", conflict.Peer)
+		}
+	}
+	if c := byUUID[edited]; c == nil || c.Local.Password != "mine" || c.Remote.Password != "theirs" {
+		t.Errorf("Unexpected edit conflict %+v", c)
+	}
+	if c := byUUID[deleted]; c == nil || c.Local != nil || c.Remote.Password != "still used" {
+		t.Errorf("Unexpected delete conflict %+v", c)
+	}
+
+	// Unresolved conflicts survive another sync
+	summary = syncTestVaults(t, db, key, path)
+	if summary.Pulled != 0 || summary.Pushed != 0 || secretPassword(t, other, key, edited) != "theirs" {
+		t.Errorf("Expected unresolved entries to be left alone, got %+v", summary)
+	}
+
+	// Keeping this copy's password and the other copy's entry reaches both copies with the next sync
+	if err := database.ResolveSyncConflict(db, key, byUUID[edited].ID, false); err != nil {
+		t.Fatalf("Error resolving conflict: %v", err)
+	}
+	if err := database.ResolveSyncConflict(db, key, byUUID[deleted].ID, true); err != nil {
+		t.Fatalf("Error resolving conflict: %v", err)
+	}
+	if err := database.ResolveSyncConflict(db, key, byUUID[deleted].ID, true); !errors.Is(err, database.ErrConflictNotFound) {
+		t.Errorf("Expected ErrConflictNotFound resolving twice, got %v", err)
+	}
+
+	syncTestVaults(t, db, key, path)
+	for name, copy := range map[string]*sql.DB{"local": db, "remote": other} {
+		if password := secretPassword(t, copy, key, edited); password != "mine" {
+			t.Errorf("%s: expected the kept password, got %q", name, password)
+		}
+		if password := secretPassword(t, copy, key, deleted); password != "still used" {
+			t.Errorf("%s: expected the restored entry, got %q", name, password)
+		}
+	}
+	conflicts, err = database.ListSyncConflicts(db, key)
+	if err != nil || len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts left, got %v (%v)", conflicts, err)
+	}
+}
+
+// TestSyncStateAfterRekey checks conflicts and the common ancestors of a sync survive re-keying
+func TestSyncStateAfterRekey(t *testing.T) {
+	db := openTestVault(t, "RekeyedSync")
+	key := testEncryptionKey(t)
+	edited := storeSecretEntry(t, db, key, "edited.example.com", "original")
+	kept := storeSecretEntry(t, db, key, "kept.example.com", "original")
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	setSecretPassword(t, db, key, edited, "mine")
+	setSecretPassword(t, other, key, edited, "theirs")
+	if summary := syncTestVaults(t, db, key, path); summary.Conflicts != 1 {
+		t.Fatalf("Expected 1 conflict, got %+v", summary)
+	}
+
+	// Both copies move to the same new master password
+	newKeys, err := database.DeriveVaultKeys("new master password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	for _, copy := range []*sql.DB{db, other} {
+		if err := database.RekeyVault(copy, key, *newKeys); err != nil {
+			t.Fatalf("Error re-keying vault: %v", err)
+		}
+	}
+	newKey := newKeys.EncryptionKey
+
+	conflicts, err := database.ListSyncConflicts(db, newKey)
+	if err != nil || len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict after re-keying, got %v (%v)", conflicts, err)
+	}
+	if conflicts[0].Local.Password != "mine" || conflicts[0].Remote.Password != "theirs" {
+		t.Errorf("Unexpected conflict after re-keying %+v", conflicts[0])
+	}
+	if err := database.ResolveSyncConflict(db, newKey, conflicts[0].ID, true); err != nil {
+		t.Fatalf("Error resolving conflict: %v", err)
+	}
+
+	// The next sync merges against the re-encrypted common ancestors
+	setSecretPassword(t, other, newKey, kept, "changed")
+	syncTestVaults(t, db, newKey, path)
+	for name, copy := range map[string]*sql.DB{"local": db, "remote": other} {
+		if password := secretPassword(t, copy, newKey, edited); password != "theirs" {
+			t.Errorf("%s: expected the resolved password, got %q", name, password)
+		}
+		if password := secretPassword(t, copy, newKey, kept); password != "changed" {
+			t.Errorf("%s: expected the merged password, got %q", name, password)
+		}
+	}
+}
+
+// TestSyncWithoutAncestor syncs two copies that were changed before they were ever synced
+func TestSyncWithoutAncestor(t *testing.T) {
+	db := openTestVault(t, "Unsynced")
+	key := testEncryptionKey(t)
+	deleted := storeSecretEntry(t, db, key, "deleted.example.com", "original")
+	edited := storeSecretEntry(t, db, key, "edited.example.com", "original")
+	same := storeSecretEntry(t, db, key, "same.example.com", "original")
+	path, other := syncTestCopy(t, db)
+
+	entry, err := database.GetEntryByUUID(db, deleted)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.DeleteEntryFromID(db, entry.ID); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+	added := storeSecretEntry(t, other, key, "added.example.com", "new")
+	setSecretPassword(t, db, key, edited, "mine")
+	setSecretPassword(t, other, key, edited, "theirs")
+	setSecretPassword(t, db, key, same, "agreed")
+	setSecretPassword(t, other, key, same, "agreed")
+
+	summary := syncTestVaults(t, db, key, path)
+	if summary.Conflicts != 1 {
+		t.Errorf("Expected only the differently edited entry to conflict, got %+v", summary)
+	}
+	for name, copy := range map[string]*sql.DB{"local": db, "remote": other} {
+		if secretPassword(t, copy, key, deleted) != "" {
+			t.Errorf("%s: expected the deletion to reach both copies", name)
+		}
+		if secretPassword(t, copy, key, added) != "new" {
+			t.Errorf("%s: expected the added entry in both copies", name)
+		}
+		if secretPassword(t, copy, key, same) != "agreed" {
+			t.Errorf("%s: expected the identical edit to be kept", name)
+		}
+	}
+}
+
+// TestSyncAttachments copies attachments between copies and removes deleted ones
+func TestSyncAttachments(t *testing.T) {
+	db := openTestVault(t, "Attached")
+	key := testEncryptionKey(t)
+	owner := storeSecretEntry(t, db, key, "files.example.com", "original")
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	remoteEntry, err := database.GetEntryByUUID(other, owner)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	content := strings.Repeat("attachment data ", 10000)
+	attachment, err := database.AddAttachment(other, key, remoteEntry.ID, "notes.txt", strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Error adding attachment: %v", err)
+	}
+
+	syncTestVaults(t, db, key, path)
+	localEntry, err := database.GetEntryByUUID(db, owner)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	attachments, err := database.ListAttachments(db, localEntry.ID)
+	if err != nil || len(attachments) != 1 || attachments[0].UUID != attachment.UUID {
+		t.Fatalf("Expected the attachment to be copied, got %v (%v)", attachments, err)
+	}
+	var extracted bytes.Buffer
+	if err := database.ExtractAttachment(db, key, attachments[0].ID, &extracted); err != nil {
+		t.Fatalf("Error extracting copied attachment: %v", err)
+	}
+	if extracted.String() != content {
+		t.Errorf("Copied attachment does not match the original")
+	}
+
+	if err := database.DeleteAttachment(db, attachments[0].ID); err != nil {
+		t.Fatalf("Error deleting attachment: %v", err)
+	}
+	syncTestVaults(t, db, key, path)
+	attachments, err = database.ListAttachments(other, remoteEntry.ID)
+	if err != nil || len(attachments) != 0 {
+		t.Errorf("Expected the deletion to reach the other copy, got %v (%v)", attachments, err)
+	}
+}
+
+// TestSyncRefusesUnrelatedVaults checks only copies of the same vault are synced
+func TestSyncRefusesUnrelatedVaults(t *testing.T) {
+	db := openTestVault(t, "Mine")
+	key := testEncryptionKey(t)
+
+	if err := database.CreateVault("Unrelated", "hashedAuthKey", "salt"); err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	unrelated := database.GetDatabasePath("Unrelated")
+	if _, err := database.SyncVaults(db, key, unrelated); !errors.Is(err, database.ErrSyncVaultMismatch) {
+		t.Errorf("Expected ErrSyncVaultMismatch, got %v", err)
+	}
+
+	if _, err := database.SyncVaults(db, key, database.GetDatabasePath("Mine")); !errors.Is(err, database.ErrSyncSameFile) {
+		t.Errorf("Expected ErrSyncSameFile, got %v", err)
+	}
+
+	path, other := syncTestCopy(t, db)
+	if _, err := other.Exec("UPDATE vault_metadata SET auth_key = 'changed';"); err != nil {
+		t.Fatalf("Error changing auth key: %v", err)
+	}
+	if _, err := database.SyncVaults(db, key, path); !errors.Is(err, database.ErrSyncKeyMismatch) {
+		t.Errorf("Expected ErrSyncKeyMismatch, got %v", err)
+	}
+}
+
+// TestSyncPasswordChangedAt checks the time a password was changed is kept by sync and only taken from the
+// copy whose password won
+func TestSyncPasswordChangedAt(t *testing.T) {
+	db := openTestVault(t, "Aged")
+	key := testEncryptionKey(t)
+	uuid := storeSecretEntry(t, db, key, "aged.example.com", "original")
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	changedAt := func(q *sql.DB) string {
+		entry, err := database.GetEntryByUUID(q, uuid)
+		if err != nil {
+			t.Fatalf("Error fetching entry: %v", err)
+		}
+		return entry.PasswordChangedAt
+	}
+	created := changedAt(db)
+	if created == "" || changedAt(other) != created {
+		t.Fatalf("Expected the password time to be set and copied, got %q and %q", created, changedAt(other))
+	}
+
+	// The other copy changes the password, this copy only renames the entry
+	setSecretPassword(t, other, key, uuid, "rotated")
+	if _, err := other.Exec("UPDATE passwords SET password_changed_at = '2030-01-02T03:04:05.000Z' WHERE uuid = ?;", uuid); err != nil {
+		t.Fatalf("Error setting password time: %v", err)
+	}
+	if _, err := db.Exec("UPDATE passwords SET username = 'renamed' WHERE uuid = ?;", uuid); err != nil {
+		t.Fatalf("Error renaming entry: %v", err)
+	}
+	syncTestVaults(t, db, key, path)
+
+	for name, q := range map[string]*sql.DB{"this": db, "other": other} {
+		if password := secretPassword(t, q, key, uuid); password != "rotated" {
+			t.Errorf("Expected the %s copy to have the rotated password, got %q", name, password)
+		}
+		if at := changedAt(q); at != "2030-01-02T03:04:05.000Z" {
+			t.Errorf("Expected the %s copy to have the rotated password's time, got %q", name, at)
+		}
+	}
+}
+
+// TestWriteSyncCopy checks a new shared copy is private to the user and starts without this copy's sync state
+func TestWriteSyncCopy(t *testing.T) {
+	db := openTestVault(t, "Origin")
+	key := testEncryptionKey(t)
+	storeSecretEntry(t, db, key, "shared.example.com", "secret")
+	existing, _ := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, existing)
+
+	path := filepath.Join(t.TempDir(), "Shared.sqlite")
+	if err := database.WriteSyncCopy(db, path); err != nil {
+		t.Fatalf("Error writing sync copy: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the sync copy to have mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	copyDB, err := database.OpenVaultFile(path)
+	if err != nil {
+		t.Fatalf("Error opening sync copy: %v", err)
+	}
+	defer copyDB.Close()
+	var ancestors, peers int
+	err = copyDB.QueryRow("SELECT (SELECT COUNT(*) FROM sync_base), (SELECT COUNT(*) FROM sync_peers);").Scan(&ancestors, &peers)
+	if err != nil || ancestors != 0 || peers != 0 {
+		t.Errorf("Expected no sync state in the new copy, got %d ancestors and %d peers (%v)", ancestors, peers, err)
+	}
+}
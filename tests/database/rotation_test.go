@@ -0,0 +1,261 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// ageTestPassword makes an entry's password look last changed the given number of days before now
+func ageTestPassword(t *testing.T, db *sql.DB, id int, now time.Time, days int) {
+	t.Helper()
+
+	changedAt := now.UTC().AddDate(0, 0, -days).Format("2006-01-02T15:04:05.000Z")
+	if _, err := db.Exec("UPDATE passwords SET password_changed_at = ? WHERE id = ?;", changedAt, id); err != nil {
+		t.Fatalf("Error aging password: %v", err)
+	}
+}
+
+// createTestFolder creates a folder with a rotation policy and returns its ID
+func createTestFolder(t *testing.T, db *sql.DB, name string, parentID int, days int) int {
+	t.Helper()
+
+	folder, err := database.CreateFolder(db, name, parentID)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	if err := database.SetFolderRotation(db, folder.ID, days); err != nil {
+		t.Fatalf("Error setting folder rotation: %v", err)
+	}
+
+	return folder.ID
+}
+
+// TestRotationPolicies checks folders take the nearest policy up the tree, falling back to the vault's
+func TestRotationPolicies(t *testing.T) {
+	db := openTestVault(t, "Policies")
+
+	if days, err := database.GetVaultRotation(db); err != nil || days != 0 {
+		t.Fatalf("Expected no vault policy by default, got %d (%v)", days, err)
+	}
+	if err := database.SetVaultRotation(db, 90); err != nil {
+		t.Fatalf("Error setting vault rotation: %v", err)
+	}
+
+	finance := createTestFolder(t, db, "Finance", 0, 30)
+	banks := createTestFolder(t, db, "Banks", finance, database.RotationInherit)
+	personal := createTestFolder(t, db, "Personal", 0, database.RotationNever)
+	games := createTestFolder(t, db, "Games", personal, database.RotationInherit)
+	other := createTestFolder(t, db, "Other", 0, database.RotationInherit)
+
+	for name, test := range map[string]struct{ folderID, days int }{
+		"unfiled":   {0, 90},
+		"finance":   {finance, 30},
+		"subfolder": {banks, 30},
+		"never":     {personal, 0},
+		"never sub": {games, 0},
+		"inherit":   {other, 90},
+	} {
+		if days, err := database.FolderRotation(db, test.folderID); err != nil || days != test.days {
+			t.Errorf("Expected %s entries to rotate every %d days, got %d (%v)", name, test.days, days, err)
+		}
+	}
+
+	folder, err := database.GetFolder(db, finance)
+	if err != nil || folder.RotationDays != 30 {
+		t.Errorf("Expected the folder's own policy, got %+v (%v)", folder, err)
+	}
+
+	if err := database.SetVaultRotation(db, -1); !errors.Is(err, database.ErrInvalidRotation) {
+		t.Errorf("Expected ErrInvalidRotation for the vault, got %v", err)
+	}
+	if err := database.SetFolderRotation(db, finance, -2); !errors.Is(err, database.ErrInvalidRotation) {
+		t.Errorf("Expected ErrInvalidRotation for a folder, got %v", err)
+	}
+}
+
+// TestGetDueEntries checks rotations and expiries are reported once within the reminder window
+func TestGetDueEntries(t *testing.T) {
+	db := openTestVault(t, "Due")
+	key := testEncryptionKey(t)
+	now := time.Now()
+	if err := database.SetVaultRotation(db, 90); err != nil {
+		t.Fatalf("Error setting vault rotation: %v", err)
+	}
+	personal := createTestFolder(t, db, "Personal", 0, database.RotationNever)
+
+	overdue := storeTestEntry(t, db, "overdue.example.com", 0)
+	ageTestPassword(t, db, overdue, now, 100)
+	soon := storeTestEntry(t, db, "soon.example.com", 0)
+	ageTestPassword(t, db, soon, now, 80)
+	ageTestPassword(t, db, storeTestEntry(t, db, "fresh.example.com", 0), now, 10)
+	ageTestPassword(t, db, storeTestEntry(t, db, "exempt.example.com", personal), now, 400)
+
+	note, err := database.StoreTypedEntry(db, key, &database.TypedEntry{Type: database.EntrySecureNote, Title: "Old note", Secret: "text"})
+	if err != nil {
+		t.Fatalf("Error storing note: %v", err)
+	}
+	ageTestPassword(t, db, note.ID, now, 400)
+
+	expiring := storeTestEntry(t, db, "expiring.example.com", personal)
+	if err := database.SetEntryExpiry(db, expiring, now.UTC().AddDate(0, 0, 5).Format(database.DateFormat)); err != nil {
+		t.Fatalf("Error setting expiry: %v", err)
+	}
+	card, err := database.StoreTypedEntry(db, key, &database.TypedEntry{
+		Type: database.EntryCard, Title: "Old card", Secret: "4111 1111 1111 1111",
+		Fields: map[string]string{"expiry": "01/20"},
+	})
+	if err != nil {
+		t.Fatalf("Error storing card: %v", err)
+	}
+	token, err := database.StoreTypedEntry(db, key, &database.TypedEntry{
+		Type: database.EntryAPIToken, Title: "CI token", Secret: "tok_123",
+		Fields: map[string]string{"expires": now.UTC().AddDate(0, 0, 3).Format(database.DateFormat)},
+	})
+	if err != nil {
+		t.Fatalf("Error storing token: %v", err)
+	}
+	ageTestPassword(t, db, token.ID, now, 1)
+	laterCard, err := database.StoreTypedEntry(db, key, &database.TypedEntry{
+		Type: database.EntryCard, Title: "New card", Secret: "4111 1111 1111 1111",
+		Fields: map[string]string{"expiry": "12/99"},
+	})
+	if err != nil {
+		t.Fatalf("Error storing card: %v", err)
+	}
+
+	due, err := database.GetDueEntries(db, key, now, 14)
+	if err != nil {
+		t.Fatalf("Error listing due entries: %v", err)
+	}
+	type result struct {
+		reason  database.DueReason
+		overdue bool
+	}
+	found := make(map[int]result)
+	for i, entry := range due {
+		found[entry.EntryID] = result{entry.Reason, entry.Overdue}
+		if i > 0 && entry.DueDate.Before(due[i-1].DueDate) {
+			t.Errorf("Expected due entries ordered by date, got %v before %v", due[i-1].DueDate, entry.DueDate)
+		}
+	}
+	expected := map[int]result{
+		card.ID:  {database.DueExpiry, true},
+		overdue:  {database.DueRotation, true},
+		token.ID: {database.DueExpiry, false},
+		expiring: {database.DueExpiry, false},
+		soon:     {database.DueRotation, false},
+	}
+	if len(found) != len(expected) || len(due) != len(expected) {
+		t.Errorf("Expected %d due entries, got %+v", len(expected), due)
+	}
+	for id, want := range expected {
+		if found[id] != want {
+			t.Errorf("Expected entry %d to be due for %+v, got %+v", id, want, found[id])
+		}
+	}
+	if _, ok := found[laterCard.ID]; ok {
+		t.Error("Expected a card expiring in the future not to be due")
+	}
+	if due[0].EntryID != card.ID {
+		t.Errorf("Expected the longest overdue entry first, got %+v", due[0])
+	}
+
+	// A longer window includes the rotation that is due later, a cleared expiry is no longer reported
+	if err := database.SetEntryExpiry(db, expiring, ""); err != nil {
+		t.Fatalf("Error clearing expiry: %v", err)
+	}
+	due, err = database.GetDueEntries(db, key, now, 90)
+	if err != nil {
+		t.Fatalf("Error listing due entries: %v", err)
+	}
+	ids := make(map[int]bool)
+	for _, entry := range due {
+		ids[entry.EntryID] = true
+	}
+	if ids[expiring] || !ids[soon] || len(due) != 6 {
+		t.Errorf("Expected 6 due entries without the cleared expiry, got %+v", due)
+	}
+
+	if err := database.SetEntryExpiry(db, expiring, "next week"); !errors.Is(err, database.ErrInvalidExpiry) {
+		t.Errorf("Expected ErrInvalidExpiry, got %v", err)
+	}
+}
+
+// TestImportedPasswordAge checks imports keep the source's change date, so old passwords are due at once
+func TestImportedPasswordAge(t *testing.T) {
+	db := openTestVault(t, "Imported")
+	key := testEncryptionKey(t)
+	now := time.Now()
+	if err := database.SetVaultRotation(db, 90); err != nil {
+		t.Fatalf("Error setting vault rotation: %v", err)
+	}
+
+	_, err := database.ImportEntries(db, key, []database.ImportRecord{
+		{Service: "old.example.com", Password: "pw1", ChangedAt: now.AddDate(0, 0, -200)},
+		{Service: "unknown.example.com", Password: "pw2"},
+		{Service: "future.example.com", Password: "pw3", ChangedAt: now.AddDate(1, 0, 0)},
+	})
+	if err != nil {
+		t.Fatalf("Error importing entries: %v", err)
+	}
+
+	due, err := database.GetDueEntries(db, key, now, 14)
+	if err != nil {
+		t.Fatalf("Error listing due entries: %v", err)
+	}
+	if len(due) != 1 || due[0].Service != "old.example.com" || !due[0].Overdue {
+		t.Errorf("Expected only the old import to be overdue, got %+v", due)
+	}
+
+	// Unknown and future change dates count from the import
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		t.Fatalf("Error listing entries: %v", err)
+	}
+	for _, entry := range entries {
+		changedAt, err := time.Parse(time.RFC3339Nano, entry.PasswordChangedAt)
+		if entry.Service != "old.example.com" && (err != nil || changedAt.After(now.Add(time.Minute)) || now.Sub(changedAt) > time.Minute) {
+			t.Errorf("Expected %s to be marked as changed now, got %q (%v)", entry.Service, entry.PasswordChangedAt, err)
+		}
+	}
+}
+
+// TestSyncRotationAndExpiry checks folder policies and expiry dates are synced
+func TestSyncRotationAndExpiry(t *testing.T) {
+	db := openTestVault(t, "Rotated")
+	key := testEncryptionKey(t)
+	uuid := storeSecretEntry(t, db, key, "synced.example.com", "secret")
+	folder, err := database.CreateFolder(db, "Work", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	path, other := syncTestCopy(t, db)
+	syncTestVaults(t, db, key, path)
+
+	entry, err := database.GetEntryByUUID(db, uuid)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if err := database.SetEntryExpiry(db, entry.ID, "2031-06-30"); err != nil {
+		t.Fatalf("Error setting expiry: %v", err)
+	}
+	if err := database.SetFolderRotation(db, folder.ID, 60); err != nil {
+		t.Fatalf("Error setting folder rotation: %v", err)
+	}
+	if summary := syncTestVaults(t, db, key, path); summary.Pushed != 2 {
+		t.Errorf("Expected the entry and folder to be pushed, got %+v", summary)
+	}
+
+	synced, err := database.GetEntryByUUID(other, uuid)
+	if err != nil || synced.ExpiresAt != "2031-06-30" {
+		t.Errorf("Expected the expiry to be synced, got %+v (%v)", synced, err)
+	}
+	var days int
+	if err := other.QueryRow("SELECT rotation_days FROM folders WHERE uuid = ?;", folder.UUID).Scan(&days); err != nil || days != 60 {
+		t.Errorf("Expected the folder policy to be synced, got %d (%v)", days, err)
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestMigrateLegacyVault opens a vault created before schema versioning and checks it is upgraded
+func TestMigrateLegacyVault(t *testing.T) {
+	useTempVaultHome(t)
+
+	// Build a vault with the original, unversioned schema
+	legacy, err := sql.Open("sqlite3", database.GetDatabasePath("LegacyVault"))
+	if err != nil {
+		t.Fatalf("Error creating legacy vault: %v", err)
+	}
+	_, err = legacy.Exec(`
+	CREATE TABLE passwords (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    service TEXT NOT NULL,
+	    username TEXT NOT NULL,
+	    password TEXT NOT NULL,
+	    notes TEXT,
+	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE vault_metadata (vault_name TEXT PRIMARY KEY, auth_key TEXT NOT NULL, salt TEXT NOT NULL);
+	INSERT INTO passwords (service, username, password, notes) VALUES ('legacy.example.com', 'old', 'pw', NULL);`)
+	if err != nil {
+		t.Fatalf("Error populating legacy vault: %v", err)
+	}
+	_ = legacy.Close()
+
+	db, err := database.InitDB("LegacyVault")
+	if err != nil {
+		t.Fatalf("Error opening legacy vault: %v", err)
+	}
+	defer db.Close()
+
+	// Existing entries are readable and new features work
+	entries, err := database.GetAllEntries(db)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 legacy entry, got %v (%v)", entries, err)
+	}
+	folder, err := database.CreateFolder(db, "Migrated", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder in migrated vault: %v", err)
+	}
+	if err := database.MoveEntryToFolder(db, entries[0].ID, folder.ID); err != nil {
+		t.Fatalf("Error filing legacy entry: %v", err)
+	}
+
+	// Legacy entries are given sync metadata
+	if entries[0].UUID == "" || entries[0].ModifiedAt == "" || entries[0].Version != 1 {
+		t.Errorf("Expected a UUID and version 1 on the legacy entry, got %+v", entries[0])
+	}
+}
@@ -1,8 +1,14 @@
 package tests
 
 import (
-	"github.com/cpainter1/PassLock/internal/database"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
 )
 
 // TestGetDatabasePath returns the database path of a sample vault
@@ -13,6 +19,8 @@ func TestGetDatabasePath(t *testing.T) {
 
 // TestListVaults
 func TestListVaults(t *testing.T) {
+	useTempVaultHome(t)
+
 	// Create sample vaults
 	err := database.CreateVault("TestingVault1", "hashedKey1", "salt1")
 	if err != nil {
@@ -58,3 +66,75 @@ func TestListVaults(t *testing.T) {
 		t.Errorf("Error deleting vault: %v", err)
 	}
 }
+
+// TestVaultKDFParams checks that a vault remembers the Argon2 parameters it was created with
+func TestVaultKDFParams(t *testing.T) {
+	useTempVaultHome(t)
+
+	params := encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+	err := database.CreateVaultWithKDF("FastVault", "hashedKey", "salt", params)
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	stored, err := database.GetKDFParamsFromVault("FastVault")
+	if err != nil {
+		t.Fatalf("Error reading KDF params: %v", err)
+	}
+	if stored != params {
+		t.Errorf("Expected %+v, got %+v", params, stored)
+	}
+
+	// Vaults created without explicit settings use the defaults
+	err = database.CreateVault("DefaultVault", "hashedKey", "salt")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	stored, err = database.GetKDFParamsFromVault("DefaultVault")
+	if err != nil {
+		t.Fatalf("Error reading KDF params: %v", err)
+	}
+	if stored != encryption.DefaultArgon2Params {
+		t.Errorf("Expected default params, got %+v", stored)
+	}
+
+	err = database.CreateVaultWithKDF("BadVault", "hashedKey", "salt", encryption.Argon2Params{})
+	if !errors.Is(err, encryption.ErrInvalidArgon2Params) {
+		t.Errorf("Expected ErrInvalidArgon2Params, got %v", err)
+	}
+}
+
+// TestVaultSearchPaths checks that vaults in additional search paths are listed and opened
+func TestVaultSearchPaths(t *testing.T) {
+	useTempVaultHome(t)
+
+	// Create a vault in another directory, then add that directory as a search path
+	otherDir := t.TempDir()
+	t.Setenv(config.EnvVaultDir, otherDir)
+	err := database.CreateVault("ElsewhereVault", "hashedKey", "salt")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(otherDir, "ElsewhereVault.sqlite")); err != nil {
+		t.Fatalf("Vault was not created in the configured directory: %v", err)
+	}
+	t.Setenv(config.EnvVaultDir, "")
+
+	cfg := config.Default()
+	cfg.SearchPaths = []string{otherDir}
+	config.SetCurrent(cfg)
+	t.Cleanup(func() { config.SetCurrent(nil) })
+
+	vaults, err := database.ListVaults()
+	if err != nil {
+		t.Fatalf("Error listing vaults: %v", err)
+	}
+	if len(vaults) != 1 || vaults[0] != "ElsewhereVault" {
+		t.Fatalf("Expected [ElsewhereVault], got %v", vaults)
+	}
+
+	db, err := database.InitDB("ElsewhereVault")
+	if err != nil {
+		t.Fatalf("Error opening vault from search path: %v", err)
+	}
+	_ = db.Close()
+}
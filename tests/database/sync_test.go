@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestSyncTracking checks new rows get UUIDs and every change moves them to a newer version
+func TestSyncTracking(t *testing.T) {
+	db := openTestVault(t, "Tracked")
+
+	vaultID, err := database.GetVaultID(db)
+	if err != nil || len(vaultID) != 36 {
+		t.Fatalf("Expected a vault UUID, got %q (%v)", vaultID, err)
+	}
+
+	id := storeTestEntry(t, db, "github.com", 0)
+	entry, err := database.GetEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+	if len(entry.UUID) != 36 || entry.UUID[14] != '4' || entry.ModifiedAt == "" || entry.Version == 0 {
+		t.Fatalf("Expected sync metadata on a new entry, got %+v", entry)
+	}
+	clock, err := database.GetVaultClock(db)
+	if err != nil || clock != entry.Version {
+		t.Errorf("Expected the clock to be at the entry's version %d, got %d (%v)", entry.Version, clock, err)
+	}
+
+	// Changes to the entry itself, its custom fields and its tags all bump its version
+	folder, err := database.CreateFolder(db, "Work", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	version := entry.Version
+	for _, step := range []struct {
+		name   string
+		change func() error
+	}{
+		{"moved", func() error { return database.MoveEntryToFolder(db, id, folder.ID) }},
+		{"tagged", func() error { return database.AddTagToEntry(db, id, "dev") }},
+		{"field", func() error {
+			_, err := database.AddCustomField(db, id, database.CustomFieldEntry{Name: "PIN", Type: database.FieldText, EncryptedValue: "1234"})
+			return err
+		}},
+		{"untagged", func() error { return database.RemoveTagFromEntry(db, id, "dev") }},
+	} {
+		name := step.name
+		if err := step.change(); err != nil {
+			t.Fatalf("Error applying change %s: %v", name, err)
+		}
+		changed, err := database.GetEntryFromID(db, id)
+		if err != nil {
+			t.Fatalf("Error fetching entry: %v", err)
+		}
+		if changed.Version <= version || changed.UUID != entry.UUID {
+			t.Errorf("Expected change %s to bump version %d keeping the UUID, got %+v", name, version, changed)
+		}
+		version = changed.Version
+	}
+
+	found, err := database.GetEntryByUUID(db, entry.UUID)
+	if err != nil || found.ID != id {
+		t.Errorf("Expected to find entry %d by UUID, got %v (%v)", id, found, err)
+	}
+	if _, err := database.GetEntryByUUID(db, "missing"); !errors.Is(err, database.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+// TestChangesSince checks the changes reported after a version, including deletions
+func TestChangesSince(t *testing.T) {
+	db := openTestVault(t, "Changes")
+	kept := storeTestEntry(t, db, "kept.example.com", 0)
+	deleted := storeTestEntry(t, db, "deleted.example.com", 0)
+	deletedEntry, err := database.GetEntryFromID(db, deleted)
+	if err != nil {
+		t.Fatalf("Error fetching entry: %v", err)
+	}
+
+	since, err := database.GetVaultClock(db)
+	if err != nil {
+		t.Fatalf("Error reading clock: %v", err)
+	}
+	changes, err := database.ChangesSince(db, since)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes since the current clock, got %v (%v)", changes, err)
+	}
+
+	folder, err := database.CreateFolder(db, "Personal", 0)
+	if err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+	if err := database.SetEntryTags(db, kept, []string{"home"}); err != nil {
+		t.Fatalf("Error tagging entry: %v", err)
+	}
+	if err := database.DeleteEntryFromID(db, deleted); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+
+	changes, err = database.ChangesSince(db, since)
+	if err != nil {
+		t.Fatalf("Error listing changes: %v", err)
+	}
+	kinds := make(map[database.ChangeKind]int)
+	for i, change := range changes {
+		if i > 0 && change.Version < changes[i-1].Version {
+			t.Errorf("Expected changes ordered by version, got %v", changes)
+		}
+		if change.Version <= since || change.UUID == "" || change.ModifiedAt.IsZero() {
+			t.Errorf("Unexpected change %+v", change)
+		}
+		kinds[change.Kind]++
+	}
+	if kinds[database.ChangeEntry] != 2 || kinds[database.ChangeFolder] != 1 || kinds[database.ChangeTag] != 1 {
+		t.Errorf("Expected 2 entry, 1 folder and 1 tag change, got %v", kinds)
+	}
+
+	// The deleted entry is reported last, as a tombstone with its UUID
+	last := changes[len(changes)-1]
+	if !last.Deleted || last.Kind != database.ChangeEntry || last.UUID != deletedEntry.UUID || last.ID != 0 {
+		t.Errorf("Expected a tombstone for the deleted entry, got %+v", last)
+	}
+
+	// Folder changes report the folder's UUID
+	stored, err := database.GetFolder(db, folder.ID)
+	if err != nil || stored.UUID == "" {
+		t.Fatalf("Expected the folder to have a UUID, got %v (%v)", stored, err)
+	}
+
+	clock, err := database.GetVaultClock(db)
+	if err != nil || clock != last.Version {
+		t.Errorf("Expected the clock at the latest change %d, got %d (%v)", last.Version, clock, err)
+	}
+}
+
+// TestSyncMetadataUnique checks every row gets its own UUID
+func TestSyncMetadataUnique(t *testing.T) {
+	db := openTestVault(t, "Unique")
+
+	seen := make(map[string]bool)
+	for _, service := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		entry, err := database.GetEntryFromID(db, storeTestEntry(t, db, service, 0))
+		if err != nil {
+			t.Fatalf("Error fetching entry: %v", err)
+		}
+		if seen[entry.UUID] || strings.ToLower(entry.UUID) != entry.UUID {
+			t.Errorf("Expected a new lowercase UUID, got %s", entry.UUID)
+		}
+		seen[entry.UUID] = true
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// TestEntryTags tests assigning, listing, and removing tags
+func TestEntryTags(t *testing.T) {
+	db := openTestVault(t, "TagVault")
+
+	github := storeTestEntry(t, db, "https://github.com", 0)
+	gitlab := storeTestEntry(t, db, "https://gitlab.com", 0)
+
+	for _, tag := range []string{"dev", "work"} {
+		if err := database.AddTagToEntry(db, github, tag); err != nil {
+			t.Fatalf("Error tagging entry: %v", err)
+		}
+	}
+	// Tags are case-insensitive and assigning twice is harmless
+	if err := database.AddTagToEntry(db, gitlab, "DEV"); err != nil {
+		t.Fatalf("Error tagging entry: %v", err)
+	}
+	if err := database.AddTagToEntry(db, gitlab, "dev"); err != nil {
+		t.Fatalf("Error re-tagging entry: %v", err)
+	}
+
+	tags, err := database.ListTags(db)
+	if err != nil {
+		t.Fatalf("Error listing tags: %v", err)
+	}
+	t.Logf("Tags: %v", tags)
+	if len(tags) != 2 {
+		t.Fatalf("Expected 2 tags, got %v", tags)
+	}
+
+	tagged, err := database.GetEntriesWithTag(db, "Dev")
+	if err != nil {
+		t.Fatalf("Error listing tagged entries: %v", err)
+	}
+	if len(tagged) != 2 {
+		t.Fatalf("Expected 2 entries tagged dev, got %d", len(tagged))
+	}
+
+	// Removing the last use of a tag removes the tag
+	if err := database.RemoveTagFromEntry(db, github, "work"); err != nil {
+		t.Fatalf("Error removing tag: %v", err)
+	}
+	tags, _ = database.ListTags(db)
+	if len(tags) != 1 {
+		t.Fatalf("Expected unused tag to be removed, got %v", tags)
+	}
+
+	// Replace tags and confirm deleting an entry drops its assignments
+	if err := database.SetEntryTags(db, github, []string{"personal", " "}); err != nil {
+		t.Fatalf("Error setting tags: %v", err)
+	}
+	entryTags, _ := database.GetTagsForEntry(db, github)
+	if len(entryTags) != 1 || entryTags[0] != "personal" {
+		t.Fatalf("Unexpected tags after SetEntryTags: %v", entryTags)
+	}
+
+	if err := database.DeleteEntryFromID(db, github); err != nil {
+		t.Fatalf("Error deleting entry: %v", err)
+	}
+	allTags, _ := database.GetAllEntryTags(db)
+	if _, ok := allTags[github]; ok {
+		t.Errorf("Deleted entry should have no tag assignments")
+	}
+}
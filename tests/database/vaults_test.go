@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// TestValidateVaultName checks which vault names are accepted
+func TestValidateVaultName(t *testing.T) {
+	valid := []string{"Personal", "Work Vault", "vault-2024_v1", "Ünïcödé", "my.vault"}
+	for _, name := range valid {
+		if err := database.ValidateVaultName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{
+		"", "   ", "../../x", "..", ".", "a/b", `a\b`, "C:vault", " padded", "padded ", ".hidden", "trailing.",
+		"CON", "nul", "com1.txt", "LPT9", "tab\tname", "what?", `quote"`, string(make([]rune, 65)),
+	}
+	for _, name := range invalid {
+		if err := database.ValidateVaultName(name); !errors.Is(err, database.ErrInvalidVaultName) {
+			t.Errorf("Expected %q to be rejected, got %v", name, err)
+		}
+	}
+}
+
+// TestCreateVaultRejectsUnsafeNames checks that vault names cannot escape the vault directory
+func TestCreateVaultRejectsUnsafeNames(t *testing.T) {
+	useTempVaultHome(t)
+
+	err := database.CreateVault("../../escaped", "hashedKey", "salt")
+	if !errors.Is(err, database.ErrInvalidVaultName) {
+		t.Fatalf("Expected ErrInvalidVaultName, got %v", err)
+	}
+	if _, err := database.InitDB("../escaped"); !errors.Is(err, database.ErrInvalidVaultName) {
+		t.Errorf("Expected InitDB to reject the name, got %v", err)
+	}
+	if path := database.GetDatabasePath("../escaped"); path != "" {
+		t.Errorf("Expected no path for an invalid name, got %q", path)
+	}
+}
+
+// TestCreateVaultDuplicate checks that creating an existing vault fails instead of reusing it
+func TestCreateVaultDuplicate(t *testing.T) {
+	useTempVaultHome(t)
+
+	err := database.CreateVault("Duplicate", "hashedKey1", "salt1")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	err = database.CreateVault("Duplicate", "hashedKey2", "salt2")
+	if !errors.Is(err, database.ErrVaultExists) {
+		t.Fatalf("Expected ErrVaultExists, got %v", err)
+	}
+
+	// The original vault is untouched
+	authenticated, err := database.AuthenticateVault("Duplicate", "hashedKey1")
+	if err != nil || !authenticated {
+		t.Errorf("Original vault was modified (authenticated=%v, err=%v)", authenticated, err)
+	}
+
+	if _, err := database.InitDB("Missing"); !errors.Is(err, database.ErrVaultNotFound) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrVaultNotFound for a missing vault, got %v", err)
+	}
+}
+
+// TestCreateVaultAt checks creating, listing, opening and deleting a vault at an explicit path
+func TestCreateVaultAt(t *testing.T) {
+	useTempVaultHome(t)
+
+	path := filepath.Join(t.TempDir(), "Portable.sqlite")
+	fast := encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+	vaultName, err := database.CreateVaultAt(path, "hashedKey", "salt", fast)
+	if err != nil {
+		t.Fatalf("Error creating vault at path: %v", err)
+	}
+	if vaultName != "Portable" {
+		t.Errorf("Expected vault name Portable, got %q", vaultName)
+	}
+
+	vaults, err := database.ListVaults()
+	if err != nil {
+		t.Fatalf("Error listing vaults: %v", err)
+	}
+	if len(vaults) != 1 || vaults[0] != "Portable" {
+		t.Errorf("Expected registered vault to be listed, got %v", vaults)
+	}
+
+	authenticated, err := database.AuthenticateVault("Portable", "hashedKey")
+	if err != nil || !authenticated {
+		t.Errorf("Could not authenticate registered vault (authenticated=%v, err=%v)", authenticated, err)
+	}
+
+	// A second vault with the same name elsewhere is rejected
+	if _, err := database.CreateVaultAt(filepath.Join(t.TempDir(), "Portable.sqlite"), "k", "s", fast); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists, got %v", err)
+	}
+	if err := database.CreateVault("Portable", "k", "s"); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists, got %v", err)
+	}
+
+	err = database.DeleteVault("Portable")
+	if err != nil {
+		t.Fatalf("Error deleting vault: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Vault file was not deleted")
+	}
+	registered, err := database.RegisteredVaults()
+	if err != nil || len(registered) != 0 {
+		t.Errorf("Deleted vault is still registered: %v (%v)", registered, err)
+	}
+}
+
+// TestVaultPathSpecialCharacters checks vault paths containing URI characters are opened as given
+func TestVaultPathSpecialCharacters(t *testing.T) {
+	useTempVaultHome(t)
+
+	dir := filepath.Join(t.TempDir(), "what?#100%25")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	path := filepath.Join(dir, "Special.sqlite")
+	fast := encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+	if _, err := database.CreateVaultAt(path, "hashedKey", "salt", fast); err != nil {
+		t.Fatalf("Error creating vault at path: %v", err)
+	}
+
+	// Nothing is created beside the directory under a truncated name
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the vault directory, got %v (%v)", entries, err)
+	}
+
+	db, err := database.OpenVaultFile(path)
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+	authenticated, err := database.AuthenticateVault("Special", "hashedKey")
+	if err != nil || !authenticated {
+		t.Errorf("Could not authenticate vault (authenticated=%v, err=%v)", authenticated, err)
+	}
+}
+
+// TestRegisterVault checks registering existing vault files
+func TestRegisterVault(t *testing.T) {
+	useTempVaultHome(t)
+
+	// Only vault files can be registered
+	notVault := filepath.Join(t.TempDir(), "notes.sqlite")
+	if err := os.WriteFile(notVault, []byte("not a database"), 0600); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	if err := database.RegisterVault("notes", notVault); !errors.Is(err, database.ErrNotVault) {
+		t.Errorf("Expected ErrNotVault, got %v", err)
+	}
+
+	// Create a vault in the vault directory, then register a copy under another name
+	err := database.CreateVault("Original", "hashedKey", "salt")
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	data, err := os.ReadFile(database.GetDatabasePath("Original"))
+	if err != nil {
+		t.Fatalf("Error reading vault: %v", err)
+	}
+	copyPath := filepath.Join(t.TempDir(), "copy.sqlite")
+	if err := os.WriteFile(copyPath, data, 0600); err != nil {
+		t.Fatalf("Error copying vault: %v", err)
+	}
+
+	if err := database.RegisterVault("Original", copyPath); !errors.Is(err, database.ErrVaultExists) {
+		t.Errorf("Expected ErrVaultExists registering a taken name, got %v", err)
+	}
+	if err := database.RegisterVault("Copy", copyPath); err != nil {
+		t.Fatalf("Error registering vault: %v", err)
+	}
+
+	// The copy still stores its original name, but unlocks under the registered one
+	authenticated, err := database.AuthenticateVault("Copy", "hashedKey")
+	if err != nil || !authenticated {
+		t.Errorf("Could not authenticate registered copy (authenticated=%v, err=%v)", authenticated, err)
+	}
+
+	if err := database.UnregisterVault("Copy"); err != nil {
+		t.Fatalf("Error unregistering vault: %v", err)
+	}
+	if _, err := os.Stat(copyPath); err != nil {
+		t.Errorf("Unregistering deleted the vault file: %v", err)
+	}
+	if err := database.UnregisterVault("Copy"); !errors.Is(err, database.ErrVaultNotFound) {
+		t.Errorf("Expected ErrVaultNotFound unregistering twice, got %v", err)
+	}
+}
@@ -1,8 +1,10 @@
 package tests
 
 import (
-	"github.com/cpainter1/PassLock/internal/encryption"
+	"errors"
 	"testing"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
 )
 
 func TestGenerateSalt(t *testing.T) {
@@ -72,3 +74,40 @@ func TestDeriveKey(t *testing.T) {
 	key4, _, _ := encryption.DeriveMasterKeys(password2, salt2)
 	t.Logf("DeriveMasterKeys 4 key: %x", key4)
 }
+
+// TestDeriveMasterKeysWithParams checks that the Argon2 parameters change the derived keys
+func TestDeriveMasterKeysWithParams(t *testing.T) {
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		t.Fatalf("GenerateSalt failed: %v", err)
+	}
+
+	fast := encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+	fastKey, _, err := encryption.DeriveMasterKeysWithParams("masterpassword", salt, fast)
+	if err != nil {
+		t.Fatalf("DeriveMasterKeysWithParams failed: %v", err)
+	}
+	defaultKey, _, err := encryption.DeriveMasterKeys("masterpassword", salt)
+	if err != nil {
+		t.Fatalf("DeriveMasterKeys failed: %v", err)
+	}
+	if fastKey == defaultKey {
+		t.Errorf("Different parameters derived the same key")
+	}
+
+	fast.KeyLen = 32
+	if _, _, err := encryption.DeriveMasterKeysWithParams("masterpassword", salt, fast); err == nil {
+		t.Errorf("Expected an error for a key too short to split")
+	}
+
+	// Costs above the limits are rejected before any memory is allocated
+	for _, params := range []encryption.Argon2Params{
+		{Time: encryption.MaxArgon2Time + 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64},
+		{Time: 1, Memory: encryption.MaxArgon2Memory + 1, Threads: 1, KeyLen: 64},
+		{Time: 1, Memory: 8 * 1024, Threads: encryption.MaxArgon2Threads + 1, KeyLen: 64},
+	} {
+		if _, _, err := encryption.DeriveMasterKeysWithParams("masterpassword", salt, params); !errors.Is(err, encryption.ErrInvalidArgon2Params) {
+			t.Errorf("Expected ErrInvalidArgon2Params for %+v, got %v", params, err)
+		}
+	}
+}
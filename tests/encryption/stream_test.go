@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// encryptStream encrypts plaintext with the streaming writer and returns the ciphertext
+func encryptStream(t *testing.T, plaintext []byte, key string, aad []byte) []byte {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	writer, err := encryption.NewEncryptWriter(&ciphertext, key, aad)
+	if err != nil {
+		t.Fatalf("NewEncryptWriter failed: %v", err)
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	return ciphertext.Bytes()
+}
+
+// decryptStream decrypts a whole stream
+func decryptStream(ciphertext []byte, key string, aad []byte) ([]byte, error) {
+	reader, err := encryption.NewDecryptReader(bytes.NewReader(ciphertext), key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	salt, _ := encryption.GenerateSalt(16)
+	key, _, _ := encryption.DeriveMasterKeys("streampassword", salt)
+
+	// Sizes around the chunk boundary are the interesting cases
+	sizes := []int{0, 1, encryption.StreamChunkSize - 1, encryption.StreamChunkSize,
+		encryption.StreamChunkSize + 1, 3*encryption.StreamChunkSize + 17}
+
+	for _, size := range sizes {
+		plaintext := make([]byte, size)
+		_, _ = rand.Read(plaintext)
+
+		ciphertext := encryptStream(t, plaintext, key, []byte("aad"))
+		decrypted, err := decryptStream(ciphertext, key, []byte("aad"))
+		if err != nil {
+			t.Fatalf("Decrypting %d bytes failed: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("Decrypted %d bytes do not match", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	salt, _ := encryption.GenerateSalt(16)
+	key, _, _ := encryption.DeriveMasterKeys("streampassword", salt)
+
+	plaintext := make([]byte, 2*encryption.StreamChunkSize+100)
+	_, _ = rand.Read(plaintext)
+	ciphertext := encryptStream(t, plaintext, key, []byte("attachment-1"))
+
+	// Flipping a bit fails authentication
+	tampered := bytes.Clone(ciphertext)
+	tampered[len(tampered)/2] ^= 1
+	if _, err := decryptStream(tampered, key, []byte("attachment-1")); !errors.Is(err, encryption.ErrStreamCorrupt) {
+		t.Errorf("Expected ErrStreamCorrupt for a flipped bit, got %v", err)
+	}
+
+	// Dropping the final chunk is detected as truncation
+	sealedChunk := encryption.StreamChunkSize + 16
+	truncated := ciphertext[:8+2*sealedChunk]
+	if _, err := decryptStream(truncated, key, []byte("attachment-1")); !errors.Is(err, encryption.ErrStreamTruncated) {
+		t.Errorf("Expected ErrStreamTruncated, got %v", err)
+	}
+
+	// Swapping two chunks fails authentication
+	swapped := bytes.Clone(ciphertext)
+	copy(swapped[8:], ciphertext[8+sealedChunk:8+2*sealedChunk])
+	copy(swapped[8+sealedChunk:], ciphertext[8:8+sealedChunk])
+	if _, err := decryptStream(swapped, key, []byte("attachment-1")); !errors.Is(err, encryption.ErrStreamCorrupt) {
+		t.Errorf("Expected ErrStreamCorrupt for reordered chunks, got %v", err)
+	}
+
+	// Associated data binds the stream to its owner
+	if _, err := decryptStream(ciphertext, key, []byte("attachment-2")); !errors.Is(err, encryption.ErrStreamCorrupt) {
+		t.Errorf("Expected ErrStreamCorrupt for the wrong associated data, got %v", err)
+	}
+
+	if _, err := decryptStream(ciphertext[:3], key, nil); !errors.Is(err, encryption.ErrStreamHeader) {
+		t.Errorf("Expected ErrStreamHeader, got %v", err)
+	}
+}
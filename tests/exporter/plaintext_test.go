@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/exporter"
+)
+
+// fastKDF keeps key derivation quick in tests
+var fastKDF = encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+
+// createExportVault creates a vault protected by password under a temporary home, filled with two entries
+func createExportVault(t *testing.T, password string) (*sql.DB, string) {
+	t.Helper()
+	t.Setenv(config.EnvHome, t.TempDir())
+	t.Setenv(config.EnvConfig, "")
+	t.Setenv(config.EnvVaultDir, "")
+
+	keys, err := database.DeriveVaultKeys(password, fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	err = database.CreateVaultWithKDF("Exported", keys.AuthKey, keys.Salt, keys.KDF)
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	db, err := database.InitDB("Exported")
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	_, err = database.ImportEntries(db, keys.EncryptionKey, []database.ImportRecord{
+		{
+			Service:     "github.com",
+			Username:    "octocat",
+			Password:    "pw1",
+			Notes:       "line one\nline two",
+			Folder:      []string{"Work", "Dev"},
+			Tags:        []string{"dev", "work"},
+			Fields:      []database.ImportField{{Name: "URL", Type: database.FieldURL, Value: "https://github.com/login"}, {Name: "TOTP", Type: database.FieldHidden, Value: "JBSWY3DP"}},
+			Attachments: []database.ImportAttachment{{Name: "key.txt", Data: []byte("secret file")}},
+		},
+		{Service: "Alarm", Password: "code 42", EntryType: database.EntrySecureNote},
+	})
+	if err != nil {
+		t.Fatalf("Error filling vault: %v", err)
+	}
+
+	return db, keys.EncryptionKey
+}
+
+// privateDir returns a temporary directory only its owner can read
+func privateDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatalf("Error restricting directory: %v", err)
+	}
+	return dir
+}
+
+// TestExportPlaintextJSON checks the JSON structure, file permissions and the export record
+func TestExportPlaintextJSON(t *testing.T) {
+	db, key := createExportVault(t, "correct horse")
+	path := filepath.Join(privateDir(t), "vault.json")
+
+	count, err := exporter.ExportPlaintext(db, key, "correct horse", path, exporter.PlaintextJSON, false)
+	if err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 entries, got %d", count)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading export: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(path)
+	var vault struct {
+		Vault   string     `json:"vault"`
+		Folders [][]string `json:"folders"`
+		Entries []struct {
+			Type        string   `json:"type"`
+			Service     string   `json:"service"`
+			Password    string   `json:"password"`
+			Notes       string   `json:"notes"`
+			Folder      []string `json:"folder"`
+			Tags        []string `json:"tags"`
+			Fields      []struct{ Name, Type, Value string }
+			Attachments []struct {
+				Name string `json:"name"`
+				Data []byte `json:"data"`
+			} `json:"attachments"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &vault); err != nil {
+		t.Fatalf("Error decoding export: %v", err)
+	}
+	if vault.Vault != "Exported" || len(vault.Folders) != 2 || len(vault.Entries) != 2 {
+		t.Fatalf("Unexpected export %+v", vault)
+	}
+
+	byService := make(map[string]int)
+	for i, entry := range vault.Entries {
+		byService[entry.Service] = i
+	}
+	login := vault.Entries[byService["github.com"]]
+	if login.Password != "pw1" || login.Notes != "line one\nline two" || len(login.Folder) != 2 || len(login.Tags) != 2 ||
+		len(login.Fields) != 2 || len(login.Attachments) != 1 || string(login.Attachments[0].Data) != "secret file" {
+		t.Errorf("Unexpected login %+v", login)
+	}
+	if note := vault.Entries[byService["Alarm"]]; note.Type != string(database.EntrySecureNote) || note.Password != "code 42" {
+		t.Errorf("Unexpected note %+v", note)
+	}
+
+	exports, err := database.ListPlaintextExports(db)
+	if err != nil {
+		t.Fatalf("Error listing exports: %v", err)
+	}
+	if len(exports) != 1 || exports[0].Format != "json" || exports[0].Path != path || exports[0].Entries != 2 {
+		t.Errorf("Unexpected export records %+v", exports)
+	}
+}
+
+// TestExportPlaintextCSV checks the interchange columns
+func TestExportPlaintextCSV(t *testing.T) {
+	db, key := createExportVault(t, "correct horse")
+	path := filepath.Join(privateDir(t), "vault.csv")
+
+	_, err := exporter.ExportPlaintext(db, key, "correct horse", path, exporter.PlaintextCSV, false)
+	if err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening export: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "title" {
+		t.Fatalf("Unexpected rows %v", rows)
+	}
+
+	for _, row := range rows[1:] {
+		if row[0] != "github.com" {
+			continue
+		}
+		want := []string{"github.com", "https://github.com/login", "octocat", "pw1", "line one\nline two", "Work/Dev", "dev,work", "JBSWY3DP"}
+		for i := range want {
+			if row[i] != want[i] {
+				t.Errorf("Column %s: expected %q, got %q", rows[0][i], want[i], row[i])
+			}
+		}
+	}
+}
+
+// TestExportPlaintextSafeguards checks the master password and location checks
+func TestExportPlaintextSafeguards(t *testing.T) {
+	db, key := createExportVault(t, "correct horse")
+	dir := privateDir(t)
+
+	_, err := exporter.ExportPlaintext(db, key, "wrong", filepath.Join(dir, "vault.json"), exporter.PlaintextJSON, false)
+	if !errors.Is(err, database.ErrWrongMasterPassword) {
+		t.Errorf("Expected ErrWrongMasterPassword, got %v", err)
+	}
+
+	_, err = exporter.ExportPlaintext(db, key, "correct horse", filepath.Join(dir, "vault.xml"), "xml", false)
+	if !errors.Is(err, exporter.ErrUnknownPlaintextFormat) {
+		t.Errorf("Expected ErrUnknownPlaintextFormat, got %v", err)
+	}
+
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	_ = os.Chmod(shared, 0o755)
+	path := filepath.Join(shared, "vault.json")
+
+	_, err = exporter.ExportPlaintext(db, key, "correct horse", path, exporter.PlaintextJSON, false)
+	if !errors.Is(err, exporter.ErrWorldReadable) {
+		t.Errorf("Expected ErrWorldReadable, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written, got %v", err)
+	}
+
+	_, err = exporter.ExportPlaintext(db, key, "correct horse", path, exporter.PlaintextJSON, true)
+	if err != nil {
+		t.Fatalf("Error exporting with force: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a 0600 file, got %v %v", info, err)
+	}
+
+	exports, _ := database.ListPlaintextExports(db)
+	if len(exports) != 1 {
+		t.Errorf("Expected only the successful export to be recorded, got %d", len(exports))
+	}
+}
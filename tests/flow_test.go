@@ -48,7 +48,7 @@ func TestFullEncryptionFlow(t *testing.T) {
 		EncryptedNotes:    encryptedNotes,
 	}
 
-	db, err := database.InitDB("TestingVault")
+	db, err := database.OpenMemoryDB()
 	if err != nil {
 		t.Errorf("Error connecting to database: %v", err)
 	}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/health"
+)
+
+// breachedPasswords are the passwords written to the test datasets with their counts
+var breachedPasswords = map[string]int{"password": 9545824, "Summer2024!": 312, "correct horse battery staple": 3}
+
+// breachFillers is the number of other hashes in the test datasets, enough for the single file to be bisected
+const breachFillers = 3000
+
+// breachHash returns the uppercase SHA-1 hash the breach datasets use
+func breachHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// breachLines returns sorted "HASH:COUNT" lines for the breached passwords and many filler hashes
+func breachLines() []string {
+	lines := make([]string, 0, len(breachedPasswords)+breachFillers)
+	for password, count := range breachedPasswords {
+		lines = append(lines, fmt.Sprintf("%s:%d", breachHash(password), count))
+	}
+	for i := range breachFillers {
+		lines = append(lines, fmt.Sprintf("%s:%d", breachHash(fmt.Sprintf("filler-%d", i)), i%50+1))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// writeBreachFile writes the lines as a single sorted file with Windows line endings like the HIBP download
+func writeBreachFile(t *testing.T, lines []string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600); err != nil {
+		t.Fatalf("Error writing breach file: %v", err)
+	}
+	return path
+}
+
+// writeBreachDirectory writes the lines as range files named by their hash prefix
+func writeBreachDirectory(t *testing.T, lines []string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	ranges := make(map[string][]string)
+	for _, line := range lines {
+		ranges[line[:5]] = append(ranges[line[:5]], line[5:])
+	}
+	for prefix, suffixes := range ranges {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(suffixes, "\n")), 0600); err != nil {
+			t.Fatalf("Error writing breach range: %v", err)
+		}
+	}
+	return dir
+}
+
+// TestBreachCount checks breached passwords are found in both dataset layouts and others are not
+func TestBreachCount(t *testing.T) {
+	lines := breachLines()
+	fillers := make(map[string]struct {
+		password string
+		count    int
+	})
+	for i := range breachFillers {
+		password := fmt.Sprintf("filler-%d", i)
+		fillers[breachHash(password)] = struct {
+			password string
+			count    int
+		}{password, i%50 + 1}
+	}
+
+	for layout, path := range map[string]string{"file": writeBreachFile(t, lines), "directory": writeBreachDirectory(t, lines)} {
+		data, err := health.OpenBreachData(path)
+		if err != nil {
+			t.Fatalf("Error opening %s: %v", layout, err)
+		}
+
+		for password, expected := range breachedPasswords {
+			count, err := data.BreachCount(password)
+			if err != nil || count != expected {
+				t.Errorf("Expected %q to be found %d times in the %s, got %d (%v)", password, expected, layout, count, err)
+			}
+		}
+		// The first and last lines are found as well
+		for _, line := range []string{lines[0], lines[len(lines)-1]} {
+			filler := fillers[line[:40]]
+			if count, err := data.BreachCount(filler.password); err != nil || count != filler.count {
+				t.Errorf("Expected line %s to be found in the %s, got %d (%v)", line, layout, count, err)
+			}
+		}
+		for _, password := range []string{"xK9#mP2$vL7q-Zr4", "", "not breached"} {
+			if count, err := data.BreachCount(password); err != nil || count != 0 {
+				t.Errorf("Expected %q not to be found in the %s, got %d (%v)", password, layout, count, err)
+			}
+		}
+
+		if err := data.Close(); err != nil {
+			t.Errorf("Error closing %s: %v", layout, err)
+		}
+	}
+
+	if _, err := health.OpenBreachData(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing dataset to fail, got %v", err)
+	}
+}
+
+// TestBreachCountInvalid checks a file that is not a breach dataset is rejected
+func TestBreachCountInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("not a hash list at all ", 1000)), 0600); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	data, err := health.OpenBreachData(path)
+	if err != nil {
+		t.Fatalf("Error opening file: %v", err)
+	}
+	defer func(data *health.BreachData) {
+		_ = data.Close()
+	}(data)
+
+	if _, err := data.BreachCount("password"); !errors.Is(err, health.ErrBreachData) {
+		t.Errorf("Expected ErrBreachData, got %v", err)
+	}
+}
+
+// TestBuildReportBreaches checks breached passwords are flagged first in the health report
+func TestBuildReportBreaches(t *testing.T) {
+	useTempHome(t)
+	db, key := createHealthVault(t, "Breached", []database.ImportRecord{
+		{Service: "shop.example.com", Password: "correct horse battery staple", Tags: []string{"2fa"}},
+		{Service: "bank.example.com", Password: "Wq8@zN3!pT6&hY1a", Tags: []string{"2fa"}},
+	})
+	data, err := health.OpenBreachData(writeBreachFile(t, breachLines()))
+	if err != nil {
+		t.Fatalf("Error opening breach data: %v", err)
+	}
+	defer func(data *health.BreachData) {
+		_ = data.Close()
+	}(data)
+
+	report, err := health.BuildReport(db, key, health.Options{Breaches: data})
+	if err != nil {
+		t.Fatalf("Error building report: %v", err)
+	}
+	if len(report.Entries) != 1 || report.Counts[health.IssueBreached] != 1 {
+		t.Fatalf("Expected one breached entry, got %+v", report.Entries)
+	}
+	if entry := report.Entries[0]; entry.Service != "shop.example.com" || entry.Breaches != 3 || !slices.Equal(entry.Issues, []health.Issue{health.IssueBreached}) {
+		t.Errorf("Unexpected breached entry %+v", entry)
+	}
+}
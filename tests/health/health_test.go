@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/health"
+)
+
+// fastKDF keeps key derivation quick in tests
+var fastKDF = encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+
+// createHealthVault creates a vault under the current temporary home filled with records
+func createHealthVault(t *testing.T, vaultName string, records []database.ImportRecord) (*sql.DB, string) {
+	t.Helper()
+
+	keys, err := database.DeriveVaultKeys("health password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	err = database.CreateVaultWithKDF(vaultName, keys.AuthKey, keys.Salt, keys.KDF)
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	db, err := database.InitDB(vaultName)
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	_, err = database.ImportEntries(db, keys.EncryptionKey, records)
+	if err != nil {
+		t.Fatalf("Error filling vault: %v", err)
+	}
+
+	return db, keys.EncryptionKey
+}
+
+// useTempHome points the vault directory at a temporary directory for the rest of the test
+func useTempHome(t *testing.T) {
+	t.Helper()
+	t.Setenv(config.EnvHome, t.TempDir())
+	t.Setenv(config.EnvConfig, "")
+	t.Setenv(config.EnvVaultDir, "")
+}
+
+// findEntry returns the report of the entry for service, or nil if it has no issues
+func findEntry(report *health.Report, service string) *health.EntryReport {
+	for _, entry := range report.Entries {
+		if entry.Service == service {
+			return entry
+		}
+	}
+	return nil
+}
+
+// TestEstimateStrength checks common, patterned and random passwords are rated as expected
+func TestEstimateStrength(t *testing.T) {
+	for _, test := range []struct {
+		password string
+		min, max health.Strength
+	}{
+		{"", health.StrengthVeryWeak, health.StrengthVeryWeak},
+		{"password", health.StrengthVeryWeak, health.StrengthVeryWeak},
+		{"P@ssw0rd1!", health.StrengthVeryWeak, health.StrengthWeak},
+		{"Summer2024", health.StrengthVeryWeak, health.StrengthWeak},
+		{"aaaaaaaaaaaaaaaa", health.StrengthVeryWeak, health.StrengthWeak},
+		{"abcdefghijklmnop", health.StrengthVeryWeak, health.StrengthWeak},
+		{"xK9#mP2$vL7q", health.StrengthStrong, health.StrengthVeryStrong},
+		{"correct horse battery staple", health.StrengthVeryStrong, health.StrengthVeryStrong},
+	} {
+		strength := health.EstimateStrength(test.password)
+		if strength < test.min || strength > test.max {
+			t.Errorf("Expected %q to be rated %s to %s, got %s (%.1f bits)",
+				test.password, test.min, test.max, strength, health.EstimateEntropy(test.password))
+		}
+	}
+}
+
+// TestBuildReport checks every kind of issue is found and the report never contains passwords
+func TestBuildReport(t *testing.T) {
+	useTempHome(t)
+	totp := database.ImportField{Name: "TOTP", Type: database.FieldHidden, Value: "otpauth://totp/GitHub?secret=JBSWY3DP"}
+	db, key := createHealthVault(t, "Health", []database.ImportRecord{
+		{Service: "github.com", Username: "octocat", Password: "xK9#mP2$vL7q-Zr4", Fields: []database.ImportField{totp}},
+		{Service: "shop.example.com", Username: "me", Password: "Summer2024!", Tags: []string{"2fa"}},
+		{Service: "forum.example.com", Username: "me", Password: "Summer2024!", Tags: []string{"2fa"}},
+		{Service: "bank.example.com", Password: "Wq8@zN3!pT6&hY1a", Tags: []string{"2FA"}},
+		{Service: "mail.example.com", Password: "Wq8@zN3!pT6&hY1b", Tags: []string{"MFA"}},
+		{Service: "http://router.local", Password: "Gj5%uE2^kB9*sD4f", Tags: []string{"2fa"}},
+		{Service: "legacy.example.com", Password: "Rf3!cV8@nM2#xL6w", Fields: []database.ImportField{
+			{Name: "URL", Type: database.FieldURL, Value: "http://legacy.example.com/login"}, totp,
+		}},
+		{Service: "old.example.com", Password: "Hs7&dK1!qP4@wZ9e", Fields: []database.ImportField{totp}},
+		{Service: "news.example.com", Password: "Tb2^yH8&kN5!cF3j"},
+		{Service: "Alarm", Password: "1234", EntryType: database.EntrySecureNote},
+	})
+	changedAt := time.Now().UTC().AddDate(0, 0, -400).Format("2006-01-02T15:04:05.000Z")
+	if _, err := db.Exec("UPDATE passwords SET password_changed_at = ? WHERE service = 'old.example.com';", changedAt); err != nil {
+		t.Fatalf("Error aging password: %v", err)
+	}
+
+	report, err := health.BuildReport(db, key, health.Options{MaxAgeDays: health.DefaultMaxAgeDays})
+	if err != nil {
+		t.Fatalf("Error building report: %v", err)
+	}
+	if report.Checked != 9 {
+		t.Errorf("Expected 9 passwords checked (not the note), got %d", report.Checked)
+	}
+	if findEntry(report, "github.com") != nil || findEntry(report, "Alarm") != nil {
+		t.Errorf("Expected no issues for a strong unique password with 2FA or for notes, got %+v", report.Entries)
+	}
+
+	for service, expected := range map[string][]health.Issue{
+		"shop.example.com":    {health.IssueWeak, health.IssueReused},
+		"bank.example.com":    {health.IssueSimilar},
+		"http://router.local": {health.IssueInsecure},
+		"legacy.example.com":  {health.IssueInsecure},
+		"old.example.com":     {health.IssueOld},
+		"news.example.com":    {health.IssueNo2FA},
+	} {
+		entry := findEntry(report, service)
+		if entry == nil || !slices.Equal(entry.Issues, expected) {
+			t.Errorf("Expected %s to have issues %v, got %+v", service, expected, entry)
+		}
+	}
+	if shop := findEntry(report, "shop.example.com"); shop != nil && !slices.Equal(shop.ReusedWith, []string{"forum.example.com (me)"}) {
+		t.Errorf("Expected the reused password to name the other entry, got %v", shop.ReusedWith)
+	}
+	if old := findEntry(report, "old.example.com"); old != nil && old.AgeDays < 399 {
+		t.Errorf("Expected the password age in days, got %d", old.AgeDays)
+	}
+	if report.Counts[health.IssueReused] != 2 || report.Counts[health.IssueSimilar] != 2 {
+		t.Errorf("Unexpected issue counts %v", report.Counts)
+	}
+	if report.Score <= 0 || report.Score >= 100 {
+		t.Errorf("Expected a score between 0 and 100, got %d", report.Score)
+	}
+	if first := report.Entries[0]; first.Service != "shop.example.com" && first.Service != "forum.example.com" {
+		t.Errorf("Expected the worst entries first, got %s", first.Service)
+	}
+
+	var data bytes.Buffer
+	if err := report.WriteJSON(&data); err != nil {
+		t.Fatalf("Error writing JSON: %v", err)
+	}
+	for _, secret := range []string{"Summer2024!", "xK9#mP2$vL7q", "JBSWY3DP"} {
+		if strings.Contains(data.String(), secret) {
+			t.Errorf("Expected the JSON report to leave out secrets, found %q", secret)
+		}
+	}
+	if !strings.Contains(data.String(), `"score"`) || !strings.Contains(data.String(), `"reused"`) {
+		t.Errorf("Expected the score and issues in the JSON report, got %s", data.String())
+	}
+}
+
+// TestBuildReportAcrossVaults checks reuse is found in other unlocked vaults
+func TestBuildReportAcrossVaults(t *testing.T) {
+	useTempHome(t)
+	twoFactor := []string{"2fa"}
+	db, key := createHealthVault(t, "Personal", []database.ImportRecord{
+		{Service: "home.example.com", Password: "Lp4$wQ9!zR2&mT7x", Tags: twoFactor},
+	})
+	other, otherKey := createHealthVault(t, "Work", []database.ImportRecord{
+		{Service: "work.example.com", Username: "jdoe", Password: "Lp4$wQ9!zR2&mT7x", Tags: twoFactor},
+	})
+
+	report, err := health.BuildReport(db, key, health.Options{})
+	if err != nil || len(report.Entries) != 0 || report.Score != 100 {
+		t.Fatalf("Expected a healthy vault on its own, got %+v (%v)", report, err)
+	}
+
+	report, err = health.BuildReport(db, key, health.Options{Others: []health.Source{{Name: "Work", DB: other, EncryptionKey: otherKey}}})
+	if err != nil {
+		t.Fatalf("Error building report: %v", err)
+	}
+	if len(report.Entries) != 1 || !slices.Equal(report.Entries[0].ReusedWith, []string{"Work: work.example.com (jdoe)"}) {
+		t.Errorf("Expected the password to be reused in the other vault, got %+v", report.Entries)
+	}
+	if report.Checked != 1 {
+		t.Errorf("Expected only this vault's entries to be counted, got %d", report.Checked)
+	}
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/importer"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHKey returns a PEM private key and its authorized_keys public key
+func testSSHKey(t *testing.T) (string, string) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatalf("Error encoding key: %v", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatalf("Error encoding public key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(block)), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublic)))
+}
+
+// bitwardenExport returns an unencrypted Bitwarden export with one item of every type
+func bitwardenExport(t *testing.T) []byte {
+	t.Helper()
+
+	privateKey, publicKey := testSSHKey(t)
+	export := map[string]any{
+		"encrypted": false,
+		"folders":   []any{map[string]any{"id": "f1", "name": "Work/Dev"}},
+		"items": []any{
+			map[string]any{
+				"type": 1, "name": "GitHub", "folderId": "f1", "notes": "my notes", "revisionDate": "2024-03-01T10:00:00.000Z",
+				"login": map[string]any{
+					"uris":     []any{map[string]any{"uri": "https://github.com/login"}, map[string]any{"uri": "https://gist.github.com"}},
+					"username": "octocat", "password": "current", "totp": "JBSWY3DP", "passwordRevisionDate": "2024-02-01T09:30:00.000Z",
+					"fido2Credentials": []any{map[string]any{"credentialId": "x"}},
+				},
+				"fields": []any{
+					map[string]any{"name": "PIN", "value": "1234", "type": 1},
+					map[string]any{"name": "Admin", "value": "true", "type": 2},
+					map[string]any{"name": "Linked", "value": nil, "type": 3, "linkedId": 100},
+				},
+				"passwordHistory": []any{map[string]any{"lastUsedDate": "2023-05-01T12:00:00.000Z", "password": "old"}},
+			},
+			map[string]any{"type": 2, "name": "Alarm", "notes": "code 42", "revisionDate": "2024-04-01T00:00:00.000Z",
+				"secureNote": map[string]any{"type": 0}},
+			map[string]any{"type": 3, "name": "Visa", "card": map[string]any{
+				"cardholderName": "Jane Doe", "brand": "Visa", "number": "4111111111111111",
+				"expMonth": "3", "expYear": "2030", "code": "123"}},
+			map[string]any{"type": 3, "name": "Broken card", "card": map[string]any{"number": "1234"}},
+			map[string]any{"type": 4, "name": "Me", "identity": map[string]any{
+				"firstName": "Jane", "lastName": "Doe", "email": "jane@example.com", "address1": "1 Main St",
+				"city": "Springfield", "state": "IL", "postalCode": "12345", "country": "US", "ssn": "000-00-0000"}},
+			map[string]any{"type": 5, "name": "Server", "sshKey": map[string]any{
+				"privateKey": privateKey, "publicKey": publicKey, "keyFingerprint": "SHA256:abc"}},
+			map[string]any{"type": 9, "name": "Unknown"},
+		},
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("Error encoding export: %v", err)
+	}
+	return data
+}
+
+// encryptBitwardenExport wraps an export the way Bitwarden's password protected export does (PBKDF2)
+func encryptBitwardenExport(t *testing.T, data []byte, password string) []byte {
+	t.Helper()
+
+	salt := "c2FsdHNhbHRzYWx0c2FsdA=="
+	key, err := pbkdf2.Key(sha256.New, password, []byte(salt), 1000, 32)
+	if err != nil {
+		t.Fatalf("Error deriving key: %v", err)
+	}
+	encKey, _ := hkdf.Expand(sha256.New, key, "enc", 32)
+	macKey, _ := hkdf.Expand(sha256.New, key, "mac", 32)
+
+	encrypt := func(plaintext []byte) string {
+		block, _ := aes.NewCipher(encKey)
+		iv := make([]byte, aes.BlockSize)
+		_, _ = rand.Read(iv)
+		padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+		padded := append(bytes.Clone(plaintext), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write(iv)
+		mac.Write(padded)
+		return "2." + base64.StdEncoding.EncodeToString(iv) + "|" + base64.StdEncoding.EncodeToString(padded) +
+			"|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	wrapped, err := json.Marshal(map[string]any{
+		"encrypted": true, "passwordProtected": true, "salt": salt, "kdfType": 0, "kdfIterations": 1000,
+		"encKeyValidation_DO_NOT_EDIT": encrypt([]byte("validation")), "data": encrypt(data),
+	})
+	if err != nil {
+		t.Fatalf("Error encoding export: %v", err)
+	}
+	return wrapped
+}
+
+// recordFields returns the fields of a record by name
+func recordFields(record database.ImportRecord) map[string]database.ImportField {
+	fields := make(map[string]database.ImportField)
+	for _, field := range record.Fields {
+		fields[field.Name] = field
+	}
+	return fields
+}
+
+// TestParseBitwardenJSON checks the mapping of every Bitwarden item type and the warnings
+func TestParseBitwardenJSON(t *testing.T) {
+	result, err := importer.ParseBitwardenJSON(bytes.NewReader(bitwardenExport(t)), "")
+	if err != nil {
+		t.Fatalf("Error parsing export: %v", err)
+	}
+	if result.Format != importer.FormatBitwardenJSON || len(result.Records) != 6 || len(result.Skipped) != 1 {
+		t.Fatalf("Unexpected result: %d records, skipped %v", len(result.Records), result.Skipped)
+	}
+
+	login := result.Records[0]
+	fields := recordFields(login)
+	if login.Service != "github.com" || strings.Join(login.Folder, "/") != "Work/Dev" || login.Password != "current" {
+		t.Errorf("Unexpected login %+v", login)
+	}
+	if fields["Title"].Value != "GitHub" || fields["URL"].Value != "https://github.com/login" ||
+		fields["URL 2"].Value != "https://gist.github.com" || fields["TOTP"].Type != database.FieldHidden ||
+		fields["PIN"].Type != database.FieldHidden || fields["Admin"].Value != "true" ||
+		fields["Previous password (2023-05-01)"].Value != "old" {
+		t.Errorf("Unexpected login fields %+v", login.Fields)
+	}
+	if !login.ChangedAt.Equal(time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected the login's password revision date, got %v", login.ChangedAt)
+	}
+
+	note := result.Records[1]
+	if note.EntryType != database.EntrySecureNote || note.Password != "code 42" || note.Notes != "" {
+		t.Errorf("Unexpected note %+v", note)
+	}
+	if !note.ChangedAt.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the note's revision date, got %v", note.ChangedAt)
+	}
+
+	card := result.Records[2]
+	fields = recordFields(card)
+	if card.EntryType != database.EntryCard || card.Username != "Jane Doe" || fields["Expiry (MM/YY)"].Value != "03/30" ||
+		fields["Security code"].Value != "123" || fields["Brand"].Value != "Visa" {
+		t.Errorf("Unexpected card %+v", card)
+	}
+	if result.Records[3].EntryType != database.EntryLogin {
+		t.Errorf("Expected the invalid card to be imported as a login, got %s", result.Records[3].EntryType)
+	}
+
+	identity := result.Records[4]
+	fields = recordFields(identity)
+	if identity.EntryType != database.EntryIdentity || identity.Username != "Jane Doe" || fields["Email"].Type != database.FieldEmail ||
+		fields["Address"].Value != "1 Main St" || fields["State"].Value != "IL" || fields["ID number"].Value != "000-00-0000" {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+
+	key := result.Records[5]
+	if key.EntryType != database.EntrySSHKey || !strings.Contains(key.Password, "PRIVATE KEY") || recordFields(key)["Fingerprint"].Value != "SHA256:abc" {
+		t.Errorf("Unexpected SSH key %+v", key)
+	}
+
+	var messages []string
+	for _, warning := range result.Warnings {
+		messages = append(messages, warning.Item+": "+warning.Message)
+	}
+	joined := strings.Join(messages, "\n")
+	if !strings.Contains(joined, "GitHub: passkeys") || !strings.Contains(joined, `linked field "Linked"`) ||
+		!strings.Contains(joined, "Broken card: imported as a login") {
+		t.Errorf("Unexpected warnings:\n%s", joined)
+	}
+}
+
+// TestParseBitwardenJSONEncrypted checks password protected exports
+func TestParseBitwardenJSONEncrypted(t *testing.T) {
+	encrypted := encryptBitwardenExport(t, bitwardenExport(t), "hunter2")
+
+	result, err := importer.ParseBitwardenJSON(bytes.NewReader(encrypted), "hunter2")
+	if err != nil {
+		t.Fatalf("Error parsing encrypted export: %v", err)
+	}
+	if len(result.Records) != 6 {
+		t.Errorf("Expected 6 records, got %d", len(result.Records))
+	}
+
+	if _, err := importer.ParseBitwardenJSON(bytes.NewReader(encrypted), "wrong"); !errors.Is(err, importer.ErrBitwardenPassword) {
+		t.Errorf("Expected ErrBitwardenPassword, got %v", err)
+	}
+
+	accountEncrypted := `{"encrypted": true, "encKeyValidation_DO_NOT_EDIT": "2.a|b|c", "folders": [], "items": []}`
+	if _, err := importer.ParseBitwardenJSON(strings.NewReader(accountEncrypted), ""); !errors.Is(err, importer.ErrBitwardenAccountKey) {
+		t.Errorf("Expected ErrBitwardenAccountKey, got %v", err)
+	}
+	if _, err := importer.ParseBitwardenJSON(strings.NewReader(`{"hello": 1}`), ""); !errors.Is(err, importer.ErrNotBitwardenJSON) {
+		t.Errorf("Expected ErrNotBitwardenJSON, got %v", err)
+	}
+}
+
+// TestImportBitwardenJSON checks that typed entries are stored and read back by their schema
+func TestImportBitwardenJSON(t *testing.T) {
+	db, key := openImportVault(t)
+
+	result, err := importer.ImportBitwardenJSON(db, key, bytes.NewReader(bitwardenExport(t)), "", false)
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if result.Imported != 6 || result.FoldersCreated != 2 {
+		t.Errorf("Expected 6 entries and 2 folders, got %d and %d", result.Imported, result.FoldersCreated)
+	}
+
+	entries, err := database.GetAllEntries(db)
+	if err != nil {
+		t.Fatalf("Error listing entries: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Service == "github.com" && entry.PasswordChangedAt != "2024-02-01T09:30:00.000Z" {
+			t.Errorf("Expected the imported password change date, got %q", entry.PasswordChangedAt)
+		}
+	}
+	for _, entry := range entries {
+		if entry.EntryType != database.EntryCard || entry.Service != "Visa" {
+			continue
+		}
+		typed, err := database.GetTypedEntry(db, key, entry.ID)
+		if err != nil {
+			t.Fatalf("Error reading card: %v", err)
+		}
+		if typed.Secret != "4111111111111111" || typed.Fields["expiry"] != "03/30" || database.ValidateTypedEntry(typed) != nil {
+			t.Errorf("Unexpected stored card %+v", typed)
+		}
+		return
+	}
+	t.Errorf("Card entry was not imported")
+}
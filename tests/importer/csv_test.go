@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/importer"
+)
+
+// TestDetectCSVFormats checks that each supported application's header row is recognized
+func TestDetectCSVFormats(t *testing.T) {
+	tests := []struct {
+		format importer.Format
+		csv    string
+	}{
+		{importer.FormatChrome, "name,url,username,password,note\nGitHub,https://github.com/login,octocat,pw,\n"},
+		{importer.FormatFirefox, `"url","username","password","httpRealm","formActionOrigin","guid","timeCreated","timeLastUsed","timePasswordChanged"` + "\n" +
+			`"https://github.com","octocat","pw",,"https://github.com","{1}","1","1","1"` + "\n"},
+		{importer.FormatBitwarden, "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+			"Work,,login,GitHub,,,0,https://github.com,octocat,pw,\n"},
+		{importer.FormatLastPass, "url,username,password,totp,extra,name,grouping,fav\nhttps://github.com,octocat,pw,,,GitHub,Work,0\n"},
+		{importer.Format1Password, `"Title","Url","Username","Password","OTPAuth","Favorite","Archived","Tags","Notes"` + "\n" +
+			`"GitHub","https://github.com","octocat","pw","","false","false","",""` + "\n"},
+		{importer.FormatKeePassXC, `"Group","Title","Username","Password","URL","Notes","TOTP","Icon","Last Modified","Created"` + "\n" +
+			`"Root/Work","GitHub","octocat","pw","https://github.com","","","0","",""` + "\n"},
+		{importer.FormatGenericCSV, "Website,Login,Password\nhttps://github.com,octocat,pw\n"},
+	}
+
+	for _, test := range tests {
+		result, err := importer.ParseCSV(strings.NewReader(test.csv))
+		if err != nil {
+			t.Errorf("%s: error parsing CSV: %v", test.format, err)
+			continue
+		}
+		if result.Format != test.format {
+			t.Errorf("Expected format %s, got %s", test.format, result.Format)
+		}
+		if len(result.Records) != 1 || result.Records[0].Service != "github.com" || result.Records[0].Username != "octocat" {
+			t.Errorf("%s: unexpected records %+v", test.format, result.Records)
+		}
+	}
+
+	if _, err := importer.ParseCSV(strings.NewReader("a,b,c\n1,2,3\n")); !errors.Is(err, importer.ErrUnrecognizedCSV) {
+		t.Errorf("Expected ErrUnrecognizedCSV, got %v", err)
+	}
+	if _, err := importer.ParseCSV(strings.NewReader("")); !errors.Is(err, importer.ErrEmptyCSV) {
+		t.Errorf("Expected ErrEmptyCSV, got %v", err)
+	}
+}
+
+// TestParseCSVMapping checks folders, tags, notes, TOTP and extra columns
+func TestParseCSVMapping(t *testing.T) {
+	bitwarden := "\ufefffolder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+		"Work/Dev,1,login,GitHub,my notes,\"PIN: 1234\nRecovery: abc\",0,https://github.com/login,octocat,pw,JBSWY3DP\n" +
+		",,note,Wi-Fi,the code is 42,,0,,,,\n"
+
+	result, err := importer.ParseCSV(strings.NewReader(bitwarden))
+	if err != nil {
+		t.Fatalf("Error parsing CSV: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d (skipped %v)", len(result.Records), result.Skipped)
+	}
+
+	login := result.Records[0]
+	if strings.Join(login.Folder, "/") != "Work/Dev" || login.Notes != "my notes" || login.Password != "pw" {
+		t.Errorf("Unexpected login record %+v", login)
+	}
+	fields := make(map[string]database.ImportField)
+	for _, field := range login.Fields {
+		fields[field.Name] = field
+	}
+	if fields["Title"].Value != "GitHub" || fields["URL"].Type != database.FieldURL ||
+		fields["TOTP"].Type != database.FieldHidden || fields["PIN"].Value != "1234" || fields["Recovery"].Value != "abc" {
+		t.Errorf("Unexpected login fields %+v", login.Fields)
+	}
+
+	note := result.Records[1]
+	if note.EntryType != database.EntrySecureNote || note.Service != "Wi-Fi" || note.Password != "the code is 42" || note.Notes != "" {
+		t.Errorf("Unexpected note record %+v", note)
+	}
+
+	// LastPass secure notes keep their text in the extra column
+	lastPass := "url,username,password,totp,extra,name,grouping,fav\nhttp://sn,,,,alarm code 1234,Alarm,,0\n"
+	result, err = importer.ParseCSV(strings.NewReader(lastPass))
+	if err != nil {
+		t.Fatalf("Error parsing CSV: %v", err)
+	}
+	if len(result.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d (skipped %v)", len(result.Records), result.Skipped)
+	}
+	if note := result.Records[0]; note.EntryType != database.EntrySecureNote || note.Password != "alarm code 1234" || note.Notes != "" {
+		t.Errorf("Unexpected LastPass note record %+v", note)
+	}
+
+	onePassword := `"Title","Url","Username","Password","OTPAuth","Favorite","Archived","Tags","Notes","Security Question"` + "\n" +
+		`"Bank","bank.example.com","jdoe","pw","","false","false","finance, personal","","Mother's maiden name"` + "\n"
+	result, err = importer.ParseCSV(strings.NewReader(onePassword))
+	if err != nil {
+		t.Fatalf("Error parsing CSV: %v", err)
+	}
+	record := result.Records[0]
+	if strings.Join(record.Tags, "|") != "finance|personal" {
+		t.Errorf("Expected tags finance and personal, got %v", record.Tags)
+	}
+	if len(record.Fields) != 2 || record.Fields[1].Name != "Security Question" {
+		t.Errorf("Expected the extra column as a custom field, got %+v", record.Fields)
+	}
+}
+
+// TestParseCSVSkippedRows checks that bad rows are reported with their line numbers
+func TestParseCSVSkippedRows(t *testing.T) {
+	csv := "name,url,username,password\n" +
+		"GitHub,https://github.com,octocat,pw\n" +
+		",,,\n" +
+		",,lonely,pw\n" +
+		"Too,https://too.example.com,many,columns,here\n" +
+		"GitLab,https://gitlab.com,octocat,pw\n"
+
+	result, err := importer.ParseCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("Error parsing CSV: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Errorf("Expected 2 records, got %d", len(result.Records))
+	}
+
+	var lines []int
+	for _, skipped := range result.Skipped {
+		lines = append(lines, skipped.Line)
+	}
+	if len(lines) != 3 || lines[0] != 3 || lines[1] != 4 || lines[2] != 5 {
+		t.Errorf("Expected lines 3, 4 and 5 to be skipped, got %v", result.Skipped)
+	}
+}
+
+// TestImportCSV imports into a vault, checking the dry run, encryption, folders and tags
+func TestImportCSV(t *testing.T) {
+	db, key := openImportVault(t)
+	keepass := `"Group","Title","Username","Password","URL","Notes","TOTP","Icon","Last Modified","Created"` + "\n" +
+		`"Root/Work","GitHub","octocat","secret","https://github.com","notes","","0","",""` + "\n" +
+		`"Root/Work/Servers","Router","admin","hunter2","","","","0","",""` + "\n"
+
+	preview, err := importer.ImportCSV(db, key, strings.NewReader(keepass), true)
+	if err != nil {
+		t.Fatalf("Error previewing import: %v", err)
+	}
+	if !preview.DryRun || preview.Imported != 0 || len(preview.Records) != 2 {
+		t.Errorf("Unexpected dry run result %+v", preview)
+	}
+	if entries, _ := database.GetAllEntries(db); len(entries) != 0 {
+		t.Fatalf("Dry run stored %d entries", len(entries))
+	}
+
+	result, err := importer.ImportCSV(db, key, strings.NewReader(keepass), false)
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if result.DryRun || result.Imported != 2 || result.FoldersCreated != 2 {
+		t.Errorf("Unexpected import result %+v", result)
+	}
+
+	entries, err := database.GetAllEntries(db)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d (%v)", len(entries), err)
+	}
+	password, err := encryption.Decrypt(entries[0].EncryptedPassword, key)
+	if err != nil || password != "secret" {
+		t.Errorf("Expected encrypted password secret, got %q (%v)", password, err)
+	}
+	if decryptedField(t, db, key, entries[0].ID, "URL") != "https://github.com" {
+		t.Errorf("Expected the URL to be kept as a custom field")
+	}
+
+	path, err := database.GetFolderPath(db, entries[1].FolderID)
+	if err != nil || strings.Join(path, "/") != "Work/Servers" {
+		t.Errorf("Expected folder Work/Servers, got %v (%v)", path, err)
+	}
+
+	// Importing again reuses the existing folders
+	result, err = importer.ImportCSV(db, key, strings.NewReader(keepass), false)
+	if err != nil || result.FoldersCreated != 0 {
+		t.Errorf("Expected existing folders to be reused, got %+v (%v)", result, err)
+	}
+}
+
+// TestImportEntriesIsAtomic checks that a failing record leaves the vault unchanged
+func TestImportEntriesIsAtomic(t *testing.T) {
+	db, key := openImportVault(t)
+
+	records := []database.ImportRecord{
+		{Service: "github.com", Password: "pw", Tags: []string{"dev"}},
+		{Service: "gitlab.com", Password: "pw", Fields: []database.ImportField{{Name: "Bad", Type: "unknown"}}},
+	}
+	if _, err := database.ImportEntries(db, key, records); !errors.Is(err, database.ErrInvalidFieldType) {
+		t.Errorf("Expected ErrInvalidFieldType, got %v", err)
+	}
+
+	entries, _ := database.GetAllEntries(db)
+	tags, _ := database.ListTags(db)
+	if len(entries) != 0 || len(tags) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d entries and tags %v", len(entries), tags)
+	}
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// openImportVault returns an in-memory vault and a random encryption key for it
+func openImportVault(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	db, err := database.OpenMemoryDB()
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	key, err := encryption.GenerateSalt(32)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	return db, key
+}
+
+// decryptedField returns the decrypted value of an entry's custom field, or "" if it has none by that name
+func decryptedField(t *testing.T, db *sql.DB, key string, entryID int, name string) string {
+	t.Helper()
+
+	fields, err := database.GetCustomFields(db, entryID)
+	if err != nil {
+		t.Fatalf("Error reading custom fields: %v", err)
+	}
+	for _, field := range fields {
+		if field.Name == name {
+			value, err := encryption.Decrypt(field.EncryptedValue, key)
+			if err != nil {
+				t.Fatalf("Error decrypting field %s: %v", name, err)
+			}
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/exporter"
+	"github.com/cpainter1/PassLock/internal/importer"
+	"github.com/cpainter1/PassLock/internal/kdbx"
+)
+
+// fastKDBXOptions returns cheap KDF settings so tests run quickly
+func fastKDBXOptions() kdbx.Options {
+	return kdbx.Options{Cipher: kdbx.CipherChaCha20, KDF: kdbx.KDFArgon2id, Iterations: 1, MemoryKiB: 64, Parallelism: 1, Compress: true}
+}
+
+// TestParseKDBXMapping checks folders, the recycle bin, history passwords, attachments and entry types
+func TestParseKDBXMapping(t *testing.T) {
+	old := &kdbx.Entry{Modified: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)}
+	old.Set(kdbx.KeyPassword, "old-password", true)
+	same := &kdbx.Entry{Modified: time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)}
+	same.Set(kdbx.KeyPassword, "current", true)
+
+	login := &kdbx.Entry{
+		UUID:        kdbx.NewUUID(),
+		Modified:    time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC),
+		Tags:        []string{"dev"},
+		History:     []*kdbx.Entry{old, same},
+		Attachments: []kdbx.Attachment{{Name: "key.txt", Data: []byte("secret file")}},
+	}
+	login.Set(kdbx.KeyTitle, "GitHub", false)
+	login.Set(kdbx.KeyUserName, "octocat", false)
+	login.Set(kdbx.KeyPassword, "current", true)
+	login.Set(kdbx.KeyURL, "https://www.github.com/login", false)
+	login.Set("Recovery code", "abc-123", true)
+	login.Set("Team", "core", false)
+
+	note := &kdbx.Entry{UUID: kdbx.NewUUID()}
+	note.Set(kdbx.KeyTitle, "Alarm code", false)
+	note.Set(kdbx.KeyNotes, "1234", false)
+	note.Set(importer.EntryTypeKey, string(database.EntrySecureNote), false)
+
+	deleted := &kdbx.Entry{UUID: kdbx.NewUUID()}
+	deleted.Set(kdbx.KeyTitle, "Old account", false)
+
+	untitled := &kdbx.Entry{UUID: kdbx.NewUUID()}
+
+	recycleBin := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Recycle Bin", Entries: []*kdbx.Entry{deleted}}
+	dev := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Dev", Entries: []*kdbx.Entry{login}}
+	work := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Work", Groups: []*kdbx.Group{dev}}
+	root := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Database", Entries: []*kdbx.Entry{note, untitled},
+		Groups: []*kdbx.Group{work, recycleBin}}
+
+	var buf bytes.Buffer
+	err := kdbx.Write(&buf, &kdbx.Database{Root: root, RecycleBin: recycleBin.UUID}, "hunter2", fastKDBXOptions())
+	if err != nil {
+		t.Fatalf("Error writing KeePass file: %v", err)
+	}
+
+	result, err := importer.ParseKDBX(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatalf("Error parsing KeePass file: %v", err)
+	}
+	if result.Format != importer.FormatKeePass || len(result.Records) != 2 || len(result.Skipped) != 2 {
+		t.Fatalf("Unexpected result: %d records, skipped %v", len(result.Records), result.Skipped)
+	}
+
+	if result.Records[0].Service != "Alarm code" || result.Records[0].EntryType != database.EntrySecureNote ||
+		result.Records[0].Notes != "1234" || len(result.Records[0].Folder) != 0 {
+		t.Errorf("Unexpected note record %+v", result.Records[0])
+	}
+
+	record := result.Records[1]
+	if record.Service != "github.com" || record.Password != "current" || strings.Join(record.Folder, "/") != "Work/Dev" ||
+		record.EntryType != database.EntryLogin || len(record.Tags) != 1 {
+		t.Errorf("Unexpected login record %+v", record)
+	}
+	fields := make(map[string]database.ImportField)
+	for _, field := range record.Fields {
+		fields[field.Name] = field
+	}
+	if fields["Title"].Value != "GitHub" || fields["URL"].Type != database.FieldURL ||
+		fields["Recovery code"].Type != database.FieldHidden || fields["Team"].Type != database.FieldText {
+		t.Errorf("Unexpected fields %+v", record.Fields)
+	}
+	if fields["Previous password (2023-05-01)"].Value != "old-password" || len(record.Fields) != 5 {
+		t.Errorf("Expected one previous password field, got %+v", record.Fields)
+	}
+	if !record.ChangedAt.Equal(same.Modified) {
+		t.Errorf("Expected the password change date of the version that set it, got %v", record.ChangedAt)
+	}
+	if len(record.Attachments) != 1 || string(record.Attachments[0].Data) != "secret file" {
+		t.Errorf("Unexpected attachments %+v", record.Attachments)
+	}
+
+	if _, err := importer.ParseKDBX(bytes.NewReader(buf.Bytes()), "wrong"); !errors.Is(err, kdbx.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+// TestKDBXExportRoundTrip checks that exporting a vault and importing the file restores its contents
+func TestKDBXExportRoundTrip(t *testing.T) {
+	db, key := openImportVault(t)
+
+	_, err := database.ImportEntries(db, key, []database.ImportRecord{
+		{
+			Service:     "github.com",
+			Username:    "octocat",
+			Password:    "pw1",
+			Notes:       "my notes",
+			Folder:      []string{"Work", "Dev"},
+			Tags:        []string{"dev"},
+			Fields:      []database.ImportField{{Name: "URL", Type: database.FieldURL, Value: "https://github.com/login"}, {Name: "PIN", Type: database.FieldHidden, Value: "1234"}, {Name: "Password", Value: "shadowed"}},
+			Attachments: []database.ImportAttachment{{Name: "key.txt", Data: []byte("secret file")}},
+		},
+		{Service: "Wi-Fi", Password: "pw2", EntryType: database.EntrySecureNote},
+	})
+	if err != nil {
+		t.Fatalf("Error filling vault: %v", err)
+	}
+	if _, err := database.CreateFolder(db, "Empty", 0); err != nil {
+		t.Fatalf("Error creating folder: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = exporter.ExportKDBX(db, key, &buf, "hunter2", fastKDBXOptions())
+	if err != nil {
+		t.Fatalf("Error exporting: %v", err)
+	}
+
+	keepass, err := kdbx.Read(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatalf("Error reading export: %v", err)
+	}
+	names := make([]string, 0)
+	for _, group := range keepass.Root.Groups {
+		names = append(names, group.Name)
+	}
+	if strings.Join(names, ",") != "Empty,Work" {
+		t.Errorf("Expected groups Empty and Work, got %v", names)
+	}
+
+	result, err := importer.ParseKDBX(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatalf("Error parsing export: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(result.Records))
+	}
+
+	byService := make(map[string]database.ImportRecord)
+	for _, record := range result.Records {
+		byService[record.Service] = record
+	}
+	login := byService["github.com"]
+	if login.Username != "octocat" || login.Password != "pw1" || login.Notes != "my notes" ||
+		strings.Join(login.Folder, "/") != "Work/Dev" || len(login.Tags) != 1 || len(login.Attachments) != 1 {
+		t.Errorf("Unexpected login record %+v", login)
+	}
+	fields := make(map[string]database.ImportField)
+	for _, field := range login.Fields {
+		fields[field.Name] = field
+	}
+	if fields["URL"].Value != "https://github.com/login" || fields["PIN"].Type != database.FieldHidden ||
+		fields["Password (2)"].Value != "shadowed" {
+		t.Errorf("Unexpected fields %+v", login.Fields)
+	}
+	if byService["Wi-Fi"].EntryType != database.EntrySecureNote {
+		t.Errorf("Expected the secure note type to survive, got %+v", byService["Wi-Fi"])
+	}
+}
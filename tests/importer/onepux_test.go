@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/importer"
+)
+
+// onePUXArchive returns a 1PUX archive with the given items in one vault and the given files
+func onePUXArchive(t *testing.T, items []any, files map[string]string) []byte {
+	t.Helper()
+
+	document, err := json.Marshal(map[string]any{
+		"accounts": []any{map[string]any{
+			"attrs":  map[string]any{"name": "Jane"},
+			"vaults": []any{map[string]any{"attrs": map[string]any{"name": "Personal"}, "items": items}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Error encoding export: %v", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	contents := map[string]string{"export.attributes": `{"version": 3}`, "export.data": string(document)}
+	for name, data := range files {
+		contents["files/"+name] = data
+	}
+	for name, data := range contents {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Error creating archive: %v", err)
+		}
+		_, _ = w.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Error closing archive: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// onePUXField returns a 1PUX section field
+func onePUXField(id string, title string, kind string, value any) map[string]any {
+	return map[string]any{"id": id, "title": title, "value": map[string]any{kind: value}}
+}
+
+// TestParse1PUX checks the mapping of 1Password categories, sections, files and warnings
+func TestParse1PUX(t *testing.T) {
+	privateKey, publicKey := testSSHKey(t)
+	items := []any{
+		map[string]any{
+			"categoryUuid": "001", "state": "active",
+			"overview": map[string]any{"title": "GitHub", "url": "https://github.com/login", "tags": []string{"dev"}},
+			"details": map[string]any{
+				"loginFields": []any{
+					map[string]any{"designation": "username", "value": "octocat"},
+					map[string]any{"designation": "password", "value": "current"},
+				},
+				"notesPlain": "my notes",
+				"sections": []any{map[string]any{"title": "", "fields": []any{
+					onePUXField("otp", "one-time password", "totp", "otpauth://totp/x?secret=JBSWY3DP"),
+					onePUXField("recovery", "Recovery email", "email", map[string]any{"email_address": "jane@example.com"}),
+					onePUXField("since", "Member since", "date", 1672531200),
+					onePUXField("backup", "Backup codes", "file", map[string]any{"fileName": "codes.txt", "documentId": "doc1"}),
+					onePUXField("weird", "Weird", "unknownKind", map[string]any{"a": 1}),
+				}}},
+				"passwordHistory": []any{map[string]any{"value": "old", "time": 1682942400}},
+			},
+		},
+		map[string]any{
+			"categoryUuid": "002", "state": "archived",
+			"overview": map[string]any{"title": "Visa"},
+			"details": map[string]any{"sections": []any{map[string]any{"fields": []any{
+				onePUXField("cardholder", "cardholder name", "string", "Jane Doe"),
+				onePUXField("type", "type", "creditCardType", "visa"),
+				onePUXField("ccnum", "number", "creditCardNumber", "4111111111111111"),
+				onePUXField("cvv", "verification number", "concealed", "123"),
+				onePUXField("expiry", "expiry date", "monthYear", 203003),
+				onePUXField("bank", "issuing bank", "string", "Big Bank"),
+			}}}},
+		},
+		map[string]any{
+			"categoryUuid": "004",
+			"overview":     map[string]any{"title": "Me"},
+			"details": map[string]any{"sections": []any{map[string]any{"fields": []any{
+				onePUXField("firstname", "first name", "string", "Jane"),
+				onePUXField("lastname", "last name", "string", "Doe"),
+				onePUXField("birthdate", "birth date", "date", 631152000),
+				onePUXField("address", "address", "address", map[string]any{"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "12345", "country": "us"}),
+			}}}},
+		},
+		map[string]any{
+			"categoryUuid": "109",
+			"overview":     map[string]any{"title": "Home router"},
+			"details": map[string]any{"sections": []any{map[string]any{"fields": []any{
+				onePUXField("network_name", "network name", "string", "HomeNet"),
+				onePUXField("wireless_security", "security", "menu", "wpa2p"),
+				onePUXField("wireless_password", "wireless network password", "concealed", "supersecret"),
+			}}}},
+		},
+		map[string]any{
+			"categoryUuid": "114",
+			"overview":     map[string]any{"title": "Server key"},
+			"details": map[string]any{"sections": []any{map[string]any{"fields": []any{
+				onePUXField("private_key", "private key", "sshKey", map[string]any{"privateKey": privateKey, "metadata": map[string]any{"publicKey": publicKey, "fingerprint": "SHA256:abc"}}),
+			}}}},
+		},
+		map[string]any{
+			"categoryUuid": "105",
+			"overview":     map[string]any{"title": "Gym"},
+			"details": map[string]any{"sections": []any{map[string]any{"fields": []any{
+				onePUXField("membership_no", "member ID", "string", "M-42"),
+			}}}},
+		},
+		map[string]any{"categoryUuid": "001", "trashed": true, "overview": map[string]any{"title": "Deleted"}},
+	}
+	archive := onePUXArchive(t, items, map[string]string{"doc1__codes.txt": "111 222"})
+
+	result, err := importer.Parse1PUX(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Error parsing archive: %v", err)
+	}
+	if result.Format != importer.Format1PUX || len(result.Records) != 6 || len(result.Skipped) != 1 {
+		t.Fatalf("Unexpected result: %d records, skipped %v", len(result.Records), result.Skipped)
+	}
+
+	login := result.Records[0]
+	fields := recordFields(login)
+	if login.Service != "github.com" || login.Username != "octocat" || login.Password != "current" ||
+		strings.Join(login.Folder, "/") != "Personal" || len(login.Tags) != 1 || login.Notes != "my notes" {
+		t.Errorf("Unexpected login %+v", login)
+	}
+	if fields["one-time password"].Type != database.FieldHidden || fields["Recovery email"].Type != database.FieldEmail ||
+		fields["Member since"].Value != "2023-01-01" || fields["Previous password (2023-05-01)"].Value != "old" {
+		t.Errorf("Unexpected login fields %+v", login.Fields)
+	}
+	if len(login.Attachments) != 1 || string(login.Attachments[0].Data) != "111 222" {
+		t.Errorf("Unexpected attachments %+v", login.Attachments)
+	}
+
+	card := result.Records[1]
+	fields = recordFields(card)
+	if card.EntryType != database.EntryCard || card.Password != "4111111111111111" || card.Username != "Jane Doe" ||
+		fields["Expiry (MM/YY)"].Value != "03/30" || fields["Brand"].Value != "visa" || fields["issuing bank"].Value != "Big Bank" ||
+		strings.Join(card.Tags, ",") != "Archived" {
+		t.Errorf("Unexpected card %+v", card)
+	}
+
+	identity := result.Records[2]
+	fields = recordFields(identity)
+	if identity.EntryType != database.EntryIdentity || identity.Username != "Jane Doe" || fields["Date of birth"].Value != "1990-01-01" ||
+		fields["City"].Value != "Springfield" || fields["State"].Value != "IL" {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+
+	wifi := result.Records[3]
+	if wifi.EntryType != database.EntryWiFi || wifi.Service != "HomeNet" || recordFields(wifi)["Security (WPA2, WPA3, WEP, Open)"].Value != "WPA2" {
+		t.Errorf("Unexpected Wi-Fi network %+v", wifi)
+	}
+
+	if result.Records[4].EntryType != database.EntrySSHKey || recordFields(result.Records[4])["Public key"].Value != publicKey {
+		t.Errorf("Unexpected SSH key %+v", result.Records[4])
+	}
+
+	gym := result.Records[5]
+	if gym.EntryType != database.EntryLogin || recordFields(gym)["member ID"].Value != "M-42" {
+		t.Errorf("Unexpected membership %+v", gym)
+	}
+
+	var messages []string
+	for _, warning := range result.Warnings {
+		messages = append(messages, warning.Item+": "+warning.Message)
+	}
+	joined := strings.Join(messages, "\n")
+	if !strings.Contains(joined, `GitHub: field "Weird"`) || !strings.Contains(joined, "Gym: 1Password category 105") {
+		t.Errorf("Unexpected warnings:\n%s", joined)
+	}
+}
+
+// TestImport1PUX checks storing an archive and rejecting files that are not 1PUX archives
+func TestImport1PUX(t *testing.T) {
+	db, key := openImportVault(t)
+
+	items := []any{map[string]any{
+		"categoryUuid": "003",
+		"overview":     map[string]any{"title": "Alarm"},
+		"details":      map[string]any{"notesPlain": "code 42"},
+	}}
+	result, err := importer.Import1PUX(db, key, bytes.NewReader(onePUXArchive(t, items, nil)), false)
+	if err != nil {
+		t.Fatalf("Error importing: %v", err)
+	}
+	if result.Imported != 1 || result.FoldersCreated != 1 {
+		t.Errorf("Expected 1 entry and 1 folder, got %d and %d", result.Imported, result.FoldersCreated)
+	}
+
+	if _, err := importer.Parse1PUX(strings.NewReader("not a zip")); !errors.Is(err, importer.ErrNot1PUX) {
+		t.Errorf("Expected ErrNot1PUX, got %v", err)
+	}
+}
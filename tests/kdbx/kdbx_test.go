@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cpainter1/PassLock/internal/kdbx"
+)
+
+// testOptions returns cheap KDF settings so tests run quickly
+func testOptions(cipher kdbx.Cipher, kdf kdbx.KDF) kdbx.Options {
+	return kdbx.Options{Cipher: cipher, KDF: kdf, Iterations: 1, MemoryKiB: 64, Parallelism: 1, Rounds: 10, Compress: true}
+}
+
+// sampleDatabase returns a database with nested groups, protected strings, attachments and history
+func sampleDatabase() *kdbx.Database {
+	old := &kdbx.Entry{UUID: kdbx.NewUUID(), Modified: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)}
+	old.Set(kdbx.KeyTitle, "GitHub", false)
+	old.Set(kdbx.KeyPassword, "old-password", true)
+
+	entry := &kdbx.Entry{
+		UUID:        kdbx.NewUUID(),
+		Tags:        []string{"dev", "work"},
+		Created:     time.Date(2023, 1, 1, 8, 30, 0, 0, time.UTC),
+		Modified:    time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC),
+		History:     []*kdbx.Entry{old},
+		Attachments: []kdbx.Attachment{{Name: "key.txt", Data: []byte("secret file")}},
+	}
+	entry.Set(kdbx.KeyTitle, "GitHub", false)
+	entry.Set(kdbx.KeyUserName, "octocat", false)
+	entry.Set(kdbx.KeyPassword, "p<a>ss&word", true)
+	entry.Set(kdbx.KeyURL, "https://github.com", false)
+	entry.Set("Recovery code", "abc-123", true)
+
+	work := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Work", Entries: []*kdbx.Entry{entry}}
+	root := &kdbx.Group{UUID: kdbx.NewUUID(), Name: "Vault", Groups: []*kdbx.Group{work}}
+
+	return &kdbx.Database{Name: "Vault", Root: root}
+}
+
+// TestRoundTrip checks that every cipher and KDF can read back what it wrote
+func TestRoundTrip(t *testing.T) {
+	for _, cipher := range []kdbx.Cipher{kdbx.CipherAES256, kdbx.CipherChaCha20, kdbx.CipherTwofish} {
+		for _, kdf := range []kdbx.KDF{kdbx.KDFArgon2d, kdbx.KDFArgon2id, kdbx.KDFAES} {
+			var buf bytes.Buffer
+			err := kdbx.Write(&buf, sampleDatabase(), "hunter2", testOptions(cipher, kdf))
+			if err != nil {
+				t.Fatalf("%s/%s: error writing: %v", cipher, kdf, err)
+			}
+
+			db, err := kdbx.Read(&buf, "hunter2")
+			if err != nil {
+				t.Fatalf("%s/%s: error reading: %v", cipher, kdf, err)
+			}
+			if db.Name != "Vault" || len(db.Root.Groups) != 1 || db.Root.Groups[0].Name != "Work" {
+				t.Fatalf("%s/%s: unexpected groups %+v", cipher, kdf, db.Root)
+			}
+
+			entries := db.Root.Groups[0].Entries
+			if len(entries) != 1 {
+				t.Fatalf("%s/%s: expected 1 entry, got %d", cipher, kdf, len(entries))
+			}
+			entry := entries[0]
+			if entry.Get(kdbx.KeyPassword) != "p<a>ss&word" || entry.Get("Recovery code") != "abc-123" ||
+				entry.Get(kdbx.KeyUserName) != "octocat" {
+				t.Errorf("%s/%s: unexpected strings %+v", cipher, kdf, entry.Strings)
+			}
+			if len(entry.Tags) != 2 || !entry.Modified.Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+				t.Errorf("%s/%s: unexpected tags or times %v %v", cipher, kdf, entry.Tags, entry.Modified)
+			}
+			if len(entry.Attachments) != 1 || string(entry.Attachments[0].Data) != "secret file" {
+				t.Errorf("%s/%s: unexpected attachments %+v", cipher, kdf, entry.Attachments)
+			}
+			if len(entry.History) != 1 || entry.History[0].Get(kdbx.KeyPassword) != "old-password" {
+				t.Errorf("%s/%s: unexpected history %+v", cipher, kdf, entry.History)
+			}
+		}
+	}
+}
+
+// TestReadErrors checks wrong passwords, tampering and files that are not KeePass databases
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	err := kdbx.Write(&buf, sampleDatabase(), "hunter2", testOptions(kdbx.CipherAES256, kdbx.KDFArgon2d))
+	if err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	file := buf.Bytes()
+
+	if _, err := kdbx.Read(bytes.NewReader(file), "wrong"); !errors.Is(err, kdbx.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	tampered := bytes.Clone(file)
+	tampered[len(tampered)-40] ^= 0xff
+	if _, err := kdbx.Read(bytes.NewReader(tampered), "hunter2"); !errors.Is(err, kdbx.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a tampered payload, got %v", err)
+	}
+
+	tampered = bytes.Clone(file)
+	tampered[20] ^= 0xff
+	if _, err := kdbx.Read(bytes.NewReader(tampered), "hunter2"); !errors.Is(err, kdbx.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a tampered header, got %v", err)
+	}
+
+	if _, err := kdbx.Read(bytes.NewReader([]byte("not a keepass file")), "hunter2"); !errors.Is(err, kdbx.ErrNotKDBX) {
+		t.Errorf("Expected ErrNotKDBX, got %v", err)
+	}
+}
+
+// setKDFParameter overwrites a uint64 or uint32 KDF parameter of a written file and fixes the header checksum
+func setKDFParameter(t *testing.T, file []byte, key string, value uint64) []byte {
+	t.Helper()
+
+	file = bytes.Clone(file)
+	for _, width := range []int{8, 4} {
+		// Variant dictionary entry: type, key length, key, value length, value
+		valueType := byte(0x05)
+		if width == 4 {
+			valueType = 0x04
+		}
+		marker := append([]byte{valueType, byte(len(key)), 0, 0, 0}, key...)
+		marker = append(marker, byte(width), 0, 0, 0)
+		index := bytes.Index(file, marker)
+		if index < 0 {
+			continue
+		}
+		if width == 8 {
+			binary.LittleEndian.PutUint64(file[index+len(marker):], value)
+		} else {
+			binary.LittleEndian.PutUint32(file[index+len(marker):], uint32(value))
+		}
+
+		end := headerEnd(file)
+		hash := sha256.Sum256(file[:end])
+		copy(file[end:], hash[:])
+		return file
+	}
+
+	t.Fatalf("KDF parameter %s not found", key)
+	return nil
+}
+
+// headerEnd returns the length of the outer header, whose fields follow the 12-byte signature until the
+// end-of-header field (ID 0)
+func headerEnd(file []byte) int {
+	end := 12
+	for {
+		id := file[end]
+		end += 5 + int(binary.LittleEndian.Uint32(file[end+1:]))
+		if id == 0 {
+			return end
+		}
+	}
+}
+
+// TestReadOversizedKDF checks a file demanding huge Argon2 or AES-KDF costs is rejected before deriving the key
+func TestReadOversizedKDF(t *testing.T) {
+	var argon, aes bytes.Buffer
+	err := kdbx.Write(&argon, sampleDatabase(), "hunter2", testOptions(kdbx.CipherAES256, kdbx.KDFArgon2id))
+	if err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	if err := kdbx.Write(&aes, sampleDatabase(), "hunter2", testOptions(kdbx.CipherAES256, kdbx.KDFAES)); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+
+	for name, file := range map[string][]byte{
+		"memory":      setKDFParameter(t, argon.Bytes(), "M", 1<<40),
+		"iterations":  setKDFParameter(t, argon.Bytes(), "I", 1<<31),
+		"parallelism": setKDFParameter(t, setKDFParameter(t, argon.Bytes(), "M", 1<<29), "P", 1<<16),
+		"rounds":      setKDFParameter(t, aes.Bytes(), "R", 1<<62),
+	} {
+		if _, err := kdbx.Read(bytes.NewReader(file), "hunter2"); !errors.Is(err, kdbx.ErrUnsupportedKDF) {
+			t.Errorf("Expected ErrUnsupportedKDF for oversized %s, got %v", name, err)
+		}
+	}
+}
+
+// TestReadOversizedBlock checks a block size beyond the cap or the end of the file is rejected before the block
+// is allocated
+func TestReadOversizedBlock(t *testing.T) {
+	var buf bytes.Buffer
+	err := kdbx.Write(&buf, sampleDatabase(), "hunter2", testOptions(kdbx.CipherChaCha20, kdbx.KDFArgon2id))
+	if err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+
+	// The first block's size follows the header, its SHA-256 and HMAC, and the block's own HMAC
+	offset := headerEnd(buf.Bytes()) + 3*32
+	for name, size := range map[string]uint32{"above the cap": 0xfffffff0, "past the end": 32 * 1024 * 1024} {
+		file := bytes.Clone(buf.Bytes())
+		binary.LittleEndian.PutUint32(file[offset:], size)
+		if _, err := kdbx.Read(bytes.NewReader(file), "hunter2"); !errors.Is(err, kdbx.ErrCorrupt) {
+			t.Errorf("Expected ErrCorrupt for a block size %s, got %v", name, err)
+		}
+	}
+}
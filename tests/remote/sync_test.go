@@ -0,0 +1,361 @@
+package tests
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/remote"
+	"golang.org/x/net/webdav"
+)
+
+// fastKDF keeps key derivation quick in tests
+var fastKDF = encryption.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 64}
+
+// createDevices creates a vault protected by password and a copy of it standing in for a second device
+func createDevices(t *testing.T, password string) (*sql.DB, *sql.DB, string) {
+	t.Helper()
+	t.Setenv(config.EnvHome, t.TempDir())
+	t.Setenv(config.EnvConfig, "")
+	t.Setenv(config.EnvVaultDir, "")
+
+	keys, err := database.DeriveVaultKeys(password, fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	err = database.CreateVaultWithKDF("Laptop", keys.AuthKey, keys.Salt, keys.KDF)
+	if err != nil {
+		t.Fatalf("Error creating vault: %v", err)
+	}
+	laptop, err := database.InitDB("Laptop")
+	if err != nil {
+		t.Fatalf("Error opening vault: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = laptop.Close()
+	})
+	storeEntry(t, laptop, keys.EncryptionKey, "github.com")
+
+	path := filepath.Join(t.TempDir(), "Phone.sqlite")
+	if _, err := laptop.Exec("VACUUM INTO ?;", path); err != nil {
+		t.Fatalf("Error copying vault: %v", err)
+	}
+	phone, err := database.OpenVaultFile(path)
+	if err != nil {
+		t.Fatalf("Error opening copy: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = phone.Close()
+	})
+
+	return laptop, phone, keys.EncryptionKey
+}
+
+// storeEntry stores an entry for service with an encrypted password
+func storeEntry(t *testing.T, db *sql.DB, key string, service string) {
+	t.Helper()
+
+	encrypted, err := encryption.Encrypt("hunter2", key)
+	if err != nil {
+		t.Fatalf("Error encrypting password: %v", err)
+	}
+	_, err = database.StorePassword(db, database.PasswordEntry{Service: service, Username: "user", EncryptedPassword: encrypted})
+	if err != nil {
+		t.Fatalf("Error storing entry: %v", err)
+	}
+}
+
+// hasService reports whether a vault has an entry for service
+func hasService(t *testing.T, db *sql.DB, service string) bool {
+	t.Helper()
+
+	entries, err := database.GetEntriesFromService(db, service)
+	if err != nil {
+		t.Fatalf("Error fetching entries: %v", err)
+	}
+	return len(entries) > 0
+}
+
+// syncDevice syncs a vault through backend
+func syncDevice(t *testing.T, db *sql.DB, key string, backend remote.Backend) *database.SyncSummary {
+	t.Helper()
+
+	summary, err := remote.Sync(db, key, backend)
+	if err != nil {
+		t.Fatalf("Error syncing with %s: %v", backend.Name(), err)
+	}
+	return summary
+}
+
+// =-- WebDAV Test Server --= //
+
+// davServer is an in-process WebDAV server requiring basic auth. The x/net handler ignores conditional
+// headers on PUT, so they are checked here the way real servers do.
+type davServer struct {
+	*httptest.Server
+	handler   *webdav.Handler
+	mu        sync.Mutex
+	failures  int    // Requests answered 503 before the server recovers
+	beforePut func() // Run before the next PUT is handled
+	rejected  int    // PUT requests refused because the ETag changed
+}
+
+// newDAVServer starts a WebDAV server for the rest of the test
+func newDAVServer(t *testing.T) *davServer {
+	t.Helper()
+
+	server := &davServer{handler: &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// serve authenticates a request, applies the configured faults and passes it to the WebDAV handler
+func (s *davServer) serve(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "s3cret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	hook := s.beforePut
+	if r.Method == http.MethodPut {
+		s.beforePut = nil
+	}
+	s.mu.Unlock()
+
+	if r.Method != http.MethodPut {
+		s.handler.ServeHTTP(w, r)
+		return
+	}
+	if hook != nil {
+		hook()
+	}
+
+	// Checking the ETag and writing happen under one lock, like an atomic conditional PUT
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := httptest.NewRecorder()
+	s.handler.ServeHTTP(current, httptest.NewRequest(http.MethodHead, r.URL.Path, nil))
+	etag := ""
+	if current.Code == http.StatusOK {
+		etag = current.Header().Get("ETag")
+	}
+	match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if (match != "" && match != etag) || (noneMatch == "*" && etag != "") {
+		s.rejected++
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+// stored returns the shared copy kept by the server
+func (s *davServer) stored(t *testing.T, path string) []byte {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected a shared copy at %s, got status %d", path, recorder.Code)
+	}
+	return recorder.Body.Bytes()
+}
+
+// newWebDAV returns a backend for the shared copy at path on the server
+func newWebDAV(t *testing.T, server *davServer, path string) *remote.WebDAV {
+	t.Helper()
+
+	backend, err := remote.NewWebDAV(server.URL+path, "alice", "s3cret")
+	if err != nil {
+		t.Fatalf("Error creating backend: %v", err)
+	}
+	return backend
+}
+
+// =-- Tests --= //
+
+// TestDirectorySync syncs two devices through a shared folder and checks only encrypted data is stored
+func TestDirectorySync(t *testing.T) {
+	laptop, phone, key := createDevices(t, "directory password")
+	dir := t.TempDir()
+	backend := remote.NewDirectory(dir, "Laptop")
+
+	// The first sync starts the shared copy
+	syncDevice(t, laptop, key, backend)
+	storeEntry(t, phone, key, "phone.example.com")
+	summary := syncDevice(t, phone, key, backend)
+	if summary.Pushed != 1 {
+		t.Errorf("Expected the phone's entry to be pushed, got %+v", summary)
+	}
+	storeEntry(t, laptop, key, "laptop.example.com")
+	syncDevice(t, laptop, key, backend)
+	syncDevice(t, phone, key, backend)
+
+	for name, db := range map[string]*sql.DB{"laptop": laptop, "phone": phone} {
+		for _, service := range []string{"github.com", "phone.example.com", "laptop.example.com"} {
+			if !hasService(t, db, service) {
+				t.Errorf("Expected %s to have %s after syncing", name, service)
+			}
+		}
+	}
+
+	blob, err := os.ReadFile(backend.Path)
+	if err != nil {
+		t.Fatalf("Error reading shared copy: %v", err)
+	}
+	for _, plaintext := range []string{"SQLite format", "github.com", "laptop.example.com"} {
+		if bytes.Contains(blob, []byte(plaintext)) {
+			t.Errorf("Expected the shared copy to be encrypted, found %q", plaintext)
+		}
+	}
+	info, err := os.Stat(backend.Path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private shared copy, got %v (%v)", info, err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files, got %v", leftovers)
+	}
+}
+
+// TestDirectoryVersionChanged checks an upload over a replaced copy is refused
+func TestDirectoryVersionChanged(t *testing.T) {
+	backend := remote.NewDirectory(t.TempDir(), "Vault")
+	if _, err := backend.Download(&bytes.Buffer{}); !errors.Is(err, remote.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	first, err := backend.Upload(bytes.NewReader([]byte("first")), "")
+	if err != nil {
+		t.Fatalf("Error uploading: %v", err)
+	}
+	if _, err := backend.Upload(bytes.NewReader([]byte("other")), ""); !errors.Is(err, remote.ErrVersionChanged) {
+		t.Errorf("Expected creating an existing copy to fail, got %v", err)
+	}
+	second, err := backend.Upload(bytes.NewReader([]byte("second")), first)
+	if err != nil || second == first {
+		t.Fatalf("Expected a new version, got %q (%v)", second, err)
+	}
+	if _, err := backend.Upload(bytes.NewReader([]byte("stale")), first); !errors.Is(err, remote.ErrVersionChanged) {
+		t.Errorf("Expected an upload over a stale version to fail, got %v", err)
+	}
+
+	var data bytes.Buffer
+	version, err := backend.Download(&data)
+	if err != nil || version != second || data.String() != "second" {
+		t.Errorf("Expected the second upload, got %q at %q (%v)", data.String(), version, err)
+	}
+}
+
+// TestWebDAVSync syncs two devices through a WebDAV server
+func TestWebDAVSync(t *testing.T) {
+	laptop, phone, key := createDevices(t, "webdav password")
+	server := newDAVServer(t)
+	backend := newWebDAV(t, server, "/Laptop.plsync")
+
+	syncDevice(t, laptop, key, backend)
+	storeEntry(t, phone, key, "phone.example.com")
+	syncDevice(t, phone, key, backend)
+	summary := syncDevice(t, laptop, key, backend)
+	if summary.Pulled != 1 || !hasService(t, laptop, "phone.example.com") {
+		t.Errorf("Expected the laptop to receive the phone's entry, got %+v", summary)
+	}
+
+	blob := server.stored(t, "/Laptop.plsync")
+	if bytes.Contains(blob, []byte("SQLite format")) || bytes.Contains(blob, []byte("phone.example.com")) {
+		t.Error("Expected the server to only store encrypted data")
+	}
+	if name := backend.Name(); name != server.URL+"/Laptop.plsync" {
+		t.Errorf("Expected the backend to be named by its URL, got %s", name)
+	}
+
+	wrongPassword, err := remote.NewWebDAV(server.URL+"/Laptop.plsync", "alice", "wrong")
+	if err != nil {
+		t.Fatalf("Error creating backend: %v", err)
+	}
+	if _, err := remote.Sync(laptop, key, wrongPassword); !errors.Is(err, remote.ErrServer) {
+		t.Errorf("Expected a server error with wrong credentials, got %v", err)
+	}
+}
+
+// TestWebDAVConcurrentUpload checks a sync that loses an upload race starts over and keeps both changes
+func TestWebDAVConcurrentUpload(t *testing.T) {
+	laptop, phone, key := createDevices(t, "race password")
+	server := newDAVServer(t)
+	backend := newWebDAV(t, server, "/Laptop.plsync")
+	syncDevice(t, laptop, key, backend)
+	syncDevice(t, phone, key, backend)
+
+	// The phone uploads its change while the laptop is about to upload its own
+	storeEntry(t, phone, key, "phone.example.com")
+	storeEntry(t, laptop, key, "laptop.example.com")
+	server.beforePut = func() {
+		if _, err := remote.Sync(phone, key, newWebDAV(t, server, "/Laptop.plsync")); err != nil {
+			t.Errorf("Error syncing phone: %v", err)
+		}
+	}
+	syncDevice(t, laptop, key, backend)
+
+	if server.rejected != 1 {
+		t.Errorf("Expected the laptop's first upload to be rejected, got %d rejections", server.rejected)
+	}
+	if !hasService(t, laptop, "phone.example.com") {
+		t.Error("Expected the laptop to merge the phone's upload")
+	}
+	syncDevice(t, phone, key, backend)
+	if !hasService(t, phone, "laptop.example.com") {
+		t.Error("Expected the phone to receive the laptop's entry")
+	}
+}
+
+// TestWebDAVRetriesUnavailable checks requests are retried while the server is briefly unavailable
+func TestWebDAVRetriesUnavailable(t *testing.T) {
+	server := newDAVServer(t)
+	backend := newWebDAV(t, server, "/Vault.plsync")
+
+	server.failures = 2
+	version, err := backend.Upload(bytes.NewReader([]byte("data")), "")
+	if err != nil || version == "" {
+		t.Fatalf("Expected the upload to succeed after retrying, got %q (%v)", version, err)
+	}
+
+	server.failures = 5
+	if _, err := backend.Download(&bytes.Buffer{}); !errors.Is(err, remote.ErrServer) {
+		t.Errorf("Expected a server error once retries run out, got %v", err)
+	}
+}
+
+// TestSyncWrongKey checks a shared copy of another vault is refused without changing this one
+func TestSyncWrongKey(t *testing.T) {
+	laptop, _, key := createDevices(t, "first password")
+	backend := remote.NewDirectory(t.TempDir(), "Laptop")
+	syncDevice(t, laptop, key, backend)
+
+	otherKey, err := database.DeriveVaultKeys("second password", fastKDF)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	if _, err := remote.Sync(laptop, otherKey.EncryptionKey, backend); !errors.Is(err, remote.ErrUnreadableBlob) {
+		t.Errorf("Expected ErrUnreadableBlob, got %v", err)
+	}
+	if _, err := remote.NewWebDAV("ftp://example.com/vault", "", ""); !errors.Is(err, remote.ErrUnsupportedURL) {
+		t.Errorf("Expected ErrUnsupportedURL, got %v", err)
+	}
+}
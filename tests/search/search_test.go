@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/search"
+)
+
+// sampleDocuments returns a small set of documents used across search tests
+func sampleDocuments() []search.Document {
+	return []search.Document{
+		{ID: 1, Service: "https://github.com/login", Username: "octocat", Tags: []string{"work", "dev"}},
+		{ID: 2, Service: "https://mail.google.com", Username: "example@gmail.com", Notes: "recovery codes in the safe"},
+		{ID: 3, Service: "GitLab", Username: "octocat", Tags: []string{"dev"}},
+		{ID: 4, Service: "bank.example.com", Username: "jdoe", Notes: "PIN changed in March"},
+	}
+}
+
+// TestSearchSubstring tests case-insensitive substring matching on a URL service
+func TestSearchSubstring(t *testing.T) {
+	index := search.NewIndex(sampleDocuments())
+
+	results := index.Search("GitHub", 0)
+	t.Logf("Results: %v", results)
+
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Fatalf("Expected only entry 1 for \"GitHub\", got %v", results)
+	}
+	if results[0].Field != "service" {
+		t.Errorf("Expected best field to be service, got %s", results[0].Field)
+	}
+}
+
+// TestSearchTokens tests that every query token must match some field
+func TestSearchTokens(t *testing.T) {
+	index := search.NewIndex(sampleDocuments())
+
+	// "octocat" matches entries 1 and 3, "lab" narrows it down to GitLab
+	results := index.Search("octocat lab", 0)
+	t.Logf("Results: %v", results)
+
+	if len(results) != 1 || results[0].ID != 3 {
+		t.Fatalf("Expected only entry 3 for \"octocat lab\", got %v", results)
+	}
+
+	// Tags are searchable
+	results = index.Search("dev", 0)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results for tag \"dev\", got %v", results)
+	}
+}
+
+// TestSearchRanking tests that stronger matches are ranked above weaker ones
+func TestSearchRanking(t *testing.T) {
+	index := search.NewIndex(sampleDocuments())
+
+	// "git" is a prefix of both services, but only a fuzzy match elsewhere
+	results := index.Search("git", 0)
+	t.Logf("Results: %v", results)
+	if len(results) < 2 || (results[0].ID != 1 && results[0].ID != 3) {
+		t.Fatalf("Expected GitHub or GitLab to rank first, got %v", results)
+	}
+
+	// Words in decrypted notes are matched too
+	results = index.Search("march", 0)
+	if len(results) != 1 || results[0].Field != "notes" {
+		t.Fatalf("Expected a single notes match for \"march\", got %v", results)
+	}
+}
+
+// TestSearchFuzzy tests subsequence matching and the result limit
+func TestSearchFuzzy(t *testing.T) {
+	index := search.NewIndex(sampleDocuments())
+
+	results := index.Search("gthb", 0)
+	t.Logf("Results: %v", results)
+	if len(results) == 0 || results[0].ID != 1 {
+		t.Fatalf("Expected fuzzy query \"gthb\" to find GitHub, got %v", results)
+	}
+
+	results = index.Search("o", 1)
+	if len(results) != 1 {
+		t.Fatalf("Expected limit of 1 result, got %d", len(results))
+	}
+
+	if results := index.Search("   ", 0); results != nil {
+		t.Errorf("Expected no results for an empty query, got %v", results)
+	}
+}
+
+// TestBuildIndex tests that notes are decrypted in memory and searchable
+func TestBuildIndex(t *testing.T) {
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		t.Fatalf("GenerateSalt failed: %v", err)
+	}
+	key, _, err := encryption.DeriveMasterKeys("searchpassword", salt)
+	if err != nil {
+		t.Fatalf("DeriveMasterKeys failed: %v", err)
+	}
+
+	encryptedNotes, err := encryption.Encrypt("security question: first pet", key)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	entries := []*database.PasswordInformation{
+		{ID: 10, Service: "https://example.com", Username: "alice", EncryptedNotes: encryptedNotes},
+		{ID: 11, Service: "https://example.org", Username: "bob"},
+	}
+
+	index, err := search.BuildIndex(entries, key)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	results := index.Search("pet", 0)
+	if len(results) != 1 || results[0].ID != 10 {
+		t.Fatalf("Expected entry 10 for \"pet\", got %v", results)
+	}
+
+	// A wrong key must fail rather than silently skipping notes
+	wrongKey, _, _ := encryption.DeriveMasterKeys("wrongpassword", salt)
+	if _, err := search.BuildIndex(entries, wrongKey); err == nil {
+		t.Errorf("Expected BuildIndex to fail with the wrong key")
+	}
+}
+
+// TestLoadIndexSkipsUnreadable checks an entry whose notes cannot be decrypted is left out of a vault's index
+func TestLoadIndexSkipsUnreadable(t *testing.T) {
+	db, err := database.OpenMemoryDB()
+	if err != nil {
+		t.Fatalf("OpenMemoryDB failed: %v", err)
+	}
+	defer db.Close()
+
+	salt, err := encryption.GenerateSalt(16)
+	if err != nil {
+		t.Fatalf("GenerateSalt failed: %v", err)
+	}
+	key, _, err := encryption.DeriveMasterKeys("searchpassword", salt)
+	if err != nil {
+		t.Fatalf("DeriveMasterKeys failed: %v", err)
+	}
+	encryptedNotes, err := encryption.Encrypt("security question: first pet", key)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	readable, err := database.StorePassword(db, database.PasswordEntry{Service: "https://example.com", Username: "alice", EncryptedNotes: encryptedNotes})
+	if err != nil {
+		t.Fatalf("StorePassword failed: %v", err)
+	}
+	_, err = database.StorePassword(db, database.PasswordEntry{Service: "https://damaged.example.com", Username: "bob", EncryptedNotes: "not a ciphertext"})
+	if err != nil {
+		t.Fatalf("StorePassword failed: %v", err)
+	}
+
+	index, err := search.LoadIndex(db, key)
+	if err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+	if index.Len() != 1 {
+		t.Errorf("Expected only the readable entry to be indexed, got %d documents", index.Len())
+	}
+	if results := index.Search("pet", 0); len(results) != 1 || results[0].ID != readable.ID {
+		t.Errorf("Expected the readable entry for \"pet\", got %v", results)
+	}
+}
+
+// BenchmarkSearch measures searching a vault with several thousand entries
+func BenchmarkSearch(b *testing.B) {
+	docs := make([]search.Document, 5000)
+	for i := range docs {
+		docs[i] = search.Document{
+			ID:       i,
+			Service:  fmt.Sprintf("https://service%d.example.com/login", i),
+			Username: fmt.Sprintf("user%d@example.com", i),
+			Tags:     []string{"tag", fmt.Sprintf("group%d", i%10)},
+			Notes:    "some longer notes about this account and its recovery",
+		}
+	}
+	index := search.NewIndex(docs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.Search("service42 group2", 20)
+	}
+}
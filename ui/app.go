@@ -1,12 +1,24 @@
 package ui
 
 import (
+	"log"
+
 	"fyne.io/fyne/v2/app"
+	"github.com/cpainter1/PassLock/internal/config"
 	"github.com/cpainter1/PassLock/ui/views"
 )
 
 func RunApp() {
+	// Load settings before anything looks up vaults, falling back to the defaults on errors
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Using default settings: %v", err)
+		cfg = config.Default()
+	}
+	config.SetCurrent(cfg)
+
 	myApp := app.New()
+	myApp.Settings().SetTheme(ui.NewTheme(cfg.UI.Theme))
 	mainWindow := myApp.NewWindow("PassLock")
 
 	ui.ShowLoginUI(mainWindow)
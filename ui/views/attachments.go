@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// attachmentItems returns a form row for every attachment of an entry
+func (view *vaultView) attachmentItems(entry *database.PasswordInformation) []*widget.FormItem {
+	attachments, err := database.ListAttachments(view.db, entry.ID)
+	if err != nil {
+		log.Printf("Error loading attachments for entry %d: %v", entry.ID, err)
+		return nil
+	}
+
+	var items []*widget.FormItem
+	for _, attachment := range attachments {
+		label := widget.NewLabel(fmt.Sprintf("%s (%s)", attachment.Name, formatSize(attachment.Size)))
+
+		saveButton := widget.NewButtonWithIcon("", theme.DownloadIcon(), func() {
+			view.saveAttachment(entry, attachment)
+		})
+		deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			dialog.ShowConfirm("Delete Attachment", "Delete \""+attachment.Name+"\"?", func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				if err := database.DeleteAttachment(view.db, attachment.ID); err != nil {
+					dialog.ShowError(err, view.win)
+					return
+				}
+				view.audit(database.AuditDelete, entry, "attachment "+attachment.Name)
+				label.SetText("(deleted)")
+			}, view.win)
+		})
+
+		items = append(items, widget.NewFormItem("Attachment",
+			container.NewBorder(nil, nil, nil, container.NewHBox(saveButton, deleteButton), label)))
+	}
+
+	return items
+}
+
+// showAddAttachmentDialog lets the user pick a file to encrypt and attach to an entry
+func (view *vaultView) showAddAttachmentDialog(entry *database.PasswordInformation, onAdded func()) {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		if reader == nil {
+			return // Cancelled
+		}
+		defer func(reader fyne.URIReadCloser) {
+			err := reader.Close()
+			if err != nil {
+				log.Printf("Error closing file: %v", err)
+			}
+		}(reader)
+
+		_, err = database.AddAttachment(view.db, view.encryptionKey, entry.ID, reader.URI().Name(), reader)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.audit(database.AuditEdit, entry, "attached "+reader.URI().Name())
+
+		onAdded()
+	}, view.win)
+}
+
+// saveAttachment decrypts an attachment to a file chosen by the user
+func (view *vaultView) saveAttachment(entry *database.PasswordInformation, attachment *database.Attachment) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		if writer == nil {
+			return // Cancelled
+		}
+
+		err = database.ExtractAttachment(view.db, view.encryptionKey, attachment.ID, writer)
+		closeErr := writer.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("attachment could not be verified, discard the saved file: %w", err), view.win)
+			return
+		}
+		view.audit(database.AuditReveal, entry, "saved attachment "+attachment.Name)
+	}, view.win)
+	saveDialog.SetFileName(attachment.Name)
+	saveDialog.Show()
+}
+
+// formatSize formats a byte count for display
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
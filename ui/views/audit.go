@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// audit records vault activity, an entry may be nil for vault-wide events
+func (view *vaultView) audit(event database.AuditEvent, entry *database.PasswordInformation, detail string) {
+	record := database.AuditRecord{Event: event, Detail: detail}
+	if entry != nil {
+		record.EntryID = entry.ID
+		record.Service = entry.Service
+	}
+
+	// Failures are logged by the database package, the action itself already happened
+	_ = database.AppendAudit(view.db, view.encryptionKey, record)
+}
+
+// showAuditLogDialog lists the vault's audit log, newest first, and warns if the chain is broken
+func (view *vaultView) showAuditLogDialog() {
+	view.touch()
+
+	records, err := database.ReadAuditLog(view.db, view.encryptionKey)
+	if err != nil && !errors.Is(err, database.ErrAuditTampered) {
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	status := widget.NewLabel(fmt.Sprintf("%d records, chain verified", len(records)))
+	if err != nil {
+		status.SetText("WARNING: " + err.Error())
+		status.Importance = widget.DangerImportance
+	}
+	status.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int {
+			return len(records)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			record := records[len(records)-1-i]
+			text := fmt.Sprintf("%s  %s  %s", record.Time.Local().Format("2006-01-02 15:04:05"), record.Event, record.Actor)
+			if record.Service != "" {
+				text += "  " + record.Service
+			}
+			if record.Detail != "" {
+				text += "  (" + record.Detail + ")"
+			}
+			o.(*widget.Label).SetText(text)
+		})
+
+	exportButton := widget.NewButtonWithIcon("Export CSV", theme.UploadIcon(), view.saveAuditLog)
+
+	content := container.NewBorder(status, exportButton, nil, nil, list)
+	logDialog := dialog.NewCustom("Audit Log", "Close", content, view.win)
+	logDialog.Resize(fyne.NewSize(750, 450))
+	logDialog.Show()
+}
+
+// saveAuditLog writes the audit log as CSV to a file chosen by the user
+func (view *vaultView) saveAuditLog() {
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer func(writer io.Closer) {
+			_ = writer.Close()
+		}(writer)
+
+		err = database.ExportAuditLog(view.db, view.encryptionKey, writer)
+		if err != nil {
+			log.Printf("Error exporting audit log of vault %s: %v", view.vaultName, err)
+			dialog.ShowError(err, view.win)
+		}
+	}, view.win)
+	fileDialog.SetFileName(view.vaultName + "-audit.csv")
+	fileDialog.Resize(fyne.NewSize(700, 500))
+	fileDialog.Show()
+}
@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// backupCheckInterval is how often an unlocked vault checks whether a scheduled backup is due
+const backupCheckInterval = time.Hour
+
+// startBackupSchedule takes scheduled backups while the vault is unlocked
+func (view *vaultView) startBackupSchedule() {
+	view.stopBackups = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(backupCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := database.BackupIfDue(view.vaultName); err != nil {
+				log.Printf("Error taking scheduled backup of vault %s: %v", view.vaultName, err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(view.stopBackups)
+}
+
+// stopBackupSchedule stops scheduled backups when the vault is locked
+func (view *vaultView) stopBackupSchedule() {
+	if view.stopBackups != nil {
+		close(view.stopBackups)
+		view.stopBackups = nil
+	}
+}
+
+// showBackupsDialog lists the vault's backups and allows backing up and restoring
+func (view *vaultView) showBackupsDialog() {
+	view.touch()
+
+	backups, err := database.ListBackups(view.vaultName)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	selected := -1
+	backupList := widget.NewList(
+		func() int {
+			return len(backups)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(backupLabel(backups[i]))
+		})
+	backupList.OnSelected = func(i widget.ListItemID) {
+		selected = i
+	}
+
+	var backupsDialog dialog.Dialog
+
+	backupNowButton := widget.NewButtonWithIcon("Back Up Now", theme.DocumentSaveIcon(), func() {
+		if _, err := database.BackupVault(view.vaultName, database.BackupManual); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		backupsDialog.Hide()
+		view.showBackupsDialog()
+	})
+	restoreButton := widget.NewButtonWithIcon("Restore", theme.HistoryIcon(), func() {
+		if selected < 0 {
+			return
+		}
+		backupsDialog.Hide()
+		view.confirmRestoreBackup(backups[selected])
+	})
+	restoreButton.Importance = widget.DangerImportance
+
+	checkButton := widget.NewButtonWithIcon("Check Integrity", theme.ConfirmIcon(), func() {
+		backupsDialog.Hide()
+		view.showIntegrityDialog()
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(backupNowButton, restoreButton, checkButton), nil, nil, backupList)
+	backupsDialog = dialog.NewCustom("Backups", "Close", content, view.win)
+	backupsDialog.Resize(fyne.NewSize(550, 400))
+	backupsDialog.Show()
+}
+
+// confirmRestoreBackup asks for the backup's master password and replaces the vault with it
+func (view *vaultView) confirmRestoreBackup(backup *database.Backup) {
+	passwordEntry := widget.NewPasswordEntry()
+	message := widget.NewLabel("The vault will be replaced by the backup from " +
+		backup.CreatedAt.Local().Format("2006-01-02 15:04") + ". The current contents are backed up first.")
+	message.Wrapping = fyne.TextWrapWord
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("", message),
+		widget.NewFormItem("Master password", passwordEntry),
+	}
+	form := dialog.NewForm("Restore Backup", "Restore", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		if err := view.session.RestoreBackup(backup, passwordEntry.Text); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		// The backup may use another master password, so unlock again
+		view.lock()
+	}, view.win)
+	form.Resize(fyne.NewSize(450, 250))
+	form.Show()
+}
+
+// backupLabel describes a backup in the backup list
+func backupLabel(backup *database.Backup) string {
+	entries := "unreadable"
+	if backup.Entries >= 0 {
+		entries = fmt.Sprintf("%d entries", backup.Entries)
+	}
+
+	return fmt.Sprintf("%s - %s - %s (%s)",
+		backup.CreatedAt.Local().Format("2006-01-02 15:04:05"), backup.Reason, entries, formatSize(backup.Size))
+}
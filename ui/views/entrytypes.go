@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// showNewEntryDialog asks which type of entry to create
+func (view *vaultView) showNewEntryDialog() {
+	view.touch()
+
+	var labels []string
+	schemas := make(map[string]*database.EntrySchema)
+	for _, schema := range database.EntrySchemas {
+		labels = append(labels, schema.Label)
+		schemas[schema.Label] = schema
+	}
+
+	typeSelect := widget.NewSelect(labels, nil)
+	typeSelect.SetSelected(labels[0])
+
+	dialog.ShowForm("New Entry", "Next", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Type", typeSelect)},
+		func(confirmed bool) {
+			if confirmed {
+				view.showTypedEntryForm(schemas[typeSelect.Selected])
+			}
+		}, view.win)
+}
+
+// showTypedEntryForm displays a form built from an entry type's schema
+func (view *vaultView) showTypedEntryForm(schema *database.EntrySchema) {
+	titleEntry := widget.NewEntry()
+	usernameEntry := widget.NewEntry()
+	notesEntry := widget.NewMultiLineEntry()
+	tagsEntry := widget.NewEntry()
+	tagsEntry.SetPlaceHolder("Comma separated")
+
+	// Multi-line secrets (notes, keys) cannot be masked
+	secretEntry := widget.NewPasswordEntry()
+	if schema.SecretLines {
+		secretEntry = widget.NewMultiLineEntry()
+	}
+
+	items := []*widget.FormItem{widget.NewFormItem(schema.TitleLabel, titleEntry)}
+	if schema.UsernameLabel != "" {
+		items = append(items, widget.NewFormItem(schema.UsernameLabel, usernameEntry))
+	}
+	if schema.SecretLabel != "" {
+		items = append(items, widget.NewFormItem(schema.SecretLabel, secretEntry))
+	}
+
+	// One input per type-specific field, hidden fields are masked
+	fieldEntries := make(map[string]*widget.Entry)
+	for _, field := range schema.Fields {
+		fieldEntry := widget.NewEntry()
+		if field.Type.IsSecret() {
+			fieldEntry = widget.NewPasswordEntry()
+		}
+		if field.Type == database.FieldDate {
+			fieldEntry.SetPlaceHolder("YYYY-MM-DD")
+		}
+		fieldEntries[field.Key] = fieldEntry
+		items = append(items, widget.NewFormItem(field.Label, fieldEntry))
+	}
+
+	paths, options := view.folderPaths()
+	folderSelect := widget.NewSelect(options, nil)
+	folderSelect.SetSelected(options[0])
+	for name, id := range paths {
+		if id != 0 && id == view.selectedFolderID() {
+			folderSelect.SetSelected(name)
+		}
+	}
+
+	items = append(items,
+		widget.NewFormItem("Notes", notesEntry),
+		widget.NewFormItem("Folder", folderSelect),
+		widget.NewFormItem("Tags", tagsEntry),
+	)
+
+	form := dialog.NewForm("New "+schema.Label, "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		entry := &database.TypedEntry{
+			Type:     schema.Type,
+			Title:    titleEntry.Text,
+			Username: usernameEntry.Text,
+			Secret:   secretEntry.Text,
+			Notes:    notesEntry.Text,
+			Fields:   make(map[string]string),
+			FolderID: paths[folderSelect.Selected],
+		}
+		for key, fieldEntry := range fieldEntries {
+			entry.Fields[key] = fieldEntry.Text
+		}
+
+		view.confirmBreachedPassword(schema.Type, entry.Secret, func() {
+			view.storeTypedEntry(entry, splitTags(tagsEntry.Text))
+		})
+	}, view.win)
+	form.Resize(fyne.NewSize(500, 500))
+	form.Show()
+}
+
+// storeTypedEntry saves a new entry with its tags
+func (view *vaultView) storeTypedEntry(entry *database.TypedEntry, tags []string) {
+	// Validation and encryption happen in the database package
+	stored, err := database.StoreTypedEntry(view.db, view.encryptionKey, entry)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	if err := database.SetEntryTags(view.db, stored.ID, tags); err != nil {
+		dialog.ShowError(err, view.win)
+	}
+	view.audit(database.AuditCreate, stored, "")
+
+	view.loadSidebar()
+	view.refreshEntries()
+}
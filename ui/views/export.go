@@ -0,0 +1,232 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/exporter"
+	"github.com/cpainter1/PassLock/internal/kdbx"
+)
+
+// showExportVaultDialog asks for an export password and a destination, then exports the vault
+func showExportVaultDialog(win fyne.Window, vaultName string) {
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Export password", passwordEntry),
+		widget.NewFormItem("Confirm password", confirmEntry),
+	}
+
+	dialog.ShowForm("Export Vault", "Choose File", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if passwordEntry.Text == "" {
+			dialog.ShowError(errors.New("the export password cannot be empty"), win)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(errors.New("the export passwords do not match"), win)
+			return
+		}
+
+		win.SetFixedSize(false)
+		win.Resize(fyne.NewSize(700, 500))
+
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			ShowLoginUI(win)
+			if err != nil || writer == nil {
+				return
+			}
+			path := writer.URI().Path()
+			_ = writer.Close()
+
+			err = database.ExportVault(vaultName, path, passwordEntry.Text, config.Current().KDF.Params())
+			if err != nil {
+				log.Printf("Error exporting vault %s: %v", vaultName, err)
+				dialog.ShowError(err, win)
+				return
+			}
+			dialog.ShowInformation("Export Vault", "Vault exported to "+path, win)
+		}, win)
+		fileDialog.SetFileName(database.DefaultExportName(vaultName))
+		fileDialog.Show()
+	}, win)
+}
+
+// showImportVaultDialog asks for an export file and its password, then installs it as a new vault
+func showImportVaultDialog(win fyne.Window) {
+	win.SetFixedSize(false)
+	win.Resize(fyne.NewSize(700, 500))
+
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		ShowLoginUI(win)
+		if err != nil || reader == nil {
+			return
+		}
+		path := reader.URI().Path()
+		_ = reader.Close()
+
+		info, err := database.ReadExportInfo(path)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+
+		nameEntry := widget.NewEntry()
+		nameEntry.SetText(info.VaultName)
+		passwordEntry := widget.NewPasswordEntry()
+
+		items := []*widget.FormItem{
+			widget.NewFormItem("Vault name", nameEntry),
+			widget.NewFormItem("Export password", passwordEntry),
+		}
+
+		dialog.ShowForm("Import Vault", "Import", "Cancel", items, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			vaultName, err := database.ImportVault(path, passwordEntry.Text, nameEntry.Text)
+			if err != nil {
+				log.Printf("Error importing vault from %s: %v", path, err)
+				dialog.ShowError(err, win)
+				return
+			}
+
+			ShowLoginUI(win)
+			dialog.ShowInformation("Import Vault", "Vault imported as "+vaultName, win)
+		}, win)
+	}, win)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{database.ExportExtension}))
+	fileDialog.Show()
+}
+
+// showExportMenu shows the export formats below the export button
+func (view *vaultView) showExportMenu(anchor fyne.CanvasObject) {
+	view.touch()
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("KeePass Database...", view.showExportDialog),
+		fyne.NewMenuItem("Plaintext JSON...", func() {
+			view.showPlaintextExportDialog(exporter.PlaintextJSON)
+		}),
+		fyne.NewMenuItem("Plaintext CSV...", func() {
+			view.showPlaintextExportDialog(exporter.PlaintextCSV)
+		}),
+	)
+
+	position := fyne.CurrentApp().Driver().AbsolutePositionForObject(anchor)
+	widget.ShowPopUpMenuAtPosition(menu, view.win.Canvas(), position.AddXY(0, anchor.Size().Height))
+}
+
+// showExportDialog asks for a password for a KeePass database and a destination, then exports the entries
+func (view *vaultView) showExportDialog() {
+	view.touch()
+
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("KeePass password", passwordEntry),
+		widget.NewFormItem("Confirm password", confirmEntry),
+	}
+
+	dialog.ShowForm("Export to KeePass", "Choose File", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if passwordEntry.Text == "" {
+			dialog.ShowError(errors.New("the KeePass password cannot be empty"), view.win)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(errors.New("the KeePass passwords do not match"), view.win)
+			return
+		}
+
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer func(writer io.Closer) {
+				_ = writer.Close()
+			}(writer)
+
+			err = exporter.ExportKDBX(view.db, view.encryptionKey, writer, passwordEntry.Text, kdbx.DefaultOptions())
+			if err != nil {
+				log.Printf("Error exporting vault %s to KeePass: %v", view.vaultName, err)
+				dialog.ShowError(err, view.win)
+				return
+			}
+			dialog.ShowInformation("Export to KeePass", "Entries exported to "+writer.URI().Path(), view.win)
+		}, view.win)
+		fileDialog.SetFileName(view.vaultName + exporter.KDBXExtension)
+		fileDialog.Resize(fyne.NewSize(700, 500))
+		fileDialog.Show()
+	}, view.win)
+}
+
+// showPlaintextExportDialog warns that the export is unencrypted, asks for the master password again and a
+// destination, then writes the decrypted entries
+func (view *vaultView) showPlaintextExportDialog(format exporter.PlaintextFormat) {
+	view.touch()
+
+	warning := widget.NewLabel("The exported file is not encrypted. Anyone who can read it can read every password.")
+	warning.Wrapping = fyne.TextWrapWord
+	passwordEntry := widget.NewPasswordEntry()
+	forceCheck := widget.NewCheck("Write even if other users can read the location", nil)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("", warning),
+		widget.NewFormItem("Master password", passwordEntry),
+		widget.NewFormItem("", forceCheck),
+	}
+
+	title := "Export to " + strings.ToUpper(string(format))
+	formDialog := dialog.NewForm(title, "Choose File", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if err := database.VerifyMasterPassword(view.db, passwordEntry.Text); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			path := writer.URI().Path()
+			_ = writer.Close()
+
+			count, err := exporter.ExportPlaintext(view.db, view.encryptionKey, passwordEntry.Text, path, format, forceCheck.Checked)
+			if err != nil {
+				// The file dialog leaves an empty file behind when the export is refused
+				if info, statErr := os.Stat(path); statErr == nil && info.Size() == 0 {
+					_ = os.Remove(path)
+				}
+				log.Printf("Error exporting vault %s to plaintext %s: %v", view.vaultName, format, err)
+				dialog.ShowError(err, view.win)
+				return
+			}
+			dialog.ShowInformation(title, fmt.Sprintf("%d entries exported to %s", count, path), view.win)
+		}, view.win)
+		fileDialog.SetFileName(view.vaultName + "." + string(format))
+		fileDialog.Resize(fyne.NewSize(700, 500))
+		fileDialog.Show()
+	}, view.win)
+	formDialog.Resize(fyne.NewSize(450, 0))
+	formDialog.Show()
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// customFieldItems returns a form row for every custom field of an entry
+func (view *vaultView) customFieldItems(entry *database.PasswordInformation) []*widget.FormItem {
+	fields, err := database.GetCustomFields(view.db, entry.ID)
+	if err != nil {
+		log.Printf("Error loading custom fields for entry %d: %v", entry.ID, err)
+		return nil
+	}
+
+	var items []*widget.FormItem
+	for _, field := range fields {
+		items = append(items, widget.NewFormItem(field.Name, view.customFieldValue(entry, field)))
+	}
+
+	return items
+}
+
+// customFieldValue displays a custom field value, secret values stay hidden until revealed
+func (view *vaultView) customFieldValue(entry *database.PasswordInformation, field *database.CustomField) fyne.CanvasObject {
+	decrypt := func() (string, bool) {
+		value, err := encryption.Decrypt(field.EncryptedValue, view.encryptionKey)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return "", false
+		}
+		return value, true
+	}
+
+	valueLabel := widget.NewLabel("")
+	valueLabel.Wrapping = fyne.TextWrapWord
+
+	copyButton := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		if value, ok := decrypt(); ok {
+			view.copyToClipboard(value)
+			view.audit(database.AuditCopy, entry, "field "+field.Name)
+		}
+	})
+	deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		dialog.ShowConfirm("Delete Field", "Delete the field \""+field.Name+"\"?", func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := database.DeleteCustomField(view.db, field.ID); err != nil {
+				dialog.ShowError(err, view.win)
+				return
+			}
+			view.audit(database.AuditDelete, entry, "field "+field.Name)
+			valueLabel.SetText("(deleted)")
+		}, view.win)
+	})
+
+	buttons := container.NewHBox(copyButton, deleteButton)
+	if field.Type.IsSecret() {
+		valueLabel.SetText("********")
+		revealButton := widget.NewButtonWithIcon("", theme.VisibilityIcon(), func() {
+			if value, ok := decrypt(); ok {
+				valueLabel.SetText(value)
+				view.audit(database.AuditReveal, entry, "field "+field.Name)
+			}
+		})
+		buttons.Objects = append([]fyne.CanvasObject{revealButton}, buttons.Objects...)
+	} else if value, err := encryption.Decrypt(field.EncryptedValue, view.encryptionKey); err == nil {
+		valueLabel.SetText(value)
+	} else {
+		log.Printf("Error decrypting custom field %d: %v", field.ID, err)
+		valueLabel.SetText("(unreadable)")
+	}
+
+	return container.NewBorder(nil, nil, nil, buttons, valueLabel)
+}
+
+// showAddFieldDialog displays a form to add a typed custom field to an entry
+func (view *vaultView) showAddFieldDialog(entry *database.PasswordInformation, onAdded func()) {
+	nameEntry := widget.NewEntry()
+	valueEntry := widget.NewEntry()
+
+	var typeOptions []string
+	for _, fieldType := range database.FieldTypes {
+		typeOptions = append(typeOptions, string(fieldType))
+	}
+	typeSelect := widget.NewSelect(typeOptions, func(selected string) {
+		// Secret values are masked while typing, like passwords
+		valueEntry.Password = database.FieldType(selected).IsSecret()
+		valueEntry.Refresh()
+	})
+	typeSelect.SetSelected(string(database.FieldText))
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Type", typeSelect),
+		widget.NewFormItem("Value", valueEntry),
+	}
+
+	form := dialog.NewForm("Add Field", "Add", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		fieldType := database.FieldType(typeSelect.Selected)
+		if err := database.ValidateFieldValue(fieldType, valueEntry.Text); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		encryptedValue, err := encryption.Encrypt(valueEntry.Text, view.encryptionKey)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		_, err = database.AddCustomField(view.db, entry.ID, database.CustomFieldEntry{
+			Name:           nameEntry.Text,
+			Type:           fieldType,
+			EncryptedValue: encryptedValue,
+		})
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.audit(database.AuditEdit, entry, "added field "+nameEntry.Text)
+
+		onAdded()
+	}, view.win)
+	form.Resize(fyne.NewSize(400, 250))
+	form.Show()
+}
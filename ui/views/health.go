@@ -0,0 +1,282 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/health"
+)
+
+// healthIssueNames are the display names of password health issues
+var healthIssueNames = map[health.Issue]string{
+	health.IssueBreached: "Breached",
+	health.IssueWeak:     "Weak",
+	health.IssueReused:   "Reused",
+	health.IssueSimilar:  "Similar",
+	health.IssueOld:      "Old",
+	health.IssueInsecure: "Insecure URL",
+	health.IssueNo2FA:    "No 2FA",
+}
+
+// unlockedVault is another vault whose passwords are compared for reuse
+type unlockedVault struct {
+	name          string
+	encryptionKey string
+}
+
+// showHealthDialog reports weak, reused, old and insecure passwords, comparing with other unlocked vaults
+func (view *vaultView) showHealthDialog(others []unlockedVault) {
+	view.touch()
+
+	report, err := view.buildHealthReport(others)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	status := widget.NewLabel(fmt.Sprintf("Score %d/100, %d passwords checked, %d with issues.", report.Score, report.Checked, len(report.Entries)))
+	switch {
+	case report.Score < 50:
+		status.Importance = widget.DangerImportance
+	case report.Score < 80:
+		status.Importance = widget.WarningImportance
+	default:
+		status.Importance = widget.SuccessImportance
+	}
+	status.TextStyle = fyne.TextStyle{Bold: true}
+	status.Wrapping = fyne.TextWrapWord
+
+	counts := make([]string, 0, len(healthIssueNames))
+	for _, issue := range []health.Issue{health.IssueBreached, health.IssueWeak, health.IssueReused, health.IssueSimilar, health.IssueOld, health.IssueInsecure, health.IssueNo2FA} {
+		counts = append(counts, fmt.Sprintf("%s: %d", healthIssueNames[issue], report.Counts[issue]))
+	}
+	compared := "Compared with this vault only"
+	if len(others) > 0 {
+		names := make([]string, 0, len(others))
+		for _, other := range others {
+			names = append(names, other.name)
+		}
+		compared = "Compared with " + strings.Join(names, ", ")
+	}
+	summary := widget.NewLabel(strings.Join(counts, "   ") + "\n" + compared)
+	summary.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int {
+			return len(report.Entries)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(healthEntryText(report.Entries[i]))
+		})
+
+	var healthDialog dialog.Dialog
+	compareButton := widget.NewButtonWithIcon("Compare with Vault...", theme.SearchIcon(), func() {
+		view.showHealthCompareDialog(others, func(added []unlockedVault) {
+			healthDialog.Hide()
+			view.showHealthDialog(added)
+		})
+	})
+	exportButton := widget.NewButtonWithIcon("Export JSON", theme.UploadIcon(), func() {
+		view.saveHealthReport(report)
+	})
+
+	remindersButton := widget.NewButtonWithIcon("Rotations and Expiries", theme.MediaReplayIcon(), func() {
+		view.showDueReminders(true)
+	})
+
+	content := container.NewBorder(container.NewVBox(status, summary), container.NewHBox(compareButton, exportButton, remindersButton), nil, nil, list)
+	healthDialog = dialog.NewCustom("Password Health", "Close", content, view.win)
+	healthDialog.Resize(fyne.NewSize(750, 450))
+	healthDialog.Show()
+}
+
+// buildHealthReport opens the other vaults and the breach data for as long as it takes to check the passwords
+func (view *vaultView) buildHealthReport(others []unlockedVault) (*health.Report, error) {
+	options := health.Options{MaxAgeDays: health.DefaultMaxAgeDays}
+	if path := config.Current().BreachData; path != "" {
+		breaches, err := health.OpenBreachData(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func(breaches *health.BreachData) {
+			_ = breaches.Close()
+		}(breaches)
+		options.Breaches = breaches
+	}
+	for _, other := range others {
+		session, err := database.OpenVaultSession(other.name)
+		if err != nil {
+			return nil, err
+		}
+		defer func(session *database.VaultSession) {
+			_ = session.Close()
+		}(session)
+		options.Others = append(options.Others, health.Source{Name: other.name, DB: session.DB, EncryptionKey: other.encryptionKey})
+	}
+
+	return health.BuildReport(view.db, view.encryptionKey, options)
+}
+
+// healthEntryText describes an entry's issues on one line
+func healthEntryText(entry *health.EntryReport) string {
+	name := entry.Service
+	if entry.Username != "" {
+		name += " (" + entry.Username + ")"
+	}
+
+	details := make([]string, 0, len(entry.Issues))
+	for _, issue := range entry.Issues {
+		detail := healthIssueNames[issue]
+		switch issue {
+		case health.IssueBreached:
+			detail += fmt.Sprintf(" (seen %d times)", entry.Breaches)
+		case health.IssueWeak:
+			detail += " (" + entry.Strength.String() + ")"
+		case health.IssueReused:
+			detail += " with " + strings.Join(entry.ReusedWith, ", ")
+		case health.IssueSimilar:
+			detail += " to " + strings.Join(entry.SimilarTo, ", ")
+		case health.IssueOld:
+			detail += fmt.Sprintf(" (%d days)", entry.AgeDays)
+		}
+		details = append(details, detail)
+	}
+
+	return name + ": " + strings.Join(details, "; ")
+}
+
+// showHealthCompareDialog unlocks another vault with its master password and adds it to the compared vaults
+func (view *vaultView) showHealthCompareDialog(others []unlockedVault, onUnlocked func([]unlockedVault)) {
+	vaults, err := database.ListVaults()
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+	vaults = slices.DeleteFunc(vaults, func(name string) bool {
+		return name == view.vaultName || slices.ContainsFunc(others, func(other unlockedVault) bool {
+			return other.name == name
+		})
+	})
+	if len(vaults) == 0 {
+		dialog.ShowInformation("Compare with Vault", "There are no other vaults to compare with.", view.win)
+		return
+	}
+
+	vaultSelect := widget.NewSelect(vaults, nil)
+	vaultSelect.SetSelected(vaults[0])
+	passwordEntry := widget.NewPasswordEntry()
+
+	dialog.ShowForm("Compare with Vault", "Unlock", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Vault", vaultSelect),
+			widget.NewFormItem("Master Password", passwordEntry),
+		},
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			encryptionKey, err := unlockVault(vaultSelect.Selected, passwordEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, view.win)
+				return
+			}
+			onUnlocked(append(slices.Clone(others), unlockedVault{name: vaultSelect.Selected, encryptionKey: encryptionKey}))
+		}, view.win)
+}
+
+// unlockVault verifies the master password of a vault and returns its encryption key
+func unlockVault(vaultName string, masterPassword string) (string, error) {
+	salt, err := database.GetSaltFromVault(vaultName)
+	if err != nil {
+		return "", err
+	}
+	kdfParams, err := database.GetKDFParamsFromVault(vaultName)
+	if err != nil {
+		return "", err
+	}
+	encryptionKey, authKey, err := encryption.DeriveMasterKeysWithParams(masterPassword, salt, kdfParams)
+	if err != nil {
+		return "", err
+	}
+
+	authenticated, err := database.AuthenticateVault(vaultName, authKey)
+	if err != nil {
+		return "", err
+	}
+	if !authenticated {
+		return "", errors.New("the master password is incorrect")
+	}
+
+	return encryptionKey, nil
+}
+
+// saveHealthReport writes a health report as JSON to a file chosen by the user
+func (view *vaultView) saveHealthReport(report *health.Report) {
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer func(writer io.Closer) {
+			_ = writer.Close()
+		}(writer)
+
+		err = report.WriteJSON(writer)
+		if err != nil {
+			log.Printf("Error exporting health report of vault %s: %v", view.vaultName, err)
+			dialog.ShowError(err, view.win)
+		}
+	}, view.win)
+	fileDialog.SetFileName(view.vaultName + "-health.json")
+	fileDialog.Resize(fyne.NewSize(700, 500))
+	fileDialog.Show()
+}
+
+// confirmBreachedPassword saves right away unless the password appears in the configured breach data, in
+// which case the user is asked first
+func (view *vaultView) confirmBreachedPassword(entryType database.EntryType, password string, save func()) {
+	path := config.Current().BreachData
+	if path == "" || password == "" || !health.ChecksEntryType(entryType) {
+		save()
+		return
+	}
+
+	// A missing or unreadable dataset must not keep entries from being saved
+	count := 0
+	breaches, err := health.OpenBreachData(path)
+	if err == nil {
+		count, err = breaches.BreachCount(password)
+		_ = breaches.Close()
+	}
+	if err != nil {
+		log.Printf("Error checking password against breach data %s: %v", path, err)
+	}
+	if count == 0 {
+		save()
+		return
+	}
+
+	dialog.ShowConfirm("Breached Password",
+		fmt.Sprintf("This password appears %d times in known data breaches and is likely to be guessed. Save it anyway?", count),
+		func(confirmed bool) {
+			if confirmed {
+				save()
+			}
+		}, view.win)
+}
@@ -0,0 +1,197 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/exporter"
+	"github.com/cpainter1/PassLock/internal/importer"
+)
+
+// showImportMenu shows the import sources below the import button
+func (view *vaultView) showImportMenu(anchor fyne.CanvasObject) {
+	view.touch()
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("From File...", view.showImportDialog),
+		fyne.NewMenuItem("From pass Store...", view.showPassImportDialog),
+	)
+
+	position := fyne.CurrentApp().Driver().AbsolutePositionForObject(anchor)
+	widget.ShowPopUpMenuAtPosition(menu, view.win.Canvas(), position.AddXY(0, anchor.Size().Height))
+}
+
+// showImportDialog asks for a file exported from another password manager and previews its import
+func (view *vaultView) showImportDialog() {
+	view.touch()
+
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer func(reader io.Closer) {
+			_ = reader.Close()
+		}(reader)
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			log.Printf("Error reading import file: %v", err)
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		var result *importer.Result
+		switch strings.ToLower(filepath.Ext(reader.URI().Path())) {
+		case exporter.KDBXExtension:
+			view.showImportPasswordDialog("KeePass password", func(password string) (*importer.Result, error) {
+				return importer.ParseKDBX(bytes.NewReader(data), password)
+			})
+			return
+		case ".json":
+			result, err = importer.ParseBitwardenJSON(bytes.NewReader(data), "")
+			if errors.Is(err, importer.ErrBitwardenPassword) {
+				view.showImportPasswordDialog("Export password", func(password string) (*importer.Result, error) {
+					return importer.ParseBitwardenJSON(bytes.NewReader(data), password)
+				})
+				return
+			}
+		case ".1pux":
+			result, err = importer.Parse1PUX(bytes.NewReader(data))
+		default:
+			result, err = importer.ParseCSV(bytes.NewReader(data))
+		}
+		if err != nil {
+			log.Printf("Error reading import file: %v", err)
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		view.confirmImport(result)
+	}, view.win)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".csv", ".json", ".1pux", exporter.KDBXExtension}))
+	fileDialog.Resize(fyne.NewSize(700, 500))
+	fileDialog.Show()
+}
+
+// showPassImportDialog asks for a pass password store, then the OpenPGP private key that decrypts it
+func (view *vaultView) showPassImportDialog() {
+	view.touch()
+
+	folderDialog := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil || dir == nil {
+			return
+		}
+
+		keyDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer func(reader io.Closer) {
+				_ = reader.Close()
+			}(reader)
+
+			privateKey, err := io.ReadAll(reader)
+			if err != nil {
+				log.Printf("Error reading private key: %v", err)
+				dialog.ShowError(err, view.win)
+				return
+			}
+
+			view.showImportPasswordDialog("Key passphrase", func(passphrase string) (*importer.Result, error) {
+				return importer.ParsePass(dir.Path(), bytes.NewReader(privateKey), passphrase)
+			})
+		}, view.win)
+		keyDialog.SetFilter(storage.NewExtensionFileFilter([]string{".asc", ".gpg", ".key", ".pgp"}))
+		keyDialog.Resize(fyne.NewSize(700, 500))
+		keyDialog.Show()
+	}, view.win)
+	folderDialog.Resize(fyne.NewSize(700, 500))
+	folderDialog.Show()
+}
+
+// showImportPasswordDialog asks for the password of an encrypted import file before previewing its import
+func (view *vaultView) showImportPasswordDialog(label string, parse func(password string) (*importer.Result, error)) {
+	passwordEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{
+		widget.NewFormItem(label, passwordEntry),
+	}
+
+	dialog.ShowForm("Import Entries", "Open", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		result, err := parse(passwordEntry.Text)
+		if err != nil {
+			log.Printf("Error reading import file: %v", err)
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		view.confirmImport(result)
+	}, view.win)
+}
+
+// confirmImport previews the entries and skipped rows of an import before storing them
+func (view *vaultView) confirmImport(result *importer.Result) {
+	summary := widget.NewLabel(fmt.Sprintf("Format: %s\n%d entries will be imported, %d were skipped, %d warnings.",
+		result.Format, len(result.Records), len(result.Skipped), len(result.Warnings)))
+
+	var lines []string
+	for _, record := range result.Records {
+		lines = append(lines, record.Service+" - "+record.Username)
+	}
+	unit := "item"
+	switch result.Format {
+	case importer.FormatKeePass, importer.FormatBitwardenJSON, importer.Format1PUX, importer.FormatPass:
+	default:
+		unit = "line"
+	}
+	for _, skipped := range result.Skipped {
+		lines = append(lines, fmt.Sprintf("Skipped %s %d: %s", unit, skipped.Line, skipped.Reason))
+	}
+	for _, warning := range result.Warnings {
+		lines = append(lines, fmt.Sprintf("Warning for %s: %s", warning.Item, warning.Message))
+	}
+	preview := widget.NewList(
+		func() int {
+			return len(lines)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(lines[i])
+		})
+
+	content := container.NewBorder(summary, nil, nil, nil, preview)
+	confirm := dialog.NewCustomConfirm("Import Entries", "Import", "Cancel", content, func(confirmed bool) {
+		if !confirmed || len(result.Records) == 0 {
+			return
+		}
+
+		err := importer.Apply(view.db, view.encryptionKey, result)
+		if err != nil {
+			log.Printf("Error importing entries: %v", err)
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		view.loadSidebar()
+		view.refreshEntries()
+		dialog.ShowInformation("Import Entries", fmt.Sprintf(
+			"Imported %d entries and created %d folders.", result.Imported, result.FoldersCreated), view.win)
+	}, view.win)
+	confirm.Resize(fyne.NewSize(550, 450))
+	confirm.Show()
+}
@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// showIntegrityDialog checks the vault and lists the problems found, offering to quarantine corrupt entries
+func (view *vaultView) showIntegrityDialog() {
+	view.touch()
+
+	report, err := database.CheckVaultIntegrity(view.db, view.encryptionKey)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+	quarantined, err := database.ListQuarantine(view.db)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	status := widget.NewLabel(fmt.Sprintf("%d entries checked, no problems found.", report.Entries))
+	if !report.Healthy() {
+		status.SetText(fmt.Sprintf("%d entries checked, %d problems found.", report.Entries, len(report.Issues)))
+		status.Importance = widget.DangerImportance
+	}
+	status.Wrapping = fyne.TextWrapWord
+
+	lines := make([]string, 0, len(report.Issues)+len(quarantined))
+	for _, issue := range report.Issues {
+		if issue.Kind == database.IssueEntry {
+			lines = append(lines, fmt.Sprintf("%s: %s", issue.Service, issue.Detail))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", issue.Kind, issue.Detail))
+		}
+	}
+	for _, entry := range quarantined {
+		lines = append(lines, fmt.Sprintf("In quarantine since %s: %s - %s (%s)", entry.QuarantinedAt, entry.Service, entry.Username, entry.Reason))
+	}
+	list := widget.NewList(
+		func() int {
+			return len(lines)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(lines[i])
+		})
+
+	var integrityDialog dialog.Dialog
+	corrupt := len(report.CorruptEntries())
+	quarantineButton := widget.NewButtonWithIcon(fmt.Sprintf("Quarantine %d Entries", corrupt), theme.WarningIcon(), func() {
+		dialog.ShowConfirm("Quarantine Entries",
+			"Entries that cannot be decrypted are moved out of the vault (a backup is taken first). "+
+				"The next sync restores them from a healthy copy.", func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				integrityDialog.Hide()
+				if _, err := database.QuarantineEntries(view.db, view.encryptionKey, report); err != nil {
+					dialog.ShowError(err, view.win)
+					return
+				}
+				view.refreshEntries()
+				view.showIntegrityDialog()
+			}, view.win)
+	})
+	quarantineButton.Importance = widget.DangerImportance
+	if corrupt == 0 || view.session.ReadOnly {
+		quarantineButton.Disable()
+	}
+
+	content := container.NewBorder(status, quarantineButton, nil, nil, list)
+	integrityDialog = dialog.NewCustom("Vault Integrity", "Close", content, view.win)
+	integrityDialog.Resize(fyne.NewSize(650, 400))
+	integrityDialog.Show()
+}
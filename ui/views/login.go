@@ -1,13 +1,18 @@
 package ui
 
 import (
+	"log"
+	"path/filepath"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/config"
 	"github.com/cpainter1/PassLock/internal/database"
 	"github.com/cpainter1/PassLock/internal/encryption"
-	"log"
 )
 
 // ShowCreateVaultForm displays a form to create a new vault.
@@ -28,6 +33,22 @@ func ShowCreateVaultForm(win fyne.Window) {
 		fyne.TextStyle{Bold: true})
 	masterPasswordNote.Wrapping = fyne.TextWrapWord // Wrapping
 
+	// Optional location outside the vault directory
+	locationDir := ""
+	locationLabel := widget.NewLabel("Location: vault directory")
+	locationLabel.Truncation = fyne.TextTruncateEllipsis
+	locationButton := widget.NewButtonWithIcon("Choose Location", theme.FolderOpenIcon(), func() {
+		win.Resize(fyne.NewSize(700, 500))
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			win.Resize(fyne.NewSize(300, 250))
+			if err != nil || dir == nil {
+				return
+			}
+			locationDir = dir.Path()
+			locationLabel.SetText("Location: " + locationDir)
+		}, win)
+	})
+
 	// Create button
 	createButton := widget.NewButtonWithIcon("Create", theme.ConfirmIcon(), func() {
 		vaultName := vaultNameEntry.Text
@@ -38,22 +59,36 @@ func ShowCreateVaultForm(win fyne.Window) {
 			return
 		}
 
+		// Check the name before the slow key derivation
+		if err := database.ValidateVaultName(vaultName); err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+
 		keySalt, err := encryption.GenerateSalt(16)
 		if err != nil {
 			log.Printf("Error creating salt: %s", err)
 			return
 		}
 
-		_, authKey, err := encryption.DeriveMasterKeys(vaultPassword, keySalt)
+		// New vaults use the configured key derivation settings
+		kdfParams := config.Current().KDF.Params()
+		_, authKey, err := encryption.DeriveMasterKeysWithParams(vaultPassword, keySalt, kdfParams)
 		log.Printf("Derived master key: %v", authKey)
 		if err != nil {
 			log.Fatalf("Failed to derive master keys: %v", err)
 			return
 		}
 
-		err = database.CreateVault(vaultName, authKey, keySalt)
+		if locationDir != "" {
+			_, err = database.CreateVaultAt(
+				filepath.Join(locationDir, vaultName+database.VaultExtension), authKey, keySalt, kdfParams)
+		} else {
+			err = database.CreateVaultWithKDF(vaultName, authKey, keySalt, kdfParams)
+		}
 		if err != nil {
 			log.Println("Failed to create vault:", err)
+			dialog.ShowError(err, win)
 			return
 		}
 
@@ -74,6 +109,8 @@ func ShowCreateVaultForm(win fyne.Window) {
 		vaultNameEntry,
 		vaultPasswordEntry,
 		masterPasswordNote,
+		locationLabel,
+		locationButton,
 		createButton,
 		cancelButton,
 	)
@@ -109,8 +146,15 @@ func ShowAuthenticationForm(win fyne.Window, vaultName string) {
 			return
 		}
 
-		// Obtain authKey from provided master password
-		_, authKey, err := encryption.DeriveMasterKeys(vaultPasswordEntry.Text, salt)
+		kdfParams, err := database.GetKDFParamsFromVault(vaultName)
+		if err != nil {
+			log.Printf("Error retrieving key derivation settings: %s", err)
+			authResultLabel.SetText("Failed to authenticate")
+			return
+		}
+
+		// Obtain encryptionKey and authKey from provided master password
+		encryptionKey, authKey, err := encryption.DeriveMasterKeysWithParams(vaultPasswordEntry.Text, salt, kdfParams)
 		if err != nil {
 			log.Printf("Failed to derive master key: %v", err)
 		}
@@ -129,7 +173,7 @@ func ShowAuthenticationForm(win fyne.Window, vaultName string) {
 			return
 		} else {
 			authResultLabel.SetText("Authentication succeeded")
-			// TODO: Implement main view
+			ShowVaultUI(win, vaultName, encryptionKey)
 		}
 	})
 	authenticateButton.Importance = widget.HighImportance
@@ -183,16 +227,24 @@ func ShowLoginUI(win fyne.Window) {
 		},
 		// Create item
 		func() fyne.CanvasObject {
-			// Return new button for each vault
-			return widget.NewButton("", nil)
+			// Return new button for each vault, with a menu button for vault actions
+			return container.NewBorder(nil, nil, nil,
+				widget.NewButtonWithIcon("", theme.MoreVerticalIcon(), nil),
+				widget.NewButton("", nil))
 		},
 		// Update item
 		func(i int, o fyne.CanvasObject) {
-			button := o.(*widget.Button)
+			row := o.(*fyne.Container)
+			button := row.Objects[0].(*widget.Button)
 			button.SetText(vaults[i])
 			button.OnTapped = func() {
 				ShowAuthenticationForm(win, vaults[i])
 			}
+
+			menuButton := row.Objects[1].(*widget.Button)
+			menuButton.OnTapped = func() {
+				showVaultActionsMenu(win, vaults[i], menuButton)
+			}
 		})
 
 	// Button to create a new vault
@@ -204,6 +256,30 @@ func ShowLoginUI(win fyne.Window) {
 		})
 	createVaultButton.Importance = widget.HighImportance
 
+	// Button to open a vault file from anywhere, it is registered so it stays listed
+	openVaultButton := widget.NewButtonWithIcon(
+		"Open Vault File",
+		theme.FolderOpenIcon(),
+		func() {
+			showOpenVaultFileDialog(win)
+		})
+
+	// Button to import an encrypted vault export as a new vault
+	importVaultButton := widget.NewButtonWithIcon(
+		"Import Vault",
+		theme.DownloadIcon(),
+		func() {
+			showImportVaultDialog(win)
+		})
+
+	// Button to list archived vaults
+	archivedVaultsButton := widget.NewButtonWithIcon(
+		"Archived Vaults",
+		theme.StorageIcon(),
+		func() {
+			showArchivedVaultsDialog(win)
+		})
+
 	// Create "Vaults:" label
 	vaultsLabel := widget.NewLabelWithStyle(
 		"Vaults:",
@@ -215,6 +291,9 @@ func ShowLoginUI(win fyne.Window) {
 		title,
 		description,
 		createVaultButton,
+		openVaultButton,
+		importVaultButton,
+		archivedVaultsButton,
 		vaultsLabel,
 	)
 	// Make a border to contain all objects
@@ -228,3 +307,31 @@ func ShowLoginUI(win fyne.Window) {
 
 	win.SetContent(fullContent)
 }
+
+// showOpenVaultFileDialog registers a vault file chosen by the user and shows its authentication form
+func showOpenVaultFileDialog(win fyne.Window) {
+	win.SetFixedSize(false)
+	win.Resize(fyne.NewSize(700, 500))
+
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			ShowLoginUI(win)
+			return
+		}
+		path := reader.URI().Path()
+		_ = reader.Close()
+
+		vaultName := database.VaultNameFromPath(path)
+		err = database.RegisterVault(vaultName, path)
+		if err != nil {
+			log.Printf("Error opening vault file %s: %v", path, err)
+			ShowLoginUI(win)
+			dialog.ShowError(err, win)
+			return
+		}
+
+		ShowAuthenticationForm(win, vaultName)
+	}, win)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{database.VaultExtension}))
+	fileDialog.Show()
+}
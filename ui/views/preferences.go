@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"image/color"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"github.com/cpainter1/PassLock/internal/config"
+)
+
+// =-- Theme --= //
+
+// variantTheme forces the default theme into a single light or dark variant
+type variantTheme struct {
+	fyne.Theme
+	variant fyne.ThemeVariant
+}
+
+// Color returns the theme color for the forced variant
+func (t variantTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	return t.Theme.Color(name, t.variant)
+}
+
+// NewTheme returns the theme for a configured theme name ("system" follows the OS)
+func NewTheme(name string) fyne.Theme {
+	switch name {
+	case "light":
+		return variantTheme{Theme: theme.DefaultTheme(), variant: theme.VariantLight}
+	case "dark":
+		return variantTheme{Theme: theme.DefaultTheme(), variant: theme.VariantDark}
+	default:
+		return theme.DefaultTheme()
+	}
+}
+
+// =-- Clipboard and Auto-Lock --= //
+
+// copyToClipboard copies a secret, clearing it after the configured delay unless it was replaced
+func (view *vaultView) copyToClipboard(value string) {
+	clipboard := view.win.Clipboard()
+	clipboard.SetContent(value)
+
+	delay := config.Current().UI.ClipboardClearSeconds
+	if delay <= 0 {
+		return
+	}
+	time.AfterFunc(time.Duration(delay)*time.Second, func() {
+		if clipboard.Content() == value {
+			clipboard.SetContent("")
+		}
+	})
+}
+
+// touch records user activity, restarting the auto-lock timer
+func (view *vaultView) touch() {
+	minutes := config.Current().AutoLockMinutes
+	if minutes <= 0 {
+		return
+	}
+
+	delay := time.Duration(minutes) * time.Minute
+	if view.idleTimer == nil {
+		view.idleTimer = time.AfterFunc(delay, view.lock)
+		return
+	}
+	view.idleTimer.Reset(delay)
+}
@@ -0,0 +1,204 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+)
+
+// reminderDays is how far ahead rotations and expiries are shown after unlocking
+const reminderDays = 14
+
+// rotationPeriods are the rotation periods offered in days
+var rotationPeriods = []int{30, 60, 90, 180, 365}
+
+// =-- Rotation Policies --= //
+
+// showRotationPolicyDialog sets the rotation policy of the selected folder, or the vault's if none is selected
+func (view *vaultView) showRotationPolicyDialog() {
+	view.touch()
+
+	folderID := view.selectedFolderID()
+	var current int
+	var options []string
+	values := make(map[string]int)
+	title := "Vault Rotation Policy"
+	message := "Passwords of entries outside folders with their own policy must be changed every:"
+	if folderID == 0 {
+		days, err := database.GetVaultRotation(view.db)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		current = days
+		options = []string{"Never"}
+		values["Never"] = 0
+	} else {
+		inherited, err := database.FolderRotation(view.db, view.folders[folderID].ParentID)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		current = view.folders[folderID].RotationDays
+		title = "Folder Rotation Policy"
+		message = fmt.Sprintf("Passwords of entries in \"%s\" and its subfolders must be changed every:", view.folders[folderID].Name)
+		inherit := "Same as parent (" + rotationText(inherited) + ")"
+		options = []string{inherit, "Never"}
+		values[inherit] = database.RotationInherit
+		values["Never"] = database.RotationNever
+	}
+
+	periods := rotationPeriods
+	if current > 0 && !slices.Contains(periods, current) {
+		periods = append([]int{current}, periods...)
+	}
+	for _, days := range periods {
+		option := rotationText(days)
+		options = append(options, option)
+		values[option] = days
+	}
+
+	periodSelect := widget.NewSelect(options, nil)
+	for option, days := range values {
+		if days == current {
+			periodSelect.SetSelected(option)
+		}
+	}
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+
+	policyDialog := dialog.NewCustomConfirm(title, "Save", "Cancel", container.NewVBox(label, periodSelect), func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		days := values[periodSelect.Selected]
+		var err error
+		if folderID == 0 {
+			err = database.SetVaultRotation(view.db, days)
+		} else {
+			err = database.SetFolderRotation(view.db, folderID, days)
+		}
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.loadSidebar()
+	}, view.win)
+	policyDialog.Resize(fyne.NewSize(450, 200))
+	policyDialog.Show()
+}
+
+// rotationText describes a rotation period
+func rotationText(days int) string {
+	if days <= 0 {
+		return "never"
+	}
+	return strconv.Itoa(days) + " days"
+}
+
+// =-- Reminders --= //
+
+// showDueReminders lists entries that must be rotated or expire soon, showing nothing if there are none
+// unless always is set
+func (view *vaultView) showDueReminders(always bool) {
+	due, err := database.GetDueEntries(view.db, view.encryptionKey, time.Now(), reminderDays)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+	if len(due) == 0 {
+		if always {
+			dialog.ShowInformation("Reminders", fmt.Sprintf("Nothing needs rotating or expires in the next %d days.", reminderDays), view.win)
+		}
+		return
+	}
+
+	overdue := 0
+	for _, entry := range due {
+		if entry.Overdue {
+			overdue++
+		}
+	}
+	status := widget.NewLabel(fmt.Sprintf("%d entries are overdue, %d more are due in the next %d days.", overdue, len(due)-overdue, reminderDays))
+	if overdue > 0 {
+		status.Importance = widget.DangerImportance
+	}
+	status.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int {
+			return len(due)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(dueText(due[i]))
+		})
+
+	// Selecting a rotation marks it done by changing the password, an expiry opens the entry
+	hint := widget.NewLabel("Select an entry to rotate its password or change its expiry.")
+	var reminderDialog dialog.Dialog
+	list.OnSelected = func(i widget.ListItemID) {
+		list.UnselectAll()
+		entry, err := database.GetEntryFromID(view.db, due[i].EntryID)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		if due[i].Reason != database.DueRotation {
+			reminderDialog.Hide()
+			view.showEntryDialog(entry)
+			return
+		}
+		view.showRotatedDialog(entry, func() {
+			reminderDialog.Hide()
+			view.refreshEntries()
+			view.showDueReminders(true)
+		})
+	}
+
+	reminderDialog = dialog.NewCustom("Reminders", "Close", container.NewBorder(status, hint, nil, nil, list), view.win)
+	reminderDialog.Resize(fyne.NewSize(650, 400))
+	reminderDialog.Show()
+}
+
+// showRotatedDialog records a rotation by storing the entry's new password
+func (view *vaultView) showRotatedDialog(entry *database.PasswordInformation, onRotated func()) {
+	schema, err := database.GetEntrySchema(entry.EntryType)
+	if err != nil {
+		schema, _ = database.GetEntrySchema(database.EntryLogin)
+	}
+	view.showChangePasswordDialog(entry, schema.SecretLabel, func(*database.PasswordInformation) {
+		onRotated()
+	})
+}
+
+// dueText describes why an entry is due on one line
+func dueText(entry *database.DueEntry) string {
+	name := entry.Service
+	if entry.Username != "" {
+		name += " (" + entry.Username + ")"
+	}
+
+	date := entry.DueDate.Format(database.DateFormat)
+	switch {
+	case entry.Reason == database.DueRotation && entry.Overdue:
+		return fmt.Sprintf("%s: password rotation overdue since %s (every %d days)", name, date, entry.RotationDays)
+	case entry.Reason == database.DueRotation:
+		return fmt.Sprintf("%s: password must be rotated by %s (every %d days)", name, date, entry.RotationDays)
+	case entry.Overdue:
+		return fmt.Sprintf("%s: expired on %s", name, date)
+	default:
+		return fmt.Sprintf("%s: expires on %s", name, date)
+	}
+}
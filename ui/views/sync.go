@@ -0,0 +1,273 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/remote"
+)
+
+// showSyncMenu shows the sync actions below the sync button
+func (view *vaultView) showSyncMenu(anchor fyne.CanvasObject) {
+	view.touch()
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Sync with Vault File...", view.showSyncDialog),
+		fyne.NewMenuItem("Sync with Folder...", view.showFolderSyncDialog),
+		fyne.NewMenuItem("Sync with WebDAV...", view.showWebDAVSyncDialog),
+		fyne.NewMenuItem("Resolve Conflicts...", view.showConflictsDialog),
+	)
+
+	position := fyne.CurrentApp().Driver().AbsolutePositionForObject(anchor)
+	widget.ShowPopUpMenuAtPosition(menu, view.win.Canvas(), position.AddXY(0, anchor.Size().Height))
+}
+
+// showSyncDialog asks for another copy of the vault (e.g., in a shared folder) and merges it with this one
+func (view *vaultView) showSyncDialog() {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		// Only the path is needed, the vault is opened by the database package
+		path := reader.URI().Path()
+		_ = reader.Close()
+
+		view.syncWith(path)
+	}, view.win)
+	fileDialog.Resize(fyne.NewSize(700, 500))
+	fileDialog.Show()
+}
+
+// showFolderSyncDialog asks for a shared folder (e.g., kept in sync by Syncthing) to sync through
+func (view *vaultView) showFolderSyncDialog() {
+	view.touch()
+
+	folderDialog := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil || dir == nil {
+			return
+		}
+
+		backend := remote.NewDirectory(dir.Path(), view.vaultName)
+		view.runSync(backend.Name(), func() (*database.SyncSummary, error) {
+			return remote.Sync(view.db, view.encryptionKey, backend)
+		})
+	}, view.win)
+	folderDialog.Resize(fyne.NewSize(700, 500))
+	folderDialog.Show()
+}
+
+// showWebDAVSyncDialog asks for the WebDAV location and credentials to sync through
+func (view *vaultView) showWebDAVSyncDialog() {
+	view.touch()
+
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://cloud.example.com/remote.php/dav/files/me/" + view.vaultName + remote.BlobExtension)
+	usernameEntry := widget.NewEntry()
+	passwordEntry := widget.NewPasswordEntry()
+	message := widget.NewLabel("Only encrypted vault data is uploaded.")
+	message.Wrapping = fyne.TextWrapWord
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("File URL", urlEntry),
+		widget.NewFormItem("Username", usernameEntry),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("", message),
+	}
+	form := dialog.NewForm("Sync with WebDAV", "Sync", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		backend, err := remote.NewWebDAV(strings.TrimSpace(urlEntry.Text), usernameEntry.Text, passwordEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.runSync(backend.Name(), func() (*database.SyncSummary, error) {
+			return remote.Sync(view.db, view.encryptionKey, backend)
+		})
+	}, view.win)
+	form.Resize(fyne.NewSize(600, 280))
+	form.Show()
+}
+
+// syncWith merges the vault with the copy at path and reports the result
+func (view *vaultView) syncWith(path string) {
+	view.runSync(path, func() (*database.SyncSummary, error) {
+		return database.SyncVaults(view.db, view.encryptionKey, path)
+	})
+}
+
+// runSync runs a sync with the copy named peer and reports the result
+func (view *vaultView) runSync(peer string, sync func() (*database.SyncSummary, error)) {
+	summary, err := sync()
+	if err != nil {
+		log.Printf("Error syncing vault %s with %s: %v", view.vaultName, peer, err)
+		dialog.ShowError(err, view.win)
+		return
+	}
+
+	view.loadSidebar()
+	view.refreshEntries()
+
+	message := fmt.Sprintf("%d changes received, %d changes sent, %d entries merged.",
+		summary.Pulled, summary.Pushed, summary.Merged)
+	if summary.Conflicts == 0 {
+		dialog.ShowInformation("Sync", message, view.win)
+		return
+	}
+	message += fmt.Sprintf("\n%d entries were changed differently in both copies and need to be resolved.", summary.Conflicts)
+	dialog.ShowConfirm("Sync", message+"\nResolve them now?", func(resolve bool) {
+		if resolve {
+			view.showConflictsDialog()
+		}
+	}, view.win)
+}
+
+// showConflictsDialog lists the entries waiting for a sync conflict to be resolved
+func (view *vaultView) showConflictsDialog() {
+	view.touch()
+
+	conflicts, err := database.ListSyncConflicts(view.db, view.encryptionKey)
+	if err != nil {
+		dialog.ShowError(err, view.win)
+		return
+	}
+	if len(conflicts) == 0 {
+		dialog.ShowInformation("Sync Conflicts", "There are no sync conflicts to resolve.", view.win)
+		return
+	}
+
+	var listDialog dialog.Dialog
+	list := widget.NewList(
+		func() int {
+			return len(conflicts)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(conflictTitle(conflicts[i]))
+		})
+	list.OnSelected = func(i widget.ListItemID) {
+		listDialog.Hide()
+		view.showConflictDialog(conflicts[i])
+	}
+
+	listDialog = dialog.NewCustom("Sync Conflicts", "Close", list, view.win)
+	listDialog.Resize(fyne.NewSize(550, 400))
+	listDialog.Show()
+}
+
+// showConflictDialog compares both versions of an entry and lets the user keep one
+func (view *vaultView) showConflictDialog(conflict *database.SyncConflict) {
+	grid := container.NewGridWithColumns(3,
+		widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("This copy", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Other copy", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	for _, row := range conflictRows(conflict.Local, conflict.Remote, view.folderNames()) {
+		grid.Add(widget.NewLabel(row[0]))
+		for _, value := range row[1:] {
+			label := widget.NewLabel(value)
+			label.Wrapping = fyne.TextWrapWord
+			grid.Add(label)
+		}
+	}
+
+	info := widget.NewLabel("Found while syncing with " + conflict.Peer + ". The version you keep is sent to the other copy with the next sync.")
+	info.Wrapping = fyne.TextWrapWord
+
+	var conflictDialog *dialog.CustomDialog
+	resolve := func(keepRemote bool) {
+		conflictDialog.Hide()
+		err := database.ResolveSyncConflict(view.db, view.encryptionKey, conflict.ID, keepRemote)
+		if err != nil && !errors.Is(err, database.ErrConflictNotFound) {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.loadSidebar()
+		view.refreshEntries()
+		view.showConflictsDialog()
+	}
+	keepLocal := widget.NewButton("Keep This Copy", func() { resolve(false) })
+	keepRemote := widget.NewButton("Keep Other Copy", func() { resolve(true) })
+	keepLocal.Importance = widget.HighImportance
+
+	content := container.NewBorder(info, container.NewHBox(keepLocal, keepRemote), nil, nil, container.NewVScroll(grid))
+	conflictDialog = dialog.NewCustom("Resolve "+conflictTitle(conflict), "Later", content, view.win)
+	conflictDialog.Resize(fyne.NewSize(700, 500))
+	conflictDialog.Show()
+}
+
+// folderNames returns the path of every folder by UUID
+func (view *vaultView) folderNames() map[string]string {
+	paths, _ := view.folderPaths()
+	names := make(map[string]string)
+	for path, id := range paths {
+		if folder, ok := view.folders[id]; ok {
+			names[folder.UUID] = path
+		}
+	}
+	return names
+}
+
+// conflictTitle names the entry of a conflict
+func conflictTitle(conflict *database.SyncConflict) string {
+	for _, entry := range []*database.SyncEntry{conflict.Local, conflict.Remote} {
+		if entry != nil {
+			return entry.Service + " - " + entry.Username
+		}
+	}
+	return conflict.UUID
+}
+
+// conflictRows lists each part of an entry for both versions, secrets are only marked as same or changed
+func conflictRows(local *database.SyncEntry, remote *database.SyncEntry, folders map[string]string) [][]string {
+	describe := func(entry *database.SyncEntry, other *database.SyncEntry) []string {
+		if entry == nil {
+			return []string{"(deleted)", "", "", "", "", "", "", ""}
+		}
+		secret := func(value string, otherValue func(*database.SyncEntry) string) string {
+			if other != nil && otherValue(other) != value {
+				return "•••••••• (differs)"
+			}
+			return "••••••••"
+		}
+		var fields []string
+		for _, field := range entry.Fields {
+			fields = append(fields, field.Name)
+		}
+		folder, ok := folders[entry.Folder]
+		switch {
+		case entry.Folder == "":
+			folder = "(none)"
+		case !ok:
+			folder = "(not in this copy)"
+		}
+		return []string{
+			entry.Service,
+			entry.Username,
+			secret(entry.Password, func(e *database.SyncEntry) string { return e.Password }),
+			secret(entry.Notes, func(e *database.SyncEntry) string { return e.Notes }),
+			folder,
+			strings.Join(entry.Tags, ", "),
+			strings.Join(fields, ", "),
+			entry.ExpiresAt,
+		}
+	}
+
+	labels := []string{"Service", "Username", "Password", "Notes", "Folder", "Tags", "Custom fields", "Expires"}
+	localValues, remoteValues := describe(local, remote), describe(remote, local)
+	rows := make([][]string, len(labels))
+	for i, label := range labels {
+		rows[i] = []string{label, localValues[i], remoteValues[i]}
+	}
+	return rows
+}
@@ -0,0 +1,690 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+	"github.com/cpainter1/PassLock/internal/search"
+)
+
+// Sidebar tree node IDs (folders and tags are prefixed with their kind)
+const (
+	nodeAll       = "all"
+	nodeUnfiled   = "unfiled"
+	nodeTags      = "tags"
+	folderPrefix  = "folder:"
+	tagNodePrefix = "tag:"
+)
+
+// vaultView holds the state of an unlocked vault window
+type vaultView struct {
+	win           fyne.Window
+	session       *database.VaultSession
+	db            *sql.DB
+	vaultName     string
+	encryptionKey string
+
+	selectedNode string                          // Currently selected sidebar node
+	folders      map[int]*database.Folder        // All folders by ID
+	children     map[int][]int                   // Subfolder IDs by parent ID (0 for top-level)
+	tags         []string                        // All tags in the vault
+	entries      []*database.PasswordInformation // Entries currently listed
+
+	tree        *widget.Tree
+	entryList   *widget.List
+	searchEntry *widget.Entry
+
+	idleTimer   *time.Timer   // Locks the vault after the configured idle time
+	stopBackups chan struct{} // Stops scheduled backups
+	locked      bool
+}
+
+// ShowVaultUI displays the main view of an unlocked vault
+func ShowVaultUI(win fyne.Window, vaultName string, encryptionKey string) {
+	session, err := database.OpenVaultSession(vaultName)
+	if err != nil {
+		log.Printf("Error opening vault %s: %v", vaultName, err)
+		ShowLoginUI(win)
+		dialog.ShowError(err, win)
+		return
+	}
+
+	view := &vaultView{
+		win:           win,
+		session:       session,
+		db:            session.DB,
+		vaultName:     vaultName,
+		encryptionKey: encryptionKey,
+		selectedNode:  nodeAll,
+	}
+
+	// Failures are logged by the database package and do not keep the vault locked
+	if !session.ReadOnly {
+		_ = database.RecordUnlock(view.db, encryptionKey)
+	}
+
+	win.SetTitle("PassLock - " + vaultName)
+	win.SetFixedSize(false)
+	win.Resize(fyne.NewSize(900, 600))
+
+	view.loadSidebar()
+	win.SetContent(view.build())
+	view.refreshEntries()
+	view.touch()
+	view.showDueReminders(false)
+	// The session holding the write lock takes the scheduled backups
+	if !session.ReadOnly {
+		view.startBackupSchedule()
+	}
+}
+
+// build creates the vault window layout
+func (view *vaultView) build() fyne.CanvasObject {
+	// Sidebar tree of folders and tags
+	view.tree = widget.NewTree(
+		view.treeChildren,
+		view.treeIsBranch,
+		func(branch bool) fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(uid widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(view.treeLabel(uid))
+		})
+	view.tree.OnSelected = func(uid widget.TreeNodeID) {
+		view.touch()
+		view.selectedNode = uid
+		view.refreshEntries()
+	}
+	view.tree.OpenBranch(nodeTags)
+
+	folderToolbar := container.NewGridWithColumns(5,
+		widget.NewButtonWithIcon("", theme.FolderNewIcon(), view.showNewFolderDialog),
+		widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), view.showRenameFolderDialog),
+		widget.NewButtonWithIcon("", theme.MailForwardIcon(), view.showMoveFolderDialog),
+		widget.NewButtonWithIcon("", theme.MediaReplayIcon(), view.showRotationPolicyDialog),
+		widget.NewButtonWithIcon("", theme.DeleteIcon(), view.confirmDeleteFolder),
+	)
+	sidebar := container.NewBorder(nil, folderToolbar, nil, nil, view.tree)
+
+	// Search box and entry list
+	view.searchEntry = widget.NewEntry()
+	view.searchEntry.SetPlaceHolder("Search service, username, tags or notes")
+	view.searchEntry.OnChanged = func(string) {
+		view.touch()
+		view.refreshEntries()
+	}
+
+	view.entryList = widget.NewList(
+		func() int {
+			return len(view.entries)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			entry := view.entries[i]
+			o.(*widget.Label).SetText(entry.Service + " - " + entry.Username)
+		})
+	view.entryList.OnSelected = func(i widget.ListItemID) {
+		view.touch()
+		view.entryList.UnselectAll()
+		view.showEntryDialog(view.entries[i])
+	}
+
+	addButton := widget.NewButtonWithIcon("Add Entry", theme.ContentAddIcon(), view.showNewEntryDialog)
+	addButton.Importance = widget.HighImportance
+
+	var importButton *widget.Button
+	importButton = widget.NewButtonWithIcon("Import", theme.DownloadIcon(), func() {
+		view.showImportMenu(importButton)
+	})
+
+	var exportButton *widget.Button
+	exportButton = widget.NewButtonWithIcon("Export", theme.UploadIcon(), func() {
+		view.showExportMenu(exportButton)
+	})
+
+	var syncButton *widget.Button
+	syncButton = widget.NewButtonWithIcon("Sync", theme.ViewRefreshIcon(), func() {
+		view.showSyncMenu(syncButton)
+	})
+	if view.session.ReadOnly {
+		syncButton.Disable()
+	}
+
+	backupsButton := widget.NewButtonWithIcon("Backups", theme.HistoryIcon(), view.showBackupsDialog)
+
+	auditButton := widget.NewButtonWithIcon("Audit Log", theme.ListIcon(), view.showAuditLogDialog)
+
+	healthButton := widget.NewButtonWithIcon("Health", theme.WarningIcon(), func() {
+		view.showHealthDialog(nil)
+	})
+
+	lockButton := widget.NewButtonWithIcon("Lock", theme.LogoutIcon(), view.lock)
+	lockButton.Importance = widget.DangerImportance
+
+	topBar := container.NewBorder(nil, nil, nil, container.NewHBox(addButton, importButton, exportButton, syncButton, backupsButton, auditButton, healthButton, lockButton), view.searchEntry)
+
+	// Writes fail while another process holds the vault's write lock
+	var banner fyne.CanvasObject
+	if view.session.ReadOnly {
+		label := widget.NewLabel("Read-only: this vault is open in another window or program, changes cannot be saved.")
+		label.Importance = widget.WarningImportance
+		label.Wrapping = fyne.TextWrapWord
+		banner = label
+	}
+	mainContent := container.NewBorder(topBar, banner, nil, nil, view.entryList)
+
+	split := container.NewHSplit(sidebar, mainContent)
+	split.Offset = 0.28
+
+	return split
+}
+
+// lock closes the vault and returns to vault selection (also called by the auto-lock timer)
+func (view *vaultView) lock() {
+	if view.locked {
+		return
+	}
+	view.locked = true
+	if view.idleTimer != nil {
+		view.idleTimer.Stop()
+	}
+	view.stopBackupSchedule()
+
+	err := view.session.Close()
+	if err != nil {
+		log.Printf("Error closing vault: %v", err)
+	}
+	view.encryptionKey = ""
+
+	ShowLoginUI(view.win)
+}
+
+// =-- Sidebar --= //
+
+// loadSidebar reloads folders and tags from the vault
+func (view *vaultView) loadSidebar() {
+	folders, err := database.ListFolders(view.db)
+	if err != nil {
+		log.Printf("Error loading folders: %v", err)
+	}
+
+	view.folders = make(map[int]*database.Folder)
+	view.children = make(map[int][]int)
+	for _, folder := range folders {
+		view.folders[folder.ID] = folder
+		view.children[folder.ParentID] = append(view.children[folder.ParentID], folder.ID)
+	}
+
+	view.tags, err = database.ListTags(view.db)
+	if err != nil {
+		log.Printf("Error loading tags: %v", err)
+	}
+
+	if view.tree != nil {
+		view.tree.Refresh()
+	}
+}
+
+// treeChildren returns the child node IDs of a sidebar node
+func (view *vaultView) treeChildren(uid widget.TreeNodeID) []widget.TreeNodeID {
+	var ids []widget.TreeNodeID
+
+	switch {
+	case uid == "":
+		ids = append(ids, nodeAll, nodeUnfiled)
+		ids = append(ids, view.folderNodes(0)...)
+		ids = append(ids, nodeTags)
+	case uid == nodeTags:
+		for _, tag := range view.tags {
+			ids = append(ids, tagNodePrefix+tag)
+		}
+	case strings.HasPrefix(uid, folderPrefix):
+		ids = view.folderNodes(folderNodeID(uid))
+	}
+
+	return ids
+}
+
+// folderNodes returns the node IDs of the subfolders of parentID
+func (view *vaultView) folderNodes(parentID int) []widget.TreeNodeID {
+	var ids []widget.TreeNodeID
+	for _, id := range view.children[parentID] {
+		ids = append(ids, folderPrefix+strconv.Itoa(id))
+	}
+	return ids
+}
+
+// treeIsBranch returns whether a sidebar node can have children
+func (view *vaultView) treeIsBranch(uid widget.TreeNodeID) bool {
+	if uid == "" || uid == nodeTags {
+		return true
+	}
+	if strings.HasPrefix(uid, folderPrefix) {
+		return len(view.children[folderNodeID(uid)]) > 0
+	}
+	return false
+}
+
+// treeLabel returns the display text for a sidebar node
+func (view *vaultView) treeLabel(uid widget.TreeNodeID) string {
+	switch {
+	case uid == nodeAll:
+		return "All Entries"
+	case uid == nodeUnfiled:
+		return "Unfiled"
+	case uid == nodeTags:
+		return "Tags"
+	case strings.HasPrefix(uid, tagNodePrefix):
+		return "#" + strings.TrimPrefix(uid, tagNodePrefix)
+	case strings.HasPrefix(uid, folderPrefix):
+		if folder, ok := view.folders[folderNodeID(uid)]; ok {
+			return folder.Name
+		}
+	}
+	return uid
+}
+
+// folderNodeID extracts the folder ID from a folder node ID
+func folderNodeID(uid widget.TreeNodeID) int {
+	id, _ := strconv.Atoi(strings.TrimPrefix(uid, folderPrefix))
+	return id
+}
+
+// selectedFolderID returns the selected folder ID, or 0 if no folder is selected
+func (view *vaultView) selectedFolderID() int {
+	if strings.HasPrefix(view.selectedNode, folderPrefix) {
+		return folderNodeID(view.selectedNode)
+	}
+	return 0
+}
+
+// folderPaths returns the full path of every folder keyed by display string, sorted for selection
+func (view *vaultView) folderPaths() (map[string]int, []string) {
+	paths := map[string]int{"(none)": 0}
+	options := []string{"(none)"}
+
+	var names []string
+	for id := range view.folders {
+		path, err := database.GetFolderPath(view.db, id)
+		if err != nil {
+			continue
+		}
+		name := strings.Join(path, " / ")
+		paths[name] = id
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return paths, append(options, names...)
+}
+
+// =-- Folder Dialogs --= //
+
+// showNewFolderDialog prompts for a new folder inside the selected folder
+func (view *vaultView) showNewFolderDialog() {
+	parentID := view.selectedFolderID()
+
+	nameEntry := widget.NewEntry()
+	dialog.ShowForm("New Folder", "Create", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Name", nameEntry)},
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			folder, err := database.CreateFolder(view.db, nameEntry.Text, parentID)
+			if err != nil {
+				dialog.ShowError(err, view.win)
+				return
+			}
+			view.loadSidebar()
+			if parentID != 0 {
+				view.tree.OpenBranch(folderPrefix + strconv.Itoa(parentID))
+			}
+			view.tree.Select(folderPrefix + strconv.Itoa(folder.ID))
+		}, view.win)
+}
+
+// showRenameFolderDialog prompts for a new name for the selected folder
+func (view *vaultView) showRenameFolderDialog() {
+	folderID := view.selectedFolderID()
+	if folderID == 0 {
+		dialog.ShowInformation("Rename Folder", "Select a folder to rename.", view.win)
+		return
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(view.folders[folderID].Name)
+	dialog.ShowForm("Rename Folder", "Rename", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Name", nameEntry)},
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := database.RenameFolder(view.db, folderID, nameEntry.Text); err != nil {
+				dialog.ShowError(err, view.win)
+				return
+			}
+			view.loadSidebar()
+		}, view.win)
+}
+
+// showMoveFolderDialog prompts for a new parent of the selected folder
+func (view *vaultView) showMoveFolderDialog() {
+	folderID := view.selectedFolderID()
+	if folderID == 0 {
+		dialog.ShowInformation("Move Folder", "Select a folder to move.", view.win)
+		return
+	}
+
+	paths, options := view.folderPaths()
+	parentSelect := widget.NewSelect(options, nil)
+	parentSelect.SetSelected(options[0])
+
+	dialog.ShowForm("Move Folder", "Move", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Into", parentSelect)},
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := database.MoveFolder(view.db, folderID, paths[parentSelect.Selected]); err != nil {
+				dialog.ShowError(err, view.win)
+				return
+			}
+			view.loadSidebar()
+		}, view.win)
+}
+
+// confirmDeleteFolder deletes the selected folder after confirmation
+func (view *vaultView) confirmDeleteFolder() {
+	folderID := view.selectedFolderID()
+	if folderID == 0 {
+		dialog.ShowInformation("Delete Folder", "Select a folder to delete.", view.win)
+		return
+	}
+
+	message := fmt.Sprintf("Delete folder \"%s\" and its subfolders?\nEntries inside will be kept as unfiled.",
+		view.folders[folderID].Name)
+	dialog.ShowConfirm("Delete Folder", message, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if err := database.DeleteFolder(view.db, folderID); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.loadSidebar()
+		view.tree.Select(nodeAll)
+	}, view.win)
+}
+
+// =-- Entries --= //
+
+// refreshEntries reloads the entry list for the selected sidebar node and search query
+func (view *vaultView) refreshEntries() {
+	var entries []*database.PasswordInformation
+	var err error
+
+	switch {
+	case view.selectedNode == nodeUnfiled:
+		entries, err = database.GetEntriesInFolder(view.db, 0, false)
+	case strings.HasPrefix(view.selectedNode, folderPrefix):
+		entries, err = database.GetEntriesInFolder(view.db, folderNodeID(view.selectedNode), true)
+	case strings.HasPrefix(view.selectedNode, tagNodePrefix):
+		entries, err = database.GetEntriesWithTag(view.db, strings.TrimPrefix(view.selectedNode, tagNodePrefix))
+	default:
+		entries, err = database.GetAllEntries(view.db)
+	}
+	if err != nil {
+		log.Printf("Error loading entries: %v", err)
+	}
+
+	// Narrow the listed entries down with the search query
+	if view.searchEntry != nil && strings.TrimSpace(view.searchEntry.Text) != "" {
+		entries = view.searchEntries(entries, view.searchEntry.Text)
+	}
+
+	view.entries = entries
+	if view.entryList != nil {
+		view.entryList.Refresh()
+	}
+}
+
+// searchEntries filters and orders entries by search relevance
+func (view *vaultView) searchEntries(entries []*database.PasswordInformation, query string) []*database.PasswordInformation {
+	index, err := search.LoadIndex(view.db, view.encryptionKey)
+	if err != nil {
+		log.Printf("Error building search index: %v", err)
+		return entries
+	}
+
+	byID := make(map[int]*database.PasswordInformation, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+	}
+
+	var results []*database.PasswordInformation
+	for _, result := range index.Search(query, 0) {
+		if entry, ok := byID[result.ID]; ok {
+			results = append(results, entry)
+		}
+	}
+
+	return results
+}
+
+// showEntryDialog displays an entry with reveal/copy buttons and editable folder and tags
+func (view *vaultView) showEntryDialog(entry *database.PasswordInformation) {
+	// Password is only decrypted when revealed or copied
+	passwordLabel := widget.NewLabel("********")
+	revealButton := widget.NewButtonWithIcon("Reveal", theme.VisibilityIcon(), func() {
+		password, err := encryption.Decrypt(entry.EncryptedPassword, view.encryptionKey)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		passwordLabel.SetText(password)
+		view.audit(database.AuditReveal, entry, "secret")
+	})
+	copyButton := widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+		password, err := encryption.Decrypt(entry.EncryptedPassword, view.encryptionKey)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.copyToClipboard(password)
+		view.audit(database.AuditCopy, entry, "secret")
+	})
+
+	notesLabel := widget.NewLabel("")
+	notesLabel.Wrapping = fyne.TextWrapWord
+	if entry.EncryptedNotes != "" {
+		notesLabel.SetText("(hidden)")
+	}
+	revealNotesButton := widget.NewButtonWithIcon("Reveal", theme.VisibilityIcon(), func() {
+		if entry.EncryptedNotes == "" {
+			return
+		}
+		notes, err := encryption.Decrypt(entry.EncryptedNotes, view.encryptionKey)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		notesLabel.SetText(notes)
+		view.audit(database.AuditReveal, entry, "notes")
+	})
+
+	paths, options := view.folderPaths()
+	folderSelect := widget.NewSelect(options, nil)
+	folderSelect.SetSelected(options[0])
+	for name, id := range paths {
+		if id != 0 && id == entry.FolderID {
+			folderSelect.SetSelected(name)
+		}
+	}
+
+	tags, err := database.GetTagsForEntry(view.db, entry.ID)
+	if err != nil {
+		log.Printf("Error loading tags for entry %d: %v", entry.ID, err)
+	}
+	tagsEntry := widget.NewEntry()
+	tagsEntry.SetText(strings.Join(tags, ", "))
+	expiresEntry := widget.NewEntry()
+	expiresEntry.SetPlaceHolder("YYYY-MM-DD (never if empty)")
+	expiresEntry.SetText(entry.ExpiresAt)
+
+	// Labels for the built-in columns depend on the entry type
+	schema, err := database.GetEntrySchema(entry.EntryType)
+	if err != nil {
+		log.Printf("Error loading schema for entry %d: %v", entry.ID, err)
+		schema, _ = database.GetEntrySchema(database.EntryLogin)
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Type", widget.NewLabel(schema.Label)),
+		widget.NewFormItem(schema.TitleLabel, widget.NewLabel(entry.Service)),
+	}
+	if schema.UsernameLabel != "" {
+		items = append(items, widget.NewFormItem(schema.UsernameLabel, widget.NewLabel(entry.Username)))
+	}
+	if schema.SecretLabel != "" {
+		passwordLabel.Wrapping = fyne.TextWrapWord
+		items = append(items, widget.NewFormItem(schema.SecretLabel, container.NewBorder(nil, nil, nil,
+			container.NewHBox(revealButton, copyButton), passwordLabel)))
+	}
+	items = append(items,
+		widget.NewFormItem("Notes", container.NewBorder(nil, nil, nil, revealNotesButton, notesLabel)),
+		widget.NewFormItem("Folder", folderSelect),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Expires", expiresEntry),
+		widget.NewFormItem("Created", widget.NewLabel(entry.CreatedAt)),
+	)
+
+	// Custom fields and attachments follow the built-in ones, adding either reopens the dialog
+	var form *dialog.FormDialog
+	items = append(items, view.customFieldItems(entry)...)
+	items = append(items, view.attachmentItems(entry)...)
+	reopen := func() {
+		form.Hide()
+		view.showEntryDialog(entry)
+	}
+	actions := container.NewHBox(
+		widget.NewButtonWithIcon("Add Field", theme.ContentAddIcon(), func() {
+			view.showAddFieldDialog(entry, reopen)
+		}),
+		widget.NewButtonWithIcon("Attach File", theme.FileIcon(), func() {
+			view.showAddAttachmentDialog(entry, reopen)
+		}),
+		widget.NewButtonWithIcon("Delete Entry", theme.DeleteIcon(), func() {
+			view.confirmDeleteEntry(entry, form)
+		}),
+	)
+	if schema.SecretLabel != "" {
+		actions.Add(widget.NewButtonWithIcon("Change "+schema.SecretLabel, theme.DocumentCreateIcon(), func() {
+			view.showChangePasswordDialog(entry, schema.SecretLabel, func(updated *database.PasswordInformation) {
+				form.Hide()
+				view.refreshEntries()
+				view.showEntryDialog(updated)
+			})
+		}))
+	}
+	items = append(items, widget.NewFormItem("", actions))
+
+	form = dialog.NewForm(entry.Service, "Save", "Close", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if err := database.MoveEntryToFolder(view.db, entry.ID, paths[folderSelect.Selected]); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		if err := database.SetEntryTags(view.db, entry.ID, splitTags(tagsEntry.Text)); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		if err := database.SetEntryExpiry(view.db, entry.ID, expiresEntry.Text); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.audit(database.AuditEdit, entry, "folder, tags and expiry")
+		view.loadSidebar()
+		view.refreshEntries()
+	}, view.win)
+	form.Resize(fyne.NewSize(500, 450))
+	form.Show()
+}
+
+// confirmDeleteEntry deletes an entry after confirmation and closes its dialog
+func (view *vaultView) confirmDeleteEntry(entry *database.PasswordInformation, form *dialog.FormDialog) {
+	dialog.ShowConfirm("Delete Entry", fmt.Sprintf("Delete \"%s\"? This cannot be undone.", entry.Service), func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if err := database.DeleteEntryFromID(view.db, entry.ID); err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+		view.audit(database.AuditDelete, entry, "")
+
+		form.Hide()
+		view.loadSidebar()
+		view.refreshEntries()
+	}, view.win)
+}
+
+// showChangePasswordDialog prompts for a new password for an entry, stamping it as changed now
+func (view *vaultView) showChangePasswordDialog(entry *database.PasswordInformation, label string,
+	onChanged func(*database.PasswordInformation)) {
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("New "+strings.ToLower(label), passwordEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+	}
+
+	form := dialog.NewForm("Change "+label, "Change", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("the new %s entries do not match", strings.ToLower(label)), view.win)
+			return
+		}
+
+		// The change is audited together with the update
+		updated, err := database.UpdateEntryPassword(view.db, view.encryptionKey, entry.ID, passwordEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, view.win)
+			return
+		}
+
+		onChanged(updated)
+	}, view.win)
+	form.Resize(fyne.NewSize(400, 200))
+	form.Show()
+}
+
+// splitTags splits a comma separated list of tags
+func splitTags(text string) []string {
+	var tags []string
+	for _, tag := range strings.Split(text, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"errors"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/cpainter1/PassLock/internal/config"
+	"github.com/cpainter1/PassLock/internal/database"
+	"github.com/cpainter1/PassLock/internal/encryption"
+)
+
+// showVaultActionsMenu shows the rename, duplicate, export and archive actions of a vault below its menu button
+func showVaultActionsMenu(win fyne.Window, vaultName string, anchor fyne.CanvasObject) {
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Rename", func() {
+			showRenameVaultDialog(win, vaultName)
+		}),
+		fyne.NewMenuItem("Duplicate", func() {
+			showCloneVaultDialog(win, vaultName)
+		}),
+		fyne.NewMenuItem("Export", func() {
+			showExportVaultDialog(win, vaultName)
+		}),
+		fyne.NewMenuItem("Archive", func() {
+			if err := database.ArchiveVault(vaultName); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			ShowLoginUI(win)
+		}),
+	)
+
+	position := fyne.CurrentApp().Driver().AbsolutePositionForObject(anchor)
+	widget.ShowPopUpMenuAtPosition(menu, win.Canvas(), position.AddXY(0, anchor.Size().Height))
+}
+
+// showRenameVaultDialog asks for a new vault name and renames the vault
+func showRenameVaultDialog(win fyne.Window, vaultName string) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(vaultName)
+
+	dialog.ShowForm("Rename Vault", "Rename", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Name", nameEntry)},
+		func(confirmed bool) {
+			if !confirmed || nameEntry.Text == vaultName {
+				return
+			}
+			if err := database.RenameVault(vaultName, nameEntry.Text); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			ShowLoginUI(win)
+		}, win)
+}
+
+// showCloneVaultDialog asks for the copy's name and, optionally, a new master password for the copy
+func showCloneVaultDialog(win fyne.Window, vaultName string) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(vaultName + " copy")
+
+	currentPasswordEntry := widget.NewPasswordEntry()
+	newPasswordEntry := widget.NewPasswordEntry()
+	currentPasswordEntry.Disable()
+	newPasswordEntry.Disable()
+
+	rekeyCheck := widget.NewCheck("Use a new master password", func(checked bool) {
+		if checked {
+			currentPasswordEntry.Enable()
+			newPasswordEntry.Enable()
+		} else {
+			currentPasswordEntry.Disable()
+			newPasswordEntry.Disable()
+		}
+	})
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("", rekeyCheck),
+		widget.NewFormItem("Current password", currentPasswordEntry),
+		widget.NewFormItem("New password", newPasswordEntry),
+	}
+
+	dialog.ShowForm("Duplicate Vault", "Duplicate", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		var err error
+		if rekeyCheck.Checked {
+			err = cloneVaultWithPassword(vaultName, nameEntry.Text, currentPasswordEntry.Text, newPasswordEntry.Text)
+		} else {
+			err = database.CloneVault(vaultName, nameEntry.Text)
+		}
+		if err != nil {
+			log.Printf("Error duplicating vault %s: %v", vaultName, err)
+			dialog.ShowError(err, win)
+			return
+		}
+
+		ShowLoginUI(win)
+	}, win)
+}
+
+// cloneVaultWithPassword verifies the current master password and clones the vault under a new one
+func cloneVaultWithPassword(vaultName string, targetName string, currentPassword string, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("the new master password cannot be empty")
+	}
+
+	salt, err := database.GetSaltFromVault(vaultName)
+	if err != nil {
+		return err
+	}
+	kdfParams, err := database.GetKDFParamsFromVault(vaultName)
+	if err != nil {
+		return err
+	}
+	encryptionKey, authKey, err := encryption.DeriveMasterKeysWithParams(currentPassword, salt, kdfParams)
+	if err != nil {
+		return err
+	}
+
+	authenticated, err := database.AuthenticateVault(vaultName, authKey)
+	if err != nil {
+		return err
+	}
+	if !authenticated {
+		return errors.New("the current master password is incorrect")
+	}
+
+	// The copy uses the configured key derivation settings
+	newKeys, err := database.DeriveVaultKeys(newPassword, config.Current().KDF.Params())
+	if err != nil {
+		return err
+	}
+
+	return database.CloneVaultWithKeys(vaultName, targetName, encryptionKey, *newKeys)
+}
+
+// showArchivedVaultsDialog lists archived vaults so they can be restored
+func showArchivedVaultsDialog(win fyne.Window) {
+	archived, err := database.ListArchivedVaults()
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	if len(archived) == 0 {
+		dialog.ShowInformation("Archived Vaults", "There are no archived vaults.", win)
+		return
+	}
+
+	vaultSelect := widget.NewSelect(archived, nil)
+	vaultSelect.SetSelected(archived[0])
+
+	dialog.ShowForm("Archived Vaults", "Unarchive", "Close",
+		[]*widget.FormItem{widget.NewFormItem("Vault", vaultSelect)},
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := database.UnarchiveVault(vaultSelect.Selected); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			ShowLoginUI(win)
+		}, win)
+}